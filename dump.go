@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/config"
+	"github.com/cyrilschreiber3/media-processor/pkg/ffmpeg"
+	"github.com/cyrilschreiber3/media-processor/pkg/media"
+)
+
+// configDump is the effective configuration printed by -json-config-dump.
+type configDump struct {
+	Settings      map[string]any `json:"settings"`
+	FFmpegPath    string         `json:"ffmpeg_path"`
+	FFprobePath   string         `json:"ffprobe_path"`
+	HWAccel       string         `json:"hwaccel"`
+	HWAccelsFound []string       `json:"hwaccels_found"`
+}
+
+// dumpConfig prints the effective configuration and the detected FFmpeg setup as JSON.
+func dumpConfig(cfg config.Config) error {
+	dump := configDump{Settings: cfg.Settings()}
+
+	headers := make([]string, len(cfg.HTTPHeaders))
+	for i, header := range cfg.HTTPHeaders {
+		headers[i] = media.RedactHeaders(header)
+	}
+
+	dump.Settings["http-header"] = headers
+
+	dump.FFmpegPath, _ = exec.LookPath("ffmpeg")
+	dump.FFprobePath, _ = exec.LookPath("ffprobe")
+
+	if dump.FFmpegPath != "" {
+		if methods, err := ffmpeg.HardwareAccelerations(); err == nil {
+			dump.HWAccelsFound = methods
+		}
+	}
+
+	dump.HWAccel = config.HWAccelNone
+	if dump.FFmpegPath != "" {
+		backend, err := ffmpeg.HardwareBackend(cfg)
+		if err != nil {
+			return err
+		}
+
+		if backend != "" {
+			dump.HWAccel = backend
+		}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+
+	if err := encoder.Encode(dump); err != nil {
+		return fmt.Errorf("error encoding configuration: %w", err)
+	}
+
+	return nil
+}
@@ -1,104 +1,81 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"flag"
 	"log"
+	"log/slog"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"syscall"
 
-	"github.com/cyrilschreiber3/media-processor/pkg/audio"
-	"github.com/cyrilschreiber3/media-processor/pkg/ffmpeg"
-	"github.com/cyrilschreiber3/media-processor/pkg/media"
-	"github.com/cyrilschreiber3/media-processor/pkg/proxy"
+	"github.com/cyrilschreiber3/media-processor/pkg/config"
+	"github.com/cyrilschreiber3/media-processor/pkg/processor"
 )
 
-// processFile handles the processing of a single media file.
-func processFile(file os.DirEntry, filePath string) (bool, error) {
-	log.Printf("Processing file: %s\n", filePath)
+// setupLogging sends the log messages of the configured level and format to the standard error.
+// Messages of the standard log package go through the same handler.
+func setupLogging(cfg config.Config) {
+	options := &slog.HandlerOptions{Level: cfg.Level()}
 
-	// Generate proxy file
-	changed, err := proxy.GenerateProxy(filePath, file)
-	if err != nil {
-		return false, fmt.Errorf("error generating proxy: %w", err)
-	}
-
-	// Get media information for audio processing
-	mediaInfo, err := media.GetMediaInfo(filePath)
-	if err != nil {
-		return false, fmt.Errorf("error getting media info: %w", err)
+	var handler slog.Handler = slog.NewTextHandler(os.Stderr, options)
+	if cfg.LogFormat == config.LogFormatJSON {
+		handler = slog.NewJSONHandler(os.Stderr, options)
 	}
 
-	// Check if file has unsupported audio format
-	props := media.AnalyzeMediaInfo(mediaInfo)
-	if props.UnsupportedAudioFormat {
-		log.Printf("Unsupported audio format detected. Converting to PCM for file: %s\n", filePath)
-
-		err = audio.ProcessUnsupportedAudio(filePath)
-		if err != nil {
-			return false, fmt.Errorf("error processing unsupported audio source file: %w", err)
-		}
-	}
+	slog.SetDefault(slog.New(handler))
+}
 
-	return changed, nil
+// fatal logs an error and exits with a failure status.
+func fatal(err error) {
+	slog.Error(err.Error())
+	os.Exit(1)
 }
 
 func main() {
-	// Check command line arguments
-	if len(os.Args) < 2 {
-		log.Fatal("Usage: go run main.go <path>")
-	}
-
-	// Check if FFmpeg is installed
-	if !ffmpeg.IsFFmpegInstalled() {
-		log.Fatal("ffmpeg is not installed. Please install ffmpeg to use this program.")
+	// Resolve the configuration from flags, environment and config file
+	cfg, args, err := config.Resolve(os.Args[1:], os.Environ())
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
 	}
 
-	// Get the watch path from command line arguments
-	watchPath := os.Args[1]
-
-	// Read the files in the watch path
-	files, err := os.ReadDir(watchPath)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// Process each file
-	for _, file := range files {
-		// Skip directories
-		if file.IsDir() {
-			continue
-		}
-
-		filePath := filepath.Join(watchPath, file.Name())
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
+	}
 
-		// Skip non-media files
-		if !media.IsMediaFile(filePath) {
-			log.Printf("Skipping non-media file: %s\n", filePath)
+	setupLogging(cfg)
 
-			continue
+	if cfg.DumpConfig {
+		if err := dumpConfig(cfg); err != nil {
+			fatal(err)
 		}
 
-		// Skip files in the Proxy directory
-		parentDir := filepath.Dir(filePath)
-		if filepath.Base(parentDir) == "Proxy" {
-			log.Printf("Skipping proxy file: %s\n", filePath)
+		return
+	}
 
-			continue
-		}
+	// Check command line arguments
+	if len(args) < 1 {
+		slog.Error("Usage: go run main.go [flags] <directory|file|url>")
+		os.Exit(1)
+	}
 
-		// Process the file
-		changed, err := processFile(file, filePath)
-		if err != nil {
-			log.Printf("Error processing file %s: %v\n", filePath, err)
+	// Interrupting aborts the running jobs and removes their partial proxies.
+	// The signals are released once received, so interrupting again exits right away.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	context.AfterFunc(ctx, stop)
 
-			continue
-		}
+	summary, err := processor.Run(ctx, processor.Options{Config: cfg, Path: args[0]})
 
-		// Log the result
-		if changed {
-			log.Printf("File %s has been processed successfully\n", filePath)
-		} else {
-			log.Printf("File %s has not been changed\n", filePath)
-		}
+	stop()
+
+	if err != nil {
+		fatal(err)
 	}
+
+	os.Exit(summary.ExitCode())
 }
@@ -1,37 +1,82 @@
 package audio
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"log"
+	"io/fs"
+	"log/slog"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 
+	"github.com/cyrilschreiber3/media-processor/pkg/config"
 	"github.com/cyrilschreiber3/media-processor/pkg/ffmpeg"
+	"github.com/cyrilschreiber3/media-processor/pkg/fileutil"
 )
 
-// ProcessUnsupportedAudio moves the original file to the "Originals" directory
-// and creates a converted version with supported audio format.
-func ProcessUnsupportedAudio(filePath string) error {
-	log.Printf("Moving unsupported audio file to Originals: %s\n", filePath)
+// originalsMu serializes the creation of Originals directories shared by concurrent jobs.
+var originalsMu sync.Mutex
 
+// TargetCodecs lists the audio codecs an original can be converted to.
+var TargetCodecs = []string{"pcm_s16le", "pcm_s24le", "aac", "flac"}
+
+// ProcessUnsupportedAudio moves the original file to the cfg.OriginalsDir directory
+// and creates a converted version with supported audio format. It is safe for concurrent use.
+// Cancelling the context aborts the conversion and puts the original file back.
+func ProcessUnsupportedAudio(ctx context.Context, filePath string, cfg config.Config) error {
+	return convertAudio(ctx, filePath, "pcm_s16le", cfg)
+}
+
+// ConvertAudioInPlace converts the audio of a file to targetCodec, one of TargetCodecs, copying its video.
+// Like ProcessUnsupportedAudio, the original is kept in the default Originals directory next to the file.
+// It is safe for concurrent use, and cancelling the context puts the original file back.
+func ConvertAudioInPlace(ctx context.Context, filePath string, targetCodec string) error {
+	if !slices.Contains(TargetCodecs, targetCodec) {
+		return fmt.Errorf("unsupported target audio codec %q: must be one of %v", targetCodec, TargetCodecs)
+	}
+
+	// MP4 files can't hold PCM audio
+	ext := strings.ToLower(filepath.Ext(filePath))
+	if strings.HasPrefix(targetCodec, "pcm_") && (ext == ".mp4" || ext == ".m4v") {
+		return fmt.Errorf("%s files can't hold %s audio", ext, targetCodec)
+	}
+
+	return convertAudio(ctx, filePath, targetCodec, config.Default())
+}
+
+// convertAudio moves the original file to the cfg.OriginalsDir directory and writes a version of it
+// with its audio converted to audioCodec in its place.
+func convertAudio(ctx context.Context, filePath string, audioCodec string, cfg config.Config) error {
 	parentDir := filepath.Dir(filePath)
 
-	parentDirInfo, err := os.Stat(parentDir)
-	if err != nil {
-		return fmt.Errorf("error getting parent directory info: %w", err)
+	if cfg.DryRun {
+		slog.Info("Dry run, would move unsupported audio file", "path", filePath,
+			"to", filepath.Join(parentDir, cfg.OriginalsDir),
+			"command", ffmpeg.FormatCommand(ffmpeg.CreateConvertedOriginalCommand(filePath, cfg.OriginalsDir, audioCodec)))
+
+		return nil
 	}
 
+	slog.Info("Moving unsupported audio file", "path", filePath, "to", cfg.OriginalsDir)
+
 	// Create Originals directory if it doesn't exist
-	originalsDir := filepath.Join(parentDir, "Originals")
+	originalsDir := filepath.Join(parentDir, cfg.OriginalsDir)
+
+	originalsMu.Lock()
+
 	if _, err := os.Stat(originalsDir); err != nil {
-		if err := os.MkdirAll(originalsDir, parentDirInfo.Mode()); err != nil {
+		if err := fileutil.CreateDir(originalsDir, cfg.DirMode, true); err != nil {
+			originalsMu.Unlock()
+
 			return fmt.Errorf("error creating Originals directory: %w", err)
 		}
 	}
 
+	originalsMu.Unlock()
+
 	fileName := filepath.Base(filePath)
 	inputFilePath := filepath.Join(originalsDir, fileName)
 
@@ -40,25 +85,65 @@ func ProcessUnsupportedAudio(filePath string) error {
 		return fmt.Errorf("original file already exists: %s", inputFilePath)
 	}
 
-	// Move original file to Originals directory
+	sourceInfo, err := os.Stat(filePath)
+	if err != nil {
+		return fmt.Errorf("error getting file info: %w", err)
+	}
+
+	// Move original file to Originals directory, which keeps its modification time
 	if err := os.Rename(filePath, inputFilePath); err != nil {
 		return fmt.Errorf("error moving file to Originals: %w", err)
 	}
 
 	// Create and execute FFmpeg command to convert audio
-	cmd := ffmpeg.CreateConvertedOriginalCommand(filePath)
+	cmd := ffmpeg.CreateConvertedOriginalCommand(filePath, cfg.OriginalsDir, audioCodec)
 	if len(cmd) == 0 {
 		return errors.New("could not generate ffmpeg command for original file")
 	}
 
-	log.Printf("Executing ffmpeg command for original file: %s\n", strings.Join(cmd, " "))
-	cmdExec := exec.Command(cmd[0], cmd[1:]...) //nolint:gosec
+	slog.Debug("Executing ffmpeg command for original file", "command", ffmpeg.FormatCommand(cmd))
+	cmdExec := ffmpeg.CommandContext(ctx, cmd[0], cmd[1:]...)
 	cmdExec.Stdout = os.Stdout
 	cmdExec.Stderr = os.Stderr
 
 	if err := cmdExec.Run(); err != nil {
+		// Put the original back in place of the partial conversion, as if it had never been touched
+		if ctx.Err() != nil {
+			if restoreErr := restoreOriginal(inputFilePath, filePath); restoreErr != nil {
+				return fmt.Errorf("error restoring original file after cancellation: %w", restoreErr)
+			}
+
+			return fmt.Errorf("error executing ffmpeg command for original file: %w", ctx.Err())
+		}
+
 		return fmt.Errorf("error executing ffmpeg command for original file: %w", err)
 	}
 
+	for _, path := range []string{inputFilePath, filePath} {
+		if err := fileutil.ApplyOwnership(path, cfg.OutputMode, cfg.OutputGroup); err != nil {
+			return fmt.Errorf("error setting ownership of %s: %w", path, err)
+		}
+	}
+
+	if cfg.PreserveModTime {
+		if err := fileutil.SetModTime(filePath, sourceInfo.ModTime()); err != nil {
+			return fmt.Errorf("error preserving modification time of %s: %w", filePath, err)
+		}
+	}
+
+	return nil
+}
+
+// restoreOriginal moves an original file back from the Originals directory to filePath,
+// replacing the partial conversion written there.
+func restoreOriginal(originalPath string, filePath string) error {
+	if err := os.Remove(filePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error removing partial conversion: %w", err)
+	}
+
+	if err := os.Rename(originalPath, filePath); err != nil {
+		return fmt.Errorf("error moving original file back: %w", err)
+	}
+
 	return nil
 }
@@ -0,0 +1,939 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/manifest"
+	"github.com/cyrilschreiber3/media-processor/pkg/media"
+	"github.com/cyrilschreiber3/media-processor/pkg/report"
+	"github.com/cyrilschreiber3/media-processor/pkg/timing"
+)
+
+// Supported values for the proxy color range.
+const (
+	ColorRangeAuto = "auto"
+	ColorRangeTV   = "tv"
+	ColorRangePC   = "pc"
+)
+
+// DefaultMaxRate is the maximum video bitrate of proxies when none is configured.
+const DefaultMaxRate = "7M"
+
+// maxAudioSampleRate is the highest audio sample rate accepted, the one of 384 kHz studio recordings.
+const maxAudioSampleRate = 384000
+
+// maxQuality is the highest quality level accepted by every encoder, the worst quality of SVT-AV1.
+const maxQuality = 63
+
+// frameRateExp matches the frame rates accepted by FFmpeg, such as 25, 29.97 or 30000/1001.
+var frameRateExp = regexp.MustCompile(`^\d+(\.\d+)?(/\d+)?$`)
+
+// maxRateExp matches the bitrates accepted by FFmpeg, such as 7M, 800k or 1.5M.
+var maxRateExp = regexp.MustCompile(`^\d+(\.\d+)?[kKMG]?$`)
+
+// Supported hardware acceleration modes.
+const (
+	HWAccelAuto         = "auto"
+	HWAccelCUDA         = "cuda"
+	HWAccelVideoToolbox = "videotoolbox"
+	HWAccelQSV          = "qsv"
+	HWAccelVAAPI        = "vaapi"
+	HWAccelNone         = "none"
+)
+
+// Supported log formats.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// Supported audio policies of the proxy.
+const (
+	AudioPolicyCopyIfSupported = "copy-if-supported"
+	AudioPolicyAlwaysAAC       = "always-aac"
+	AudioPolicyAlwaysPCM       = "always-pcm"
+	AudioPolicyDrop            = "drop"
+)
+
+// Supported proxy containers.
+const (
+	ContainerMOV = "mov"
+	ContainerMP4 = "mp4"
+	ContainerMKV = "mkv"
+)
+
+// Supported proxy video codecs.
+const (
+	CodecH264 = "h264"
+	CodecHEVC = "hevc"
+	CodecAV1  = "av1"
+)
+
+// Supported sidecar artifacts generated next to proxies.
+const (
+	SidecarThumbnail = "thumbnail"
+	SidecarSprite    = "sprite"
+	SidecarMetadata  = "metadata"
+	SidecarWaveform  = "waveform"
+)
+
+// TonemapNone disables the tonemapping of HDR sources.
+const TonemapNone = "none"
+
+// Tonemaps lists the tonemapping operators of FFmpeg's tonemap filter.
+var Tonemaps = []string{"hable", "mobius", "reinhard", "clip", "linear", "gamma"}
+
+// Sidecars lists every supported sidecar artifact.
+var Sidecars = []string{SidecarThumbnail, SidecarSprite, SidecarMetadata, SidecarWaveform}
+
+// Supported NLEs for proxy relink metadata.
+const (
+	NLEPremiere = "premiere"
+	NLEResolve  = "resolve"
+)
+
+// Config holds the runtime settings that drive proxy generation.
+type Config struct {
+	// ConfigFile is the JSON or YAML file the settings were read from.
+	ConfigFile string
+	// AutoCrop enables detection and removal of letterbox/pillarbox bars.
+	AutoCrop bool
+	// ColorRange is the color range of the proxy: tv (limited), pc (full) or auto.
+	// Auto converts the detected source range to limited range.
+	ColorRange string
+	// Tonemap is the operator converting HDR sources to SDR proxies, one of Tonemaps, or none to only convert
+	// their pixel format. Tonemapping needs an FFmpeg built with the zimg library.
+	Tonemap string
+	// EncoderArgs is a template replacing the built-in video codec and rate arguments.
+	// The {encoder}, {maxrate}, {preset} and {quality} tokens are substituted with the built-in values.
+	EncoderArgs string
+	// ExtraArgs are FFmpeg arguments added right before the proxy output, after every built-in output option,
+	// so they can override them. Each element is a single argument.
+	ExtraArgs []string
+	// RefreshStale regenerates existing proxies whose source was modified after them.
+	RefreshStale bool
+	// Overwrite regenerates existing proxies regardless of their age, e.g. after changing the proxy settings.
+	Overwrite bool
+	// StaleTolerance is the modification time difference ignored by RefreshStale.
+	StaleTolerance time.Duration
+	// AudioPolicy selects how proxy audio is encoded: copy-if-supported, always-aac, always-pcm or drop.
+	AudioPolicy string
+	// SupportedAudioCodecs lists the audio codecs the NLEs decode, copied by copy-if-supported and left as is
+	// in sources. Other codecs are converted. A trailing * matches a codec prefix, e.g. pcm_*.
+	SupportedAudioCodecs []string
+	// NLERelink is the NLE whose relink metadata is written into proxies, or empty for none.
+	NLERelink string
+	// BurnIn draws the file name and running timecode of the source over the proxy video.
+	BurnIn bool
+	// BurnInFont is the font file BurnIn draws with, since FFmpeg's drawtext needs one.
+	BurnInFont string
+	// StripMetadata drops the metadata of the source, such as the creation date or GPS position, from the proxy.
+	StripMetadata bool
+	// FlatOutput, when set, is a single directory receiving every proxy instead of per-folder Proxy directories.
+	FlatOutput string
+	// NoModifySource leaves sources with unsupported audio as they are, instead of moving them to OriginalsDir
+	// and converting their audio. Only their proxies then have audio NLEs can decode.
+	NoModifySource bool
+	// DeleteSourceOnSuccess deletes sources once their proxy was created and verified, e.g. when they are archived
+	// elsewhere. It requires Verify or VerifyFrameCount, and never deletes the sources kept in OriginalsDir
+	// or those no verification applied to, such as audio-only sources with VerifyFrameCount alone.
+	DeleteSourceOnSuccess bool
+	// SourceTrash, when set, receives the sources removed by DeleteSourceOnSuccess instead of deleting them.
+	// It must be on the same filesystem as the sources.
+	SourceTrash string
+	// OutputRoot, when set, receives the proxies in a tree mirroring the watch path.
+	// Sources are left untouched, so unsupported audio isn't converted.
+	OutputRoot string
+	// SourceRoot is the watch path OutputRoot mirrors. It is set at runtime and has no flag.
+	SourceRoot string
+	// PreviewSeconds, when positive, generates fast preview proxies of the first seconds only.
+	PreviewSeconds float64
+	// TrimStart, when positive, starts proxies this many seconds into the source, seeking the input.
+	TrimStart float64
+	// TrimEnd, when positive, ends proxies at this position of the source, in seconds.
+	TrimEnd float64
+	// TrimDuration, when positive, limits proxies to this many seconds from TrimStart. It excludes TrimEnd.
+	TrimDuration float64
+	// Sidecars lists the artifacts generated next to each proxy: thumbnail, sprite, metadata and waveform.
+	Sidecars []string
+	// Filmstrip is the number of evenly-spaced thumbnails extracted next to each proxy, or 0 for none.
+	Filmstrip int
+	// Thumbnails extracts a poster frame of the source next to each proxy.
+	Thumbnails bool
+	// SidecarsOnly only generates the missing sidecars of existing proxies, without encoding.
+	SidecarsOnly bool
+	// AcceptPartial keeps the output of a failed encode when it covers at least PartialMinCoverage of the source.
+	AcceptPartial bool
+	// PartialMinCoverage is the fraction of the source duration a partial proxy must cover to be kept.
+	PartialMinCoverage float64
+	// VerifyFrameCount checks that proxies have the same number of frames as their source.
+	VerifyFrameCount bool
+	// Verify probes proxies once written to check they have the expected streams and the duration of their source.
+	Verify bool
+	// NormalizeFilenames rewrites proxy names to an NLE-safe character set. Names that collide get a short source hash.
+	NormalizeFilenames bool
+	// FilenameSafeChars lists the characters kept by NormalizeFilenames besides ASCII letters and digits.
+	FilenameSafeChars string
+	// OutputMode is the permission mode applied to generated files, or 0 to keep the default.
+	OutputMode os.FileMode
+	// DirMode is the permission mode of created directories, or 0 for the mode of their parent directory.
+	DirMode os.FileMode
+	// OutputGroup is the group name or id generated files are assigned to.
+	OutputGroup string
+	// HTTPHeaders are "Name: value" headers sent when probing and reading HTTP(S) sources.
+	HTTPHeaders []string
+	// GPUs lists the GPU indices jobs are assigned to in round-robin order.
+	GPUs []int
+	// GPU is the GPU index used by the current job, or -1 to let FFmpeg choose.
+	GPU int
+	// ThrottleTemperature pauses dispatch while a GPU is hotter than this many °C, or 0 to disable.
+	ThrottleTemperature int
+	// ThrottleUtilization pauses dispatch while a GPU is busier than this percentage, or 0 to disable.
+	ThrottleUtilization int
+	// ThrottleInterval is the delay between GPU readings while dispatch is paused.
+	ThrottleInterval time.Duration
+	// ScanCache is the path of the cache used to skip directories unchanged since their last complete scan.
+	ScanCache string
+	// NoCache processes every source again instead of skipping the ones unchanged since they were processed.
+	NoCache bool
+	// QuarantineAfter is the number of failed attempts after which a source is skipped, or 0 to disable.
+	QuarantineAfter int
+	// RetryFailed processes quarantined sources again.
+	RetryFailed bool
+	// FailFast stops the batch on the first failed file.
+	FailFast bool
+	// StatusFile is the path of the JSON pass/fail summary written after the batch.
+	StatusFile string
+	// Estimate probes the sources and prints an estimate of the processing time without encoding.
+	Estimate bool
+	// RealtimeFactor is the assumed encoding speed used by Estimate, in seconds of media per second.
+	RealtimeFactor float64
+	// VideoProxyDir is the folder, next to the source, receiving proxies of sources with video.
+	VideoProxyDir string
+	// AudioProxyDir is the folder, next to the source, receiving proxies of audio-only sources.
+	AudioProxyDir string
+	// OriginalsDir is the folder, next to the source, keeping the originals of sources whose audio was converted.
+	OriginalsDir string
+	// DumpConfig prints the effective configuration as JSON instead of processing anything.
+	DumpConfig bool
+	// SegmentDuration splits proxies into parts of this duration in a folder named after the source, or 0 to disable.
+	SegmentDuration time.Duration
+	// PriorityFile lists source paths or glob patterns processed before the other sources.
+	PriorityFile string
+	// ForceInputFormat is the FFmpeg format sources are read as, overriding container detection.
+	ForceInputFormat string
+	// InFlight tracks the outputs being written for crash recovery. It is set at runtime and has no flag.
+	InFlight *manifest.InFlight
+	// Timings records the time spent in each processing stage. It is set at runtime and has no flag.
+	Timings *timing.Breakdown
+	// Result collects the outcome of the file, printed with JSONOutput. It is set at runtime and has no flag.
+	Result *report.ProcessResult
+	// JSONOutput prints one JSON result per processed file on the standard output, or the estimate with Estimate.
+	JSONOutput bool
+	// LogLevel is the lowest level of the logged messages: debug, info, warn or error.
+	LogLevel string
+	// Verbose logs at the debug level, including the FFmpeg commands, whatever LogLevel is.
+	Verbose bool
+	// LogFormat is the format of the log lines on the standard error: text or json.
+	LogFormat string
+	// HWAccel selects the hardware decoding and encoding backend: cuda, videotoolbox, qsv or vaapi must be usable,
+	// auto picks the first usable one or software encoding, and none disables hardware acceleration.
+	HWAccel string
+	// ProxyWidth is the long edge of the proxy in pixels, or 0 for 960 wide landscape and 540 wide portrait proxies.
+	ProxyWidth int
+	// Ladder lists the long edges of a proxy ladder, one proxy per size named after it like name_540.mov,
+	// all encoded by a single FFmpeg command. It replaces ProxyWidth when set.
+	Ladder []int
+	// MaxRate is the maximum video bitrate of the proxy in FFmpeg notation, e.g. 3M.
+	MaxRate string
+	// MaxRateSet reports whether MaxRate was set by a flag, environment variable or config file key,
+	// even to its default value.
+	MaxRateSet bool
+	// SkipProxySized skips the sources whose resolution and bitrate are already at or below the proxy ones.
+	SkipProxySized bool
+	// Quality encodes the proxy at a constant quality level instead of capping its bitrate at MaxRate,
+	// or 0 to cap the bitrate. Lower is better, like CRF values.
+	Quality int
+	// CFRFrameRate is the constant frame rate proxies of variable frame rate sources are encoded at,
+	// e.g. 30 or 30000/1001, or empty for the average frame rate of the source.
+	CFRFrameRate string
+	// Recursive processes the media in the subdirectories of the watch path.
+	Recursive bool
+	// MaxDepth is the number of subdirectory levels descended by Recursive, or 0 for no limit.
+	MaxDepth int
+	// Include lists glob patterns, one of which the file names of the sources must match, or empty for all files.
+	Include []string
+	// Exclude lists glob patterns of file names that are not processed.
+	Exclude []string
+	// Watch keeps running and processes new media as it lands in the watch path.
+	Watch bool
+	// WatchInterval is how long a source of Watch must go without filesystem events before it is processed.
+	WatchInterval time.Duration
+	// StableWait checks that a source is unchanged over this duration before processing it, or 0 to disable.
+	StableWait time.Duration
+	// StableRetries is the number of times an unstable source is checked again before it is skipped.
+	StableRetries int
+	// Jobs is the number of files processed concurrently.
+	Jobs int
+	// PreserveModTime gives generated files the modification time of their source.
+	PreserveModTime bool
+	// DryRun logs the commands and outputs of each source without writing anything.
+	DryRun bool
+	// SubtitleSidecars extracts the text subtitles of the source to SRT files next to the proxy.
+	SubtitleSidecars bool
+	// ProxyContainer is the container and file extension of the proxies: mov, mp4 or mkv.
+	ProxyContainer string
+	// ProxyCodec is the video codec of the proxies: h264, hevc or av1.
+	ProxyCodec string
+	// AudioOnlyProxies writes the proxies of sources without video as compressed audio files.
+	AudioOnlyProxies bool
+	// TwoPass encodes libx264 proxies in two passes, targeting the max bitrate as average bitrate.
+	TwoPass bool
+	// Retries is the number of times an encode failing for lack of GPU resources is run again.
+	Retries int
+	// RetryDelay is the delay before the first retry, doubled at each following one.
+	RetryDelay time.Duration
+	// Timeout kills a proxy encode running longer than this, e.g. stuck on a malformed file, or 0 for no limit.
+	Timeout time.Duration
+	// Loudnorm normalizes the loudness of the proxy audio to LoudnessTarget following EBU R128.
+	Loudnorm bool
+	// LoudnessTarget is the integrated loudness targeted by Loudnorm, in LUFS.
+	LoudnessTarget float64
+	// DownmixStereo downmixes the proxy audio of sources with more than two channels to stereo.
+	DownmixStereo bool
+	// AudioSampleRate is the sample rate the proxy audio is resampled to, in Hz, or 0 to keep the source rate.
+	AudioSampleRate int
+}
+
+// Default returns the configuration used when no option is set.
+func Default() Config {
+	return Config{
+		AutoCrop:    false,
+		ColorRange:  ColorRangeAuto,
+		Tonemap:     "hable",
+		AudioPolicy: AudioPolicyCopyIfSupported,
+		// Cloned so flags and config files never modify the defaults of the media package
+		SupportedAudioCodecs: slices.Clone(media.DefaultSupportedAudioCodecs),
+		// Network filesystems commonly round modification times to 2 seconds
+		StaleTolerance:     2 * time.Second,
+		PartialMinCoverage: 0.99,
+		FilenameSafeChars:  "-_.",
+		GPU:                -1,
+		ThrottleInterval:   10 * time.Second,
+		RealtimeFactor:     4,
+		HWAccel:            HWAccelAuto,
+		LogLevel:           "info",
+		LogFormat:          LogFormatText,
+		MaxRate:            DefaultMaxRate,
+		Jobs:               1,
+		VideoProxyDir:      "Proxy",
+		AudioProxyDir:      "Proxy",
+		OriginalsDir:       "Originals",
+		ProxyContainer:     ContainerMOV,
+		ProxyCodec:         CodecH264,
+		LoudnessTarget:     -16,
+		WatchInterval:      5 * time.Second,
+		RetryDelay:         5 * time.Second,
+	}
+}
+
+// RegisterFlags binds the configuration fields to command line flags.
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.ConfigFile, "config", c.ConfigFile, "JSON or YAML config file of settings keyed by flag name")
+	fs.BoolVar(&c.AutoCrop, "autocrop", c.AutoCrop, "detect and crop letterbox/pillarbox bars before scaling")
+	fs.StringVar(&c.ColorRange, "color-range", c.ColorRange, "proxy color range: tv, pc or auto")
+	fs.StringVar(&c.Tonemap, "tonemap", c.Tonemap,
+		"operator converting HDR sources to SDR: hable, mobius, reinhard, clip, linear, gamma or none")
+	fs.StringVar(&c.EncoderArgs, "encoder-args", c.EncoderArgs,
+		"template replacing the video codec and rate arguments, e.g. \"-c:v {encoder} -cq 23\"")
+	fs.Var((*stringList)(&c.ExtraArgs), "ffmpeg-arg",
+		"argument added before the proxy output, overriding the built-in ones (repeatable, one argument each,"+
+			" e.g. -ffmpeg-arg=-tune -ffmpeg-arg=film)")
+	fs.BoolVar(&c.RefreshStale, "refresh-stale", c.RefreshStale, "regenerate proxies older than their source")
+	fs.BoolVar(&c.Overwrite, "overwrite", c.Overwrite, "regenerate existing proxies")
+	fs.DurationVar(&c.StaleTolerance, "stale-tolerance", c.StaleTolerance,
+		"modification time difference ignored by -refresh-stale")
+	fs.StringVar(&c.AudioPolicy, "audio-policy", c.AudioPolicy,
+		"proxy audio handling: copy-if-supported, always-aac, always-pcm or drop")
+	fs.Var((*commaList)(&c.SupportedAudioCodecs), "supported-audio-codecs",
+		"comma-separated audio codecs the NLEs decode, others are converted; a trailing * matches a prefix")
+	fs.StringVar(&c.NLERelink, "nle-relink", c.NLERelink, "write relink metadata for this NLE: premiere or resolve")
+	fs.BoolVar(&c.BurnIn, "burn-in", c.BurnIn, "draw the file name and running timecode over the proxy video")
+	fs.StringVar(&c.BurnInFont, "burn-in-font", c.BurnInFont, "font file used by -burn-in, e.g. a TTF file")
+	fs.BoolVar(&c.StripMetadata, "strip-metadata", c.StripMetadata,
+		"drop the source metadata such as creation date, GPS position and lens info from proxies")
+	fs.BoolVar(&c.NoModifySource, "no-modify-source", c.NoModifySource,
+		"never move or convert sources with unsupported audio, only their proxies get supported audio")
+	fs.BoolVar(&c.DeleteSourceOnSuccess, "delete-source-on-success", c.DeleteSourceOnSuccess,
+		"delete sources once their proxy is created and verified, requires -verify or -verify-framecount")
+	fs.StringVar(&c.SourceTrash, "source-trash", c.SourceTrash,
+		"move sources to this directory outside the watch path instead of deleting them with -delete-source-on-success")
+	fs.StringVar(&c.OutputRoot, "out", c.OutputRoot,
+		"directory receiving proxies in a tree mirroring the watch path, instead of Proxy folders next to sources")
+	fs.StringVar(&c.FlatOutput, "flat-output", c.FlatOutput,
+		"write every proxy to this single directory with collision-safe names")
+	fs.Float64Var(&c.PreviewSeconds, "preview-seconds", c.PreviewSeconds,
+		"generate fast preview proxies of the first N seconds only")
+	fs.Float64Var(&c.TrimStart, "ss", c.TrimStart, "start proxies this many seconds into the source")
+	fs.Float64Var(&c.TrimEnd, "to", c.TrimEnd, "end proxies at this position of the source, in seconds")
+	fs.Float64Var(&c.TrimDuration, "t", c.TrimDuration, "limit proxies to this many seconds of the source")
+	fs.Var((*commaList)(&c.Sidecars), "sidecars",
+		"comma-separated sidecars to generate: thumbnail, sprite, metadata, waveform")
+	fs.BoolVar(&c.Thumbnails, "thumbnails", c.Thumbnails,
+		"extract a JPEG poster frame of the source, at 10% of its duration, next to each proxy")
+	fs.IntVar(&c.Filmstrip, "filmstrip", c.Filmstrip, "extract this many evenly-spaced thumbnails next to each proxy")
+	fs.BoolVar(&c.SidecarsOnly, "sidecars-only", c.SidecarsOnly,
+		"only generate missing sidecars of existing proxies (all kinds unless -sidecars is set)")
+	fs.BoolVar(&c.AcceptPartial, "accept-partial", c.AcceptPartial,
+		"keep the output of a failed encode when it covers enough of the source")
+	fs.Float64Var(&c.PartialMinCoverage, "partial-min-coverage", c.PartialMinCoverage,
+		"fraction of the source duration a partial proxy must cover to be kept")
+	fs.BoolVar(&c.VerifyFrameCount, "verify-framecount", c.VerifyFrameCount,
+		"check that proxies have the same number of frames as their source")
+	fs.BoolVar(&c.Verify, "verify", c.Verify,
+		"check that proxies have the expected streams and a duration close to their source")
+	fs.BoolVar(&c.NormalizeFilenames, "normalize-filenames", c.NormalizeFilenames,
+		"rewrite proxy names to an NLE-safe character set")
+	fs.StringVar(&c.FilenameSafeChars, "filename-safe-chars", c.FilenameSafeChars,
+		"characters kept by -normalize-filenames besides ASCII letters and digits")
+	fs.Var((*fileMode)(&c.OutputMode), "output-mode", "octal permission mode of generated files, e.g. 0664")
+	fs.Var((*fileMode)(&c.DirMode), "dir-mode",
+		"octal permission mode of created Proxy and Originals directories, e.g. 0775 (default that of their parent)")
+	fs.StringVar(&c.OutputGroup, "output-group", c.OutputGroup, "group name or id generated files are assigned to")
+	fs.Var((*stringList)(&c.HTTPHeaders), "http-header", "\"Name: value\" header sent to HTTP(S) sources (repeatable)")
+	fs.Var((*intList)(&c.GPUs), "gpu", "GPU index to encode on, or a comma-separated list to round-robin jobs across")
+	fs.IntVar(&c.ThrottleTemperature, "throttle-temp", c.ThrottleTemperature,
+		"pause dispatching jobs while a GPU is hotter than this many °C (requires nvidia-smi)")
+	fs.IntVar(&c.ThrottleUtilization, "throttle-util", c.ThrottleUtilization,
+		"pause dispatching jobs while a GPU utilization is above this percentage (requires nvidia-smi)")
+	fs.DurationVar(&c.ThrottleInterval, "throttle-interval", c.ThrottleInterval,
+		"delay between GPU readings while dispatch is paused")
+	fs.StringVar(&c.ScanCache, "scan-cache", c.ScanCache,
+		"cache file used to skip directories unchanged since the last scan")
+	fs.BoolVar(&c.NoCache, "no-cache", c.NoCache, "don't skip sources unchanged since they were last processed")
+	fs.IntVar(&c.QuarantineAfter, "quarantine-after", c.QuarantineAfter,
+		"skip sources after this many failed attempts (0 disables the quarantine)")
+	fs.BoolVar(&c.RetryFailed, "retry-failed", c.RetryFailed, "process quarantined sources again")
+	fs.BoolVar(&c.FailFast, "fail-fast", c.FailFast, "stop processing on the first failed file")
+	fs.StringVar(&c.StatusFile, "status-file", c.StatusFile, "write a JSON pass/fail summary to this path")
+	fs.BoolVar(&c.Estimate, "estimate", c.Estimate, "probe the sources and print an estimate of the processing time")
+	fs.Float64Var(&c.RealtimeFactor, "realtime-factor", c.RealtimeFactor,
+		"encoding speed assumed by -estimate, in seconds of media encoded per second")
+	fs.StringVar(&c.OriginalsDir, "originals-dir", c.OriginalsDir,
+		"folder next to the source keeping the originals of converted sources")
+	fs.StringVar(&c.VideoProxyDir, "video-proxy-dir", c.VideoProxyDir, "folder next to the source receiving video proxies")
+	fs.StringVar(&c.AudioProxyDir, "audio-proxy-dir", c.AudioProxyDir,
+		"folder next to the source receiving proxies of audio-only sources")
+	fs.BoolVar(&c.DumpConfig, "json-config-dump", c.DumpConfig, "print the effective configuration as JSON and exit")
+	fs.DurationVar(&c.SegmentDuration, "segment-duration", c.SegmentDuration,
+		"split proxies into parts of this duration, written to Proxy/<name>/part_NNN.mov with an index")
+	fs.StringVar(&c.PriorityFile, "priority-file", c.PriorityFile,
+		"file listing source paths or glob patterns to process before the others, one per line")
+	fs.StringVar(&c.HWAccel, "hwaccel", c.HWAccel,
+		"hardware acceleration: cuda, videotoolbox, qsv, vaapi, none or auto (falls back to software when none is usable)")
+	fs.IntVar(&c.ProxyWidth, "proxy-width", c.ProxyWidth,
+		"long edge of the proxy in pixels (default 960 wide landscape and 540 wide portrait)")
+	fs.Var((*intList)(&c.Ladder), "ladder",
+		"comma-separated long edges of a proxy ladder, e.g. 640,960,1920, writing one proxy per size")
+	fs.StringVar(&c.MaxRate, "maxrate", c.MaxRate, "maximum video bitrate of the proxy, e.g. 3M or 800k")
+	fs.BoolVar(&c.SkipProxySized, "skip-proxy-sized", c.SkipProxySized,
+		"skip sources already at or below the proxy resolution and -maxrate bitrate")
+	fs.IntVar(&c.Quality, "quality", c.Quality,
+		"constant quality level of the proxy instead of -maxrate, lower is better like CRF (0 to use -maxrate)")
+	fs.StringVar(&c.CFRFrameRate, "cfr-frame-rate", c.CFRFrameRate,
+		"frame rate of proxies of variable frame rate sources, e.g. 30 or 30000/1001 (default the source average)")
+	fs.IntVar(&c.Jobs, "jobs", c.Jobs, "number of files processed concurrently")
+	fs.BoolVar(&c.PreserveModTime, "preserve-mtime", c.PreserveModTime,
+		"give proxies and converted originals the modification time of their source")
+	fs.BoolVar(&c.SubtitleSidecars, "subtitle-srt", c.SubtitleSidecars,
+		"also extract the text subtitles of the source to .srt files next to the proxy")
+	fs.StringVar(&c.ProxyCodec, "proxy-codec", c.ProxyCodec, "proxy video codec: h264, hevc or av1")
+	fs.StringVar(&c.ProxyContainer, "proxy-container", c.ProxyContainer, "proxy container: mov, mp4 or mkv")
+	fs.BoolVar(&c.AudioOnlyProxies, "audio-only-proxies", c.AudioOnlyProxies,
+		"write the proxies of sources without video as AAC .m4a files")
+	fs.BoolVar(&c.TwoPass, "two-pass", c.TwoPass,
+		"encode libx264 proxies in two passes at the -maxrate bitrate, ignored with NVENC and other codecs")
+	fs.BoolVar(&c.Loudnorm, "loudnorm", c.Loudnorm, "normalize the proxy audio loudness following EBU R128")
+	fs.Float64Var(&c.LoudnessTarget, "loudness-target", c.LoudnessTarget,
+		"integrated loudness targeted by -loudnorm, in LUFS")
+	fs.BoolVar(&c.DownmixStereo, "downmix-stereo", c.DownmixStereo,
+		"downmix the proxy audio of sources with more than two channels, such as 5.1, to stereo")
+	fs.IntVar(&c.AudioSampleRate, "audio-sample-rate", c.AudioSampleRate,
+		"sample rate the proxy audio is resampled to in Hz, e.g. 48000 (0 keeps the source rate)")
+	fs.BoolVar(&c.JSONOutput, "json", c.JSONOutput,
+		"print one JSON result per processed file (or the -estimate) on stdout, logs stay on stderr")
+	fs.StringVar(&c.LogLevel, "log-level", c.LogLevel, "lowest level of logged messages: debug, info, warn or error")
+	fs.BoolVar(&c.Verbose, "v", c.Verbose, "log debug messages such as the ffmpeg commands (same as -log-level debug)")
+	fs.StringVar(&c.LogFormat, "log-format", c.LogFormat, "format of the log lines on stderr: text or json")
+	fs.IntVar(&c.Retries, "retries", c.Retries,
+		"number of times an encode failing for lack of GPU memory or NVENC sessions is retried")
+	fs.DurationVar(&c.RetryDelay, "retry-delay", c.RetryDelay, "delay before the first retry, doubled at each retry")
+	fs.DurationVar(&c.Timeout, "timeout", c.Timeout,
+		"kill a proxy encode running longer than this and report it as failed (0 for no limit)")
+	fs.BoolVar(&c.DryRun, "dry-run", c.DryRun, "log the ffmpeg commands and target paths without running them")
+	fs.BoolVar(&c.Recursive, "recursive", c.Recursive, "also process the media in subdirectories of the watch path")
+	fs.IntVar(&c.MaxDepth, "max-depth", c.MaxDepth, "subdirectory levels descended by -recursive (0 for no limit)")
+	fs.Var((*stringList)(&c.Include), "include", "only process media whose file name matches this glob (repeatable)")
+	fs.Var((*stringList)(&c.Exclude), "exclude", "skip media whose file name matches this glob (repeatable)")
+	fs.DurationVar(&c.StableWait, "stable-wait", c.StableWait,
+		"skip sources whose size changes over this duration, as they are still being written (0 to disable)")
+	fs.IntVar(&c.StableRetries, "stable-retries", c.StableRetries,
+		"number of times a source still being written is checked again before it is skipped")
+	fs.BoolVar(&c.Watch, "watch", c.Watch, "keep running and process new media as it lands in the watch path")
+	fs.DurationVar(&c.WatchInterval, "watch-interval", c.WatchInterval,
+		"how long a file must go without filesystem events before -watch processes it")
+	fs.StringVar(&c.ForceInputFormat, "force-input-format", c.ForceInputFormat,
+		"read sources as this FFmpeg format, e.g. h264 for raw streams with a wrong extension")
+}
+
+// Level returns the lowest level of the logged messages, debug with Verbose.
+func (c *Config) Level() slog.Level {
+	if c.Verbose {
+		return slog.LevelDebug
+	}
+
+	var level slog.Level
+
+	_ = level.UnmarshalText([]byte(c.LogLevel))
+
+	return level
+}
+
+// Validate checks that the configuration values are usable.
+func (c *Config) Validate() error {
+	if !slices.Contains([]string{ColorRangeAuto, ColorRangeTV, ColorRangePC}, c.ColorRange) {
+		return fmt.Errorf("invalid color range %q: must be tv, pc or auto", c.ColorRange)
+	}
+
+	if c.Tonemap != TonemapNone && !slices.Contains(Tonemaps, c.Tonemap) {
+		return fmt.Errorf("invalid tonemap %q: must be one of %v or %s", c.Tonemap, Tonemaps, TonemapNone)
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		return fmt.Errorf("invalid log level %q: must be debug, info, warn or error", c.LogLevel)
+	}
+
+	if c.LogFormat != LogFormatText && c.LogFormat != LogFormatJSON {
+		return fmt.Errorf("invalid log format %q: must be text or json", c.LogFormat)
+	}
+
+	hwAccels := []string{HWAccelAuto, HWAccelCUDA, HWAccelVideoToolbox, HWAccelQSV, HWAccelVAAPI, HWAccelNone}
+	if !slices.Contains(hwAccels, c.HWAccel) {
+		return fmt.Errorf("invalid hardware acceleration %q: must be one of %v", c.HWAccel, hwAccels)
+	}
+
+	if len(c.SupportedAudioCodecs) == 0 {
+		return errors.New("invalid supported audio codecs: must list at least one codec")
+	}
+
+	audioPolicies := []string{AudioPolicyCopyIfSupported, AudioPolicyAlwaysAAC, AudioPolicyAlwaysPCM, AudioPolicyDrop}
+	if !slices.Contains(audioPolicies, c.AudioPolicy) {
+		return fmt.Errorf("invalid audio policy %q: must be one of %v", c.AudioPolicy, audioPolicies)
+	}
+
+	if !slices.Contains([]string{ContainerMOV, ContainerMP4, ContainerMKV}, c.ProxyContainer) {
+		return fmt.Errorf("invalid proxy container %q: must be mov, mp4 or mkv", c.ProxyContainer)
+	}
+
+	if !slices.Contains([]string{CodecH264, CodecHEVC, CodecAV1}, c.ProxyCodec) {
+		return fmt.Errorf("invalid proxy codec %q: must be h264, hevc or av1", c.ProxyCodec)
+	}
+
+	if c.ProxyCodec == CodecAV1 && c.ProxyContainer == ContainerMOV {
+		return errors.New("mov proxies can't hold AV1 video, use -proxy-container mp4 or mkv")
+	}
+
+	if c.ProxyContainer == ContainerMP4 && c.AudioPolicy == AudioPolicyAlwaysPCM {
+		return errors.New("mp4 proxies can't hold PCM audio, use another -audio-policy or -proxy-container")
+	}
+
+	if c.ProxyWidth < 0 || c.ProxyWidth%2 != 0 {
+		return fmt.Errorf("invalid proxy width %d: must be a positive even number", c.ProxyWidth)
+	}
+
+	if err := c.validateLadder(); err != nil {
+		return err
+	}
+
+	if c.Quality < 0 || c.Quality > maxQuality {
+		return fmt.Errorf("invalid quality %d: must be between 1 and %d, or 0 to use -maxrate", c.Quality, maxQuality)
+	}
+
+	if c.Quality > 0 && c.MaxRateSet {
+		return errors.New("-quality and -maxrate are mutually exclusive")
+	}
+
+	if c.EncoderArgs != "" {
+		if err := ValidateEncoderArgs(c.EncoderArgs); err != nil {
+			return err
+		}
+	}
+
+	if c.Quality > 0 && c.TwoPass {
+		return errors.New("-two-pass targets the -maxrate bitrate and can't be combined with -quality")
+	}
+
+	if c.SegmentDuration > 0 && c.TwoPass {
+		return errors.New("-two-pass cannot be combined with -segment-duration")
+	}
+
+	if !maxRateExp.MatchString(c.MaxRate) {
+		return fmt.Errorf("invalid max bitrate %q: must be a number with an optional k, K, M or G suffix", c.MaxRate)
+	}
+
+	if c.CFRFrameRate != "" && !frameRateExp.MatchString(c.CFRFrameRate) {
+		return fmt.Errorf("invalid frame rate %q: must be a number or a fraction like 30000/1001", c.CFRFrameRate)
+	}
+
+	if c.Jobs < 1 {
+		return fmt.Errorf("invalid job count %d: must be at least 1", c.Jobs)
+	}
+
+	if c.MaxDepth < 0 {
+		return fmt.Errorf("invalid max depth %d: must not be negative", c.MaxDepth)
+	}
+
+	if c.BurnIn && c.BurnInFont == "" {
+		return errors.New("-burn-in requires -burn-in-font")
+	}
+
+	for _, pattern := range slices.Concat(c.Include, c.Exclude) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid file name pattern %q: %w", pattern, err)
+		}
+	}
+
+	if c.Retries < 0 || c.RetryDelay < 0 {
+		return errors.New("-retries and -retry-delay must not be negative")
+	}
+
+	if c.Timeout < 0 {
+		return fmt.Errorf("invalid timeout %s: must not be negative", c.Timeout)
+	}
+
+	if c.StableWait < 0 || c.StableRetries < 0 {
+		return errors.New("-stable-wait and -stable-retries must not be negative")
+	}
+
+	if c.WatchInterval <= 0 {
+		return fmt.Errorf("invalid watch interval %s: must be positive", c.WatchInterval)
+	}
+
+	if c.Filmstrip < 0 {
+		return fmt.Errorf("invalid filmstrip count %d: must not be negative", c.Filmstrip)
+	}
+
+	for _, sidecar := range c.Sidecars {
+		if !slices.Contains(Sidecars, sidecar) {
+			return fmt.Errorf("invalid sidecar %q: must be one of %v", sidecar, Sidecars)
+		}
+	}
+
+	if c.NLERelink != "" && !slices.Contains([]string{NLEPremiere, NLEResolve}, c.NLERelink) {
+		return fmt.Errorf("invalid NLE %q: must be premiere or resolve", c.NLERelink)
+	}
+
+	for _, gpu := range c.GPUs {
+		if gpu < 0 {
+			return fmt.Errorf("invalid GPU index %d: must not be negative", gpu)
+		}
+	}
+
+	if len(c.GPUs) > 0 && c.HWAccel != HWAccelAuto && c.HWAccel != HWAccelCUDA {
+		return fmt.Errorf("-gpu selects NVIDIA GPUs and can't be combined with -hwaccel %s", c.HWAccel)
+	}
+
+	if c.PreviewSeconds < 0 {
+		return fmt.Errorf("invalid preview duration %v: must not be negative", c.PreviewSeconds)
+	}
+
+	if err := c.validateTrim(); err != nil {
+		return err
+	}
+
+	if err := c.validateDeleteSource(); err != nil {
+		return err
+	}
+
+	if c.QuarantineAfter < 0 {
+		return fmt.Errorf("invalid quarantine threshold %d: must not be negative", c.QuarantineAfter)
+	}
+
+	if c.ThrottleInterval <= 0 {
+		return fmt.Errorf("invalid throttle interval %s: must be positive", c.ThrottleInterval)
+	}
+
+	if c.PartialMinCoverage <= 0 || c.PartialMinCoverage > 1 {
+		return fmt.Errorf("invalid partial coverage %v: must be in (0, 1]", c.PartialMinCoverage)
+	}
+
+	if c.RealtimeFactor <= 0 {
+		return fmt.Errorf("invalid realtime factor %v: must be positive", c.RealtimeFactor)
+	}
+
+	for _, dir := range []string{c.VideoProxyDir, c.AudioProxyDir, c.OriginalsDir} {
+		if dir == "" || dir == "." || dir == ".." || strings.ContainsAny(dir, `/\`) {
+			return fmt.Errorf("invalid folder %q: must be a single folder name", dir)
+		}
+	}
+
+	if c.OriginalsDir == c.VideoProxyDir || c.OriginalsDir == c.AudioProxyDir {
+		return fmt.Errorf("invalid originals folder %q: must differ from the proxy folders", c.OriginalsDir)
+	}
+
+	if c.LoudnessTarget < -70 || c.LoudnessTarget > -5 {
+		return fmt.Errorf("invalid loudness target %v: must be between -70 and -5 LUFS", c.LoudnessTarget)
+	}
+
+	if c.AudioSampleRate < 0 || c.AudioSampleRate > maxAudioSampleRate {
+		return fmt.Errorf("invalid audio sample rate %d: must be between 1 and %d Hz, or 0 to keep the source rate",
+			c.AudioSampleRate, maxAudioSampleRate)
+	}
+
+	if c.OutputRoot != "" && c.FlatOutput != "" {
+		return errors.New("-out cannot be combined with -flat-output")
+	}
+
+	if c.SegmentDuration < 0 {
+		return fmt.Errorf("invalid segment duration %s: must not be negative", c.SegmentDuration)
+	}
+
+	if c.SegmentDuration > 0 {
+		switch {
+		case c.PreviewSeconds > 0:
+			return errors.New("-segment-duration cannot be combined with -preview-seconds")
+		case len(c.Sidecars) > 0 || c.SidecarsOnly:
+			return errors.New("-segment-duration cannot be combined with sidecars")
+		case c.AcceptPartial:
+			return errors.New("-segment-duration cannot be combined with -accept-partial")
+		case c.VerifyFrameCount:
+			return errors.New("-segment-duration cannot be combined with -verify-framecount")
+		case c.Verify:
+			return errors.New("-segment-duration cannot be combined with -verify")
+		}
+	}
+
+	if c.StaleTolerance < 0 {
+		return fmt.Errorf("invalid stale tolerance %s: must not be negative", c.StaleTolerance)
+	}
+
+	return nil
+}
+
+// validateTrim checks the time range proxies are trimmed to.
+func (c *Config) validateTrim() error {
+	switch {
+	case c.TrimStart < 0 || c.TrimEnd < 0 || c.TrimDuration < 0:
+		return errors.New("invalid trim range: -ss, -to and -t must not be negative")
+	case c.TrimEnd > 0 && c.TrimDuration > 0:
+		return errors.New("-to cannot be combined with -t")
+	case c.TrimEnd > 0 && c.TrimStart >= c.TrimEnd:
+		return fmt.Errorf("invalid trim range: start %v must be before end %v", c.TrimStart, c.TrimEnd)
+	case c.PreviewSeconds > 0 && (c.TrimEnd > 0 || c.TrimDuration > 0):
+		return errors.New("-preview-seconds cannot be combined with -to or -t")
+	case c.VerifyFrameCount && (c.TrimStart > 0 || c.TrimEnd > 0 || c.TrimDuration > 0):
+		return errors.New("-verify-framecount compares with the whole source and cannot be combined with trimming")
+	}
+
+	return nil
+}
+
+// validateDeleteSource checks that sources are only deleted once a verified proxy covering them fully exists.
+func (c *Config) validateDeleteSource() error {
+	if !c.DeleteSourceOnSuccess {
+		if c.SourceTrash != "" {
+			return errors.New("-source-trash requires -delete-source-on-success")
+		}
+
+		return nil
+	}
+
+	switch {
+	case !c.Verify && !c.VerifyFrameCount:
+		return errors.New("-delete-source-on-success requires -verify or -verify-framecount")
+	case c.NoModifySource:
+		return errors.New("-delete-source-on-success cannot be combined with -no-modify-source")
+	case c.PreviewSeconds > 0 || c.TrimStart > 0 || c.TrimEnd > 0 || c.TrimDuration > 0:
+		return errors.New("-delete-source-on-success requires proxies of the whole source, without preview or trimming")
+	case c.AcceptPartial:
+		return errors.New("-delete-source-on-success cannot be combined with -accept-partial")
+	case c.SidecarsOnly:
+		return errors.New("-delete-source-on-success cannot be combined with -sidecars-only")
+	}
+
+	return nil
+}
+
+// validateLadder checks the sizes of the proxy ladder, and that no option needing a single proxy is set with it.
+func (c *Config) validateLadder() error {
+	if len(c.Ladder) == 0 {
+		return nil
+	}
+
+	for i, width := range c.Ladder {
+		if width <= 0 || width%2 != 0 {
+			return fmt.Errorf("invalid ladder size %d: must be a positive even number", width)
+		}
+
+		if slices.Contains(c.Ladder[:i], width) {
+			return fmt.Errorf("invalid ladder: size %d is repeated", width)
+		}
+	}
+
+	switch {
+	case c.ProxyWidth != 0:
+		return errors.New("-ladder replaces -proxy-width, they can't be combined")
+	case c.TwoPass:
+		return errors.New("-ladder cannot be combined with -two-pass")
+	case c.SegmentDuration > 0:
+		return errors.New("-ladder cannot be combined with -segment-duration")
+	case c.PreviewSeconds > 0:
+		return errors.New("-ladder cannot be combined with -preview-seconds")
+	case c.FlatOutput != "":
+		return errors.New("-ladder cannot be combined with -flat-output")
+	case c.SidecarsOnly:
+		return errors.New("-ladder cannot be combined with -sidecars-only")
+	case c.RefreshStale:
+		return errors.New("-ladder cannot be combined with -refresh-stale")
+	case c.AcceptPartial:
+		return errors.New("-ladder cannot be combined with -accept-partial")
+	case c.SkipProxySized:
+		return errors.New("-ladder cannot be combined with -skip-proxy-sized")
+	}
+
+	return nil
+}
+
+// ProxyExtension returns the file extension of the proxies, including the dot.
+func (c Config) ProxyExtension() string {
+	return "." + c.ProxyContainer
+}
+
+// TrimLength returns the length in seconds of the range proxies are trimmed to, or 0 when it runs to the end.
+func (c Config) TrimLength() float64 {
+	if c.TrimDuration > 0 {
+		return c.TrimDuration
+	}
+
+	if c.TrimEnd > 0 {
+		return c.TrimEnd - c.TrimStart
+	}
+
+	return 0
+}
+
+// intList is a flag value holding a comma-separated list of integers.
+type intList []int
+
+func (l *intList) String() string {
+	if l == nil {
+		return ""
+	}
+
+	values := make([]string, len(*l))
+	for i, value := range *l {
+		values[i] = strconv.Itoa(value)
+	}
+
+	return strings.Join(values, ",")
+}
+
+func (l *intList) Set(value string) error {
+	var values []int
+
+	for _, field := range strings.Split(value, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+
+		parsed, err := strconv.Atoi(field)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q: %w", field, err)
+		}
+
+		values = append(values, parsed)
+	}
+
+	*l = values
+
+	return nil
+}
+
+// fileMode is a flag value holding octal permission bits.
+type fileMode os.FileMode
+
+func (m *fileMode) String() string {
+	if m == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%#o", uint32(*m))
+}
+
+func (m *fileMode) Set(value string) error {
+	parsed, err := strconv.ParseUint(value, 8, 32)
+	if err != nil {
+		return fmt.Errorf("invalid octal mode %q: %w", value, err)
+	}
+
+	if parsed > uint64(os.ModePerm) {
+		return fmt.Errorf("invalid mode %q: only permission bits are allowed", value)
+	}
+
+	*m = fileMode(parsed)
+
+	return nil
+}
+
+// stringList is a repeatable flag value collecting strings.
+type stringList []string
+
+func (l *stringList) String() string {
+	if l == nil {
+		return ""
+	}
+
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+
+	return nil
+}
+
+// commaList is a flag value holding a comma-separated list of strings.
+type commaList []string
+
+func (l *commaList) String() string {
+	if l == nil {
+		return ""
+	}
+
+	return strings.Join(*l, ",")
+}
+
+func (l *commaList) Set(value string) error {
+	var values []string
+
+	for _, field := range strings.Split(value, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			values = append(values, field)
+		}
+	}
+
+	*l = values
+
+	return nil
+}
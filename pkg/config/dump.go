@@ -0,0 +1,47 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"time"
+)
+
+// Settings returns the configuration keyed by flag name, in the format read from config files.
+// Lists are returned as slices, empty when unset, and durations and modes as their flag representation.
+func (c Config) Settings() map[string]any {
+	fs := flag.NewFlagSet("media-processor", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	c.RegisterFlags(fs)
+
+	settings := make(map[string]any)
+
+	// Empty lists are dumped as [] rather than null, which config files can't read back
+	fs.VisitAll(func(f *flag.Flag) {
+		switch value := f.Value.(type) {
+		case *stringList:
+			settings[f.Name] = append([]string{}, *value...)
+		case *commaList:
+			settings[f.Name] = append([]string{}, *value...)
+		case *intList:
+			settings[f.Name] = append([]int{}, *value...)
+		case flag.Getter:
+			settings[f.Name] = value.Get()
+
+			// Durations are easier to read and to reuse in a config file as strings
+			if _, isDuration := value.Get().(time.Duration); isDuration {
+				settings[f.Name] = value.String()
+			}
+		default:
+			settings[f.Name] = value.String()
+		}
+	})
+
+	delete(settings, "json-config-dump")
+
+	// The default bitrate cap doesn't apply to constant quality proxies, and would conflict with -quality once read back
+	if c.Quality > 0 && !c.MaxRateSet {
+		delete(settings, "maxrate")
+	}
+
+	return settings
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSettings(t *testing.T) {
+	configPath := writeConfigFile(t, "config.yaml", "jobs: 2\nhwaccel: vaapi\nstale-tolerance: 5s\n")
+
+	cfg, _, err := Resolve(
+		[]string{"-config", configPath, "-jobs", "4", "-ffmpeg-arg", "-an", "-ffmpeg-arg", "-sn", "/footage"},
+		[]string{"MEDIAPROXY_HWACCEL=cuda", "MEDIAPROXY_SUPPORTED_AUDIO_CODECS=aac,opus", "MEDIAPROXY_GPU=0,1"},
+	)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+
+	settings := cfg.Settings()
+
+	want := map[string]any{
+		"config":                 configPath,
+		"jobs":                   4,
+		"hwaccel":                "cuda",
+		"stale-tolerance":        "5s",
+		"supported-audio-codecs": []string{"aac", "opus"},
+		"ffmpeg-arg":             []string{"-an", "-sn"},
+		"gpu":                    []int{0, 1},
+		"overwrite":              false,
+	}
+
+	for name, value := range want {
+		if !reflect.DeepEqual(settings[name], value) {
+			t.Errorf("Settings()[%q] = %#v, want %#v", name, settings[name], value)
+		}
+	}
+
+	if _, ok := settings["json-config-dump"]; ok {
+		t.Error("Settings() includes json-config-dump, want it left out")
+	}
+}
+
+func TestSettingsRoundTrip(t *testing.T) {
+	cfg := Default()
+	cfg.Jobs = 3
+	cfg.StaleTolerance = 10 * time.Second
+	cfg.SupportedAudioCodecs = []string{"flac"}
+	cfg.OutputMode = 0o640
+	cfg.Quality = 23
+
+	settings := cfg.Settings()
+	delete(settings, "config")
+
+	data, err := json.Marshal(settings)
+	if err != nil {
+		t.Fatalf("error marshalling settings: %v", err)
+	}
+
+	// The dumped settings are a valid config file giving the same configuration
+	loaded, err := Load(writeConfigFile(t, "dump.json", string(data)))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if loaded.Jobs != cfg.Jobs || loaded.StaleTolerance != cfg.StaleTolerance || loaded.OutputMode != cfg.OutputMode ||
+		!slices.Equal(loaded.SupportedAudioCodecs, cfg.SupportedAudioCodecs) {
+		t.Errorf("Load() = %+v, want the dumped configuration %+v", loaded, cfg)
+	}
+
+	if err := loaded.Validate(); err != nil {
+		t.Errorf("Config.Validate() error = %v, want the dumped configuration to be valid", err)
+	}
+}
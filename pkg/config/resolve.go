@@ -0,0 +1,234 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// EnvPrefix prefixes the environment variables bound to configuration flags.
+// A flag such as -color-range is read from MEDIAPROXY_COLOR_RANGE.
+const EnvPrefix = "MEDIAPROXY_"
+
+// ProjectConfigName is the config file read from the watch path when no other config file is set.
+const ProjectConfigName = ".media-processor.yaml"
+
+// Resolve builds the effective configuration by merging, in increasing order of precedence,
+// the defaults, the config file, the environment variables and the command line flags.
+// The config file is set with -config or MEDIAPROXY_CONFIG, and otherwise defaults to the
+// ProjectConfigName file of the watch path when there is one. The remaining arguments are returned.
+func Resolve(args []string, environ []string) (Config, []string, error) {
+	// Parse the flags first to find the config file and report usage errors
+	flagCfg := Default()
+	flagSet := flag.NewFlagSet("media-processor", flag.ContinueOnError)
+	flagCfg.RegisterFlags(flagSet)
+
+	if err := flagSet.Parse(args); err != nil {
+		return Config{}, nil, err //nolint:wrapcheck
+	}
+
+	env := parseEnviron(environ)
+
+	configPath := env[EnvVarName("config")]
+	if isFlagSet(flagSet, "config") {
+		configPath = flagCfg.ConfigFile
+	}
+
+	if configPath == "" && flagSet.NArg() > 0 {
+		projectPath := filepath.Join(flagSet.Arg(0), ProjectConfigName)
+		if info, err := os.Stat(projectPath); err == nil && info.Mode().IsRegular() {
+			configPath = projectPath
+		}
+	}
+
+	cfg := Default()
+	fs := flag.NewFlagSet("media-processor", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	cfg.RegisterFlags(fs)
+
+	if configPath != "" {
+		if err := applyFile(fs, configPath); err != nil {
+			return Config{}, nil, err
+		}
+	}
+
+	if err := applyEnv(fs, env); err != nil {
+		return Config{}, nil, err
+	}
+
+	var flagErr error
+
+	flagSet.Visit(func(f *flag.Flag) {
+		values := []string{f.Value.String()}
+		if list, ok := f.Value.(*stringList); ok {
+			values = *list
+		}
+
+		if err := setFlag(fs, f.Name, values); err != nil && flagErr == nil {
+			flagErr = err
+		}
+	})
+
+	if flagErr != nil {
+		return Config{}, nil, flagErr
+	}
+
+	cfg.ConfigFile = configPath
+	cfg.MaxRateSet = isFlagSet(fs, "maxrate")
+
+	return cfg, flagSet.Args(), nil
+}
+
+// EnvVarName returns the environment variable bound to a flag.
+func EnvVarName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// Load reads the settings of a JSON or YAML config file on top of the defaults.
+func Load(path string) (Config, error) {
+	cfg := Default()
+	fs := flag.NewFlagSet("media-processor", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	cfg.RegisterFlags(fs)
+
+	if err := applyFile(fs, path); err != nil {
+		return Config{}, err
+	}
+
+	cfg.ConfigFile = path
+	cfg.MaxRateSet = isFlagSet(fs, "maxrate")
+
+	return cfg, nil
+}
+
+// applyFile applies a JSON or YAML config file whose keys are flag names.
+// List values are given as arrays; snake_case keys are accepted as well.
+func applyFile(fs *flag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading config file: %w", err)
+	}
+
+	var settings map[string]any
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		settings, err = parseYAML(data)
+		if err != nil {
+			return fmt.Errorf("error unmarshalling config file %s: %w", path, err)
+		}
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+
+		if err := decoder.Decode(&settings); err != nil {
+			return fmt.Errorf("error unmarshalling config file %s: %w", path, err)
+		}
+	}
+
+	// Apply keys in a stable order so errors are reproducible
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		name := strings.ReplaceAll(key, "_", "-")
+		if name == "config" || fs.Lookup(name) == nil {
+			return fmt.Errorf("unknown setting %q in config file %s", key, path)
+		}
+
+		var values []string
+
+		if list, ok := settings[key].([]any); ok {
+			for _, value := range list {
+				values = append(values, fmt.Sprint(value))
+			}
+		} else {
+			values = []string{fmt.Sprint(settings[key])}
+		}
+
+		if err := setFlag(fs, name, values); err != nil {
+			return fmt.Errorf("invalid setting %q in config file %s: %w", key, path, err)
+		}
+	}
+
+	return nil
+}
+
+// applyEnv applies the MEDIAPROXY_ environment variables. Repeatable flags take newline-separated values.
+func applyEnv(fs *flag.FlagSet, env map[string]string) error {
+	var envErr error
+
+	fs.VisitAll(func(f *flag.Flag) {
+		value, ok := env[EnvVarName(f.Name)]
+		if !ok || f.Name == "config" || envErr != nil {
+			return
+		}
+
+		values := []string{value}
+		if _, isList := f.Value.(*stringList); isList {
+			values = strings.Split(value, "\n")
+		}
+
+		if err := setFlag(fs, f.Name, values); err != nil {
+			envErr = fmt.Errorf("invalid value for %s: %w", EnvVarName(f.Name), err)
+		}
+	})
+
+	return envErr
+}
+
+// setFlag replaces the value of a flag. Repeatable flags are reset before the values are added.
+// The flag is set through the flag set, so isFlagSet tells the settings given by any source from the defaults.
+func setFlag(fs *flag.FlagSet, name string, values []string) error {
+	f := fs.Lookup(name)
+
+	list, isList := f.Value.(*stringList)
+	if !isList {
+		return fs.Set(name, strings.Join(values, ",")) //nolint:wrapcheck
+	}
+
+	*list = nil
+
+	for _, value := range values {
+		if err := fs.Set(name, value); err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+
+	return nil
+}
+
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	found := false
+
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			found = true
+		}
+	})
+
+	return found
+}
+
+func parseEnviron(environ []string) map[string]string {
+	env := make(map[string]string)
+
+	for _, entry := range environ {
+		key, value, ok := strings.Cut(entry, "=")
+		if ok && strings.HasPrefix(key, EnvPrefix) {
+			env[key] = value
+		}
+	}
+
+	return env
+}
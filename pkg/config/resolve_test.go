@@ -0,0 +1,206 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/media"
+)
+
+// writeConfigFile writes a config file in a temporary directory and returns its path.
+func writeConfigFile(t *testing.T, name string, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("error creating %s: %v", path, err)
+	}
+
+	return path
+}
+
+func TestResolvePrecedence(t *testing.T) {
+	configFile := "jobs: 2\nhwaccel: vaapi\nvideo_proxy_dir: FileProxy\nsupported-audio-codecs:\n  - aac\n  - opus\n"
+
+	tests := []struct {
+		name          string
+		file          bool
+		environ       []string
+		args          []string
+		wantJobs      int
+		wantHWAccel   string
+		wantProxyDir  string
+		wantAudioList []string
+	}{
+		{
+			name:          "defaults",
+			wantJobs:      1,
+			wantHWAccel:   HWAccelAuto,
+			wantProxyDir:  "Proxy",
+			wantAudioList: media.DefaultSupportedAudioCodecs,
+		},
+		{
+			name:          "config file over defaults",
+			file:          true,
+			wantJobs:      2,
+			wantHWAccel:   "vaapi",
+			wantProxyDir:  "FileProxy",
+			wantAudioList: []string{"aac", "opus"},
+		},
+		{
+			name:          "environment over config file",
+			file:          true,
+			environ:       []string{"MEDIAPROXY_JOBS=3", "MEDIAPROXY_SUPPORTED_AUDIO_CODECS=pcm_s16le,mp3", "HOME=/root"},
+			wantJobs:      3,
+			wantHWAccel:   "vaapi",
+			wantProxyDir:  "FileProxy",
+			wantAudioList: []string{"pcm_s16le", "mp3"},
+		},
+		{
+			name:          "flags over environment",
+			file:          true,
+			environ:       []string{"MEDIAPROXY_JOBS=3", "MEDIAPROXY_HWACCEL=cuda"},
+			args:          []string{"-jobs", "4", "-video-proxy-dir", "FlagProxy", "-supported-audio-codecs", "flac"},
+			wantJobs:      4,
+			wantHWAccel:   "cuda",
+			wantProxyDir:  "FlagProxy",
+			wantAudioList: []string{"flac"},
+		},
+		{
+			name:          "environment over defaults",
+			environ:       []string{"MEDIAPROXY_HWACCEL=none"},
+			wantJobs:      1,
+			wantHWAccel:   HWAccelNone,
+			wantProxyDir:  "Proxy",
+			wantAudioList: media.DefaultSupportedAudioCodecs,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if tt.file {
+				args = append([]string{"-config", writeConfigFile(t, "config.yaml", configFile)}, args...)
+			}
+
+			cfg, rest, err := Resolve(append(args, "/footage"), tt.environ)
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+
+			if !slices.Equal(rest, []string{"/footage"}) {
+				t.Errorf("Resolve() args = %v, want the watch path", rest)
+			}
+
+			if cfg.Jobs != tt.wantJobs || cfg.HWAccel != tt.wantHWAccel || cfg.VideoProxyDir != tt.wantProxyDir {
+				t.Errorf("Resolve() jobs, hwaccel, proxy dir = %d, %q, %q, want %d, %q, %q",
+					cfg.Jobs, cfg.HWAccel, cfg.VideoProxyDir, tt.wantJobs, tt.wantHWAccel, tt.wantProxyDir)
+			}
+
+			if !slices.Equal(cfg.SupportedAudioCodecs, tt.wantAudioList) {
+				t.Errorf("Resolve() supported audio codecs = %v, want %v", cfg.SupportedAudioCodecs, tt.wantAudioList)
+			}
+		})
+	}
+}
+
+func TestResolveConfigFile(t *testing.T) {
+	flagFile := writeConfigFile(t, "flag.json", `{"jobs": 5}`)
+	envFile := writeConfigFile(t, "env.json", `{"jobs": 6}`)
+
+	watchPath := t.TempDir()
+	if err := os.WriteFile(filepath.Join(watchPath, ProjectConfigName), []byte("jobs: 7\n"), 0o600); err != nil {
+		t.Fatalf("error creating the project config: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		environ  []string
+		args     []string
+		wantFile string
+		wantJobs int
+	}{
+		{"project config of the watch path", nil, nil, filepath.Join(watchPath, ProjectConfigName), 7},
+		{"config from the environment", []string{"MEDIAPROXY_CONFIG=" + envFile}, nil, envFile, 6},
+		{
+			"config flag over the environment",
+			[]string{"MEDIAPROXY_CONFIG=" + envFile}, []string{"-config", flagFile}, flagFile, 5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _, err := Resolve(append(tt.args, watchPath), tt.environ)
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+
+			if cfg.ConfigFile != tt.wantFile || cfg.Jobs != tt.wantJobs {
+				t.Errorf("Resolve() config file, jobs = %q, %d, want %q, %d", cfg.ConfigFile, cfg.Jobs, tt.wantFile, tt.wantJobs)
+			}
+		})
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		environ []string
+		args    []string
+	}{
+		{"unknown config file key", `{"unknown": true}`, nil, nil},
+		{"invalid config file value", `{"jobs": "many"}`, nil, nil},
+		{"invalid environment value", "", []string{"MEDIAPROXY_JOBS=many"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeConfigFile(t, "config.json", tt.file)}, args...)
+			}
+
+			if _, _, err := Resolve(append(args, "/footage"), tt.environ); err == nil {
+				t.Error("Resolve() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestResolveQualityMaxRate(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		environ []string
+		args    []string
+		wantErr bool
+	}{
+		{"quality alone", "", nil, []string{"-quality", "23"}, false},
+		{"maxrate alone", "", nil, []string{"-maxrate", "3M"}, false},
+		{"maxrate flag", "", nil, []string{"-quality", "23", "-maxrate", "3M"}, true},
+		{"maxrate flag at its default", "", nil, []string{"-quality", "23", "-maxrate", DefaultMaxRate}, true},
+		{"maxrate environment variable", "", []string{"MEDIAPROXY_MAXRATE=3M"}, []string{"-quality", "23"}, true},
+		{"maxrate config file key", `{"quality": 23, "maxrate": "7M"}`, nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeConfigFile(t, "config.json", tt.file)}, args...)
+			}
+
+			cfg, _, err := Resolve(append(args, "/footage"), tt.environ)
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Config.Validate() error = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
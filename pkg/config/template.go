@@ -0,0 +1,113 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+var templateTokenExp = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// encoderTemplateTokens lists the tokens that can be used in an encoder args template.
+var encoderTemplateTokens = []string{"encoder", "maxrate", "preset", "quality"}
+
+// SplitArgs splits a command line into arguments the way argv is built, without any shell expansion.
+// Single and double quotes group words, and a backslash escapes the next character outside single quotes.
+func SplitArgs(line string) ([]string, error) {
+	var (
+		args    []string
+		current strings.Builder
+		inArg   bool
+		quote   rune
+		escaped bool
+	)
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, errors.New("unterminated quote in arguments")
+	}
+
+	if escaped {
+		return nil, errors.New("trailing backslash in arguments")
+	}
+
+	if inArg {
+		args = append(args, current.String())
+	}
+
+	return args, nil
+}
+
+// ValidateEncoderArgs checks that an encoder args template tokenizes and only uses known tokens.
+func ValidateEncoderArgs(template string) error {
+	args, err := SplitArgs(template)
+	if err != nil {
+		return fmt.Errorf("invalid encoder args template: %w", err)
+	}
+
+	if len(args) == 0 {
+		return errors.New("invalid encoder args template: no arguments")
+	}
+
+	for _, arg := range args {
+		for _, match := range templateTokenExp.FindAllStringSubmatch(arg, -1) {
+			if !slices.Contains(encoderTemplateTokens, match[1]) {
+				return fmt.Errorf("invalid encoder args template: unknown token {%s}", match[1])
+			}
+		}
+	}
+
+	return nil
+}
+
+// ExpandEncoderArgs tokenizes an encoder args template and substitutes its tokens.
+// Substitution happens per argument, so a value can never introduce extra arguments.
+func ExpandEncoderArgs(template string, values map[string]string) ([]string, error) {
+	if err := ValidateEncoderArgs(template); err != nil {
+		return nil, err
+	}
+
+	args, _ := SplitArgs(template)
+
+	for i, arg := range args {
+		args[i] = templateTokenExp.ReplaceAllStringFunc(arg, func(token string) string {
+			return values[strings.Trim(token, "{}")]
+		})
+	}
+
+	return args, nil
+}
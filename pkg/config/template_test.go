@@ -0,0 +1,117 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    []string
+		wantErr bool
+	}{
+		{"words", "-c:v libx264  -crf 23", []string{"-c:v", "libx264", "-crf", "23"}, false},
+		{"double quotes", `-metadata "title=My clip"`, []string{"-metadata", "title=My clip"}, false},
+		{"single quotes", `-x265-params 'log-level=error'`, []string{"-x265-params", "log-level=error"}, false},
+		{"escaped space", `-metadata title=My\ clip`, []string{"-metadata", "title=My clip"}, false},
+		{"empty quotes", `-metadata ""`, []string{"-metadata", ""}, false},
+		{"empty", "  ", nil, false},
+		{"unterminated quote", `-metadata "title`, nil, true},
+		{"trailing backslash", `-crf 23\`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SplitArgs(tt.line)
+			if (err != nil) != tt.wantErr || !slices.Equal(got, tt.want) {
+				t.Errorf("SplitArgs(%q) = %q, %v, want %q (error: %v)", tt.line, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateEncoderArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		wantErr  string
+	}{
+		{"known tokens", "-c:v {encoder} -preset {preset} -maxrate {maxrate} -crf {quality}", ""},
+		{"no tokens", "-c:v libx264 -crf 20", ""},
+		{"unknown token", "-c:v {codec}", "unknown token {codec}"},
+		{"no arguments", " ", "no arguments"},
+		{"unterminated quote", `-c:v "{encoder}`, "unterminated quote"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateEncoderArgs(tt.template)
+			if (err == nil) != (tt.wantErr == "") || (err != nil && !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("ValidateEncoderArgs(%q) error = %v, want %q", tt.template, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExpandEncoderArgs(t *testing.T) {
+	values := map[string]string{"encoder": "libx264", "maxrate": "10M", "preset": "fast", "quality": "23"}
+
+	tests := []struct {
+		name     string
+		template string
+		values   map[string]string
+		want     []string
+	}{
+		{
+			name:     "substitution",
+			template: "-c:v {encoder} -preset {preset} -crf {quality}",
+			values:   values,
+			want:     []string{"-c:v", "libx264", "-preset", "fast", "-crf", "23"},
+		},
+		{
+			name:     "token inside an argument",
+			template: "-x264-params vbv-maxrate={maxrate}:keyint=48",
+			values:   values,
+			want:     []string{"-x264-params", "vbv-maxrate=10M:keyint=48"},
+		},
+		{
+			name:     "value with spaces stays one argument",
+			template: "-metadata comment={preset}",
+			values:   map[string]string{"preset": "very slow"},
+			want:     []string{"-metadata", "comment=very slow"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExpandEncoderArgs(tt.template, tt.values)
+			if err != nil || !slices.Equal(got, tt.want) {
+				t.Errorf("ExpandEncoderArgs(%q) = %q, %v, want %q", tt.template, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandEncoderArgsInvalid(t *testing.T) {
+	if _, err := ExpandEncoderArgs("-c:v {codec}", nil); err == nil {
+		t.Error("ExpandEncoderArgs() error = nil, want the unknown token")
+	}
+}
+
+func TestValidateEncoderArgsTemplate(t *testing.T) {
+	cfg := Default()
+	cfg.EncoderArgs = "-c:v {encoder} -crf {crf}"
+
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "unknown token {crf}") {
+		t.Errorf("Config.Validate() error = %v, want the unknown token", err)
+	}
+
+	cfg.EncoderArgs = "-c:v {encoder} -crf {quality}"
+
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Config.Validate() error = %v, want nil", err)
+	}
+}
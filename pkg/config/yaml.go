@@ -0,0 +1,114 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// parseYAML parses the subset of YAML used by config files: a flat mapping of settings to scalars,
+// with lists written either inline ([a, b]) or as indented "- item" lines. Comments and a leading
+// document marker are ignored.
+func parseYAML(data []byte) (map[string]any, error) {
+	settings := make(map[string]any)
+
+	var listKey string
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+
+		line := strings.TrimRight(stripYAMLComment(scanner.Text()), " \t\r")
+		if strings.TrimSpace(line) == "" || line == "---" {
+			continue
+		}
+
+		// Items of a block list are indented below their key
+		if line[0] == ' ' || line[0] == '\t' {
+			item, ok := strings.CutPrefix(strings.TrimLeft(line, " \t"), "- ")
+			if !ok || listKey == "" {
+				return nil, fmt.Errorf("line %d: nested values are not supported", lineNumber)
+			}
+
+			list, _ := settings[listKey].([]any)
+			settings[listKey] = append(list, unquoteYAML(strings.TrimSpace(item)))
+
+			continue
+		}
+
+		key, value, found := strings.Cut(line, ":")
+		if !found || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("line %d: expected \"setting: value\"", lineNumber)
+		}
+
+		key = strings.TrimSpace(key)
+		if _, exists := settings[key]; exists {
+			return nil, fmt.Errorf("line %d: duplicate setting %q", lineNumber, key)
+		}
+
+		value = strings.TrimSpace(value)
+		listKey = ""
+
+		switch {
+		case value == "":
+			// The value is the block list on the following lines
+			settings[key] = []any{}
+			listKey = key
+		case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+			list := []any{}
+
+			if inner := strings.TrimSpace(value[1 : len(value)-1]); inner != "" {
+				for _, item := range strings.Split(inner, ",") {
+					list = append(list, unquoteYAML(strings.TrimSpace(item)))
+				}
+			}
+
+			settings[key] = list
+		default:
+			settings[key] = unquoteYAML(value)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading YAML: %w", err)
+	}
+
+	if len(settings) == 0 && len(bytes.TrimSpace(data)) > 0 {
+		return nil, errors.New("no settings found")
+	}
+
+	return settings, nil
+}
+
+// stripYAMLComment removes a trailing comment, keeping # characters inside quotes.
+func stripYAMLComment(line string) string {
+	var quote rune
+
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+
+	return line
+}
+
+// unquoteYAML removes the quotes around a scalar.
+func unquoteYAML(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+
+	return value
+}
@@ -0,0 +1,168 @@
+package disc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Directory names of ripped disc structures.
+const (
+	DVDDirName    = "VIDEO_TS"
+	BlurayDirName = "BDMV"
+)
+
+var vobPartExp = regexp.MustCompile(`(?i)^VTS_(\d{2})_(\d)\.VOB$`)
+
+// Title is a disc title made of one or more consecutive parts.
+type Title struct {
+	// Root is the directory holding the disc structure.
+	Root string
+	// Parts are the paths of the title parts in playback order.
+	Parts []string
+}
+
+// Input returns the FFmpeg input for the title, using the concat protocol for multi-part titles.
+func (t Title) Input() string {
+	if len(t.Parts) == 1 {
+		return t.Parts[0]
+	}
+
+	return "concat:" + strings.Join(t.Parts, "|")
+}
+
+// IsDiscRoot reports whether a directory holds a ripped DVD or Blu-ray structure.
+func IsDiscRoot(dirPath string) bool {
+	for _, name := range []string{DVDDirName, BlurayDirName} {
+		if info, err := os.Stat(filepath.Join(dirPath, name)); err == nil && info.IsDir() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GroupVOBParts groups VOB file names by title set number, in part order.
+// Menu parts (VTS_xx_0.VOB) and VIDEO_TS.VOB are excluded.
+func GroupVOBParts(names []string) map[int][]string {
+	groups := make(map[int][]string)
+
+	for _, name := range names {
+		match := vobPartExp.FindStringSubmatch(name)
+		if match == nil || match[2] == "0" {
+			continue
+		}
+
+		titleSet, _ := strconv.Atoi(match[1])
+		groups[titleSet] = append(groups[titleSet], name)
+	}
+
+	for _, parts := range groups {
+		sort.Slice(parts, func(i, j int) bool {
+			return strings.ToUpper(parts[i]) < strings.ToUpper(parts[j])
+		})
+	}
+
+	return groups
+}
+
+// FindTitle returns the main title of the disc stored in root.
+func FindTitle(root string) (Title, error) {
+	if info, err := os.Stat(filepath.Join(root, DVDDirName)); err == nil && info.IsDir() {
+		return findDVDTitle(root)
+	}
+
+	return findBlurayTitle(root)
+}
+
+// findDVDTitle returns the title set with the largest total size, which is the main feature on simple discs.
+func findDVDTitle(root string) (Title, error) {
+	dir := filepath.Join(root, DVDDirName)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return Title{}, fmt.Errorf("error reading %s: %w", DVDDirName, err)
+	}
+
+	names := make([]string, 0, len(entries))
+	sizes := make(map[string]int64)
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return Title{}, fmt.Errorf("error getting file info: %w", err)
+		}
+
+		names = append(names, entry.Name())
+		sizes[entry.Name()] = info.Size()
+	}
+
+	var (
+		bestParts []string
+		bestSize  int64
+	)
+
+	for _, parts := range GroupVOBParts(names) {
+		var size int64
+		for _, part := range parts {
+			size += sizes[part]
+		}
+
+		if size > bestSize {
+			bestParts, bestSize = parts, size
+		}
+	}
+
+	if len(bestParts) == 0 {
+		return Title{}, errors.New("no title found in " + DVDDirName)
+	}
+
+	title := Title{Root: root}
+	for _, part := range bestParts {
+		title.Parts = append(title.Parts, filepath.Join(dir, part))
+	}
+
+	return title, nil
+}
+
+// findBlurayTitle returns the largest M2TS stream. Playlists are not parsed, so titles spanning
+// several clips only get their largest clip.
+func findBlurayTitle(root string) (Title, error) {
+	dir := filepath.Join(root, BlurayDirName, "STREAM")
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return Title{}, fmt.Errorf("error reading %s: %w", dir, err)
+	}
+
+	var (
+		bestPath string
+		bestSize int64
+	)
+
+	for _, entry := range entries {
+		if !strings.EqualFold(filepath.Ext(entry.Name()), ".m2ts") {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return Title{}, fmt.Errorf("error getting file info: %w", err)
+		}
+
+		if info.Size() > bestSize {
+			bestPath, bestSize = filepath.Join(dir, entry.Name()), info.Size()
+		}
+	}
+
+	if bestPath == "" {
+		return Title{}, errors.New("no stream found in " + BlurayDirName)
+	}
+
+	return Title{Root: root, Parts: []string{bestPath}}, nil
+}
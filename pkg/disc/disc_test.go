@@ -0,0 +1,133 @@
+package disc
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeDisc creates the files of a ripped disc structure with the given sizes in bytes.
+func writeDisc(t *testing.T, files map[string]int) string {
+	t.Helper()
+
+	root := t.TempDir()
+
+	for name, size := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("error creating the directory of %s: %v", name, err)
+		}
+
+		if err := os.WriteFile(path, []byte(strings.Repeat("x", size)), 0o600); err != nil {
+			t.Fatalf("error creating %s: %v", name, err)
+		}
+	}
+
+	return root
+}
+
+func TestGroupVOBParts(t *testing.T) {
+	names := []string{
+		"VIDEO_TS.IFO", "VIDEO_TS.VOB", "VTS_01_0.IFO", "VTS_01_0.VOB", "VTS_01_2.VOB", "VTS_01_1.VOB",
+		"vts_02_1.vob", "VTS_02_0.VOB", "VTS_01_3.VOB", "VTS_01_1.BUP",
+	}
+
+	want := map[int][]string{
+		1: {"VTS_01_1.VOB", "VTS_01_2.VOB", "VTS_01_3.VOB"},
+		2: {"vts_02_1.vob"},
+	}
+
+	if got := GroupVOBParts(names); !reflect.DeepEqual(got, want) {
+		t.Errorf("GroupVOBParts() = %v, want %v", got, want)
+	}
+}
+
+func TestTitleInput(t *testing.T) {
+	tests := []struct {
+		name  string
+		parts []string
+		want  string
+	}{
+		{"single part", []string{"/disc/VIDEO_TS/VTS_01_1.VOB"}, "/disc/VIDEO_TS/VTS_01_1.VOB"},
+		{
+			name:  "several parts",
+			parts: []string{"/disc/VIDEO_TS/VTS_01_1.VOB", "/disc/VIDEO_TS/VTS_01_2.VOB"},
+			want:  "concat:/disc/VIDEO_TS/VTS_01_1.VOB|/disc/VIDEO_TS/VTS_01_2.VOB",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (Title{Parts: tt.parts}).Input(); got != tt.want {
+				t.Errorf("Title.Input() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindTitle(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]int
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "DVD main feature",
+			files: map[string]int{
+				"VIDEO_TS/VIDEO_TS.VOB": 500, "VIDEO_TS/VTS_01_0.VOB": 400, "VIDEO_TS/VTS_01_1.VOB": 100,
+				"VIDEO_TS/VTS_02_1.VOB": 300, "VIDEO_TS/VTS_02_2.VOB": 200,
+			},
+			want: []string{"VIDEO_TS/VTS_02_1.VOB", "VIDEO_TS/VTS_02_2.VOB"},
+		},
+		{
+			name:  "Blu-ray largest stream",
+			files: map[string]int{"BDMV/STREAM/00000.m2ts": 100, "BDMV/STREAM/00001.M2TS": 300, "BDMV/index.bdmv": 900},
+			want:  []string{"BDMV/STREAM/00001.M2TS"},
+		},
+		{
+			name:    "DVD without title",
+			files:   map[string]int{"VIDEO_TS/VIDEO_TS.VOB": 500},
+			wantErr: true,
+		},
+		{
+			name:    "Blu-ray without stream",
+			files:   map[string]int{"BDMV/index.bdmv": 100},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := writeDisc(t, tt.files)
+
+			if !IsDiscRoot(root) {
+				t.Errorf("IsDiscRoot() = false, want true")
+			}
+
+			title, err := FindTitle(root)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FindTitle() error = %v, want error: %v", err, tt.wantErr)
+			}
+
+			var want []string
+			for _, part := range tt.want {
+				want = append(want, filepath.Join(root, part))
+			}
+
+			if !reflect.DeepEqual(title.Parts, want) || (err == nil && title.Root != root) {
+				t.Errorf("FindTitle() = %+v, want the parts %v of %s", title, want, root)
+			}
+		})
+	}
+}
+
+func TestIsDiscRootPlainDirectory(t *testing.T) {
+	root := writeDisc(t, map[string]int{"clip.mov": 10, "VIDEO_TS": 10})
+
+	if IsDiscRoot(root) {
+		t.Error("IsDiscRoot() = true, want false without a disc directory")
+	}
+}
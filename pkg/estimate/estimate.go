@@ -0,0 +1,46 @@
+package estimate
+
+import (
+	"slices"
+	"time"
+)
+
+// Estimate returns the wall-clock time needed to encode media of the given durations (in seconds)
+// at the given realtime factor with concurrent jobs. Jobs are scheduled longest first on the
+// least loaded worker, which is how a work queue drains in practice.
+func Estimate(durations []float64, concurrency int, realtimeFactor float64) time.Duration {
+	if len(durations) == 0 || realtimeFactor <= 0 {
+		return 0
+	}
+
+	concurrency = max(concurrency, 1)
+
+	sorted := slices.Clone(durations)
+	slices.Sort(sorted)
+	slices.Reverse(sorted)
+
+	workers := make([]float64, min(concurrency, len(sorted)))
+
+	for _, duration := range sorted {
+		least := 0
+		for i := range workers {
+			if workers[i] < workers[least] {
+				least = i
+			}
+		}
+
+		workers[least] += max(duration, 0) / realtimeFactor
+	}
+
+	return time.Duration(slices.Max(workers) * float64(time.Second))
+}
+
+// Total returns the sum of the durations in seconds.
+func Total(durations []float64) float64 {
+	total := 0.0
+	for _, duration := range durations {
+		total += max(duration, 0)
+	}
+
+	return total
+}
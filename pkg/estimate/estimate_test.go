@@ -0,0 +1,42 @@
+package estimate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEstimate(t *testing.T) {
+	tests := []struct {
+		name           string
+		durations      []float64
+		concurrency    int
+		realtimeFactor float64
+		want           time.Duration
+	}{
+		{"single job", []float64{600}, 1, 2, 5 * time.Minute},
+		{"sequential jobs", []float64{600, 300, 300}, 1, 1, 20 * time.Minute},
+		{"evenly balanced workers", []float64{600, 300, 300}, 2, 1, 10 * time.Minute},
+		{"longest job bounds the run", []float64{3600, 60, 60, 60}, 4, 1, time.Hour},
+		{"more workers than jobs", []float64{120, 60}, 8, 2, time.Minute},
+		{"slower than realtime", []float64{60}, 1, 0.5, 2 * time.Minute},
+		{"longest first on the least loaded worker", []float64{300, 500, 200, 100, 400}, 2, 1, 800 * time.Second},
+		{"no concurrency counts as one job", []float64{60, 60}, 0, 1, 2 * time.Minute},
+		{"negative durations ignored", []float64{60, -30}, 1, 1, time.Minute},
+		{"no durations", nil, 4, 1, 0},
+		{"invalid realtime factor", []float64{60}, 1, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Estimate(tt.durations, tt.concurrency, tt.realtimeFactor); got != tt.want {
+				t.Errorf("Estimate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTotal(t *testing.T) {
+	if got := Total([]float64{60, 30.5, -10}); got != 90.5 {
+		t.Errorf("Total() = %v, want 90.5", got)
+	}
+}
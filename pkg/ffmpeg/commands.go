@@ -1,75 +1,853 @@
 package ffmpeg
 
 import (
+	"fmt"
+	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 
+	"github.com/cyrilschreiber3/media-processor/pkg/config"
 	"github.com/cyrilschreiber3/media-processor/pkg/media"
 )
 
-// UseHardwareAcceleration determines if CUDA hardware acceleration should be used.
-const UseHardwareAcceleration = true
-
 // CreateProxyCommand creates an FFmpeg command for generating a proxy file.
-func CreateProxyCommand(filePath string, proxyFilePath string, props media.Properties) []string {
+// With a segment duration, proxyFilePath is the index of the segment set and the parts are written next to it.
+// The audio of extraInputs, such as the audio essences of an OP-Atom clip, is muxed with the main input.
+func CreateProxyCommand(
+	filePath string, proxyFilePath string, props media.Properties, cfg config.Config, extraInputs ...string,
+) ([]string, error) {
 	var cmd []string
 
 	cmd = append(cmd, "ffmpeg", "-y", "-hide_banner", "-loglevel", "error")
 
-	if UseHardwareAcceleration {
-		cmd = append(cmd, "-hwaccel", "cuda")
+	backend, err := HardwareBackend(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	cuda := backend == config.HWAccelCUDA
+
+	// The scale and crop filters run on the CPU, so CUDA frames are downloaded explicitly.
+	// Rotated sources are left to the automatic download, since FFmpeg rotates them before our filters.
+	// Other backends always download decoded frames automatically.
+	hwDownload := cuda && props.HasVideoStream && IsCUDADecodable(props) && props.Rotation == 0
+
+	if backend == config.HWAccelVAAPI {
+		cmd = append(cmd, "-vaapi_device", vaapiDevice)
+	}
+
+	if backend != "" {
+		cmd = append(cmd, "-hwaccel", backend)
+
+		if cuda && cfg.GPU >= 0 {
+			cmd = append(cmd, "-hwaccel_device", strconv.Itoa(cfg.GPU))
+		}
+
+		if hwDownload {
+			cmd = append(cmd, "-hwaccel_output_format", "cuda")
+		}
 	}
 
+	cmd = append(cmd, media.HeaderArgs(filePath, cfg.HTTPHeaders)...)
+	cmd = append(cmd, trimInputArgs(cfg)...)
 	cmd = append(cmd, "-i", filePath)
 
+	// Separate essences are seeked the same, to stay in sync
+	for _, input := range extraInputs {
+		cmd = append(cmd, trimInputArgs(cfg)...)
+		cmd = append(cmd, "-i", input)
+	}
+
+	// Only the first stream of each type is picked by default with several inputs,
+	// and cover art may be picked over the video. 0:V leaves attached pictures out.
+	if explicitMapping(props, extraInputs) {
+		cmd = append(cmd, "-map", "0:V?", "-map", "0:a?")
+
+		for i := range extraInputs {
+			cmd = append(cmd, "-map", strconv.Itoa(i+1)+":a?")
+		}
+	}
+
 	//nolint:nestif
 	if props.HasVideoStream {
-		if UseHardwareAcceleration {
-			cmd = append(cmd, "-c:v", "h264_nvenc")
-		} else {
-			cmd = append(cmd, "-c:v", "libx264")
+		encoder := Encoder(cfg, backend)
+
+		if pixelFormat := proxyPixelFormat(props, cfg, backend); pixelFormat != "" {
+			cmd = append(cmd, "-pix_fmt", pixelFormat)
 		}
 
-		if props.HighestBitDepth > 8 {
-			cmd = append(cmd, "-pix_fmt", "yuv420p")
+		preset := defaultPreset(encoder)
+		if cfg.PreviewSeconds > 0 {
+			preset = fastPreset(encoder)
 		}
 
-		cmd = append(cmd, "-maxrate", "7M", "-preset", "default")
+		maxRate := cfg.MaxRate
+		if maxRate == "" {
+			maxRate = config.DefaultMaxRate
+		}
 
-		if props.IsVertical {
-			cmd = append(cmd, "-vf", "scale=540:-2")
+		if cfg.EncoderArgs != "" {
+			encoderArgs, err := config.ExpandEncoderArgs(cfg.EncoderArgs, map[string]string{
+				"encoder": encoder,
+				"maxrate": maxRate,
+				"preset":  preset,
+				"quality": strconv.Itoa(cfg.Quality),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("error expanding encoder args: %w", err)
+			}
+
+			cmd = append(cmd, encoderArgs...)
 		} else {
-			cmd = append(cmd, "-vf", "scale=960:-2")
+			cmd = append(cmd, "-c:v", encoder)
+			cmd = append(cmd, rateControlArgs(encoder, maxRate, cfg.Quality)...)
+
+			if preset != "" {
+				cmd = append(cmd, "-preset", preset)
+			}
+		}
+
+		// Two-pass rate control needs an average bitrate to target
+		if UseTwoPass(props, cfg) && cfg.EncoderArgs == "" {
+			cmd = append(cmd, "-b:v", maxRate, "-bufsize", maxRate)
+		}
+
+		if cuda && cfg.GPU >= 0 {
+			cmd = append(cmd, "-gpu", strconv.Itoa(cfg.GPU))
+		}
+
+		var filters []string
+
+		if hwDownload {
+			filters = append(filters, hwDownloadFilter(props))
+		}
+
+		if props.Crop != nil {
+			filters = append(filters, props.Crop.Filter())
+		}
+
+		// Without known dimensions the proxy can't be fitted, so the video keeps its size
+		if props.Orientation != media.OrientationUnknown {
+			filters = append(filters, scaleFilter(props, cfg)+rangeArgs(props, cfg))
+		}
+
+		// Tonemapping after scaling converts fewer pixels
+		if UseTonemap(props, cfg) {
+			filters = append(filters, tonemapFilter(cfg))
+		}
+
+		// The text is drawn after scaling so its size doesn't depend on the source resolution
+		if cfg.BurnIn {
+			filters = append(filters, burnInFilters(filePath, props, cfg)...)
+		}
+
+		if backend == config.HWAccelVAAPI {
+			filters = append(filters, vaapiUploadFilter(props, cfg))
+		}
+
+		if len(filters) > 0 {
+			cmd = append(cmd, "-vf", strings.Join(filters, ","))
+		}
+
+		cmd = append(cmd, constantFrameRateArgs(props, cfg)...)
+
+		if outRange := outputColorRange(cfg); outRange != "" {
+			cmd = append(cmd, "-color_range", outRange)
+		}
+
+		if UseTonemap(props, cfg) {
+			cmd = append(cmd, "-colorspace", "bt709", "-color_primaries", "bt709", "-color_trc", "bt709")
+		}
+
+		// QuickTime players only decode HEVC tagged as hvc1
+		if cfg.ProxyCodec == config.CodecHEVC && cfg.ProxyContainer != config.ContainerMKV {
+			cmd = append(cmd, "-tag:v", "hvc1")
+		}
+	}
+
+	// Drop placeholder video streams ffmpeg would otherwise encode
+	if !props.HasVideoStream {
+		cmd = append(cmd, "-vn")
+	}
+
+	cmd = append(cmd, audioArgs(props, cfg)...)
+
+	cmd = append(cmd, subtitleArgs(props, cfg, extraInputs)...)
+
+	cmd = append(cmd, metadataArgs(props, cfg)...)
+
+	cmd = append(cmd, relinkArgs(filePath, props, cfg)...)
+
+	if cfg.PreviewSeconds > 0 {
+		cmd = append(cmd, "-t", strconv.FormatFloat(cfg.PreviewSeconds, 'f', -1, 64))
+	}
+
+	// Seeking the input resets the timestamps, so the end of the range is given as a length
+	if length := cfg.TrimLength(); length > 0 {
+		cmd = append(cmd, "-t", strconv.FormatFloat(length, 'f', -1, 64))
+	}
+
+	// Extra arguments come last so they override the built-in output options
+	if cfg.SegmentDuration > 0 {
+		segmentDir := filepath.Dir(proxyFilePath)
+
+		cmd = append(cmd, segmentArgs(segmentDir, props, cfg)...)
+		cmd = append(cmd, cfg.ExtraArgs...)
+		cmd = append(cmd, filepath.Join(segmentDir, SegmentPattern(cfg)))
+
+		return cmd, nil
+	}
+
+	if flags := movFlags(props, cfg); flags != "" {
+		cmd = append(cmd, "-movflags", flags)
+	}
+
+	cmd = append(cmd, cfg.ExtraArgs...)
+	cmd = append(cmd, proxyFilePath)
+
+	return cmd, nil
+}
+
+// AudioProxyExtension is the file extension of audio-only proxies.
+const AudioProxyExtension = ".m4a"
+
+// IsAudioOnlyProxy reports whether the proxy of a source is written as a compressed audio file.
+func IsAudioOnlyProxy(props media.Properties, cfg config.Config) bool {
+	return cfg.AudioOnlyProxies && !props.HasVideoStream && props.HasAudioStream
+}
+
+// ProxyExtension returns the file extension of the proxy of a source, including the dot.
+func ProxyExtension(props media.Properties, cfg config.Config) string {
+	if IsAudioOnlyProxy(props, cfg) {
+		return AudioProxyExtension
+	}
+
+	return cfg.ProxyExtension()
+}
+
+// CheckContainer returns an error when the proxy container can't hold the streams the proxy of a source would have.
+func CheckContainer(props media.Properties, cfg config.Config) error {
+	if cfg.ProxyContainer != config.ContainerMP4 || !props.HasAudioStream || IsAudioOnlyProxy(props, cfg) {
+		return nil
+	}
+
+	args := audioArgs(props, cfg)
+
+	for i := 1; i < len(args); i++ {
+		if args[i-1] != "-c:a" {
+			continue
+		}
+
+		codec := args[i]
+		if codec == "copy" {
+			codec = props.AudioCodec
+		}
+
+		if strings.HasPrefix(codec, "pcm_") {
+			return fmt.Errorf("mp4 proxies can't hold PCM audio, use -audio-policy %s or another -proxy-container",
+				config.AudioPolicyAlwaysAAC)
+		}
+	}
+
+	return nil
+}
+
+// trimInputArgs returns the input options seeking to the start of the range proxies are trimmed to.
+func trimInputArgs(cfg config.Config) []string {
+	if cfg.TrimStart <= 0 {
+		return nil
+	}
+
+	return []string{"-ss", strconv.FormatFloat(cfg.TrimStart, 'f', -1, 64)}
+}
+
+// UseTwoPass reports whether the proxy of a source is encoded in two passes.
+// Only libx264 is driven with -pass, hardware encoders have no such two-pass mode, and previews are meant to be quick.
+func UseTwoPass(props media.Properties, cfg config.Config) bool {
+	return cfg.TwoPass && props.HasVideoStream && cfg.PreviewSeconds <= 0 && cfg.ProxyCodec == config.CodecH264 &&
+		!UseHardwareAcceleration(cfg)
+}
+
+// muxerOptions are the output options with a value that are private to the proxy muxers,
+// which the null muxer of a first pass rejects.
+var muxerOptions = []string{
+	"-f", "-movflags", "-segment_time", "-segment_format", "-segment_list", "-segment_list_type", "-reset_timestamps",
+}
+
+// TwoPassCommands turns a proxy command into the commands of its two passes, sharing the passLogFile prefix.
+// The first pass only analyzes the video, discarding its output, so it leaves out the options of the proxy muxer.
+func TwoPassCommands(cmd []string, passLogFile string) ([]string, []string) {
+	output := len(cmd) - 1
+
+	// Output options follow the last input, the ones before it such as a forced input format are kept
+	lastInput := 0
+
+	for i, arg := range cmd[:output] {
+		if arg == "-i" {
+			lastInput = i
+		}
+	}
+
+	var firstPass []string
+
+	for i := 0; i < output; i++ {
+		if i > lastInput+1 && slices.Contains(muxerOptions, cmd[i]) && i+1 < output {
+			i++
+
+			continue
+		}
+
+		firstPass = append(firstPass, cmd[i])
+	}
+
+	firstPass = append(firstPass, "-pass", "1", "-passlogfile", passLogFile, "-an", "-sn", "-f", "null", os.DevNull)
+
+	secondPass := slices.Clone(cmd[:output])
+	secondPass = append(secondPass, "-pass", "2", "-passlogfile", passLogFile, cmd[output])
+
+	return firstPass, secondPass
+}
+
+// MultiOutputCommand merges proxy commands of the same inputs, such as the rungs of a proxy ladder,
+// into a single command writing all their outputs, so the inputs are only read and decoded once.
+// Each command has the given number of inputs, which must be the same for every command.
+func MultiOutputCommand(cmds [][]string, inputs int) []string {
+	if len(cmds) == 0 {
+		return nil
+	}
+
+	var merged []string
+
+	for i, cmd := range cmds {
+		// The output options follow the value of the last -i
+		outputStart := len(cmd)
+		seen := 0
+
+		for j := 0; j < len(cmd)-1; j++ {
+			if cmd[j] == "-i" {
+				seen++
+				if seen == inputs {
+					outputStart = j + 2
+
+					break
+				}
+			}
+		}
+
+		if i == 0 {
+			merged = append(merged, cmd[:outputStart]...)
+		}
+
+		merged = append(merged, cmd[outputStart:]...)
+	}
+
+	return merged
+}
+
+// cudaDecoders lists the codecs NVDEC decodes, so frames stay on the GPU until they are downloaded.
+var cudaDecoders = []string{"h264", "hevc", "av1", "vp8", "vp9", "mpeg1video", "mpeg2video", "mpeg4", "vc1", "mjpeg"}
+
+// IsCUDADecodable reports whether the video of a source is decoded on the GPU with -hwaccel cuda.
+// Other sources silently fall back to software decoding, whose frames can't go through hwdownload.
+func IsCUDADecodable(props media.Properties) bool {
+	if !slices.Contains(cudaDecoders, props.VideoCodec) {
+		return false
+	}
+
+	// NVDEC only decodes 4:2:0 content on most GPUs
+	return strings.Contains(props.PixelFormat, "420") || strings.HasPrefix(props.PixelFormat, "nv12") ||
+		strings.HasPrefix(props.PixelFormat, "p010")
+}
+
+// constantFrameRateArgs returns the arguments encoding the proxy of a variable frame rate source at a constant
+// frame rate, which some NLEs need to keep it in sync. It returns nil for constant frame rate sources,
+// and when no frame rate is configured and the average one of the source is unknown.
+func constantFrameRateArgs(props media.Properties, cfg config.Config) []string {
+	if !props.VariableFrameRate {
+		return nil
+	}
+
+	frameRate := cfg.CFRFrameRate
+	if frameRate == "" {
+		if _, ok := media.ParseFrameRate(props.FrameRate); !ok {
+			return nil
+		}
+
+		frameRate = props.FrameRate
+	}
+
+	return []string{"-vsync", "cfr", "-r", frameRate}
+}
+
+// hwDownloadFilter returns the filter moving decoded CUDA frames to system memory for the CPU filters.
+func hwDownloadFilter(props media.Properties) string {
+	if props.HighestBitDepth > 8 {
+		return "hwdownload,format=p010le"
+	}
+
+	return "hwdownload,format=nv12"
+}
+
+// vaapiUploadFilter returns the filter moving the filtered frames to the VAAPI device in the proxy pixel format.
+func vaapiUploadFilter(props media.Properties, cfg config.Config) string {
+	if props.HighestBitDepth > 8 && cfg.ProxyCodec != config.CodecH264 {
+		return "format=p010,hwupload"
+	}
+
+	return "format=nv12,hwupload"
+}
+
+// proxyPixelFormat returns the pixel format forced on the proxy, or "" to keep the source format.
+// H.264 proxies are always 8-bit for compatibility, while HEVC and AV1 keep high bit depths in 10-bit.
+// Tonemapped proxies are SDR, so they are 8-bit too.
+// VAAPI frames get their format from the upload filter instead.
+func proxyPixelFormat(props media.Properties, cfg config.Config, backend string) string {
+	switch {
+	case props.HighestBitDepth <= 8 || backend == config.HWAccelVAAPI:
+		return ""
+	case cfg.ProxyCodec == config.CodecH264 || UseTonemap(props, cfg):
+		return "yuv420p"
+	case backend != "":
+		return "p010le"
+	default:
+		return "yuv420p10le"
+	}
+}
+
+// rateControlArgs returns the arguments capping the bitrate of an encoder at maxRate,
+// or encoding at a constant quality when quality is set. The quality is passed as -crf to the software
+// encoders, -cq to NVENC, -global_quality to QSV, -qp to VAAPI and -q:v to VideoToolbox.
+func rateControlArgs(encoder string, maxRate string, quality int) []string {
+	if quality <= 0 {
+		return []string{"-maxrate", maxRate}
+	}
+
+	level := strconv.Itoa(quality)
+
+	switch encoder {
+	case "h264_nvenc", "hevc_nvenc", "av1_nvenc":
+		// A zero target bitrate lets the quality alone drive the encoder
+		return []string{"-rc", "vbr", "-cq", level, "-b:v", "0"}
+	case "h264_qsv", "hevc_qsv", "av1_qsv":
+		return []string{"-global_quality", level}
+	case "h264_vaapi", "hevc_vaapi", "av1_vaapi":
+		return []string{"-rc_mode", "CQP", "-qp", level}
+	case "h264_videotoolbox", "hevc_videotoolbox":
+		// VideoToolbox ranks quality from 1 to 100 the other way round
+		return []string{"-q:v", strconv.Itoa(max(100-2*quality, 1))}
+	default:
+		return []string{"-crf", level}
+	}
+}
+
+// defaultPreset returns the preset an encoder is run with by default, or "" for encoders without presets.
+func defaultPreset(encoder string) string {
+	switch encoder {
+	case "libx265", "h264_qsv", "hevc_qsv", "av1_qsv":
+		return "medium"
+	case "h264_videotoolbox", "hevc_videotoolbox", "h264_vaapi", "hevc_vaapi", "av1_vaapi":
+		return ""
+	case "libsvtav1":
+		return "8"
+	default:
+		return "default"
+	}
+}
+
+// fastPreset returns the fastest preset of an encoder, used for previews.
+func fastPreset(encoder string) string {
+	switch encoder {
+	case "h264_nvenc", "hevc_nvenc", "av1_nvenc":
+		return "p1"
+	case "h264_qsv", "hevc_qsv", "av1_qsv":
+		return "veryfast"
+	case "h264_videotoolbox", "hevc_videotoolbox", "h264_vaapi", "hevc_vaapi", "av1_vaapi":
+		return ""
+	case "libsvtav1":
+		return "12"
+	default:
+		return "ultrafast"
+	}
+}
+
+// audioArgs returns the audio codec arguments implementing the configured audio policy.
+func audioArgs(props media.Properties, cfg config.Config) []string {
+	if cfg.AudioPolicy == config.AudioPolicyDrop {
+		return []string{"-an"}
+	}
+
+	if !props.HasAudioStream {
+		return nil
+	}
+
+	args := audioCodecArgs(props, cfg)
+
+	if cfg.Loudnorm {
+		args = loudnormArgs(args, cfg)
+	}
+
+	if formatArgs := audioFormatArgs(props, cfg); len(formatArgs) > 0 {
+		args = append(transcodeCopiedAudio(args, cfg), formatArgs...)
+	}
+
+	return args
+}
+
+// audioFormatArgs returns the arguments downmixing the proxy audio to stereo and resampling it, as configured.
+// Mono and stereo sources keep their channels, and audio already at the configured rate isn't resampled.
+func audioFormatArgs(props media.Properties, cfg config.Config) []string {
+	var args []string
+
+	if cfg.DownmixStereo && props.AudioChannels > 2 {
+		args = append(args, "-ac", "2")
+	}
+
+	// Loudnorm resamples the audio whatever its source rate
+	if cfg.AudioSampleRate > 0 && (props.AudioSampleRate != cfg.AudioSampleRate || cfg.Loudnorm) {
+		args = append(args, "-ar", strconv.Itoa(cfg.AudioSampleRate))
+	}
+
+	return args
+}
+
+// transcodeCopiedAudio replaces a copied audio codec in the codec arguments, since filtered audio can't be copied.
+// Copied streams are encoded to PCM like unsupported formats, or to AAC in MP4 proxies which can't hold PCM.
+func transcodeCopiedAudio(codecArgs []string, cfg config.Config) []string {
+	args := slices.Clone(codecArgs)
+
+	if i := slices.Index(args, "copy"); i > 0 && args[i-1] == "-c:a" {
+		args[i] = "pcm_s16le"
+		if cfg.ProxyContainer == config.ContainerMP4 {
+			args[i] = "aac"
 		}
 	}
 
-	if props.HasAudioStream {
+	return args
+}
+
+// audioCodecArgs returns the audio codec of the proxy of a source with audio.
+func audioCodecArgs(props media.Properties, cfg config.Config) []string {
+	// Audio editors only need a lightweight preview
+	if IsAudioOnlyProxy(props, cfg) {
+		return []string{"-c:a", "aac", "-b:a", "128k"}
+	}
+
+	switch cfg.AudioPolicy {
+	case config.AudioPolicyAlwaysAAC:
+		return []string{"-c:a", "aac"}
+	case config.AudioPolicyAlwaysPCM:
+		return []string{"-c:a", "pcm_s16le"}
+	default:
 		if props.UnsupportedAudioFormat {
-			cmd = append(cmd, "-c:a", "pcm_s16le")
+			return []string{"-c:a", "pcm_s16le"}
 		}
+
+		return []string{"-c:a", "copy"}
 	}
+}
 
-	cmd = append(cmd, proxyFilePath)
+// loudnormArgs adds the EBU R128 loudness normalization filter to the audio codec arguments.
+func loudnormArgs(codecArgs []string, cfg config.Config) []string {
+	args := transcodeCopiedAudio(codecArgs, cfg)
 
-	return cmd
+	filter := "loudnorm=I=" + strconv.FormatFloat(cfg.LoudnessTarget, 'f', -1, 64) + ":TP=-1.5:LRA=11"
+	args = append(args, "-af", filter)
+
+	// loudnorm resamples to 192 kHz, so restore a common rate unless another one is configured
+	if cfg.AudioSampleRate == 0 {
+		args = append(args, "-ar", "48000")
+	}
+
+	return args
+}
+
+// explicitMapping reports whether the streams of the proxy are mapped explicitly instead of relying
+// on the default stream selection of FFmpeg.
+func explicitMapping(props media.Properties, extraInputs []string) bool {
+	return len(extraInputs) > 0 || props.HasAttachedPicture
+}
+
+// subtitleArgs returns the arguments carrying the text subtitles of the source into the proxy,
+// as mov_text in QuickTime containers and SRT in Matroska. Bitmap subtitles can't be converted and are dropped.
+func subtitleArgs(props media.Properties, cfg config.Config, extraInputs []string) []string {
+	if !props.HasSubtitleStream {
+		return nil
+	}
+
+	if len(props.TextSubtitleStreams) == 0 {
+		return []string{"-sn"}
+	}
+
+	var args []string
+
+	if explicitMapping(props, extraInputs) {
+		for _, index := range props.TextSubtitleStreams {
+			args = append(args, "-map", "0:"+strconv.Itoa(index))
+		}
+	}
+
+	if cfg.ProxyContainer == config.ContainerMKV {
+		return append(args, "-c:s", "srt")
+	}
+
+	return append(args, "-c:s", "mov_text")
+}
+
+// metadataArgs returns the arguments copying the global and video stream metadata of the source into the proxy,
+// or dropping all of it with StripMetadata. Audio and subtitle streams keep their metadata by default.
+func metadataArgs(props media.Properties, cfg config.Config) []string {
+	if cfg.StripMetadata {
+		return []string{"-map_metadata", "-1"}
+	}
+
+	args := []string{"-map_metadata", "0"}
+
+	if props.HasVideoStream {
+		args = append(args, "-map_metadata:s:v", "0:s:v")
+	}
+
+	// The creation date may only be set on the video stream of the source, so it is set on the proxy explicitly
+	if props.CreationTime != "" {
+		args = append(args, "-metadata", "creation_time="+props.CreationTime)
+	}
+
+	return args
+}
+
+// movFlags returns the flags of the mov, mp4 and m4a muxers, or "" for other containers.
+func movFlags(props media.Properties, cfg config.Config) string {
+	audioOnly := IsAudioOnlyProxy(props, cfg)
+	if cfg.ProxyContainer == config.ContainerMKV && !audioOnly {
+		return ""
+	}
+
+	var flags string
+
+	// Move the index to the start of the file so the proxy plays before it is fully read
+	if cfg.ProxyContainer == config.ContainerMP4 || audioOnly {
+		flags += "+faststart"
+	}
+
+	// These muxers drop the tags they don't know, such as GPS positions or lens info, unless told otherwise
+	if !cfg.StripMetadata {
+		flags += "+use_metadata_tags"
+	}
+
+	return flags
+}
+
+// relinkArgs returns the metadata arguments letting an NLE attach the proxy to its original.
+// Resolve matches proxies on reel name and timecode, Premiere on clip name and timecode.
+func relinkArgs(filePath string, props media.Properties, cfg config.Config) []string {
+	if cfg.NLERelink == "" {
+		return nil
+	}
+
+	var args []string
+
+	fileName := filepath.Base(filePath)
+
+	switch cfg.NLERelink {
+	case config.NLEResolve:
+		if props.HasVideoStream {
+			args = append(args, "-metadata:s:v:0", "reel_name="+strings.TrimSuffix(fileName, filepath.Ext(fileName)))
+		}
+	case config.NLEPremiere:
+		args = append(args, "-metadata", "title="+fileName)
+	}
+
+	if props.Timecode != "" && props.HasVideoStream {
+		args = append(args, "-timecode", props.Timecode)
+	}
+
+	return args
+}
+
+// scaleFilter returns the scale filter fitting the proxy to the configured long edge, keeping the aspect ratio.
+// Encoders such as NVENC reject 4:2:0 video of odd dimensions, so the fixed edge is rounded down to an even size
+// and the other one is computed as an even size explicitly.
+func scaleFilter(props media.Properties, cfg config.Config) string {
+	vertical := props.Orientation == media.OrientationVertical
+
+	if cfg.ProxyWidth <= 0 {
+		if vertical {
+			return "scale=540:" + evenHeight
+		}
+
+		return "scale=960:" + evenHeight
+	}
+
+	edge := strconv.Itoa(cfg.ProxyWidth &^ 1)
+	if vertical {
+		return "scale=" + evenWidth + ":" + edge
+	}
+
+	return "scale=" + edge + ":" + evenHeight
 }
 
-// CreateConvertedOriginalCommand creates an FFmpeg command for converting original file.
-func CreateConvertedOriginalCommand(filePath string) []string {
+// Sizes keeping the aspect ratio of the input for the other edge of the scale filter, rounded down to even values.
+const (
+	evenWidth  = "trunc(oh*a/2)*2"
+	evenHeight = "trunc(ow/a/2)*2"
+)
+
+// outputColorRange returns the color range the proxy should be encoded with.
+func outputColorRange(cfg config.Config) string {
+	if cfg.ColorRange == config.ColorRangeAuto {
+		return config.ColorRangeTV
+	}
+
+	return cfg.ColorRange
+}
+
+// rangeArgs returns the scale filter options converting the source range to the proxy range.
+func rangeArgs(props media.Properties, cfg config.Config) string {
+	var args string
+
+	if props.ColorRange == config.ColorRangeTV || props.ColorRange == config.ColorRangePC {
+		args += ":in_range=" + props.ColorRange
+	}
+
+	if outRange := outputColorRange(cfg); outRange != "" {
+		args += ":out_range=" + outRange
+	}
+
+	return args
+}
+
+// FormatCommand formats a command for logging, redacting HTTP header values.
+// Arguments are quoted like in a POSIX shell, so paths with spaces or special characters can be copied as is.
+func FormatCommand(cmd []string) string {
+	formatted := make([]string, len(cmd))
+
+	for i, arg := range cmd {
+		if i > 0 && cmd[i-1] == "-headers" {
+			arg = media.RedactHeaders(arg)
+		}
+
+		formatted[i] = quoteArg(arg)
+	}
+
+	return strings.Join(formatted, " ")
+}
+
+// quoteArg single-quotes a command argument unless it only contains characters a shell leaves alone.
+func quoteArg(arg string) string {
+	safe := func(r rune) bool {
+		return r < 0x80 && (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+			strings.ContainsRune("-_./:=,+%@", r))
+	}
+
+	if arg != "" && !strings.ContainsFunc(arg, func(r rune) bool { return !safe(r) }) {
+		return arg
+	}
+
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// CreateConvertedOriginalCommand creates an FFmpeg command for converting the audio of an original file
+// to audioCodec, copying its video. The original was moved to the originalsDir folder next to it.
+func CreateConvertedOriginalCommand(filePath string, originalsDir string, audioCodec string) []string {
 	var cmd []string
 
 	fileName := filepath.Base(filePath)
 	parentDir := filepath.Dir(filePath)
-	inputFilePath := filepath.Join(parentDir, "Originals", fileName)
+	inputFilePath := filepath.Join(parentDir, originalsDir, fileName)
 
 	cmd = append(cmd, "ffmpeg", "-y", "-hide_banner", "-loglevel", "error")
-	cmd = append(cmd, "-i", inputFilePath, "-c:v", "copy", "-c:a", "pcm_s16le", filePath)
+	cmd = append(cmd, "-i", inputFilePath, "-c:v", "copy", "-c:a", audioCodec, filePath)
 
 	return cmd
 }
 
+// HardwareAccelerations returns the hardware acceleration methods supported by the installed FFmpeg.
+func HardwareAccelerations() ([]string, error) {
+	output, err := execCommand("ffmpeg", "-hide_banner", "-hwaccels").Output()
+	if err != nil {
+		return nil, fmt.Errorf("error executing ffmpeg: %w", err)
+	}
+
+	return ParseHardwareAccelerations(string(output)), nil
+}
+
+// ParseHardwareAccelerations parses the output of ffmpeg -hwaccels.
+func ParseHardwareAccelerations(output string) []string {
+	var methods []string
+
+	_, list, _ := strings.Cut(output, "Hardware acceleration methods:")
+	for _, line := range strings.Split(list, "\n") {
+		if method := strings.TrimSpace(line); method != "" {
+			methods = append(methods, method)
+		}
+	}
+
+	return methods
+}
+
 // IsFFmpegInstalled checks if FFmpeg is installed on the system.
 func IsFFmpegInstalled() bool {
 	_, err := exec.LookPath("ffmpeg")
 	return err == nil //nolint:nlreturn
 }
+
+// CreateRemuxCommand creates an FFmpeg command remuxing a file read as inputFormat without re-encoding.
+// MP4 outputs get a regular index at the start of the file.
+func CreateRemuxCommand(filePath string, inputFormat string, outputPath string) []string {
+	var cmd []string
+
+	cmd = append(cmd, "ffmpeg", "-y", "-hide_banner", "-loglevel", "error")
+	cmd = append(cmd, "-f", inputFormat, "-i", filePath, "-map", "0", "-c", "copy")
+
+	if strings.EqualFold(filepath.Ext(outputPath), ".mp4") {
+		cmd = append(cmd, "-movflags", "+faststart")
+	}
+
+	cmd = append(cmd, outputPath)
+
+	return cmd
+}
+
+const (
+	// SegmentListName is the CSV index listing the segments of a proxy with their start and end times.
+	SegmentListName = "index.csv"
+	// PartialSegmentListName is the name of the segment list while FFmpeg is still writing segments.
+	PartialSegmentListName = SegmentListName + ".partial"
+	// SegmentGlob matches the segments of a proxy in any container.
+	SegmentGlob = "part_*"
+)
+
+// SegmentPattern returns the name pattern of the segments of a proxy.
+func SegmentPattern(cfg config.Config) string {
+	return "part_%03d" + cfg.ProxyExtension()
+}
+
+// segmentArgs returns the segment muxer arguments splitting the proxy into parts of the configured duration.
+// Key frames are forced at every boundary so the parts are cut exactly and each of them can be played alone.
+// The list is written next to the segments under a temporary name until the proxy is complete.
+func segmentArgs(segmentDir string, props media.Properties, cfg config.Config) []string {
+	seconds := strconv.FormatFloat(cfg.SegmentDuration.Seconds(), 'f', -1, 64)
+
+	var args []string
+
+	if props.HasVideoStream {
+		args = append(args, "-force_key_frames", "expr:gte(t,n_forced*"+seconds+")")
+	}
+
+	args = append(args, "-f", "segment", "-segment_time", seconds, "-segment_format", segmentFormat(cfg),
+		"-reset_timestamps", "1",
+		"-segment_list", filepath.Join(segmentDir, PartialSegmentListName), "-segment_list_type", "csv")
+
+	return args
+}
+
+// segmentFormat returns the muxer writing the segments in the proxy container.
+func segmentFormat(cfg config.Config) string {
+	if cfg.ProxyContainer == config.ContainerMKV {
+		return "matroska"
+	}
+
+	return cfg.ProxyContainer
+}
@@ -0,0 +1,890 @@
+package ffmpeg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/config"
+	"github.com/cyrilschreiber3/media-processor/pkg/disc"
+	"github.com/cyrilschreiber3/media-processor/pkg/internal/fakeexec"
+	"github.com/cyrilschreiber3/media-processor/pkg/media"
+)
+
+// softwareConfig returns the default configuration with software encoding, which never runs FFmpeg to detect
+// hardware encoders.
+func softwareConfig() config.Config {
+	cfg := config.Default()
+	cfg.HWAccel = config.HWAccelNone
+
+	return cfg
+}
+
+// argValue returns the value following the last occurrence of an option in a command.
+func argValue(cmd []string, option string) (string, bool) {
+	for i := len(cmd) - 2; i >= 0; i-- {
+		if cmd[i] == option {
+			return cmd[i+1], true
+		}
+	}
+
+	return "", false
+}
+
+// containsArgs reports whether a command contains the given consecutive arguments.
+func containsArgs(cmd []string, args ...string) bool {
+	for i := range len(cmd) - len(args) + 1 {
+		if slices.Equal(cmd[i:i+len(args)], args) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// proxyCommand creates a proxy command, failing the test on error.
+func proxyCommand(
+	t *testing.T, filePath string, proxyFilePath string, props media.Properties, cfg config.Config, extraInputs ...string,
+) []string {
+	t.Helper()
+
+	cmd, err := CreateProxyCommand(filePath, proxyFilePath, props, cfg, extraInputs...)
+	if err != nil {
+		t.Fatalf("CreateProxyCommand() error = %v", err)
+	}
+
+	if len(cmd) == 0 {
+		t.Fatal("CreateProxyCommand() returned no command")
+	}
+
+	return cmd
+}
+
+func TestCreateProxyCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		props   media.Properties
+		want    map[string]string
+		without []string
+	}{
+		{
+			name: "video only",
+			props: media.Properties{
+				HasVideoStream: true, Orientation: media.OrientationHorizontal, Width: 1920, Height: 1080,
+				HighestBitDepth: 8, VideoCodec: "h264", PixelFormat: "yuv420p",
+			},
+			want:    map[string]string{"-c:v": "libx264", "-vf": "scale=960:trunc(ow/a/2)*2:out_range=tv"},
+			without: []string{"-c:a", "-vn", "-pix_fmt"},
+		},
+		{
+			name:    "audio only",
+			props:   media.Properties{HasAudioStream: true, AudioCodec: "aac"},
+			want:    map[string]string{"-c:a": "copy"},
+			without: []string{"-c:v", "-vf", "-pix_fmt"},
+		},
+		{
+			name: "vertical",
+			props: media.Properties{
+				HasVideoStream: true, HasAudioStream: true, Orientation: media.OrientationVertical,
+				Width: 1080, Height: 1920, HighestBitDepth: 8, VideoCodec: "hevc", AudioCodec: "aac",
+				PixelFormat: "yuv420p",
+			},
+			want:    map[string]string{"-vf": "scale=540:trunc(ow/a/2)*2:out_range=tv", "-c:a": "copy"},
+			without: []string{"-vn"},
+		},
+		{
+			name: "high bit depth",
+			props: media.Properties{
+				HasVideoStream: true, HasAudioStream: true, Orientation: media.OrientationHorizontal,
+				Width: 3840, Height: 2160, HighestBitDepth: 10, VideoCodec: "prores", AudioCodec: "pcm_s24le",
+				PixelFormat: "yuv422p10le",
+			},
+			want:    map[string]string{"-pix_fmt": "yuv420p", "-c:v": "libx264", "-c:a": "copy"},
+			without: []string{"-vn"},
+		},
+		{
+			name: "unsupported audio",
+			props: media.Properties{
+				HasVideoStream: true, HasAudioStream: true, Orientation: media.OrientationHorizontal,
+				Width: 1920, Height: 1080, HighestBitDepth: 8, VideoCodec: "h264", AudioCodec: "alac",
+				UnsupportedAudioFormat: true, PixelFormat: "yuv420p",
+			},
+			want: map[string]string{"-c:a": "pcm_s16le"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := proxyCommand(t, "in.mov", "out.mov", tt.props, softwareConfig())
+
+			if input, _ := argValue(cmd, "-i"); input != "in.mov" || cmd[len(cmd)-1] != "out.mov" {
+				t.Errorf("CreateProxyCommand() = %v, want in.mov encoded to out.mov", cmd)
+			}
+
+			if tt.props.HasVideoStream == slices.Contains(cmd, "-vn") {
+				t.Errorf("CreateProxyCommand() = %v, want -vn only without video", cmd)
+			}
+
+			for option, want := range tt.want {
+				if got, ok := argValue(cmd, option); !ok || got != want {
+					t.Errorf("CreateProxyCommand() %s = %q, want %q", option, got, want)
+				}
+			}
+
+			for _, option := range tt.without {
+				if slices.Contains(cmd, option) {
+					t.Errorf("CreateProxyCommand() = %v, want no %s", cmd, option)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateProxyCommandAudioPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      string
+		unsupported bool
+		want        string
+	}{
+		{"copy if supported", config.AudioPolicyCopyIfSupported, false, "copy"},
+		{"copy if supported with unsupported audio", config.AudioPolicyCopyIfSupported, true, "pcm_s16le"},
+		{"always aac", config.AudioPolicyAlwaysAAC, false, "aac"},
+		{"always aac with unsupported audio", config.AudioPolicyAlwaysAAC, true, "aac"},
+		{"always pcm", config.AudioPolicyAlwaysPCM, false, "pcm_s16le"},
+		{"drop", config.AudioPolicyDrop, false, ""},
+		{"drop with unsupported audio", config.AudioPolicyDrop, true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := softwareConfig()
+			cfg.AudioPolicy = tt.policy
+
+			props := media.Properties{
+				HasVideoStream: true, HasAudioStream: true, Orientation: media.OrientationHorizontal,
+				Width: 1920, Height: 1080, HighestBitDepth: 8, VideoCodec: "h264", AudioCodec: "aac",
+				UnsupportedAudioFormat: tt.unsupported, PixelFormat: "yuv420p",
+			}
+
+			cmd := proxyCommand(t, "in.mov", "out.mov", props, cfg)
+
+			codec, ok := argValue(cmd, "-c:a")
+			if codec != tt.want || ok == (tt.want == "") {
+				t.Errorf("CreateProxyCommand() -c:a = %q, want %q", codec, tt.want)
+			}
+
+			if dropped := slices.Contains(cmd, "-an"); dropped != (tt.policy == config.AudioPolicyDrop) {
+				t.Errorf("CreateProxyCommand() = %v, want -an only when dropping the audio", cmd)
+			}
+		})
+	}
+}
+
+func TestCreateProxyCommandTrim(t *testing.T) {
+	cfg := softwareConfig()
+	cfg.TrimStart = 60
+	cfg.TrimEnd = 90
+
+	props := media.Properties{HasAudioStream: true, AudioCodec: "aac"}
+	cmd := proxyCommand(t, "in.wav", "out.mov", props, cfg)
+
+	seek := slices.Index(cmd, "-ss")
+	if seek < 0 || seek > slices.Index(cmd, "-i") || cmd[seek+1] != "60" {
+		t.Errorf("CreateProxyCommand() = %v, want the input seeked to 60", cmd)
+	}
+
+	if length, _ := argValue(cmd, "-t"); length != "30" {
+		t.Errorf("CreateProxyCommand() -t = %q, want 30", length)
+	}
+}
+
+func TestCreateProxyCommandHTTPHeaders(t *testing.T) {
+	cfg := softwareConfig()
+	cfg.HTTPHeaders = []string{"Authorization: Bearer s3cr3t"}
+
+	props := media.Properties{HasAudioStream: true, AudioCodec: "aac"}
+	url := "https://media.example.com/voice.m4a"
+
+	cmd := proxyCommand(t, url, "/proxies/voice.m4a", props, cfg)
+
+	headers := slices.Index(cmd, "-headers")
+	if headers < 0 || headers > slices.Index(cmd, "-i") || cmd[headers+1] != "Authorization: Bearer s3cr3t\r\n" {
+		t.Errorf("CreateProxyCommand() = %v, want the headers before the input", cmd)
+	}
+
+	formatted := FormatCommand(cmd)
+	if strings.Contains(formatted, "s3cr3t") || !strings.Contains(formatted, "Authorization: <redacted>") {
+		t.Errorf("FormatCommand() = %q, want the header value redacted", formatted)
+	}
+
+	// Local sources never get the headers
+	if cmd := proxyCommand(t, "/footage/voice.m4a", "/proxies/voice.m4a", props, cfg); slices.Contains(cmd, "-headers") {
+		t.Errorf("CreateProxyCommand() = %v, want no headers for a local source", cmd)
+	}
+}
+
+func TestCreateProxyCommandDiscTitle(t *testing.T) {
+	title := disc.Title{Root: "/discs/MOVIE", Parts: []string{
+		"/discs/MOVIE/VIDEO_TS/VTS_01_1.VOB", "/discs/MOVIE/VIDEO_TS/VTS_01_2.VOB",
+	}}
+
+	props := media.Properties{
+		HasVideoStream: true, HasAudioStream: true, Orientation: media.OrientationHorizontal,
+		Width: 720, Height: 576, HighestBitDepth: 8, VideoCodec: "mpeg2video", AudioCodec: "ac3", PixelFormat: "yuv420p",
+	}
+
+	cmd := proxyCommand(t, title.Input(), "/discs/Proxy/MOVIE.mov", props, softwareConfig())
+
+	want := "concat:/discs/MOVIE/VIDEO_TS/VTS_01_1.VOB|/discs/MOVIE/VIDEO_TS/VTS_01_2.VOB"
+	if input, _ := argValue(cmd, "-i"); input != want {
+		t.Errorf("CreateProxyCommand() -i = %q, want %q", input, want)
+	}
+
+	if slices.Contains(cmd, "-headers") {
+		t.Errorf("CreateProxyCommand() = %v, want no HTTP headers for a disc", cmd)
+	}
+}
+
+func TestCreateProxyCommandNLERelink(t *testing.T) {
+	tests := []struct {
+		name     string
+		nle      string
+		timecode string
+		want     [][]string
+		without  []string
+	}{
+		{
+			name: "resolve",
+			nle:  config.NLEResolve,
+			want: [][]string{{"-metadata:s:v:0", "reel_name=A001_C002"}},
+		},
+		{
+			name:    "premiere",
+			nle:     config.NLEPremiere,
+			want:    [][]string{{"-metadata", "title=A001_C002.MOV"}},
+			without: []string{"-metadata:s:v:0"},
+		},
+		{
+			name:     "with timecode",
+			nle:      config.NLEResolve,
+			timecode: "01:00:00:00",
+			want:     [][]string{{"-metadata:s:v:0", "reel_name=A001_C002"}, {"-timecode", "01:00:00:00"}},
+		},
+		{
+			name:     "none",
+			timecode: "01:00:00:00",
+			without:  []string{"-metadata", "-metadata:s:v:0", "-timecode"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := softwareConfig()
+			cfg.NLERelink = tt.nle
+
+			props := media.Properties{
+				HasVideoStream: true, Orientation: media.OrientationHorizontal, Width: 1920, Height: 1080,
+				HighestBitDepth: 8, VideoCodec: "h264", PixelFormat: "yuv420p", Timecode: tt.timecode,
+			}
+
+			cmd := proxyCommand(t, "/footage/A001_C002.MOV", "/footage/Proxy/A001_C002.mov", props, cfg)
+
+			for _, args := range tt.want {
+				if !containsArgs(cmd, args...) {
+					t.Errorf("CreateProxyCommand() = %v, want %v", cmd, args)
+				}
+			}
+
+			for _, option := range tt.without {
+				if slices.Contains(cmd, option) {
+					t.Errorf("CreateProxyCommand() = %v, want no %s", cmd, option)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateProxyCommandPreview(t *testing.T) {
+	cfg := softwareConfig()
+	cfg.PreviewSeconds = 30
+	cfg.TwoPass = true
+
+	props := media.Properties{
+		HasVideoStream: true, HasAudioStream: true, Orientation: media.OrientationHorizontal,
+		Width: 1920, Height: 1080, HighestBitDepth: 8, VideoCodec: "h264", AudioCodec: "aac", PixelFormat: "yuv420p",
+	}
+
+	cmd := proxyCommand(t, "in.mov", "out_preview.mov", props, cfg)
+
+	if length, _ := argValue(cmd, "-t"); length != "30" {
+		t.Errorf("CreateProxyCommand() -t = %q, want 30", length)
+	}
+
+	if preset, _ := argValue(cmd, "-preset"); preset != "ultrafast" {
+		t.Errorf("CreateProxyCommand() -preset = %q, want ultrafast", preset)
+	}
+
+	// Previews are quick glances, never worth a second pass
+	if UseTwoPass(props, cfg) {
+		t.Error("UseTwoPass() = true, want false for previews")
+	}
+}
+
+func TestCreateProxyCommandMetadata(t *testing.T) {
+	tests := []struct {
+		name          string
+		container     string
+		strip         bool
+		creationTime  string
+		wantArgs      [][]string
+		wantMovFlags  string
+		withoutOption []string
+	}{
+		{
+			name: "copied", container: config.ContainerMOV, creationTime: "2024-05-01T10:00:00.000000Z",
+			wantArgs: [][]string{
+				{"-map_metadata", "0"}, {"-map_metadata:s:v", "0:s:v"},
+				{"-metadata", "creation_time=2024-05-01T10:00:00.000000Z"},
+			},
+			wantMovFlags: "+use_metadata_tags",
+		},
+		{
+			name: "mp4", container: config.ContainerMP4,
+			wantArgs:      [][]string{{"-map_metadata", "0"}},
+			wantMovFlags:  "+faststart+use_metadata_tags",
+			withoutOption: []string{"-metadata"},
+		},
+		{
+			name: "mkv", container: config.ContainerMKV,
+			wantArgs:      [][]string{{"-map_metadata", "0"}},
+			withoutOption: []string{"-movflags"},
+		},
+		{
+			name: "stripped", container: config.ContainerMOV, strip: true, creationTime: "2024-05-01T10:00:00.000000Z",
+			wantArgs:      [][]string{{"-map_metadata", "-1"}},
+			withoutOption: []string{"-map_metadata:s:v", "-metadata", "-movflags"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := softwareConfig()
+			cfg.ProxyContainer = tt.container
+			cfg.StripMetadata = tt.strip
+
+			props := media.Properties{
+				HasVideoStream: true, Orientation: media.OrientationHorizontal, Width: 1920, Height: 1080,
+				HighestBitDepth: 8, VideoCodec: "h264", PixelFormat: "yuv420p", CreationTime: tt.creationTime,
+			}
+
+			cmd := proxyCommand(t, "in.mov", "out."+tt.container, props, cfg)
+
+			for _, args := range tt.wantArgs {
+				if !containsArgs(cmd, args...) {
+					t.Errorf("CreateProxyCommand() = %v, want %v", cmd, args)
+				}
+			}
+
+			if tt.wantMovFlags != "" {
+				if flags, _ := argValue(cmd, "-movflags"); flags != tt.wantMovFlags {
+					t.Errorf("CreateProxyCommand() -movflags = %q, want %q", flags, tt.wantMovFlags)
+				}
+			}
+
+			for _, option := range tt.withoutOption {
+				if slices.Contains(cmd, option) {
+					t.Errorf("CreateProxyCommand() = %v, want no %s", cmd, option)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateProxyCommandEvenDimensions(t *testing.T) {
+	tests := []struct {
+		name        string
+		width       int
+		height      int
+		orientation media.Orientation
+		proxyWidth  int
+		want        string
+	}{
+		{"default long edge", 1080, 607, media.OrientationHorizontal, 0, "scale=960:trunc(ow/a/2)*2"},
+		{"default vertical", 607, 1080, media.OrientationVertical, 0, "scale=540:trunc(ow/a/2)*2"},
+		{"odd long edge", 1080, 607, media.OrientationHorizontal, 721, "scale=720:trunc(ow/a/2)*2"},
+		{"odd vertical long edge", 607, 1080, media.OrientationVertical, 721, "scale=trunc(oh*a/2)*2:720"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := softwareConfig()
+			cfg.ProxyWidth = tt.proxyWidth
+
+			props := media.Properties{
+				HasVideoStream: true, Orientation: tt.orientation, Width: tt.width, Height: tt.height,
+				HighestBitDepth: 8, VideoCodec: "h264", PixelFormat: "yuv420p",
+			}
+
+			cmd := proxyCommand(t, "in.mov", "out.mov", props, cfg)
+
+			// 1080x607 scaled to 960 wide is 539.6 high, which is rounded down to an even 538
+			if filters, _ := argValue(cmd, "-vf"); !strings.HasPrefix(filters, tt.want+":") {
+				t.Errorf("CreateProxyCommand() -vf = %q, want it to start with %s", filters, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateProxyCommandColorRange(t *testing.T) {
+	tests := []struct {
+		name        string
+		sourceRange string
+		colorRange  string
+		wantFilter  string
+		wantRange   string
+	}{
+		{"full range source", "pc", config.ColorRangeAuto, "in_range=pc:out_range=tv", "tv"},
+		{"limited range source", "tv", config.ColorRangeAuto, "in_range=tv:out_range=tv", "tv"},
+		{"unspecified source", "", config.ColorRangeAuto, "scale=960:trunc(ow/a/2)*2:out_range=tv", "tv"},
+		{"forced full range", "tv", config.ColorRangePC, "in_range=tv:out_range=pc", "pc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := softwareConfig()
+			cfg.ColorRange = tt.colorRange
+
+			props := media.Properties{
+				HasVideoStream: true, Orientation: media.OrientationHorizontal, Width: 1920, Height: 1080,
+				HighestBitDepth: 8, VideoCodec: "h264", PixelFormat: "yuv420p", ColorRange: tt.sourceRange,
+			}
+
+			cmd := proxyCommand(t, "in.mov", "out.mov", props, cfg)
+
+			if filters, _ := argValue(cmd, "-vf"); !strings.HasSuffix(filters, tt.wantFilter) {
+				t.Errorf("CreateProxyCommand() -vf = %q, want a scale ending with %q", filters, tt.wantFilter)
+			}
+
+			if got, _ := argValue(cmd, "-color_range"); got != tt.wantRange {
+				t.Errorf("CreateProxyCommand() -color_range = %q, want %q", got, tt.wantRange)
+			}
+		})
+	}
+}
+
+func TestCreateProxyCommandCrop(t *testing.T) {
+	props := media.Properties{
+		HasVideoStream: true, Orientation: media.OrientationHorizontal, Width: 1920, Height: 1080,
+		HighestBitDepth: 8, VideoCodec: "h264", PixelFormat: "yuv420p",
+		Crop: &media.Crop{Width: 1920, Height: 800, X: 0, Y: 140},
+	}
+
+	cmd := proxyCommand(t, "in.mov", "out.mov", props, softwareConfig())
+
+	filters, _ := argValue(cmd, "-vf")
+	crop, scale := strings.Index(filters, "crop=1920:800:0:140"), strings.Index(filters, "scale=")
+
+	if crop < 0 || scale < 0 || crop > scale {
+		t.Errorf("CreateProxyCommand() -vf = %q, want the crop filter before scale", filters)
+	}
+}
+
+func TestCreateProxyCommandEncoderArgs(t *testing.T) {
+	cfg := softwareConfig()
+	cfg.EncoderArgs = "-c:v {encoder} -preset {preset} -crf {quality}"
+	cfg.Quality = 20
+
+	props := media.Properties{
+		HasVideoStream: true, Orientation: media.OrientationHorizontal, Width: 3840, Height: 2160,
+		HighestBitDepth: 10, VideoCodec: "prores", PixelFormat: "yuv422p10le",
+	}
+
+	cmd := proxyCommand(t, "in.mov", "out.mov", props, cfg)
+
+	want := map[string]string{
+		"-c:v": "libx264", "-preset": "default", "-crf": "20", "-pix_fmt": "yuv420p",
+		"-vf": "scale=960:trunc(ow/a/2)*2:out_range=tv",
+	}
+	for option, value := range want {
+		if got, ok := argValue(cmd, option); !ok || got != value {
+			t.Errorf("CreateProxyCommand() %s = %q, want %q", option, got, value)
+		}
+	}
+
+	// The template replaces the built-in rate control
+	if slices.Contains(cmd, "-maxrate") {
+		t.Errorf("CreateProxyCommand() = %v, want no built-in -maxrate", cmd)
+	}
+}
+
+func TestCreateProxyCommandEncoderArgsInvalid(t *testing.T) {
+	cfg := softwareConfig()
+	cfg.EncoderArgs = "-c:v {codec}"
+
+	props := media.Properties{
+		HasVideoStream: true, Orientation: media.OrientationHorizontal, Width: 1920, Height: 1080,
+		HighestBitDepth: 8, VideoCodec: "h264", PixelFormat: "yuv420p",
+	}
+
+	if cmd, err := CreateProxyCommand("in.mov", "out.mov", props, cfg); err == nil {
+		t.Errorf("CreateProxyCommand() = %v, want an error", cmd)
+	}
+}
+
+func TestCreateProxyCommandGPU(t *testing.T) {
+	tests := []struct {
+		name    string
+		gpu     int
+		want    map[string]string
+		without []string
+	}{
+		{"pinned device", 2, map[string]string{"-hwaccel": "cuda", "-hwaccel_device": "2", "-gpu": "2"}, nil},
+		{"first device", 0, map[string]string{"-hwaccel_device": "0", "-gpu": "0"}, nil},
+		{"any device", -1, map[string]string{"-hwaccel": "cuda"}, []string{"-hwaccel_device", "-gpu"}},
+	}
+
+	props := media.Properties{
+		HasVideoStream: true, Orientation: media.OrientationHorizontal, Width: 1920, Height: 1080,
+		HighestBitDepth: 8, VideoCodec: "h264", PixelFormat: "yuv420p",
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeCommands(t, map[string]fakeexec.Output{"ffmpeg": {Stdout: cudaOutput}})
+
+			cfg := config.Default()
+			cfg.HWAccel = config.HWAccelCUDA
+			cfg.GPU = tt.gpu
+
+			cmd := proxyCommand(t, "in.mov", "out.mov", props, cfg)
+
+			if encoder, _ := argValue(cmd, "-c:v"); encoder != "h264_nvenc" {
+				t.Fatalf("CreateProxyCommand() -c:v = %q, want h264_nvenc", encoder)
+			}
+
+			for option, want := range tt.want {
+				if got, ok := argValue(cmd, option); !ok || got != want {
+					t.Errorf("CreateProxyCommand() %s = %q, want %q", option, got, want)
+				}
+			}
+
+			for _, option := range tt.without {
+				if slices.Contains(cmd, option) {
+					t.Errorf("CreateProxyCommand() = %v, want no %s", cmd, option)
+				}
+			}
+
+			// The device is picked before the input is opened
+			if device := slices.Index(cmd, "-hwaccel_device"); device > slices.Index(cmd, "-i") {
+				t.Errorf("CreateProxyCommand() = %v, want -hwaccel_device before the input", cmd)
+			}
+		})
+	}
+}
+
+func TestCreateProxyCommandSegments(t *testing.T) {
+	video := media.Properties{
+		HasVideoStream: true, Orientation: media.OrientationHorizontal, Width: 1920, Height: 1080,
+		HighestBitDepth: 8, VideoCodec: "h264", PixelFormat: "yuv420p",
+	}
+	audio := media.Properties{HasAudioStream: true, AudioCodec: "aac"}
+
+	tests := []struct {
+		name       string
+		props      media.Properties
+		container  string
+		wantFormat string
+		wantOutput string
+		keyFrames  bool
+	}{
+		{"video in mov", video, config.ContainerMOV, "mov", "part_%03d.mov", true},
+		{"video in mkv", video, config.ContainerMKV, "matroska", "part_%03d.mkv", true},
+		{"audio only", audio, config.ContainerMOV, "mov", "part_%03d.mov", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := softwareConfig()
+			cfg.ProxyContainer = tt.container
+			cfg.SegmentDuration = 10 * time.Minute
+
+			cmd := proxyCommand(t, "in.mov", "/footage/Proxy/clip/index.csv", tt.props, cfg)
+
+			want := []string{
+				"-f", "segment", "-segment_time", "600", "-segment_format", tt.wantFormat, "-reset_timestamps", "1",
+				"-segment_list", "/footage/Proxy/clip/index.csv.partial", "-segment_list_type", "csv",
+			}
+			if !containsArgs(cmd, want...) {
+				t.Errorf("CreateProxyCommand() = %v, want the segment muxer %v", cmd, want)
+			}
+
+			if output := cmd[len(cmd)-1]; output != "/footage/Proxy/clip/"+tt.wantOutput {
+				t.Errorf("CreateProxyCommand() output = %q, want the segment pattern", output)
+			}
+
+			if got := containsArgs(cmd, "-force_key_frames", "expr:gte(t,n_forced*600)"); got != tt.keyFrames {
+				t.Errorf("CreateProxyCommand() forces key frames = %v, want %v", got, tt.keyFrames)
+			}
+
+			// The segment muxer writes the parts itself, so the proxy is never fragmented for the whole file
+			if slices.Contains(cmd, "-movflags") {
+				t.Errorf("CreateProxyCommand() = %v, want no -movflags", cmd)
+			}
+		})
+	}
+}
+
+func TestCreateProxyCommandHWDownload(t *testing.T) {
+	tests := []struct {
+		name       string
+		codec      string
+		pixFmt     string
+		bitDepth   int
+		rotation   int
+		wantFilter string
+	}{
+		{"8-bit h264", "h264", "yuv420p", 8, 0, "hwdownload,format=nv12"},
+		{"10-bit hevc", "hevc", "yuv420p10le", 10, 0, "hwdownload,format=p010le"},
+		{"software decoded prores", "prores", "yuv422p10le", 10, 0, ""},
+		{"software decoded 4:2:2 h264", "h264", "yuv422p", 8, 0, ""},
+		{"rotated source downloaded automatically", "h264", "yuv420p", 8, 90, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeCommands(t, map[string]fakeexec.Output{"ffmpeg": {Stdout: cudaOutput}})
+
+			props := media.Properties{
+				HasVideoStream: true, Orientation: media.OrientationHorizontal, Width: 1920, Height: 1080,
+				HighestBitDepth: tt.bitDepth, VideoCodec: tt.codec, PixelFormat: tt.pixFmt, Rotation: tt.rotation,
+				Crop: &media.Crop{Width: 1920, Height: 800, X: 0, Y: 140},
+			}
+
+			cfg := config.Default()
+			cfg.HWAccel = config.HWAccelCUDA
+
+			cmd := proxyCommand(t, "in.mov", "out.mov", props, cfg)
+			filters, _ := argValue(cmd, "-vf")
+
+			if tt.wantFilter == "" {
+				if strings.Contains(filters, "hwdownload") || slices.Contains(cmd, "-hwaccel_output_format") {
+					t.Errorf("CreateProxyCommand() = %v, want the frames downloaded automatically", cmd)
+				}
+
+				return
+			}
+
+			// GPU frames are kept on the device by the decoder, and downloaded before the CPU crop and scale
+			if format, _ := argValue(cmd, "-hwaccel_output_format"); format != "cuda" {
+				t.Errorf("CreateProxyCommand() -hwaccel_output_format = %q, want cuda", format)
+			}
+
+			if !strings.HasPrefix(filters, tt.wantFilter+",crop=") {
+				t.Errorf("CreateProxyCommand() -vf = %q, want it to start with %s before the crop", filters, tt.wantFilter)
+			}
+		})
+	}
+}
+
+func TestDeviceRoundRobin(t *testing.T) {
+	devices := NewDeviceRoundRobin([]int{0, 1, 3})
+
+	var got []int
+	for range 7 {
+		got = append(got, devices.Next())
+	}
+
+	if want := []int{0, 1, 3, 0, 1, 3, 0}; !slices.Equal(got, want) {
+		t.Errorf("DeviceRoundRobin.Next() = %v, want %v", got, want)
+	}
+
+	if got := NewDeviceRoundRobin(nil).Next(); got != -1 {
+		t.Errorf("DeviceRoundRobin.Next() without devices = %d, want -1", got)
+	}
+}
+
+func TestHardwareAccelerations(t *testing.T) {
+	fake := fakeCommands(t, map[string]fakeexec.Output{
+		"ffmpeg": {Stdout: "Hardware acceleration methods:\ncuda\nvaapi\n\n"},
+	})
+
+	methods, err := HardwareAccelerations()
+	if err != nil {
+		t.Fatalf("HardwareAccelerations() error = %v", err)
+	}
+
+	if !slices.Equal(methods, []string{"cuda", "vaapi"}) {
+		t.Errorf("HardwareAccelerations() = %v, want [cuda vaapi]", methods)
+	}
+
+	if calls := fake.Calls(); len(calls) != 1 || !slices.Contains(calls[0], "-hwaccels") {
+		t.Errorf("commands run = %v, want ffmpeg -hwaccels", calls)
+	}
+}
+
+func TestHardwareBackend(t *testing.T) {
+	tests := []struct {
+		name    string
+		hwAccel string
+		codec   string
+		output  fakeexec.Output
+		want    string
+		wantErr bool
+	}{
+		{"chosen backend", config.HWAccelCUDA, config.CodecHEVC, fakeexec.Output{Stdout: cudaOutput}, "cuda", false},
+		{"auto", config.HWAccelAuto, config.CodecH264, fakeexec.Output{Stdout: cudaOutput}, "cuda", false},
+		{"auto without encoder", config.HWAccelAuto, config.CodecAV1, fakeexec.Output{Stdout: cudaOutput}, "", false},
+		{"auto detection error", config.HWAccelAuto, config.CodecH264, fakeexec.Output{ExitCode: 1}, "", false},
+		{"none", config.HWAccelNone, config.CodecH264, fakeexec.Output{Stdout: cudaOutput}, "", false},
+		{"chosen backend missing", config.HWAccelVAAPI, config.CodecH264, fakeexec.Output{Stdout: cudaOutput}, "", true},
+		{
+			"chosen backend without encoder", config.HWAccelCUDA, config.CodecAV1,
+			fakeexec.Output{Stdout: cudaOutput}, "", true,
+		},
+		{"chosen backend detection error", config.HWAccelCUDA, config.CodecH264, fakeexec.Output{ExitCode: 1}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeCommands(t, map[string]fakeexec.Output{"ffmpeg": tt.output})
+
+			cfg := config.Default()
+			cfg.HWAccel = tt.hwAccel
+			cfg.ProxyCodec = tt.codec
+
+			backend, err := HardwareBackend(cfg)
+			if tt.wantErr {
+				if !errors.Is(err, ErrHWAccelUnavailable) {
+					t.Errorf("HardwareBackend() error = %v, want %v", err, ErrHWAccelUnavailable)
+				}
+
+				// Commands aren't created with an unusable backend rather than falling back to software encoding
+				if _, err := CreateProxyCommand("in.mov", "out.mov", media.Properties{}, cfg); err == nil {
+					t.Error("CreateProxyCommand() error = nil, want an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("HardwareBackend() error = %v", err)
+			}
+
+			if backend != tt.want {
+				t.Errorf("HardwareBackend() = %q, want %q", backend, tt.want)
+			}
+		})
+	}
+}
+
+func TestTwoPassCommands(t *testing.T) {
+	tests := []struct {
+		name        string
+		container   string
+		segments    time.Duration
+		wantDropped []string
+	}{
+		{"mov", config.ContainerMOV, 0, []string{"-movflags"}},
+		{"mp4", config.ContainerMP4, 0, []string{"-movflags"}},
+		{
+			"segmented", config.ContainerMOV, 10 * time.Minute,
+			[]string{"-segment_time", "-segment_format", "-reset_timestamps", "-segment_list", "-segment_list_type"},
+		},
+	}
+
+	props := media.Properties{
+		HasVideoStream: true, HasAudioStream: true, Orientation: media.OrientationHorizontal,
+		Width: 1920, Height: 1080, HighestBitDepth: 8, VideoCodec: "h264", AudioCodec: "aac", PixelFormat: "yuv420p",
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := softwareConfig()
+			cfg.ProxyContainer = tt.container
+			cfg.SegmentDuration = tt.segments
+
+			cmd := proxyCommand(t, "in.mov", "out."+tt.container, props, cfg)
+			firstPass, secondPass := TwoPassCommands(cmd, "/tmp/passlog")
+
+			// The null muxer rejects the options of the proxy muxer
+			for _, option := range tt.wantDropped {
+				if !slices.Contains(cmd, option) || slices.Contains(firstPass, option) {
+					t.Errorf("TwoPassCommands() first pass = %v, want no %s", firstPass, option)
+				}
+			}
+
+			wantTail := []string{"-pass", "1", "-passlogfile", "/tmp/passlog", "-an", "-sn", "-f", "null", os.DevNull}
+			if !slices.Equal(firstPass[len(firstPass)-len(wantTail):], wantTail) ||
+				slices.Index(firstPass, "-f") != len(firstPass)-3 {
+				t.Errorf("TwoPassCommands() first pass = %v, want it to end with %v", firstPass, wantTail)
+			}
+
+			if encoder, _ := argValue(firstPass, "-c:v"); encoder != "libx264" {
+				t.Errorf("TwoPassCommands() first pass -c:v = %q, want libx264", encoder)
+			}
+
+			wantSecond := slices.Concat(cmd[:len(cmd)-1], []string{"-pass", "2", "-passlogfile", "/tmp/passlog"},
+				cmd[len(cmd)-1:])
+			if !slices.Equal(secondPass, wantSecond) {
+				t.Errorf("TwoPassCommands() second pass = %v, want %v", secondPass, wantSecond)
+			}
+		})
+	}
+}
+
+func TestTwoPassCommandsInputFormat(t *testing.T) {
+	cmd := []string{"ffmpeg", "-f", "mpegts", "-i", "in.ts", "-c:v", "libx264", "-f", "mp4", "out.mp4"}
+
+	firstPass, _ := TwoPassCommands(cmd, "passlog")
+
+	want := []string{
+		"ffmpeg", "-f", "mpegts", "-i", "in.ts", "-c:v", "libx264",
+		"-pass", "1", "-passlogfile", "passlog", "-an", "-sn", "-f", "null", os.DevNull,
+	}
+	if !slices.Equal(firstPass, want) {
+		t.Errorf("TwoPassCommands() first pass = %v, want %v", firstPass, want)
+	}
+}
+
+func TestCommandContext(t *testing.T) {
+	fakeCommands(t, map[string]fakeexec.Output{"ffmpeg": {Stderr: "Unknown encoder 'h264_nvenc'", ExitCode: 1}})
+
+	output, err := CommandContext(context.Background(), "ffmpeg", "-i", "in.mov", "out.mov").CombinedOutput()
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		t.Fatalf("CommandContext() error = %v, want exit code 1", err)
+	}
+
+	if err := NewCommandError(err, string(output)); !errors.Is(err, ErrEncoderUnavailable) {
+		t.Errorf("NewCommandError() = %v, want %v", err, ErrEncoderUnavailable)
+	}
+}
+
+func TestCreateProxyCommandRotated(t *testing.T) {
+	var info media.MediaInfo
+
+	// A portrait phone clip stored with landscape dimensions and a quarter turn
+	err := json.Unmarshal([]byte(`{"format": {"filename": "phone.mov", "duration": "10.0"}, "streams": [
+		{"index": 0, "codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080, "pix_fmt": "yuv420p",
+		 "side_data_list": [{"side_data_type": "Display Matrix", "rotation": -90}]}]}`), &info)
+	if err != nil {
+		t.Fatalf("error unmarshalling probe output: %v", err)
+	}
+
+	fakeCommands(t, map[string]fakeexec.Output{"ffmpeg": {}})
+
+	cmd := proxyCommand(t, "phone.mov", "out.mov", media.AnalyzeMediaInfo(info), softwareConfig())
+
+	// FFmpeg rotates the frames before the filters, so the proxy is scaled as a portrait video
+	if filters, _ := argValue(cmd, "-vf"); filters != "scale=540:trunc(ow/a/2)*2:out_range=tv" {
+		t.Errorf("CreateProxyCommand() -vf = %q, want the portrait proxy width", filters)
+	}
+}
@@ -0,0 +1,135 @@
+package ffmpeg
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/media"
+)
+
+// Common causes of FFmpeg failures, detected in its output.
+var (
+	ErrNoSpaceLeft        = errors.New("no space left on device")
+	ErrEncoderUnavailable = errors.New("encoder unavailable")
+	ErrCUDAUnavailable    = errors.New("CUDA unavailable")
+	// ErrGPUBusy is a transient lack of GPU memory or encoder sessions, e.g. while other jobs use the GPU.
+	ErrGPUBusy = errors.New("GPU resources exhausted")
+	// ErrTimeout is a command killed for running longer than the configured timeout.
+	ErrTimeout = errors.New("timed out")
+)
+
+// errorPatterns maps messages of the FFmpeg output to the cause they reveal.
+// Transient patterns come first since they are reported along with generic encoder and CUDA failures,
+// and CUDA patterns come before encoder ones since a missing driver also fails the NVENC encoder.
+var errorPatterns = []struct {
+	pattern string
+	cause   error
+}{
+	{"No space left on device", ErrNoSpaceLeft},
+	{"out of memory", ErrGPUBusy},
+	{"CUDA_ERROR_OUT_OF_MEMORY", ErrGPUBusy},
+	{"incompatible client key", ErrGPUBusy},
+	{"concurrent sessions", ErrGPUBusy},
+	{"Cannot load libcuda", ErrCUDAUnavailable},
+	{"CUDA_ERROR", ErrCUDAUnavailable},
+	{"Failed setup for format cuda", ErrCUDAUnavailable},
+	{"No device available for decoder", ErrCUDAUnavailable},
+	{"Unknown encoder", ErrEncoderUnavailable},
+	{"Encoder not found", ErrEncoderUnavailable},
+	{"Cannot load libnvidia-encode", ErrEncoderUnavailable},
+	{"No capable devices found", ErrEncoderUnavailable},
+	{"OpenEncodeSessionEx failed", ErrEncoderUnavailable},
+	{"Invalid data found when processing input", media.ErrInvalidData},
+}
+
+// IsTransient reports whether a failed command may succeed when run again later.
+// Invalid inputs or missing encoders fail the same way every time.
+func IsTransient(err error) bool {
+	return errors.Is(err, ErrGPUBusy)
+}
+
+// ErrorTailLines is the number of lines of FFmpeg output kept in a CommandError.
+const ErrorTailLines = 10
+
+// CommandError is a failed FFmpeg command along with the end of its output.
+// It matches the detected cause with errors.Is, e.g. ErrEncoderUnavailable.
+type CommandError struct {
+	Err    error
+	Cause  error
+	Output []string
+}
+
+func (e *CommandError) Error() string {
+	if len(e.Output) == 0 {
+		return e.Err.Error()
+	}
+
+	return e.Err.Error() + ": " + strings.Join(e.Output, "; ")
+}
+
+func (e *CommandError) Unwrap() []error {
+	if e.Cause == nil {
+		return []error{e.Err}
+	}
+
+	return []error{e.Err, e.Cause}
+}
+
+// NewCommandError wraps the error of a failed FFmpeg command with the end of its output and its detected cause.
+func NewCommandError(err error, output string) error {
+	if err == nil {
+		return nil
+	}
+
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		lines = nil
+	}
+
+	var cause error
+
+	for _, p := range errorPatterns {
+		if cause == nil && strings.Contains(output, p.pattern) {
+			cause = p.cause
+		}
+	}
+
+	if len(lines) > ErrorTailLines {
+		lines = lines[len(lines)-ErrorTailLines:]
+	}
+
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+
+	return &CommandError{Err: err, Cause: cause, Output: lines}
+}
+
+// tailBufferSize is the amount of output an OutputTail keeps.
+const tailBufferSize = 64 * 1024
+
+// OutputTail is a writer keeping the end of the output of a command. It is safe for concurrent use.
+type OutputTail struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (t *OutputTail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > tailBufferSize {
+		t.buf = t.buf[len(t.buf)-tailBufferSize:]
+	}
+
+	return len(p), nil
+}
+
+func (t *OutputTail) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return string(t.buf)
+}
@@ -0,0 +1,46 @@
+package ffmpeg
+
+import (
+	"os/exec"
+	"sync"
+	"testing"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/internal/fakeexec"
+)
+
+func TestMain(m *testing.M) {
+	fakeexec.Main(m)
+}
+
+// cudaOutput is an excerpt of the ffmpeg -encoders and -hwaccels outputs of a machine with an NVIDIA GPU.
+const cudaOutput = `Encoders:
+ V..... = Video
+ ------
+ V....D libx264              libx264 H.264 / AVC / MPEG-4 AVC / MPEG-4 part 10 (codec h264)
+ V....D h264_nvenc           NVIDIA NVENC H.264 encoder (codec h264)
+ V....D hevc_nvenc           NVIDIA NVENC hevc encoder (codec hevc)
+Hardware acceleration methods:
+cuda
+`
+
+// fakeCommands fakes the commands run by the package for the duration of the test.
+// The hardware encoders are detected again from the faked FFmpeg.
+func fakeCommands(t *testing.T, outputs map[string]fakeexec.Output) *fakeexec.Fake {
+	t.Helper()
+
+	fake := &fakeexec.Fake{Outputs: outputs}
+
+	execCommand = fake.Command
+	execCommandContext = fake.CommandContext
+	detectHardwareEncoders = sync.OnceValues(DetectHardwareEncoders)
+	logAccelerationChoice = sync.Once{}
+
+	t.Cleanup(func() {
+		execCommand = exec.Command
+		execCommandContext = exec.CommandContext
+		detectHardwareEncoders = sync.OnceValues(DetectHardwareEncoders)
+		logAccelerationChoice = sync.Once{}
+	})
+
+	return fake
+}
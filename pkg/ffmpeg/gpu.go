@@ -0,0 +1,28 @@
+package ffmpeg
+
+import (
+	"sync/atomic"
+)
+
+// DeviceRoundRobin hands out GPU indices to jobs in round-robin order.
+// It is safe for concurrent use.
+type DeviceRoundRobin struct {
+	devices []int
+	next    atomic.Uint64
+}
+
+// NewDeviceRoundRobin creates a round-robin assigner over the given GPU indices.
+func NewDeviceRoundRobin(devices []int) *DeviceRoundRobin {
+	return &DeviceRoundRobin{devices: devices}
+}
+
+// Next returns the GPU index for the next job, or -1 when no device was configured.
+func (r *DeviceRoundRobin) Next() int {
+	if len(r.devices) == 0 {
+		return -1
+	}
+
+	n := r.next.Add(1) - 1
+
+	return r.devices[n%uint64(len(r.devices))]
+}
@@ -0,0 +1,200 @@
+package ffmpeg
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/config"
+)
+
+// softwareEncoders maps each proxy codec to its software encoder.
+var softwareEncoders = map[string]string{
+	config.CodecH264: "libx264",
+	config.CodecHEVC: "libx265",
+	config.CodecAV1:  "libsvtav1",
+}
+
+// hardwareEncoders maps each hardware acceleration backend to its encoder of each proxy codec.
+// VideoToolbox has no AV1 encoder.
+var hardwareEncoders = map[string]map[string]string{
+	config.HWAccelCUDA: {
+		config.CodecH264: "h264_nvenc",
+		config.CodecHEVC: "hevc_nvenc",
+		config.CodecAV1:  "av1_nvenc",
+	},
+	config.HWAccelVideoToolbox: {
+		config.CodecH264: "h264_videotoolbox",
+		config.CodecHEVC: "hevc_videotoolbox",
+	},
+	config.HWAccelQSV: {
+		config.CodecH264: "h264_qsv",
+		config.CodecHEVC: "hevc_qsv",
+		config.CodecAV1:  "av1_qsv",
+	},
+	config.HWAccelVAAPI: {
+		config.CodecH264: "h264_vaapi",
+		config.CodecHEVC: "hevc_vaapi",
+		config.CodecAV1:  "av1_vaapi",
+	},
+}
+
+// backendOrder is the order in which auto tries the hardware acceleration backends.
+var backendOrder = []string{config.HWAccelCUDA, config.HWAccelVideoToolbox, config.HWAccelQSV, config.HWAccelVAAPI}
+
+// ErrHWAccelUnavailable is returned when the chosen hardware acceleration backend has no usable encoder.
+var ErrHWAccelUnavailable = errors.New("hardware acceleration unavailable")
+
+// vaapiDevice is the DRM render node used by the VAAPI backend.
+const vaapiDevice = "/dev/dri/renderD128"
+
+// Encoder returns the encoder of the proxy codec, the one of the hardware backend unless it is empty.
+func Encoder(cfg config.Config, backend string) string {
+	if backend != "" {
+		return hardwareEncoders[backend][cfg.ProxyCodec]
+	}
+
+	return softwareEncoders[cfg.ProxyCodec]
+}
+
+// detectHardwareEncoders caches the result of DetectHardwareEncoders for the run.
+var detectHardwareEncoders = sync.OnceValues(DetectHardwareEncoders)
+
+// logAccelerationChoice logs the encoding path once per run.
+var logAccelerationChoice sync.Once
+
+// DetectHardwareEncoders returns the hardware accelerators that are actually usable: each backend whose hwaccel
+// FFmpeg supports, and each of their encoders that is built in and passes a test encode on this machine.
+func DetectHardwareEncoders() ([]string, error) {
+	methods, err := HardwareAccelerations()
+	if err != nil {
+		return nil, err
+	}
+
+	var usable []string
+
+	for _, backend := range backendOrder {
+		if slices.Contains(methods, backend) {
+			usable = append(usable, backend)
+		}
+	}
+
+	output, err := execCommand("ffmpeg", "-hide_banner", "-encoders").Output()
+	if err != nil {
+		return usable, fmt.Errorf("error executing ffmpeg: %w", err)
+	}
+
+	builtIn := ParseEncoders(string(output))
+
+	// Being built in doesn't mean that a compatible device and driver are present, AV1 needs a recent GPU
+	for _, backend := range backendOrder {
+		for _, codec := range []string{config.CodecH264, config.CodecHEVC, config.CodecAV1} {
+			encoder := hardwareEncoders[backend][codec]
+			if encoder != "" && slices.Contains(builtIn, encoder) && canEncode(backend, encoder) {
+				usable = append(usable, encoder)
+			}
+		}
+	}
+
+	return usable, nil
+}
+
+// ParseEncoders parses the encoder names listed by ffmpeg -encoders.
+func ParseEncoders(output string) []string {
+	var encoders []string
+
+	_, list, found := strings.Cut(output, "------")
+	if !found {
+		return nil
+	}
+
+	for _, line := range strings.Split(list, "\n") {
+		// Lines look like " V....D h264_nvenc           NVIDIA NVENC H.264 encoder (codec h264)"
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && len(fields[0]) == 6 {
+			encoders = append(encoders, fields[1])
+		}
+	}
+
+	return encoders
+}
+
+// canEncode reports whether a short test clip can be encoded with the encoder of a hardware backend.
+func canEncode(backend string, encoder string) bool {
+	args := []string{"-hide_banner", "-loglevel", "error"}
+	if backend == config.HWAccelVAAPI {
+		args = append(args, "-vaapi_device", vaapiDevice)
+	}
+
+	args = append(args, "-f", "lavfi", "-i", "color=black:s=256x256:d=0.1")
+	if backend == config.HWAccelVAAPI {
+		args = append(args, "-vf", "format=nv12,hwupload")
+	}
+
+	args = append(args, "-c:v", encoder, "-f", "null", "-")
+
+	return execCommand("ffmpeg", args...).Run() == nil //nolint:gosec
+}
+
+// HardwareBackend returns the hardware acceleration backend decoding and encoding with the configuration,
+// or "" for software encoding. auto picks the first usable backend, falling back to software encoding,
+// while a chosen backend that isn't usable on this machine is an error.
+func HardwareBackend(cfg config.Config) (string, error) {
+	if cfg.HWAccel == config.HWAccelNone {
+		return "", nil
+	}
+
+	candidates := backendOrder
+	if cfg.HWAccel != config.HWAccelAuto {
+		candidates = []string{cfg.HWAccel}
+	}
+
+	usable, err := detectHardwareEncoders()
+
+	var backend string
+
+	for _, candidate := range candidates {
+		if err == nil && slices.Contains(usable, candidate) &&
+			slices.Contains(usable, hardwareEncoders[candidate][cfg.ProxyCodec]) {
+			backend = candidate
+
+			break
+		}
+	}
+
+	if backend == "" && cfg.HWAccel != config.HWAccelAuto {
+		if err != nil {
+			return "", fmt.Errorf("%w: error detecting %s encoders: %w", ErrHWAccelUnavailable, cfg.HWAccel, err)
+		}
+
+		return "", fmt.Errorf("%w: %s has no usable %s encoder", ErrHWAccelUnavailable, cfg.HWAccel, cfg.ProxyCodec)
+	}
+
+	logAccelerationChoice.Do(func() {
+		switch {
+		case backend != "":
+			slog.Info("Using hardware acceleration", "backend", backend, "encoder", Encoder(cfg, backend))
+
+			// Only the CUDA backend can be pinned to a device
+			if len(cfg.GPUs) > 0 && backend != config.HWAccelCUDA {
+				slog.Warn("GPU selection only applies to CUDA, ignoring -gpu", "backend", backend)
+			}
+		case err != nil:
+			slog.Warn("Could not detect hardware encoders, using software encoding", "error", err)
+		default:
+			slog.Info("No hardware encoder is usable, using software encoding", "codec", cfg.ProxyCodec)
+		}
+	})
+
+	return backend, nil
+}
+
+// UseHardwareAcceleration reports whether a hardware backend decodes and encodes with the configuration.
+func UseHardwareAcceleration(cfg config.Config) bool {
+	backend, err := HardwareBackend(cfg)
+
+	return err == nil && backend != ""
+}
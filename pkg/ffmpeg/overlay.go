@@ -0,0 +1,60 @@
+package ffmpeg
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/config"
+	"github.com/cyrilschreiber3/media-processor/pkg/media"
+)
+
+// overlayStyle is the look of the burnt-in text: white on a translucent box, sized for proxy resolutions.
+const overlayStyle = "fontsize=20:fontcolor=white:box=1:boxcolor=black@0.5:boxborderw=6"
+
+// burnInFilters returns the drawtext filters burning the file name of the source at the top of the proxy,
+// and its running timecode at the bottom. Sources without a timecode show their presentation time instead.
+func burnInFilters(filePath string, props media.Properties, cfg config.Config) []string {
+	font := "fontfile=" + escapeFilterOption(cfg.BurnInFont)
+
+	name := "text=" + escapeFilterOption(escapeDrawtext(filepath.Base(filePath)))
+	nameFilter := "drawtext=" + strings.Join([]string{font, name, overlayStyle, "x=(w-tw)/2", "y=12"}, ":")
+
+	timeText := "text=" + escapeFilterOption("%{pts:hms}")
+	if _, ok := media.ParseFrameRate(props.FrameRate); ok && props.Timecode != "" {
+		timeText = "timecode=" + escapeFilterOption(props.Timecode) + ":rate=" + escapeFilterOption(props.FrameRate)
+	}
+
+	timeFilter := "drawtext=" + strings.Join([]string{font, timeText, overlayStyle, "x=(w-tw)/2", "y=h-th-12"}, ":")
+
+	return []string{escapeFiltergraph(nameFilter), escapeFiltergraph(timeFilter)}
+}
+
+// escapeDrawtext escapes the characters drawtext expands in its text, such as %{pts}.
+func escapeDrawtext(text string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%").Replace(text)
+}
+
+// escapeFilterOption escapes a filter option value, whose quotes, backslashes and colons are special.
+func escapeFilterOption(value string) string {
+	return escapeChars(value, "\\':")
+}
+
+// escapeFiltergraph escapes a filter description so it can be chained in a filtergraph.
+func escapeFiltergraph(filter string) string {
+	return escapeChars(filter, "\\'[],;")
+}
+
+// escapeChars prefixes every special character of the value with a backslash.
+func escapeChars(value string, specials string) string {
+	var escaped strings.Builder
+
+	for _, r := range value {
+		if strings.ContainsRune(specials, r) {
+			escaped.WriteByte('\\')
+		}
+
+		escaped.WriteRune(r)
+	}
+
+	return escaped.String()
+}
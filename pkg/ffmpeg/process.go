@@ -0,0 +1,15 @@
+package ffmpeg
+
+import (
+	"os/exec"
+	"time"
+)
+
+// execCommand and execCommandContext create the FFmpeg commands. Tests replace them to fake FFmpeg.
+var (
+	execCommand        = exec.Command
+	execCommandContext = exec.CommandContext
+)
+
+// killWaitDelay is how long a killed command may keep its output pipes open before Wait gives up on them.
+const killWaitDelay = 5 * time.Second
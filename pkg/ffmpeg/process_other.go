@@ -0,0 +1,17 @@
+//go:build !unix
+
+package ffmpeg
+
+import (
+	"context"
+	"os/exec"
+)
+
+// CommandContext creates a command killed when the context is done.
+// Process groups are only supported on Unix, so the processes it spawned may outlive it.
+func CommandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := execCommandContext(ctx, name, args...)
+	cmd.WaitDelay = killWaitDelay
+
+	return cmd
+}
@@ -0,0 +1,22 @@
+//go:build unix
+
+package ffmpeg
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+)
+
+// CommandContext creates a command run in its own process group, killed along with every process it spawned
+// when the context is done. Being in its own group, it doesn't receive the interrupts of the terminal.
+func CommandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := execCommandContext(ctx, name, args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = killWaitDelay
+
+	return cmd
+}
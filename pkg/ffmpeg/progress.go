@@ -0,0 +1,51 @@
+package ffmpeg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ProgressArgs are the FFmpeg options writing machine-readable progress to stdout.
+var ProgressArgs = []string{"-progress", "pipe:1", "-nostats"}
+
+// ParseProgress reads the key=value progress output of FFmpeg and reports the percentage
+// of the duration (in seconds) encoded so far. Percentages can only be computed with a known
+// duration, otherwise only the end of the encode is reported.
+func ParseProgress(r io.Reader, duration float64, fn func(pct float64)) error {
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		// out_time_ms is in microseconds as well, despite its name
+		case "out_time_us", "out_time_ms":
+			if duration <= 0 {
+				continue
+			}
+
+			microseconds, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				continue
+			}
+
+			fn(min(max(float64(microseconds)/1e6/duration*100, 0), 100))
+		case "progress":
+			if value == "end" {
+				fn(100)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading ffmpeg progress: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Layout of the sprite sheet sidecar.
+const (
+	spriteColumns = 10
+	spriteRows    = 10
+	spriteWidth   = 160
+)
+
+// CreateThumbnailCommand creates an FFmpeg command extracting a single JPEG frame at the given time.
+func CreateThumbnailCommand(filePath string, thumbnailPath string, atSeconds float64) []string {
+	var cmd []string
+
+	cmd = append(cmd, "ffmpeg", "-y", "-hide_banner", "-loglevel", "error")
+	cmd = append(cmd, "-ss", strconv.FormatFloat(atSeconds, 'f', 3, 64), "-i", filePath)
+	cmd = append(cmd, "-frames:v", "1", "-q:v", "2", thumbnailPath)
+
+	return cmd
+}
+
+// CreateSpriteCommand creates an FFmpeg command tiling evenly-spaced frames into a single sprite sheet.
+func CreateSpriteCommand(filePath string, spritePath string, durationSec float64) []string {
+	var cmd []string
+
+	frames := spriteColumns * spriteRows
+	fps := strconv.FormatFloat(float64(frames)/durationSec, 'f', 6, 64)
+	filter := fmt.Sprintf("fps=%s,scale=%d:-2,tile=%dx%d", fps, spriteWidth, spriteColumns, spriteRows)
+
+	cmd = append(cmd, "ffmpeg", "-y", "-hide_banner", "-loglevel", "error")
+	cmd = append(cmd, "-i", filePath, "-vf", filter, "-frames:v", "1", "-q:v", "4", spritePath)
+
+	return cmd
+}
+
+// CreateWaveformCommand creates an FFmpeg command rendering the audio waveform as a PNG.
+func CreateWaveformCommand(filePath string, waveformPath string) []string {
+	var cmd []string
+
+	cmd = append(cmd, "ffmpeg", "-y", "-hide_banner", "-loglevel", "error")
+	cmd = append(cmd, "-i", filePath, "-filter_complex", "showwavespic=s=1280x240", "-frames:v", "1", waveformPath)
+
+	return cmd
+}
+
+// CreateFilmstripCommand creates an FFmpeg command extracting count evenly-spaced frames in a single pass.
+// The output pattern must contain a printf-style frame number, e.g. name_thumb_%02d.jpg.
+func CreateFilmstripCommand(filePath string, outputPattern string, count int, durationSec float64) []string {
+	var cmd []string
+
+	fps := strconv.FormatFloat(float64(count)/durationSec, 'f', 6, 64)
+
+	cmd = append(cmd, "ffmpeg", "-y", "-hide_banner", "-loglevel", "error")
+	cmd = append(cmd, "-i", filePath, "-vf", "fps="+fps, "-frames:v", strconv.Itoa(count))
+	cmd = append(cmd, "-q:v", "2", "-start_number", "1", outputPattern)
+
+	return cmd
+}
+
+// CreateSubtitleCommand creates an FFmpeg command extracting a text subtitle stream to an SRT file.
+func CreateSubtitleCommand(filePath string, streamIndex int, srtPath string) []string {
+	var cmd []string
+
+	cmd = append(cmd, "ffmpeg", "-y", "-hide_banner", "-loglevel", "error")
+	cmd = append(cmd, "-i", filePath, "-map", "0:"+strconv.Itoa(streamIndex), "-c:s", "srt", srtPath)
+
+	return cmd
+}
@@ -0,0 +1,38 @@
+package ffmpeg
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestCreateFilmstripCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		count    int
+		duration float64
+		wantFPS  string
+	}{
+		{"ten thumbnails of a minute", 10, 60, "fps=0.166667"},
+		{"single thumbnail", 1, 4, "fps=0.250000"},
+		{"more thumbnails than seconds", 20, 2, "fps=10.000000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := CreateFilmstripCommand("/footage/clip.mov", "/footage/Proxy/clip_thumb_%02d.jpg", tt.count, tt.duration)
+
+			// A single pass sampling the clip at count frames over its duration, numbered from 1
+			if !containsArgs(cmd, "-i", "/footage/clip.mov", "-vf", tt.wantFPS) {
+				t.Errorf("CreateFilmstripCommand() = %v, want -vf %s", cmd, tt.wantFPS)
+			}
+
+			if !containsArgs(cmd, "-frames:v", strconv.Itoa(tt.count)) || !containsArgs(cmd, "-start_number", "1") {
+				t.Errorf("CreateFilmstripCommand() = %v, want %d frames numbered from 1", cmd, tt.count)
+			}
+
+			if cmd[len(cmd)-1] != "/footage/Proxy/clip_thumb_%02d.jpg" {
+				t.Errorf("CreateFilmstripCommand() output = %q, want the pattern", cmd[len(cmd)-1])
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package ffmpeg
+
+import (
+	"github.com/cyrilschreiber3/media-processor/pkg/config"
+	"github.com/cyrilschreiber3/media-processor/pkg/media"
+)
+
+// tonemapPeakLuminance is the nominal peak luminance in nits the linearized HDR signal is scaled to.
+const tonemapPeakLuminance = "100"
+
+// UseTonemap reports whether the proxy of a source is tonemapped from HDR to SDR.
+func UseTonemap(props media.Properties, cfg config.Config) bool {
+	return props.HasVideoStream && props.HDR && cfg.Tonemap != config.TonemapNone
+}
+
+// tonemapFilter returns the filters converting PQ or HLG video to BT.709 SDR video with the configured operator.
+// The signal is linearized and converted to BT.709 primaries in floating point before tonemapping,
+// then encoded with the BT.709 transfer in the proxy range.
+func tonemapFilter(cfg config.Config) string {
+	return "zscale=t=linear:npl=" + tonemapPeakLuminance +
+		",format=gbrpf32le" +
+		",zscale=p=bt709" +
+		",tonemap=tonemap=" + cfg.Tonemap + ":desat=0" +
+		",zscale=t=bt709:m=bt709:r=" + outputColorRange(cfg) +
+		",format=yuv420p"
+}
@@ -0,0 +1,42 @@
+package fileutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// defaultDirMode is the mode of directories created without a parent to take it from.
+const defaultDirMode = 0o755
+
+// CreateDir creates a directory along with its missing parents.
+// A zero mode gives them the permission bits of the existing parent of dirPath, or 0755 when inheritParent
+// is false, narrowed by the umask like os.MkdirAll. A non-zero mode is set exactly on dirPath, whatever the umask.
+func CreateDir(dirPath string, mode os.FileMode, inheritParent bool) error {
+	perm := mode.Perm()
+
+	switch {
+	case mode != 0:
+	case inheritParent:
+		parent, err := os.Stat(filepath.Dir(dirPath))
+		if err != nil {
+			return fmt.Errorf("error getting parent directory info: %w", err)
+		}
+
+		perm = parent.Mode().Perm()
+	default:
+		perm = defaultDirMode
+	}
+
+	if err := os.MkdirAll(dirPath, perm); err != nil {
+		return fmt.Errorf("error creating directory: %w", err)
+	}
+
+	if mode != 0 {
+		if err := os.Chmod(dirPath, perm); err != nil {
+			return fmt.Errorf("error changing directory mode: %w", err)
+		}
+	}
+
+	return nil
+}
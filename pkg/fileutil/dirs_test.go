@@ -0,0 +1,56 @@
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestCreateDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("POSIX permission bits are not supported")
+	}
+
+	tests := []struct {
+		name          string
+		parentMode    os.FileMode
+		mode          os.FileMode
+		inheritParent bool
+		want          os.FileMode
+	}{
+		{"parent mode", 0o750, 0, true, 0o750},
+		// The type and special bits of the parent are not permission bits
+		{"setgid parent", os.ModeSetgid | 0o750, 0, true, 0o750},
+		{"explicit mode", 0o700, 0o770, true, 0o770},
+		{"explicit mode without parent", 0o700, 0o711, false, 0o711},
+		{"default mode", 0o700, 0, false, 0o755},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := filepath.Join(t.TempDir(), "footage")
+			if err := os.Mkdir(parent, 0o700); err != nil {
+				t.Fatalf("error creating %s: %v", parent, err)
+			}
+
+			if err := os.Chmod(parent, tt.parentMode); err != nil {
+				t.Fatalf("error changing the mode of %s: %v", parent, err)
+			}
+
+			dirPath := filepath.Join(parent, "Proxy")
+			if err := CreateDir(dirPath, tt.mode, tt.inheritParent); err != nil {
+				t.Fatalf("CreateDir() error = %v", err)
+			}
+
+			info, err := os.Stat(dirPath)
+			if err != nil {
+				t.Fatalf("error getting %s info: %v", dirPath, err)
+			}
+
+			if !info.IsDir() || info.Mode().Perm() != tt.want {
+				t.Errorf("CreateDir() mode = %v, want a %v directory", info.Mode(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package fileutil
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/user"
+	"runtime"
+	"strconv"
+)
+
+// ApplyOwnership sets the permission bits and group of a generated file.
+// A zero mode or an empty group leaves the corresponding attribute unchanged.
+// The group can be a name or a numeric id; it is ignored on platforms without POSIX ownership.
+func ApplyOwnership(path string, mode os.FileMode, group string) error {
+	if mode != 0 {
+		if err := os.Chmod(path, mode.Perm()); err != nil {
+			return fmt.Errorf("error changing file mode: %w", err)
+		}
+	}
+
+	if group == "" {
+		return nil
+	}
+
+	if runtime.GOOS == "windows" {
+		slog.Warn("Group ownership is not supported, skipping", "os", runtime.GOOS, "path", path)
+
+		return nil
+	}
+
+	gid, err := LookupGroupID(group)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chown(path, -1, gid); err != nil {
+		return fmt.Errorf("error changing file group: %w", err)
+	}
+
+	return nil
+}
+
+// LookupGroupID resolves a group name or numeric id to a group id.
+func LookupGroupID(group string) (int, error) {
+	if gid, err := strconv.Atoi(group); err == nil {
+		return gid, nil
+	}
+
+	info, err := user.LookupGroup(group)
+	if err != nil {
+		return -1, fmt.Errorf("error looking up group %s: %w", group, err)
+	}
+
+	gid, err := strconv.Atoi(info.Gid)
+	if err != nil {
+		return -1, fmt.Errorf("error parsing group id %s: %w", info.Gid, err)
+	}
+
+	return gid, nil
+}
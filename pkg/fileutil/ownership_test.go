@@ -0,0 +1,89 @@
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+// createFile creates a file with the given permission bits.
+func createFile(t *testing.T, mode os.FileMode) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "clip_proxy.mov")
+	if err := os.WriteFile(path, nil, mode); err != nil {
+		t.Fatalf("error creating %s: %v", path, err)
+	}
+
+	if err := os.Chmod(path, mode); err != nil {
+		t.Fatalf("error changing the mode of %s: %v", path, err)
+	}
+
+	return path
+}
+
+func TestApplyOwnershipMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("POSIX permission bits are not supported")
+	}
+
+	tests := []struct {
+		name string
+		mode os.FileMode
+		want os.FileMode
+	}{
+		{"group writable", 0o664, 0o664},
+		{"only permission bits", os.ModeSetgid | 0o640, 0o640},
+		{"unchanged", 0, 0o600},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := createFile(t, 0o600)
+
+			if err := ApplyOwnership(path, tt.mode, ""); err != nil {
+				t.Fatalf("ApplyOwnership() error = %v", err)
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("error getting info of %s: %v", path, err)
+			}
+
+			if got := info.Mode().Perm(); got != tt.want {
+				t.Errorf("ApplyOwnership() mode = %o, want %o", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyOwnershipGroup(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("group ownership is not supported")
+	}
+
+	// Any user can give a file its own primary group, without privileges
+	path := createFile(t, 0o600)
+
+	if err := ApplyOwnership(path, 0, strconv.Itoa(os.Getgid())); err != nil {
+		t.Errorf("ApplyOwnership() error = %v", err)
+	}
+}
+
+func TestApplyOwnershipMissingFile(t *testing.T) {
+	if err := ApplyOwnership(filepath.Join(t.TempDir(), "missing.mov"), 0o664, ""); err == nil {
+		t.Error("ApplyOwnership() error = nil, want the chmod failure")
+	}
+}
+
+func TestLookupGroupID(t *testing.T) {
+	if gid, err := LookupGroupID("1234"); err != nil || gid != 1234 {
+		t.Errorf("LookupGroupID(\"1234\") = %d, %v, want 1234", gid, err)
+	}
+
+	if _, err := LookupGroupID("no-such-group-media-processor"); err == nil {
+		t.Error("LookupGroupID() error = nil, want the unknown group")
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd
+
+package fileutil
+
+import "errors"
+
+// FreeSpace returns the number of bytes available to the current user on the volume holding a path.
+// It is only supported on Linux, macOS and FreeBSD.
+func FreeSpace(string) (uint64, error) {
+	return 0, errors.New("free space is not supported on this platform")
+}
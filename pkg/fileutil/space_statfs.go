@@ -0,0 +1,20 @@
+//go:build linux || darwin || freebsd
+
+package fileutil
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// FreeSpace returns the number of bytes available to the current user on the volume holding a path.
+func FreeSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, fmt.Errorf("error getting free space: %w", err)
+	}
+
+	// The field types differ between platforms
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil //nolint:gosec,unconvert
+}
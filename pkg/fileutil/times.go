@@ -0,0 +1,28 @@
+package fileutil
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// CopyModTime sets the modification time of a generated file to the one of its source.
+// The access time is set to the current time.
+// Creation times are not portable and are left unchanged.
+func CopyModTime(path string, sourcePath string) error {
+	sourceInfo, err := os.Stat(sourcePath)
+	if err != nil {
+		return fmt.Errorf("error getting source file info: %w", err)
+	}
+
+	return SetModTime(path, sourceInfo.ModTime())
+}
+
+// SetModTime sets the modification time of a file, and its access time to the current time.
+func SetModTime(path string, modTime time.Time) error {
+	if err := os.Chtimes(path, time.Now(), modTime); err != nil {
+		return fmt.Errorf("error setting file times: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package gpu
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stats holds the temperature and utilization of a GPU.
+type Stats struct {
+	Index       int
+	Temperature int
+	Utilization int
+}
+
+// ParseNvidiaSMI parses the output of
+// nvidia-smi --query-gpu=index,temperature.gpu,utilization.gpu --format=csv,noheader,nounits.
+func ParseNvidiaSMI(output string) ([]Stats, error) {
+	var stats []Stats
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Split(line, ",")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("unexpected nvidia-smi line: %q", line)
+		}
+
+		values := make([]int, len(fields))
+
+		for i, field := range fields {
+			value, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil {
+				return nil, fmt.Errorf("error parsing nvidia-smi value %q: %w", field, err)
+			}
+
+			values[i] = value
+		}
+
+		stats = append(stats, Stats{Index: values[0], Temperature: values[1], Utilization: values[2]})
+	}
+
+	return stats, nil
+}
+
+// ReadNvidiaSMI queries the current temperature and utilization of all GPUs with nvidia-smi.
+func ReadNvidiaSMI() ([]Stats, error) {
+	cmd := exec.Command("nvidia-smi",
+		"--query-gpu=index,temperature.gpu,utilization.gpu",
+		"--format=csv,noheader,nounits")
+
+	var stderr bytes.Buffer
+
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("error executing nvidia-smi: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return ParseNvidiaSMI(string(output))
+}
+
+// IsNvidiaSMIInstalled checks if nvidia-smi is available on the system.
+func IsNvidiaSMIInstalled() bool {
+	_, err := exec.LookPath("nvidia-smi")
+	return err == nil //nolint:nlreturn
+}
+
+// Throttle pauses job dispatch while a GPU runs above the configured thresholds.
+type Throttle struct {
+	// MaxTemperature is the temperature in °C above which dispatch pauses, or 0 to ignore it.
+	MaxTemperature int
+	// MaxUtilization is the utilization in percent above which dispatch pauses, or 0 to ignore it.
+	MaxUtilization int
+	// Interval is the delay between readings while paused.
+	Interval time.Duration
+	// Read returns the current GPU readings.
+	Read func() ([]Stats, error)
+	// Sleep waits between readings. It defaults to time.Sleep.
+	Sleep func(time.Duration)
+}
+
+// IsHot reports whether a reading exceeds the thresholds.
+func (t *Throttle) IsHot(stats Stats) bool {
+	if t.MaxTemperature > 0 && stats.Temperature > t.MaxTemperature {
+		return true
+	}
+
+	return t.MaxUtilization > 0 && stats.Utilization > t.MaxUtilization
+}
+
+// Wait blocks until the given GPU, or every GPU when device is negative, is below the thresholds.
+// Reading failures never block dispatch.
+func (t *Throttle) Wait(device int) {
+	sleep := t.Sleep
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+
+	for {
+		stats, err := t.Read()
+		if err != nil {
+			slog.Warn("Error reading GPU stats, not throttling", "error", err)
+
+			return
+		}
+
+		hot := false
+
+		for _, stat := range stats {
+			if (device < 0 || stat.Index == device) && t.IsHot(stat) {
+				slog.Info("GPU is too hot or busy, pausing dispatch",
+					"gpu", stat.Index, "temperature", stat.Temperature, "utilization", stat.Utilization)
+
+				hot = true
+			}
+		}
+
+		if !hot {
+			return
+		}
+
+		sleep(t.Interval)
+	}
+}
@@ -0,0 +1,150 @@
+package gpu
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseNvidiaSMI(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    []Stats
+		wantErr bool
+	}{
+		{
+			name:   "several GPUs",
+			output: "0, 45, 3\n1, 83, 97\n",
+			want:   []Stats{{Index: 0, Temperature: 45, Utilization: 3}, {Index: 1, Temperature: 83, Utilization: 97}},
+		},
+		{
+			name:   "blank lines",
+			output: "\n  0, 60, 50  \n\n",
+			want:   []Stats{{Index: 0, Temperature: 60, Utilization: 50}},
+		},
+		{
+			name: "no GPU",
+		},
+		{
+			name:    "missing field",
+			output:  "0, 45\n",
+			wantErr: true,
+		},
+		{
+			name:    "unsupported value",
+			output:  "0, 45, [N/A]\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseNvidiaSMI(tt.output)
+			if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseNvidiaSMI() = %+v, %v, want %+v (error: %v)", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+// readings returns a Read function returning each reading in turn, repeating the last one.
+func readings(stats ...[]Stats) (func() ([]Stats, error), *int) {
+	calls := 0
+
+	return func() ([]Stats, error) {
+		reading := stats[min(calls, len(stats)-1)]
+		calls++
+
+		return reading, nil
+	}, &calls
+}
+
+func TestThrottleWait(t *testing.T) {
+	cool := []Stats{{Index: 0, Temperature: 50, Utilization: 20}, {Index: 1, Temperature: 55, Utilization: 30}}
+	hotSecond := []Stats{{Index: 0, Temperature: 50, Utilization: 20}, {Index: 1, Temperature: 90, Utilization: 30}}
+	busyFirst := []Stats{{Index: 0, Temperature: 50, Utilization: 99}, {Index: 1, Temperature: 55, Utilization: 30}}
+
+	tests := []struct {
+		name      string
+		device    int
+		readings  [][]Stats
+		wantReads int
+	}{
+		{"cool", -1, [][]Stats{cool}, 1},
+		{"hot until it cools", -1, [][]Stats{hotSecond, hotSecond, cool}, 3},
+		{"busy until it idles", 0, [][]Stats{busyFirst, cool}, 2},
+		{"other GPU hot", 0, [][]Stats{hotSecond}, 1},
+		{"assigned GPU hot", 1, [][]Stats{hotSecond, cool}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			read, calls := readings(tt.readings...)
+
+			var slept []time.Duration
+
+			throttle := &Throttle{
+				MaxTemperature: 80,
+				MaxUtilization: 90,
+				Interval:       time.Minute,
+				Read:           read,
+				Sleep:          func(d time.Duration) { slept = append(slept, d) },
+			}
+
+			throttle.Wait(tt.device)
+
+			if *calls != tt.wantReads {
+				t.Errorf("Throttle.Wait() read %d times, want %d", *calls, tt.wantReads)
+			}
+
+			if len(slept) != tt.wantReads-1 {
+				t.Errorf("Throttle.Wait() slept %v, want %d pauses", slept, tt.wantReads-1)
+			}
+
+			for _, d := range slept {
+				if d != time.Minute {
+					t.Errorf("Throttle.Wait() slept %v, want the interval", d)
+				}
+			}
+		})
+	}
+}
+
+func TestThrottleWaitReadError(t *testing.T) {
+	throttle := &Throttle{
+		MaxTemperature: 80,
+		Read:           func() ([]Stats, error) { return nil, errors.New("nvidia-smi failed") },
+		Sleep:          func(time.Duration) { t.Error("Throttle.Wait() paused, want dispatch to go on") },
+	}
+
+	throttle.Wait(-1)
+}
+
+func TestThrottleIsHot(t *testing.T) {
+	tests := []struct {
+		name     string
+		throttle Throttle
+		stats    Stats
+		want     bool
+	}{
+		{
+			name:     "at thresholds",
+			throttle: Throttle{MaxTemperature: 80, MaxUtilization: 90},
+			stats:    Stats{Temperature: 80, Utilization: 90},
+			want:     false,
+		},
+		{"too hot", Throttle{MaxTemperature: 80}, Stats{Temperature: 81}, true},
+		{"too busy", Throttle{MaxUtilization: 90}, Stats{Utilization: 91}, true},
+		{"disabled", Throttle{}, Stats{Temperature: 100, Utilization: 100}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.throttle.IsHot(tt.stats); got != tt.want {
+				t.Errorf("Throttle.IsHot(%+v) = %v, want %v", tt.stats, got, tt.want)
+			}
+		})
+	}
+}
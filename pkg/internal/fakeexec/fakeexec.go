@@ -0,0 +1,235 @@
+// Package fakeexec fakes the external commands run by the tests, such as FFmpeg and FFprobe.
+// A Fake creates commands re-running the test binary, which Main turns into the faked command:
+// it prints the output registered for the command name and exits with its code.
+// Commands run by other packages are faked by installing links to the test binary on the PATH.
+package fakeexec
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Environment variables passing the output of the faked command to the helper process.
+const (
+	envHelper   = "FAKEEXEC_HELPER"
+	envStdout   = "FAKEEXEC_STDOUT"
+	envStderr   = "FAKEEXEC_STDERR"
+	envExitCode = "FAKEEXEC_EXIT_CODE"
+	// envDir is the directory of the commands installed on the PATH, holding their outputs and calls.
+	envDir = "FAKEEXEC_DIR"
+)
+
+// callsFileName is the name of the file the installed commands append their name and arguments to.
+const callsFileName = "calls.jsonl"
+
+// notFoundExitCode is the exit code of commands without a registered output, as returned by shells.
+const notFoundExitCode = 127
+
+// Output is what a faked command prints and the code it exits with.
+type Output struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// Fake creates faked commands, printing the Output registered for their name.
+// An Output registered as "name arg" is used over the one of the name alone when the command is run with
+// arg, e.g. "ffprobe mpegts" for the probes forcing the MPEG-TS format. The first matching argument wins.
+// It records the commands it created, and is safe for concurrent use.
+type Fake struct {
+	Outputs map[string]Output
+
+	mu    sync.Mutex
+	calls [][]string
+	dir   string
+}
+
+// Command is a replacement of exec.Command creating a faked command.
+func (f *Fake) Command(name string, args ...string) *exec.Cmd {
+	return f.CommandContext(context.Background(), name, args...)
+}
+
+// CommandContext is a replacement of exec.CommandContext creating a faked command.
+func (f *Fake) CommandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	f.mu.Lock()
+	f.calls = append(f.calls, append([]string{name}, args...))
+	f.mu.Unlock()
+
+	output, ok := lookupOutput(f.Outputs, name, args)
+	if !ok {
+		output = Output{Stderr: name + ": not faked", ExitCode: notFoundExitCode}
+	}
+
+	cmd := exec.CommandContext(ctx, os.Args[0], append([]string{"--", name}, args...)...) //nolint:gosec
+	cmd.Env = append(os.Environ(),
+		envHelper+"=1",
+		envStdout+"="+output.Stdout,
+		envStderr+"="+output.Stderr,
+		envExitCode+"="+strconv.Itoa(output.ExitCode))
+
+	return cmd
+}
+
+// Install fakes the commands on the PATH for the duration of the test, for commands that are run by other
+// packages. Each command with a registered output is a link to the test binary.
+// Tests installing a Fake can't run in parallel.
+func (f *Fake) Install(t *testing.T) {
+	t.Helper()
+
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatalf("error getting the test binary: %v", err)
+	}
+
+	f.dir = t.TempDir()
+
+	// Each command gets the outputs registered for its name along with its arguments
+	commands := make(map[string]map[string]Output)
+
+	for key, output := range f.Outputs {
+		name, _, _ := strings.Cut(key, " ")
+		if commands[name] == nil {
+			commands[name] = make(map[string]Output)
+		}
+
+		commands[name][key] = output
+	}
+
+	for name, outputs := range commands {
+		if err := os.Symlink(executable, filepath.Join(f.dir, name)); err != nil {
+			t.Fatalf("error installing %s: %v", name, err)
+		}
+
+		data, err := json.Marshal(outputs)
+		if err != nil {
+			t.Fatalf("error marshalling the outputs of %s: %v", name, err)
+		}
+
+		if err := os.WriteFile(filepath.Join(f.dir, name+".json"), data, 0o600); err != nil {
+			t.Fatalf("error writing the outputs of %s: %v", name, err)
+		}
+	}
+
+	t.Setenv(envDir, f.dir)
+	t.Setenv("PATH", f.dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// Calls returns the name and arguments of the commands created so far, including the installed ones.
+func (f *Fake) Calls() [][]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	calls := append([][]string(nil), f.calls...)
+
+	if f.dir == "" {
+		return calls
+	}
+
+	file, err := os.Open(filepath.Join(f.dir, callsFileName))
+	if err != nil {
+		return calls
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+
+	for scanner.Scan() {
+		var call []string
+		if json.Unmarshal(scanner.Bytes(), &call) == nil {
+			calls = append(calls, call)
+		}
+	}
+
+	return calls
+}
+
+// Main runs the tests, or acts as the faked command when the test binary is run by a Fake.
+// It must be called by the TestMain of the packages using a Fake.
+func Main(m *testing.M) {
+	if dir := os.Getenv(envDir); dir != "" && os.Getenv(envHelper) != "1" {
+		if name := filepath.Base(os.Args[0]); isInstalled(dir, name) {
+			os.Exit(runInstalled(dir, name))
+		}
+	}
+
+	if os.Getenv(envHelper) != "1" {
+		os.Exit(m.Run())
+	}
+
+	fmt.Fprint(os.Stdout, os.Getenv(envStdout))
+	fmt.Fprint(os.Stderr, os.Getenv(envStderr))
+
+	exitCode, err := strconv.Atoi(os.Getenv(envExitCode))
+	if err != nil {
+		exitCode = 1
+	}
+
+	os.Exit(exitCode)
+}
+
+// lookupOutput returns the output registered for a command run with the given arguments.
+func lookupOutput(outputs map[string]Output, name string, args []string) (Output, bool) {
+	for _, arg := range args {
+		if output, ok := outputs[name+" "+arg]; ok {
+			return output, true
+		}
+	}
+
+	output, ok := outputs[name]
+
+	return output, ok
+}
+
+// isInstalled reports whether a command was installed in the directory.
+func isInstalled(dir string, name string) bool {
+	_, err := os.Stat(filepath.Join(dir, name+".json"))
+	return err == nil //nolint:nlreturn
+}
+
+// runInstalled acts as a command installed in the directory: it records the call, prints the registered
+// output and returns its exit code.
+func runInstalled(dir string, name string) int {
+	call, _ := json.Marshal(append([]string{name}, os.Args[1:]...))
+
+	calls, err := os.OpenFile(filepath.Join(dir, callsFileName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err == nil {
+		_, _ = calls.Write(append(call, '\n'))
+		_ = calls.Close()
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, name+".json"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: not faked\n", name)
+
+		return notFoundExitCode
+	}
+
+	var outputs map[string]Output
+	if err := json.Unmarshal(data, &outputs); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: invalid outputs: %v\n", name, err)
+
+		return 1
+	}
+
+	output, ok := lookupOutput(outputs, name, os.Args[1:])
+	if !ok {
+		fmt.Fprintf(os.Stderr, "%s: not faked\n", name)
+
+		return notFoundExitCode
+	}
+
+	fmt.Fprint(os.Stdout, output.Stdout)
+	fmt.Fprint(os.Stderr, output.Stderr)
+
+	return output.ExitCode
+}
@@ -0,0 +1,123 @@
+package manifest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// CacheFileName is the name of the cache of processed sources stored in the watch path.
+const CacheFileName = ".media-processor-cache.json"
+
+// CacheEntry is the state of a source when it was last processed successfully, along with its proxy.
+type CacheEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Output  string    `json:"output"`
+	Status  string    `json:"status"`
+}
+
+// Cache remembers successfully processed sources so unchanged ones can be skipped without probing them.
+// It is safe for concurrent use.
+type Cache struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]CacheEntry
+	dirty   bool
+}
+
+// LoadCache reads the cache at the given path. A missing file yields an empty cache.
+func LoadCache(path string) (*Cache, error) {
+	cache := &Cache{path: path, entries: make(map[string]CacheEntry)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cache, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading cache: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &cache.entries); err != nil {
+		return nil, fmt.Errorf("error unmarshalling cache: %w", err)
+	}
+
+	return cache, nil
+}
+
+// Lookup returns the cache entry of a source when its size and modification time are unchanged
+// and its proxy still exists. Entries of changed sources or removed proxies are dropped.
+func (c *Cache) Lookup(source string, size int64, modTime time.Time) (CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[source]
+	if !ok {
+		return CacheEntry{}, false
+	}
+
+	if entry.Size == size && entry.ModTime.Equal(modTime) {
+		if _, err := os.Stat(entry.Output); err == nil {
+			return entry, true
+		}
+	}
+
+	delete(c.entries, source)
+
+	c.dirty = true
+
+	return CacheEntry{}, false
+}
+
+// Record stores the state of a successfully processed source.
+func (c *Cache) Record(source string, entry CacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[source] = entry
+	c.dirty = true
+}
+
+// Invalidate forgets a source so it is processed again on the next run.
+func (c *Cache) Invalidate(source string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[source]; ok {
+		delete(c.entries, source)
+
+		c.dirty = true
+	}
+}
+
+// Save writes the cache to disk when it changed since it was loaded.
+func (c *Cache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.dirty {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling cache: %w", err)
+	}
+
+	tmpPath := c.path + ".tmp"
+	if err := os.WriteFile(tmpPath, append(data, '\n'), 0o644); err != nil { //nolint:gosec
+		return fmt.Errorf("error writing cache: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, c.path); err != nil {
+		return fmt.Errorf("error replacing cache: %w", err)
+	}
+
+	c.dirty = false
+
+	return nil
+}
@@ -0,0 +1,141 @@
+package manifest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// InFlightFileName is the name of the file tracking the sources being processed, stored in the watch path.
+const InFlightFileName = ".media-processor-inflight.json"
+
+// InFlightEntry records a source being processed and the outputs it is writing.
+type InFlightEntry struct {
+	Started time.Time `json:"started"`
+	Outputs []string  `json:"outputs,omitempty"`
+}
+
+// InFlight persists the sources being processed, so that a run following a crash can remove
+// their partial outputs and process them again. Every change is written to disk immediately.
+// It is safe for concurrent use.
+type InFlight struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]InFlightEntry
+}
+
+// LoadInFlight reads the in-flight sources at the given path. A missing file yields an empty set.
+func LoadInFlight(path string) (*InFlight, error) {
+	inFlight := &InFlight{path: path, entries: make(map[string]InFlightEntry)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return inFlight, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading in-flight sources: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &inFlight.entries); err != nil {
+		return nil, fmt.Errorf("error unmarshalling in-flight sources: %w", err)
+	}
+
+	return inFlight, nil
+}
+
+// Recover removes the outputs left by sources that were in flight when the previous run stopped,
+// and returns those sources sorted by path. The set is emptied.
+func (f *InFlight) Recover() ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	sources := make([]string, 0, len(f.entries))
+
+	for source, entry := range f.entries {
+		for _, output := range entry.Outputs {
+			if err := os.Remove(output); err == nil {
+				slog.Info("Removed partial output of interrupted source", "source", source, "output", output)
+			} else if !errors.Is(err, os.ErrNotExist) {
+				return nil, fmt.Errorf("error removing partial output: %w", err)
+			}
+		}
+
+		sources = append(sources, source)
+	}
+
+	slices.Sort(sources)
+
+	f.entries = make(map[string]InFlightEntry)
+
+	return sources, f.save()
+}
+
+// Start marks a source as being processed.
+func (f *InFlight) Start(source string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.entries[source] = InFlightEntry{Started: time.Now()}
+
+	return f.save()
+}
+
+// AddOutput records a file a started source is about to write, removed if the run is interrupted.
+// Outputs of sources that were not started are ignored, so a complete output can never be removed by mistake.
+func (f *InFlight) AddOutput(source string, output string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entry, ok := f.entries[source]
+	if !ok {
+		return nil
+	}
+
+	entry.Outputs = append(entry.Outputs, output)
+	f.entries[source] = entry
+
+	return f.save()
+}
+
+// Finish marks a source as no longer being processed, whatever the outcome.
+func (f *InFlight) Finish(source string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.entries, source)
+
+	return f.save()
+}
+
+// save writes the set to disk, removing the file once no source is in flight.
+func (f *InFlight) save() error {
+	if len(f.entries) == 0 {
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("error removing in-flight sources: %w", err)
+		}
+
+		return nil
+	}
+
+	data, err := json.MarshalIndent(f.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling in-flight sources: %w", err)
+	}
+
+	tmpPath := f.path + ".tmp"
+	if err := os.WriteFile(tmpPath, append(data, '\n'), 0o644); err != nil { //nolint:gosec
+		return fmt.Errorf("error writing in-flight sources: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, f.path); err != nil {
+		return fmt.Errorf("error replacing in-flight sources: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestInFlightRecover(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, InFlightFileName)
+	partial := filepath.Join(dir, "Proxy", "b.mov")
+	complete := filepath.Join(dir, "Proxy", "c.mov")
+
+	for _, output := range []string{partial, complete} {
+		if err := os.MkdirAll(filepath.Dir(output), 0o755); err != nil {
+			t.Fatalf("error creating %s: %v", filepath.Dir(output), err)
+		}
+
+		if err := os.WriteFile(output, []byte("proxy"), 0o600); err != nil {
+			t.Fatalf("error creating %s: %v", output, err)
+		}
+	}
+
+	inFlight, err := LoadInFlight(path)
+	if err != nil {
+		t.Fatalf("LoadInFlight() error = %v", err)
+	}
+
+	// b.mov and a missing output of a.mov are being written when the run crashes, c.mov was finished before
+	for _, source := range []string{"b.mov", "a.mov", "c.mov"} {
+		if err := inFlight.Start(source); err != nil {
+			t.Fatalf("InFlight.Start() error = %v", err)
+		}
+	}
+
+	for source, output := range map[string]string{"b.mov": partial, "a.mov": filepath.Join(dir, "Proxy", "a.mov")} {
+		if err := inFlight.AddOutput(source, output); err != nil {
+			t.Fatalf("InFlight.AddOutput() error = %v", err)
+		}
+	}
+
+	if err := inFlight.AddOutput("c.mov", complete); err != nil {
+		t.Fatalf("InFlight.AddOutput() error = %v", err)
+	}
+
+	if err := inFlight.Finish("c.mov"); err != nil {
+		t.Fatalf("InFlight.Finish() error = %v", err)
+	}
+
+	// A late output of a finished source is never removed
+	if err := inFlight.AddOutput("c.mov", complete); err != nil {
+		t.Fatalf("InFlight.AddOutput() error = %v", err)
+	}
+
+	restarted, err := LoadInFlight(path)
+	if err != nil {
+		t.Fatalf("LoadInFlight() error = %v", err)
+	}
+
+	sources, err := restarted.Recover()
+	if err != nil {
+		t.Fatalf("InFlight.Recover() error = %v", err)
+	}
+
+	if want := []string{"a.mov", "b.mov"}; !slices.Equal(sources, want) {
+		t.Errorf("InFlight.Recover() = %v, want %v", sources, want)
+	}
+
+	if _, err := os.Stat(partial); !os.IsNotExist(err) {
+		t.Errorf("partial output error = %v, want it removed", err)
+	}
+
+	if _, err := os.Stat(complete); err != nil {
+		t.Errorf("complete output error = %v, want it kept", err)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("in-flight file error = %v after recovery, want it removed", err)
+	}
+}
+
+func TestInFlightFinish(t *testing.T) {
+	path := filepath.Join(t.TempDir(), InFlightFileName)
+
+	inFlight, err := LoadInFlight(path)
+	if err != nil {
+		t.Fatalf("LoadInFlight() error = %v", err)
+	}
+
+	if err := inFlight.Start("a.mov"); err != nil {
+		t.Fatalf("InFlight.Start() error = %v", err)
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("in-flight file error = %v while a source is in flight, want it written", err)
+	}
+
+	if err := inFlight.Finish("a.mov"); err != nil {
+		t.Fatalf("InFlight.Finish() error = %v", err)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("in-flight file error = %v once nothing is in flight, want it removed", err)
+	}
+}
+
+func TestLoadInFlightInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), InFlightFileName)
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatalf("error creating %s: %v", path, err)
+	}
+
+	if _, err := LoadInFlight(path); err == nil {
+		t.Error("LoadInFlight() error = nil, want an error")
+	}
+}
@@ -0,0 +1,89 @@
+package manifest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileName is the name of the manifest file stored in each proxy directory.
+const FileName = ".media-processor-manifest.json"
+
+// mu serializes manifest updates within the process.
+var mu sync.Mutex
+
+// Entry records the source file a proxy was generated from.
+type Entry struct {
+	Source string `json:"source"`
+	Proxy  string `json:"proxy"`
+	// Partial is set when the proxy was kept from an encode that failed before the end.
+	Partial bool `json:"partial,omitempty"`
+}
+
+// Manifest maps proxy file names to the source they were generated from.
+type Manifest struct {
+	Entries map[string]Entry `json:"entries"`
+}
+
+// Load reads the manifest at the given path. A missing file yields an empty manifest.
+func Load(path string) (Manifest, error) {
+	manifest := Manifest{Entries: make(map[string]Entry)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return manifest, nil
+	}
+
+	if err != nil {
+		return manifest, fmt.Errorf("error reading manifest: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, fmt.Errorf("error unmarshalling manifest: %w", err)
+	}
+
+	if manifest.Entries == nil {
+		manifest.Entries = make(map[string]Entry)
+	}
+
+	return manifest, nil
+}
+
+// Record adds or replaces the entry for a proxy in the manifest stored in its directory.
+func Record(entry Entry) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	path := filepath.Join(filepath.Dir(entry.Proxy), FileName)
+
+	manifest, err := Load(path)
+	if err != nil {
+		return err
+	}
+
+	manifest.Entries[filepath.Base(entry.Proxy)] = entry
+
+	return save(path, manifest)
+}
+
+// save writes the manifest atomically by renaming a temporary file over it.
+func save(path string, manifest Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling manifest: %w", err)
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, append(data, '\n'), 0o644); err != nil { //nolint:gosec
+		return fmt.Errorf("error writing manifest: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("error replacing manifest: %w", err)
+	}
+
+	return nil
+}
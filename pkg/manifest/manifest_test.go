@@ -0,0 +1,61 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecord(t *testing.T) {
+	dir := t.TempDir()
+
+	entries := []Entry{
+		{Source: "/footage/take #3.mov", Proxy: filepath.Join(dir, "take_3_proxy.mov")},
+		{Source: "/footage/-clip.mov", Proxy: filepath.Join(dir, "_clip_proxy.mov"), Partial: true},
+		{Source: "/footage/take #3 v2.mov", Proxy: filepath.Join(dir, "take_3_proxy.mov")},
+	}
+
+	for _, entry := range entries {
+		if err := Record(entry); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	manifest, err := Load(filepath.Join(dir, FileName))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	want := map[string]Entry{
+		"take_3_proxy.mov": entries[2],
+		"_clip_proxy.mov":  entries[1],
+	}
+
+	if len(manifest.Entries) != len(want) {
+		t.Errorf("Load() entries = %v, want %v", manifest.Entries, want)
+	}
+
+	for name, entry := range want {
+		if got := manifest.Entries[name]; got != entry {
+			t.Errorf("Load() entry %s = %+v, want %+v", name, got, entry)
+		}
+	}
+}
+
+func TestLoadMissing(t *testing.T) {
+	manifest, err := Load(filepath.Join(t.TempDir(), FileName))
+	if err != nil || manifest.Entries == nil || len(manifest.Entries) != 0 {
+		t.Errorf("Load() = %+v, %v, want an empty manifest", manifest, err)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatalf("error writing manifest: %v", err)
+	}
+
+	if _, err := Load(path); err == nil {
+		t.Error("Load() error = nil, want the unmarshalling error")
+	}
+}
@@ -0,0 +1,112 @@
+package manifest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// QuarantineFileName is the name of the quarantine file stored in the watch path.
+const QuarantineFileName = ".media-processor-quarantine.json"
+
+// QuarantineEntry records the failures of a source.
+type QuarantineEntry struct {
+	Reason      string    `json:"reason"`
+	Attempts    int       `json:"attempts"`
+	LastFailure time.Time `json:"last_failure"`
+}
+
+// Quarantine tracks sources that repeatedly fail so later runs can skip them.
+// It is safe for concurrent use.
+type Quarantine struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]QuarantineEntry
+	dirty   bool
+}
+
+// LoadQuarantine reads the quarantine at the given path. A missing file yields an empty quarantine.
+func LoadQuarantine(path string) (*Quarantine, error) {
+	quarantine := &Quarantine{path: path, entries: make(map[string]QuarantineEntry)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return quarantine, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading quarantine: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &quarantine.entries); err != nil {
+		return nil, fmt.Errorf("error unmarshalling quarantine: %w", err)
+	}
+
+	return quarantine, nil
+}
+
+// Lookup returns the quarantine entry of a source when it failed at least maxAttempts times.
+func (q *Quarantine) Lookup(source string, maxAttempts int) (QuarantineEntry, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entry, ok := q.entries[source]
+
+	return entry, ok && maxAttempts > 0 && entry.Attempts >= maxAttempts
+}
+
+// RecordFailure increments the failure count of a source.
+func (q *Quarantine) RecordFailure(source string, reason string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entry := q.entries[source]
+	entry.Reason = reason
+	entry.Attempts++
+	entry.LastFailure = time.Now()
+	q.entries[source] = entry
+	q.dirty = true
+}
+
+// Clear removes a source from the quarantine after it succeeded.
+func (q *Quarantine) Clear(source string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.entries[source]; ok {
+		delete(q.entries, source)
+
+		q.dirty = true
+	}
+}
+
+// Save writes the quarantine to disk when it changed since it was loaded.
+func (q *Quarantine) Save() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.dirty {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(q.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling quarantine: %w", err)
+	}
+
+	tmpPath := q.path + ".tmp"
+	if err := os.WriteFile(tmpPath, append(data, '\n'), 0o644); err != nil { //nolint:gosec
+		return fmt.Errorf("error writing quarantine: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, q.path); err != nil {
+		return fmt.Errorf("error replacing quarantine: %w", err)
+	}
+
+	q.dirty = false
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package manifest
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestQuarantineLookup(t *testing.T) {
+	tests := []struct {
+		name        string
+		failures    int
+		maxAttempts int
+		want        bool
+	}{
+		{"below threshold", 2, 3, false},
+		{"at threshold", 3, 3, true},
+		{"above threshold", 4, 3, true},
+		{"never failed", 0, 3, false},
+		{"quarantine disabled", 5, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quarantine, err := LoadQuarantine(filepath.Join(t.TempDir(), QuarantineFileName))
+			if err != nil {
+				t.Fatalf("LoadQuarantine() error = %v", err)
+			}
+
+			for range tt.failures {
+				quarantine.RecordFailure("/footage/clip.mov", "invalid data")
+			}
+
+			entry, ok := quarantine.Lookup("/footage/clip.mov", tt.maxAttempts)
+			if ok != tt.want {
+				t.Errorf("Quarantine.Lookup() = %v, want %v", ok, tt.want)
+			}
+
+			if entry.Attempts != tt.failures {
+				t.Errorf("Quarantine.Lookup() attempts = %d, want %d", entry.Attempts, tt.failures)
+			}
+		})
+	}
+}
+
+func TestQuarantineRecordFailure(t *testing.T) {
+	quarantine, err := LoadQuarantine(filepath.Join(t.TempDir(), QuarantineFileName))
+	if err != nil {
+		t.Fatalf("LoadQuarantine() error = %v", err)
+	}
+
+	quarantine.RecordFailure("/footage/clip.mov", "invalid data")
+	quarantine.RecordFailure("/footage/clip.mov", "unsupported codec")
+
+	entry, _ := quarantine.Lookup("/footage/clip.mov", 1)
+	if entry.Attempts != 2 || entry.Reason != "unsupported codec" || entry.LastFailure.IsZero() {
+		t.Errorf("Quarantine.Lookup() = %+v, want 2 attempts with the last reason and time", entry)
+	}
+
+	quarantine.Clear("/footage/clip.mov")
+
+	if _, ok := quarantine.Lookup("/footage/clip.mov", 1); ok {
+		t.Error("Quarantine.Lookup() = true after Clear(), want false")
+	}
+}
+
+func TestQuarantineSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), QuarantineFileName)
+
+	quarantine, err := LoadQuarantine(path)
+	if err != nil {
+		t.Fatalf("LoadQuarantine() error = %v", err)
+	}
+
+	quarantine.RecordFailure("/footage/clip.mov", "invalid data")
+
+	if err := quarantine.Save(); err != nil {
+		t.Fatalf("Quarantine.Save() error = %v", err)
+	}
+
+	loaded, err := LoadQuarantine(path)
+	if err != nil {
+		t.Fatalf("LoadQuarantine() error = %v", err)
+	}
+
+	if entry, ok := loaded.Lookup("/footage/clip.mov", 1); !ok || entry.Reason != "invalid data" {
+		t.Errorf("Quarantine.Lookup() = %+v, %v after reloading, want the recorded failure", entry, ok)
+	}
+}
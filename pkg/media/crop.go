@@ -0,0 +1,137 @@
+package media
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+)
+
+const (
+	// cropDetectSamples is the number of points in the file sampled by cropdetect.
+	cropDetectSamples = 5
+	// cropDetectFrames is the number of frames analyzed at each sample point.
+	cropDetectFrames = 24
+	// cropDetectMinAgreement is the share (in percent) of detections that must agree on a rectangle.
+	cropDetectMinAgreement = 80
+)
+
+var cropDetectExp = regexp.MustCompile(`crop=(\d+):(\d+):(\d+):(\d+)`)
+
+// Crop describes a crop rectangle as reported by FFmpeg's cropdetect filter.
+type Crop struct {
+	Width  int
+	Height int
+	X      int
+	Y      int
+}
+
+// Filter returns the FFmpeg crop filter for the rectangle.
+func (c Crop) Filter() string {
+	return fmt.Sprintf("crop=%d:%d:%d:%d", c.Width, c.Height, c.X, c.Y)
+}
+
+// ParseCropDetect extracts a stable crop rectangle from cropdetect output.
+// It returns false when no rectangle was detected or when the detections disagree too much.
+func ParseCropDetect(output string) (Crop, bool) {
+	matches := cropDetectExp.FindAllStringSubmatch(output, -1)
+	if len(matches) == 0 {
+		return Crop{}, false
+	}
+
+	counts := make(map[Crop]int)
+
+	var (
+		best      Crop
+		bestCount int
+	)
+
+	for _, match := range matches {
+		var crop Crop
+
+		crop.Width, _ = strconv.Atoi(match[1])
+		crop.Height, _ = strconv.Atoi(match[2])
+		crop.X, _ = strconv.Atoi(match[3])
+		crop.Y, _ = strconv.Atoi(match[4])
+
+		counts[crop]++
+		if counts[crop] > bestCount {
+			best = crop
+			bestCount = counts[crop]
+		}
+	}
+
+	if bestCount*100 < len(matches)*cropDetectMinAgreement {
+		return Crop{}, false
+	}
+
+	if best.Width <= 0 || best.Height <= 0 {
+		return Crop{}, false
+	}
+
+	return best, true
+}
+
+// DetectCrop runs cropdetect on a sampling of frames and returns the crop rectangle to apply.
+// It returns nil when no bars were found or the detection is ambiguous.
+// Input options such as HTTP headers can be passed in inputArgs.
+func DetectCrop(filePath string, info MediaInfo, inputArgs ...string) (*Crop, error) {
+	width, height := 0, 0
+
+	for _, stream := range info.Streams {
+		if stream.CodecType == "video" && stream.Disposition.AttachedPic == 0 {
+			width, height = stream.Width, stream.Height
+
+			break
+		}
+	}
+
+	if width == 0 || height == 0 {
+		return nil, nil //nolint:nilnil
+	}
+
+	duration, err := info.DurationSeconds()
+	if err != nil || duration <= 0 {
+		duration = 0
+	}
+
+	var output []byte
+
+	for i := range cropDetectSamples {
+		offset := duration * float64(2*i+1) / float64(2*cropDetectSamples)
+
+		args := []string{"-hide_banner", "-ss", strconv.FormatFloat(offset, 'f', 3, 64)}
+		args = append(args, inputArgs...)
+		args = append(args,
+			"-i", filePath,
+			"-frames:v", strconv.Itoa(cropDetectFrames),
+			"-vf", "cropdetect=round=2",
+			"-an", "-f", "null", "-")
+
+		cmd := execCommand("ffmpeg", args...) //nolint:gosec
+
+		sampleOutput, err := cmd.CombinedOutput()
+		if err != nil {
+			return nil, fmt.Errorf("error executing ffmpeg cropdetect: %w", err)
+		}
+
+		output = append(output, sampleOutput...)
+
+		if duration == 0 {
+			break
+		}
+	}
+
+	crop, ok := ParseCropDetect(string(output))
+	if !ok {
+		slog.Info("Crop detection is ambiguous, not cropping", "path", filePath)
+
+		return nil, nil //nolint:nilnil
+	}
+
+	if crop.Width >= width && crop.Height >= height {
+		return nil, nil //nolint:nilnil
+	}
+
+	return &crop, nil
+}
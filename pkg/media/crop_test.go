@@ -0,0 +1,113 @@
+package media
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/internal/fakeexec"
+)
+
+// cropDetectLine returns a line printed by the cropdetect filter for a rectangle.
+func cropDetectLine(crop string) string {
+	return "[Parsed_cropdetect_0 @ 0x55d5] x1:0 x2:1919 y1:138 y2:941 w:1920 h:800 x:0 y:140 pts:1 t:0.04 " +
+		"limit:0.094118 crop=" + crop + "\n"
+}
+
+func TestParseCropDetect(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   Crop
+		wantOK bool
+	}{
+		{
+			name:   "stable crop",
+			output: strings.Repeat(cropDetectLine("1920:800:0:140"), 10),
+			want:   Crop{Width: 1920, Height: 800, X: 0, Y: 140},
+			wantOK: true,
+		},
+		{
+			name: "mostly stable crop",
+			output: strings.Repeat(cropDetectLine("1920:800:0:140"), 9) +
+				cropDetectLine("1920:1080:0:0"),
+			want:   Crop{Width: 1920, Height: 800, X: 0, Y: 140},
+			wantOK: true,
+		},
+		{
+			name: "changing crop",
+			output: strings.Repeat(cropDetectLine("1920:800:0:140"), 5) +
+				strings.Repeat(cropDetectLine("1440:1080:240:0"), 5),
+			wantOK: false,
+		},
+		{
+			name:   "no crop lines",
+			output: "Input #0, mov,mp4,m4a,3gp,3g2,mj2, from 'clip.mov':\n  Duration: 00:00:10.00\n",
+			wantOK: false,
+		},
+		{
+			name:   "empty rectangle",
+			output: strings.Repeat(cropDetectLine("0:0:0:0"), 10),
+			wantOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseCropDetect(tt.output)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("ParseCropDetect() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestCropFilter(t *testing.T) {
+	crop := Crop{Width: 1920, Height: 800, X: 0, Y: 140}
+
+	if got, want := crop.Filter(), "crop=1920:800:0:140"; got != want {
+		t.Errorf("Crop.Filter() = %q, want %q", got, want)
+	}
+}
+
+func TestDetectCrop(t *testing.T) {
+	tests := []struct {
+		name   string
+		stderr string
+		want   *Crop
+	}{
+		{"letterboxed", strings.Repeat(cropDetectLine("1920:800:0:140"), 4), &Crop{Width: 1920, Height: 800, Y: 140}},
+		{"full frame", strings.Repeat(cropDetectLine("1920:1080:0:0"), 4), nil},
+		{"no detection", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := fakeCommands(t, map[string]fakeexec.Output{"ffmpeg": {Stderr: tt.stderr}})
+
+			got, err := DetectCrop("clip.mov", parseProbe(t, probeVideoOnly))
+			if err != nil {
+				t.Fatalf("DetectCrop() error = %v", err)
+			}
+
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("DetectCrop() = %+v, want %+v", got, tt.want)
+			}
+
+			if calls := fake.Calls(); len(calls) != cropDetectSamples {
+				t.Errorf("commands run = %d, want %d samples", len(calls), cropDetectSamples)
+			}
+		})
+	}
+}
+
+func TestDetectCropAudioOnly(t *testing.T) {
+	fake := fakeCommands(t, map[string]fakeexec.Output{})
+
+	if got, err := DetectCrop("voice.wav", parseProbe(t, probeAudioOnly)); got != nil || err != nil {
+		t.Errorf("DetectCrop() = %+v, %v, want nil, nil", got, err)
+	}
+
+	if calls := fake.Calls(); len(calls) != 0 {
+		t.Errorf("commands run = %v, want none", calls)
+	}
+}
@@ -0,0 +1,42 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoDuration is returned when FFprobe reports no duration, e.g. "N/A" for live or fragmented inputs.
+var ErrNoDuration = errors.New("no duration")
+
+// DurationSeconds parses the container duration reported by FFprobe, in seconds.
+func (info MediaInfo) DurationSeconds() (float64, error) {
+	value := strings.TrimSpace(info.Format.Duration)
+	if value == "" || value == "N/A" {
+		return 0, ErrNoDuration
+	}
+
+	duration, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing duration %q: %w", value, err)
+	}
+
+	if math.IsNaN(duration) || math.IsInf(duration, 0) || duration < 0 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+
+	return duration, nil
+}
+
+// Duration parses the container duration reported by FFprobe.
+func (info MediaInfo) Duration() (time.Duration, error) {
+	seconds, err := info.DurationSeconds()
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
@@ -0,0 +1,56 @@
+package media
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDuration(t *testing.T) {
+	tests := []struct {
+		name        string
+		duration    string
+		wantSeconds float64
+		want        time.Duration
+		wantErr     error
+	}{
+		{"whole seconds", "123", 123, 123 * time.Second, nil},
+		{"fractional", "123.456000", 123.456, 123*time.Second + 456*time.Millisecond, nil},
+		{"surrounding spaces", " 1.5\n", 1.5, 1500 * time.Millisecond, nil},
+		{"zero", "0.000000", 0, 0, nil},
+		{"not available", "N/A", 0, 0, ErrNoDuration},
+		{"missing", "", 0, 0, ErrNoDuration},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var info MediaInfo
+			info.Format.Duration = tt.duration
+
+			seconds, err := info.DurationSeconds()
+			if !errors.Is(err, tt.wantErr) || seconds != tt.wantSeconds {
+				t.Errorf("DurationSeconds() = %v, %v, want %v, %v", seconds, err, tt.wantSeconds, tt.wantErr)
+			}
+
+			duration, err := info.Duration()
+			if !errors.Is(err, tt.wantErr) || duration != tt.want {
+				t.Errorf("Duration() = %v, %v, want %v, %v", duration, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDurationInvalid(t *testing.T) {
+	for _, value := range []string{"abc", "-1.0", "NaN", "Inf"} {
+		var info MediaInfo
+		info.Format.Duration = value
+
+		if seconds, err := info.DurationSeconds(); err == nil || errors.Is(err, ErrNoDuration) {
+			t.Errorf("DurationSeconds(%q) = %v, %v, want a parse error", value, seconds, err)
+		}
+
+		if duration, err := info.Duration(); err == nil {
+			t.Errorf("Duration(%q) = %v, want an error", value, duration)
+		}
+	}
+}
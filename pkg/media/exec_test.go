@@ -0,0 +1,52 @@
+package media
+
+import (
+	"os/exec"
+	"sync"
+	"testing"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/internal/fakeexec"
+)
+
+// pixFmtsOutput is an excerpt of the ffmpeg -pix_fmts table.
+const pixFmtsOutput = `Pixel formats:
+I.... = Supported Input  format for conversion
+.O... = Supported Output format for conversion
+..H.. = Hardware accelerated format
+...P. = Paletted format
+....B = Bitstream format
+FLAGS NAME            NB_COMPONENTS BITS_PER_PIXEL BIT_DEPTHS
+-----
+IO... yuv420p                3            12      8-8-8
+IO... yuvj420p               3            12      8-8-8
+IO... yuv422p10le            3            20      10-10-10
+IO... yuv420p10le            3            15      10-10-10
+IO... gray                   1             8      8
+..H.. cuda                   0             0      0
+`
+
+func TestMain(m *testing.M) {
+	fakeexec.Main(m)
+}
+
+// fakeCommands fakes FFmpeg and FFprobe for the duration of the test. The pixel format table is loaded
+// from the faked FFmpeg if it isn't given an output.
+func fakeCommands(t *testing.T, outputs map[string]fakeexec.Output) *fakeexec.Fake {
+	t.Helper()
+
+	if _, ok := outputs["ffmpeg"]; !ok {
+		outputs["ffmpeg"] = fakeexec.Output{Stdout: pixFmtsOutput}
+	}
+
+	fake := &fakeexec.Fake{Outputs: outputs}
+
+	execCommand = fake.Command
+	loadPixelFormatTable = sync.OnceValues(LoadPixelFormatTable)
+
+	t.Cleanup(func() {
+		execCommand = exec.Command
+		loadPixelFormatTable = sync.OnceValues(LoadPixelFormatTable)
+	})
+
+	return fake
+}
@@ -0,0 +1,27 @@
+package media
+
+import (
+	"strings"
+)
+
+// fragmentedBrands are the MP4 brands written by fragmenting muxers (DASH, CMAF, MSE captures).
+var fragmentedBrands = []string{"dash", "msdh", "msix", "cmfc", "cmf2", "iso6"}
+
+// IsFragmentedMP4 reports whether the probed file is a fragmented MP4 without a full index,
+// detected from its brands or from a missing duration.
+func IsFragmentedMP4(info MediaInfo) bool {
+	if !strings.Contains(info.Format.FormatName, "mp4") {
+		return false
+	}
+
+	brands := strings.ToLower(info.Format.Tags["major_brand"] + " " + info.Format.Tags["compatible_brands"])
+	for _, brand := range fragmentedBrands {
+		if strings.Contains(brands, brand) {
+			return true
+		}
+	}
+
+	duration, err := info.DurationSeconds()
+
+	return err != nil || duration <= 0
+}
@@ -0,0 +1,45 @@
+package media
+
+import "testing"
+
+// probeFragmentedMP4 is the ffprobe output of a DASH capture: its brands mark it as fragmented, and without
+// a full index only the first fragment is seen, so the reported duration is wrong.
+const probeFragmentedMP4 = `{"format": {"filename": "capture.mp4", "format_name": "mov,mp4,m4a,3gp,3g2,mj2",
+	"duration": "2.002", "tags": {"major_brand": "iso6", "compatible_brands": "iso6dashmp41"}}, "streams": [
+	{"index": 0, "codec_type": "video", "codec_name": "h264", "width": 1280, "height": 720,
+	 "pix_fmt": "yuv420p", "r_frame_rate": "30/1", "avg_frame_rate": "30/1"}]}`
+
+func TestIsFragmentedMP4(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   bool
+	}{
+		{"fragmented brands", probeFragmentedMP4, true},
+		{
+			"missing duration",
+			`{"format": {"filename": "stream.mp4", "format_name": "mov,mp4,m4a,3gp,3g2,mj2", "duration": "N/A",
+				"tags": {"major_brand": "isom"}}, "streams": []}`,
+			true,
+		},
+		{
+			"regular mp4",
+			`{"format": {"filename": "phone.mp4", "format_name": "mov,mp4,m4a,3gp,3g2,mj2", "duration": "10.0",
+				"tags": {"major_brand": "isom", "compatible_brands": "isomiso2avc1mp41"}}, "streams": []}`,
+			false,
+		},
+		{
+			"other container without duration",
+			`{"format": {"filename": "live.ts", "format_name": "mpegts", "duration": "N/A"}, "streams": []}`,
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsFragmentedMP4(parseProbe(t, tt.output)); got != tt.want {
+				t.Errorf("IsFragmentedMP4() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package media
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// VideoFrameCount returns the number of frames of the first video stream from the probe metadata.
+// It prefers nb_frames and falls back to duration × average frame rate, returning false when neither is known.
+func VideoFrameCount(info MediaInfo) (int64, bool) {
+	for _, stream := range info.Streams {
+		if stream.CodecType != "video" || stream.Disposition.AttachedPic == 1 ||
+			IsPlaceholderVideo(stream.Width, stream.Height) {
+			continue
+		}
+
+		if frames, err := strconv.ParseInt(stream.NbFrames, 10, 64); err == nil && frames > 0 {
+			return frames, true
+		}
+
+		duration, err := strconv.ParseFloat(stream.Duration, 64)
+		if err != nil {
+			duration, err = info.DurationSeconds()
+		}
+
+		frameRate, ok := ParseFrameRate(stream.AvgFrameRate)
+		if err != nil || !ok || duration <= 0 {
+			return 0, false
+		}
+
+		return int64(math.Round(duration * frameRate)), true
+	}
+
+	return 0, false
+}
+
+// CountFrames counts the video frames of a file by streaming FFprobe's frame list.
+func CountFrames(filePath string) (int64, error) {
+	var count int64
+
+	err := StreamFrames(filePath, func(frame Frame) error {
+		if frame.MediaType == "video" {
+			count++
+		}
+
+		return nil
+	})
+
+	return count, err
+}
+
+// frameRateTolerance is the relative difference between the base and average frame rates
+// of a stream still considered constant, absorbing the rounding of the average.
+const frameRateTolerance = 0.005
+
+// IsVariableFrameRate reports whether a stream has a variable frame rate, from its base (r_frame_rate)
+// and average (avg_frame_rate) FFprobe frame rates. Constant frame rate streams have the same ones.
+func IsVariableFrameRate(baseRate string, avgRate string) bool {
+	base, ok := ParseFrameRate(baseRate)
+	if !ok {
+		return false
+	}
+
+	avg, ok := ParseFrameRate(avgRate)
+	if !ok {
+		return false
+	}
+
+	return math.Abs(base-avg) > avg*frameRateTolerance
+}
+
+// ParseFrameRate parses an FFprobe rational frame rate like "30000/1001".
+func ParseFrameRate(rate string) (float64, bool) {
+	numStr, denStr, found := strings.Cut(rate, "/")
+	if !found {
+		denStr = "1"
+	}
+
+	num, err := strconv.ParseFloat(numStr, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	den, err := strconv.ParseFloat(denStr, 64)
+	if err != nil || den == 0 || num <= 0 {
+		return 0, false
+	}
+
+	return num / den, true
+}
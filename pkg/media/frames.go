@@ -0,0 +1,116 @@
+package media
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Frame is a single frame entry of an FFprobe -show_frames output.
+type Frame struct {
+	MediaType string `json:"media_type"`
+	KeyFrame  int    `json:"key_frame"`
+	PtsTime   string `json:"pts_time"`
+	PictType  string `json:"pict_type"`
+}
+
+// DecodeFrames incrementally decodes the frames of an FFprobe JSON output and calls fn for each of them.
+// Only one frame is held in memory at a time, so it is suitable for very large outputs.
+func DecodeFrames(r io.Reader, fn func(Frame) error) error {
+	decoder := json.NewDecoder(r)
+
+	if err := expectDelim(decoder, '{'); err != nil {
+		return err
+	}
+
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return fmt.Errorf("error reading ffprobe output: %w", err)
+		}
+
+		if key, ok := token.(string); !ok || key != "frames" {
+			// Skip values of other sections
+			var skipped json.RawMessage
+			if err := decoder.Decode(&skipped); err != nil {
+				return fmt.Errorf("error reading ffprobe output: %w", err)
+			}
+
+			continue
+		}
+
+		if err := expectDelim(decoder, '['); err != nil {
+			return err
+		}
+
+		for decoder.More() {
+			var frame Frame
+			if err := decoder.Decode(&frame); err != nil {
+				return fmt.Errorf("error decoding frame: %w", err)
+			}
+
+			if err := fn(frame); err != nil {
+				return err
+			}
+		}
+
+		if err := expectDelim(decoder, ']'); err != nil {
+			return err
+		}
+	}
+
+	return expectDelim(decoder, '}')
+}
+
+// StreamFrames runs FFprobe -show_frames on the first video stream and decodes its output while it is produced.
+// Use it instead of GetMediaInfo for probes whose output is too large to buffer.
+func StreamFrames(filePath string, fn func(Frame) error) error {
+	cmd := execCommand("ffprobe",
+		"-hide_banner",
+		"-loglevel", "error",
+		"-select_streams", "v:0",
+		"-show_frames",
+		"-show_entries", "frame=media_type,key_frame,pts_time,pict_type",
+		"-print_format", "json",
+		filePath)
+
+	var stderr bytes.Buffer
+
+	cmd.Stderr = &stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("error creating ffprobe pipe: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("error starting ffprobe: %w", err)
+	}
+
+	decodeErr := DecodeFrames(stdout, fn)
+	if decodeErr != nil {
+		// Drain the pipe so ffprobe can exit
+		_, _ = io.Copy(io.Discard, stdout)
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("error executing ffprobe: %w%s", err, formatStderr(stderr.String()))
+	}
+
+	return decodeErr
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return fmt.Errorf("error reading ffprobe output: %w", err)
+	}
+
+	if token != delim {
+		return errors.New("unexpected ffprobe output: expected " + delim.String())
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/internal/fakeexec"
+)
+
+// framesReader generates an FFprobe -show_frames output of count frames as it is read,
+// keeping track of the number of bytes read.
+type framesReader struct {
+	count  int
+	next   int
+	buffer strings.Reader
+	read   int
+	ended  bool
+}
+
+// newFramesReader returns a reader generating count frames.
+func newFramesReader(count int) *framesReader {
+	r := &framesReader{count: count}
+	r.buffer.Reset(`{"frames": [`)
+
+	return r
+}
+
+func (r *framesReader) Read(p []byte) (int, error) {
+	for r.buffer.Len() == 0 {
+		switch {
+		case r.next < r.count:
+			separator := ","
+			if r.next == 0 {
+				separator = ""
+			}
+
+			r.buffer.Reset(fmt.Sprintf(`%s{"media_type": "video", "key_frame": %d, "pts_time": "%.6f", "pict_type": "I"}`,
+				separator, boolToInt(r.next%25 == 0), float64(r.next)/25))
+			r.next++
+		case !r.ended:
+			r.buffer.Reset(`], "streams": [{"index": 0}]}`)
+			r.ended = true
+		default:
+			return 0, io.EOF
+		}
+	}
+
+	n, err := r.buffer.Read(p)
+	r.read += n
+
+	return n, err
+}
+
+// boolToInt returns 1 for true and 0 for false, as FFprobe prints flags.
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+func TestDecodeFramesLargeOutput(t *testing.T) {
+	const count = 200_000
+
+	reader := newFramesReader(count)
+
+	var (
+		frames, keyFrames int
+		readAtFirstFrame  int
+	)
+
+	err := DecodeFrames(reader, func(frame Frame) error {
+		if frames == 0 {
+			readAtFirstFrame = reader.read
+		}
+
+		frames++
+		keyFrames += frame.KeyFrame
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("DecodeFrames() error = %v", err)
+	}
+
+	if frames != count || keyFrames != count/25 {
+		t.Errorf("DecodeFrames() decoded %d frames and %d key frames, want %d and %d", frames, keyFrames, count, count/25)
+	}
+
+	// Frames are handed out while the output is read, never after buffering all of it
+	if readAtFirstFrame >= reader.read/100 {
+		t.Errorf("DecodeFrames() read %d of %d bytes before the first frame, want a small part", readAtFirstFrame,
+			reader.read)
+	}
+}
+
+func TestDecodeFramesStop(t *testing.T) {
+	errStop := errors.New("stop")
+	reader := newFramesReader(1000)
+
+	frames := 0
+
+	err := DecodeFrames(reader, func(Frame) error {
+		frames++
+		if frames == 10 {
+			return errStop
+		}
+
+		return nil
+	})
+	if !errors.Is(err, errStop) || frames != 10 {
+		t.Errorf("DecodeFrames() = %v after %d frames, want %v after 10", err, frames, errStop)
+	}
+}
+
+func TestDecodeFramesInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+	}{
+		{"not an object", `[]`},
+		{"frames not a list", `{"frames": {}}`},
+		{"truncated", `{"frames": [{"media_type": "video"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := DecodeFrames(strings.NewReader(tt.output), func(Frame) error { return nil }); err == nil {
+				t.Error("DecodeFrames() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestStreamFrames(t *testing.T) {
+	fakeCommands(t, map[string]fakeexec.Output{"ffprobe": {
+		Stdout: `{"frames": [{"media_type": "video", "key_frame": 1, "pts_time": "0.000000", "pict_type": "I"},
+			{"media_type": "video", "key_frame": 0, "pts_time": "0.040000", "pict_type": "P"}]}`,
+	}})
+
+	var got []Frame
+
+	if err := StreamFrames("clip.mov", func(frame Frame) error {
+		got = append(got, frame)
+
+		return nil
+	}); err != nil {
+		t.Fatalf("StreamFrames() error = %v", err)
+	}
+
+	if len(got) != 2 || got[0].KeyFrame != 1 || got[1].PictType != "P" || got[1].PtsTime != "0.040000" {
+		t.Errorf("StreamFrames() frames = %+v, want the faked frames", got)
+	}
+}
+
+func TestStreamFramesFailure(t *testing.T) {
+	fakeCommands(t, map[string]fakeexec.Output{"ffprobe": {Stderr: "clip.mov: Invalid data", ExitCode: 1}})
+
+	err := StreamFrames("clip.mov", func(Frame) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "Invalid data") {
+		t.Errorf("StreamFrames() error = %v, want the ffprobe failure with its output", err)
+	}
+}
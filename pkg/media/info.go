@@ -1,47 +1,130 @@
 package media
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"math"
 	"os/exec"
 	"regexp"
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
 )
 
+// averrorInvalidData is the FFmpeg error code reported when the input can't be parsed.
+const averrorInvalidData = -1094995529
+
+// ErrInvalidData is returned by GetMediaInfo when FFprobe can't parse the input, e.g. because of a wrong container.
+var ErrInvalidData = errors.New("invalid data found when processing input")
+
+// SideData is a side data entry of an FFprobe stream, such as its display matrix.
+type SideData struct {
+	SideDataType string  `json:"side_data_type"`
+	Rotation     float64 `json:"rotation"`
+}
+
 // MediaInfo represents the structure of FFprobe output.
 type MediaInfo struct {
+	Error struct {
+		Code   int    `json:"code"`
+		String string `json:"string"`
+	} `json:"error"`
 	Format struct {
-		FilePath string `json:"filename"`
-		Duration string `json:"duration"`
-		Bitrate  string `json:"bit_rate"`
+		FilePath   string            `json:"filename"`
+		FormatName string            `json:"format_name"`
+		Duration   string            `json:"duration"`
+		Bitrate    string            `json:"bit_rate"`
+		Tags       map[string]string `json:"tags"`
 	} `json:"format"`
 	Streams []struct {
-		Index        int    `json:"index"`
-		CodecType    string `json:"codec_type"`
-		CodecName    string `json:"codec_name"`
-		CodecProfile string `json:"profile"`
-		Width        int    `json:"width"`
-		Height       int    `json:"height"`
-		Bitrate      string `json:"bit_rate"`
-		PixelFormat  string `json:"pix_fmt"`
+		Index          int               `json:"index"`
+		CodecType      string            `json:"codec_type"`
+		CodecName      string            `json:"codec_name"`
+		CodecProfile   string            `json:"profile"`
+		Width          int               `json:"width"`
+		Height         int               `json:"height"`
+		Bitrate        string            `json:"bit_rate"`
+		Channels       int               `json:"channels"`
+		SampleRate     string            `json:"sample_rate"`
+		PixelFormat    string            `json:"pix_fmt"`
+		ColorRange     string            `json:"color_range"`
+		ColorTransfer  string            `json:"color_transfer"`
+		ColorPrimaries string            `json:"color_primaries"`
+		NbFrames       string            `json:"nb_frames"`
+		RFrameRate     string            `json:"r_frame_rate"`
+		AvgFrameRate   string            `json:"avg_frame_rate"`
+		Duration       string            `json:"duration"`
+		Tags           map[string]string `json:"tags"`
+		SideDataList   []SideData        `json:"side_data_list"`
+		Disposition    struct {
+			AttachedPic int `json:"attached_pic"`
+		} `json:"disposition"`
 	} `json:"streams"`
 }
 
+// Orientation is the displayed orientation of the video of a source.
+type Orientation int
+
+// Orientations of a source. Sources without video, or whose video has unknown dimensions, have an unknown one.
+const (
+	OrientationUnknown Orientation = iota
+	OrientationHorizontal
+	OrientationVertical
+)
+
 // Properties contains analyzed media properties.
 type Properties struct {
 	HasVideoStream         bool
 	HasAudioStream         bool
-	IsVertical             bool
+	HasSubtitleStream      bool
+	TextSubtitleStreams    []int
+	HasAttachedPicture     bool
+	Orientation            Orientation
+	Width                  int
+	Height                 int
+	Rotation               int
 	UnsupportedAudioFormat bool
 	HighestBitDepth        int
+	VideoCodec             string
+	AudioCodec             string
+	AudioChannels          int
+	AudioSampleRate        int
+	PixelFormat            string
+	ColorRange             string
+	ColorTransfer          string
+	ColorPrimaries         string
+	HDR                    bool
+	Timecode               string
+	FrameRate              string
+	VariableFrameRate      bool
+	CreationTime           string
+	Crop                   *Crop
+}
+
+// IsHDRTransfer reports whether an FFprobe color transfer is an HDR one, PQ (smpte2084) or HLG (arib-std-b67).
+func IsHDRTransfer(transfer string) bool {
+	return transfer == "smpte2084" || transfer == "arib-std-b67"
+}
+
+// placeholderVideoMaxSize is the largest width and height of a video stream considered a placeholder.
+const placeholderVideoMaxSize = 16
+
+// IsPlaceholderVideo reports whether a video stream is too small to be real video,
+// like the 1x1 streams some phones add to audio recordings.
+func IsPlaceholderVideo(width int, height int) bool {
+	return width > 0 && height > 0 && width <= placeholderVideoMaxSize && height <= placeholderVideoMaxSize
 }
 
 // IsMediaFile checks if a file has a media extension.
 func IsMediaFile(filePath string) bool {
-	mediaExtensions := []string{".mp4", ".avi", ".mkv", ".mov", ".flv", ".wmv", ".mp3", ".wav", ".aac", ".ogg", ".flac"}
+	mediaExtensions := []string{
+		".mp4", ".avi", ".mkv", ".mov", ".flv", ".wmv", ".mp3", ".wav", ".aac", ".ogg", ".flac", ".mxf",
+	}
 	for _, ext := range mediaExtensions {
 		lowercaseFilePath := strings.ToLower(filePath)
 		if strings.HasSuffix(lowercaseFilePath, ext) {
@@ -53,10 +136,26 @@ func IsMediaFile(filePath string) bool {
 }
 
 // GetMediaInfo uses FFprobe to get information about a media file.
-func GetMediaInfo(filePath string) (MediaInfo, error) {
+// Input options such as HTTP headers can be passed in inputArgs.
+func GetMediaInfo(filePath string, inputArgs ...string) (MediaInfo, error) {
+	return probe(nil, filePath, inputArgs)
+}
+
+// GetMediaInfoReader uses FFprobe to get information about media read from r, such as a download stream,
+// for formats that FFprobe can read without seeking. The duration of the format is often unavailable for such
+// non-seekable input, when it is only known from the end of the file, and DurationSeconds then fails.
+func GetMediaInfoReader(r io.Reader) (MediaInfo, error) {
+	return probe(r, "pipe:0", nil)
+}
+
+// execCommand creates the FFmpeg and FFprobe commands. Tests replace it to fake their output.
+var execCommand = exec.Command
+
+// probe runs FFprobe on input, feeding it stdin when not nil.
+func probe(stdin io.Reader, input string, inputArgs []string) (MediaInfo, error) {
 	var info MediaInfo
 
-	cmd := exec.Command("ffprobe",
+	args := []string{
 		"-hide_banner",
 		"-loglevel", "fatal",
 		"-show_error",
@@ -64,110 +163,223 @@ func GetMediaInfo(filePath string) (MediaInfo, error) {
 		"-show_streams",
 		"-show_private_data",
 		"-print_format", "json",
-		filePath)
+	}
+	args = append(args, inputArgs...)
+	args = append(args, input)
 
-	output, err := cmd.CombinedOutput()
+	cmd := execCommand("ffprobe", args...)
+	cmd.Stdin = stdin
+
+	// Keep stderr apart so warnings never end up in the JSON output
+	var stderr bytes.Buffer
+
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
 	if err != nil {
-		return info, fmt.Errorf("error executing ffprobe: %w", err)
+		// -show_error reports the reason in the JSON output
+		if json.Unmarshal(output, &info) == nil && info.Error.Code == averrorInvalidData {
+			return info, fmt.Errorf("error executing ffprobe: %w", ErrInvalidData)
+		}
+
+		if info.Error.String != "" {
+			return info, fmt.Errorf("error executing ffprobe: %w: %s", err, info.Error.String)
+		}
+
+		return info, fmt.Errorf("error executing ffprobe: %w%s", err, formatStderr(stderr.String()))
 	}
 
 	if err := json.Unmarshal(output, &info); err != nil {
-		return info, fmt.Errorf("error unmarshalling ffprobe output: %w", err)
+		return info, fmt.Errorf("error unmarshalling ffprobe output: %w%s", err, formatStderr(stderr.String()))
 	}
 
 	return info, nil
 }
 
-func processPixelFormatMatch(match []string, pixelFormat string, pixelFormatExp *regexp.Regexp) (int, error) {
-	result := make(map[string]string)
-
-	for i, name := range pixelFormatExp.SubexpNames() {
-		if i != 0 && name != "" {
-			result[name] = match[i]
-		}
+// formatStderr formats captured stderr output for inclusion in an error message.
+func formatStderr(stderr string) string {
+	stderr = strings.TrimSpace(stderr)
+	if stderr == "" {
+		return ""
 	}
 
-	if result["name"] == pixelFormat {
-		bitDepthStr, ok := result["bit_depth"]
-		if !ok {
-			return -1, fmt.Errorf("bit depth not found for pixel format %s", pixelFormat)
+	return ": " + stderr
+}
+
+// pixelFormatExp matches a line of the ffmpeg -pix_fmts table.
+var pixelFormatExp = regexp.MustCompile(
+	`^.{5}\s(?<name>[^\r\n\s=]*)\s*(?P<nb_components>[0-9])\s*(?P<bpp>[0-9]*)\s*(?P<bit_depth>(?:[0-9]+-)*[0-9]+)$`)
+
+// loadPixelFormatTable caches the result of LoadPixelFormatTable for the run.
+var loadPixelFormatTable = sync.OnceValues(LoadPixelFormatTable)
+
+// ParsePixelFormatTable parses the output of ffmpeg -pix_fmts into a map of pixel format names to bit depths.
+// The bit depth of a format with several components is the depth of its first component.
+func ParsePixelFormatTable(output string) map[string]int {
+	table := make(map[string]int)
+
+	nameIndex := pixelFormatExp.SubexpIndex("name")
+	componentsIndex := pixelFormatExp.SubexpIndex("nb_components")
+	bitDepthIndex := pixelFormatExp.SubexpIndex("bit_depth")
+
+	for _, line := range strings.Split(output, "\n") {
+		match := pixelFormatExp.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if match == nil {
+			continue
 		}
 
-		nbComponentsStr, ok := result["nb_components"]
-		if !ok {
-			return -1, fmt.Errorf("number of components not found for pixel format %s", pixelFormat)
+		bitDepthStr := match[bitDepthIndex]
+		if nbComponents, _ := strconv.Atoi(match[componentsIndex]); nbComponents > 1 {
+			bitDepthStr = strings.Split(bitDepthStr, "-")[0]
 		}
 
-		nbComponentsInt, err := strconv.Atoi(nbComponentsStr)
+		bitDepth, err := strconv.Atoi(bitDepthStr)
 		if err != nil {
-			return -1, fmt.Errorf("error converting number of components to int: %w", err)
+			continue
 		}
 
-		if nbComponentsInt > 1 {
-			bitDepthStr = strings.Split(bitDepthStr, "-")[0]
+		if _, ok := table[match[nameIndex]]; !ok {
+			table[match[nameIndex]] = bitDepth
 		}
+	}
+
+	return table
+}
 
-		bitDepth, _ := strconv.Atoi(bitDepthStr)
+// LoadPixelFormatTable runs ffmpeg -pix_fmts and returns the bit depth of every pixel format.
+func LoadPixelFormatTable() (map[string]int, error) {
+	cmd := execCommand("ffmpeg", "-hide_banner", "-pix_fmts")
 
-		return bitDepth, nil
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("error executing ffmpeg: %w", err)
 	}
 
-	return -1, fmt.Errorf("pixel format %s not found", pixelFormat)
+	return ParsePixelFormatTable(string(output)), nil
 }
 
 // GetBitDepth determines the bit depth of a pixel format.
+// The pixel format table is loaded from FFmpeg once and reused.
 func GetBitDepth(pixelFormat string) (int, error) {
-	cmd := exec.Command("ffmpeg", "-hide_banner", "-pix_fmts")
-
-	output, err := cmd.CombinedOutput()
+	table, err := loadPixelFormatTable()
 	if err != nil {
-		return -1, fmt.Errorf("error executing ffmpeg: %w", err)
+		return -1, err
 	}
 
-	outputArr := strings.Split(string(output), "\n")
+	bitDepth, ok := table[pixelFormat]
+	if !ok {
+		return -1, fmt.Errorf("pixel format %s not found", pixelFormat)
+	}
 
-	const pixelFormatExpStr = `^.{5}\s(?<name>[^\r\n\s=]*)\s*(?P<nb_components>[0-9])\s*(?P<bpp>[0-9]*)\s*(?P<bit_depth>(?:[0-9]+-)*[0-9]+)$` //nolint:lll
-	pixelFormatExp := regexp.MustCompile(pixelFormatExpStr)
+	return bitDepth, nil
+}
 
-	for _, line := range outputArr {
-		match := pixelFormatExp.FindStringSubmatch(line)
-		if len(match) > 0 {
-			bitDepth, err := processPixelFormatMatch(match, pixelFormat, pixelFormatExp)
-			if err == nil {
-				return bitDepth, nil
-			}
+// DefaultSupportedAudioCodecs lists the audio codecs NLEs decode natively. A trailing * matches a codec prefix.
+var DefaultSupportedAudioCodecs = []string{"mp3", "opus", "flac", "ac3", "aac", "pcm_*", "adpcm_*"}
+
+// IsAudioCodecSupported checks if an audio codec is among DefaultSupportedAudioCodecs.
+func IsAudioCodecSupported(codecName string) bool {
+	return IsAudioCodecSupportedWith(codecName, DefaultSupportedAudioCodecs)
+}
+
+// IsAudioCodecSupportedWith checks if an audio codec is among the allowed ones.
+// An allowed codec ending with * matches every codec starting with it, e.g. pcm_* for pcm_s16le.
+func IsAudioCodecSupportedWith(codecName string, allowed []string) bool {
+	if codecName == "" {
+		return false
+	}
+
+	for _, codec := range allowed {
+		if prefix, ok := strings.CutSuffix(codec, "*"); ok && strings.HasPrefix(codecName, prefix) {
+			return true
+		}
+
+		if codec == codecName {
+			return true
 		}
 	}
 
-	return -1, fmt.Errorf("pixel format %s not found", pixelFormat)
+	return false
 }
 
-// IsAudioCodecSupported checks if an audio codec is supported.
-func IsAudioCodecSupported(codecName string) bool {
-	supportedFormats := []string{"mp3", "opus", "flac", "ac3"}
-
-	switch {
-	case strings.Contains(codecName, "pcm_"):
-		return true
-	case slices.Contains(supportedFormats, codecName):
-		return true
-	default:
-		return false
+// IsTextSubtitleCodec reports whether a subtitle codec is text based, and can be converted to mov_text or SRT.
+// Bitmap subtitles such as PGS or DVD subtitles can't.
+func IsTextSubtitleCodec(codecName string) bool {
+	textCodecs := []string{"subrip", "srt", "ass", "ssa", "mov_text", "webvtt", "text", "microdvd", "subviewer"}
+
+	return slices.Contains(textCodecs, codecName)
+}
+
+// streamRotation returns the clockwise display rotation of a stream in degrees, normalized to 0, 90, 180 or 270.
+// It is read from the display matrix side data, or from the rotate tag of older FFprobe versions.
+func streamRotation(sideData []SideData, tags map[string]string) int {
+	var rotation float64
+
+	found := false
+
+	for _, data := range sideData {
+		if data.SideDataType == "Display Matrix" {
+			// The display matrix rotation is counterclockwise
+			rotation = -data.Rotation
+			found = true
+
+			break
+		}
 	}
+
+	if !found {
+		value, err := strconv.ParseFloat(tags["rotate"], 64)
+		if err != nil {
+			return 0
+		}
+
+		rotation = value
+	}
+
+	degrees := int(math.Round(rotation/90)) * 90 % 360
+	if degrees < 0 {
+		degrees += 360
+	}
+
+	return degrees
 }
 
 // AnalyzeMediaInfo analyzes the media info and returns properties.
 func AnalyzeMediaInfo(info MediaInfo) Properties {
-	var props Properties
+	return AnalyzeMediaInfoWith(info, DefaultSupportedAudioCodecs)
+}
+
+// AnalyzeMediaInfoWith is AnalyzeMediaInfo flagging the audio codecs missing from supportedAudioCodecs
+// as unsupported, as matched by IsAudioCodecSupportedWith.
+func AnalyzeMediaInfoWith(info MediaInfo, supportedAudioCodecs []string) Properties {
+	var (
+		props        Properties
+		audioStreams int
+	)
 
 	for _, stream := range info.Streams {
 		if stream.CodecType == "video" {
+			// Cover art is stored as a single-picture video stream
+			if stream.Disposition.AttachedPic == 1 {
+				slog.Debug("Ignoring attached picture stream", "index", stream.Index)
+
+				props.HasAttachedPicture = true
+
+				continue
+			}
+
+			if IsPlaceholderVideo(stream.Width, stream.Height) {
+				slog.Debug("Ignoring placeholder video stream",
+					"index", stream.Index, "width", stream.Width, "height", stream.Height)
+
+				continue
+			}
+
 			props.HasVideoStream = true
 
 			bitDepth, err := GetBitDepth(stream.PixelFormat)
 			if err != nil {
-				log.Printf("Error getting bit depth for pixel format %s: %v\n", stream.PixelFormat, err)
-				log.Printf("Using default bit depth of 8\n")
+				slog.Warn("Error getting bit depth, using 8 bits", "pixel_format", stream.PixelFormat, "error", err)
 
 				bitDepth = 8 // Default to 8 if error occurs
 			}
@@ -176,18 +388,77 @@ func AnalyzeMediaInfo(info MediaInfo) Properties {
 				props.HighestBitDepth = bitDepth
 			}
 
-			if stream.Width > stream.Height {
-				props.IsVertical = false
-			} else {
-				props.IsVertical = true
+			props.ColorRange = stream.ColorRange
+			props.ColorTransfer = stream.ColorTransfer
+			props.ColorPrimaries = stream.ColorPrimaries
+			props.HDR = IsHDRTransfer(stream.ColorTransfer)
+			props.VideoCodec = stream.CodecName
+			props.PixelFormat = stream.PixelFormat
+			props.FrameRate = stream.AvgFrameRate
+			props.VariableFrameRate = IsVariableFrameRate(stream.RFrameRate, stream.AvgFrameRate)
+
+			if timecode, ok := stream.Tags["timecode"]; ok && props.Timecode == "" {
+				props.Timecode = timecode
+			}
+
+			if creationTime, ok := stream.Tags["creation_time"]; ok && props.CreationTime == "" {
+				props.CreationTime = creationTime
+			}
+
+			// Players and FFmpeg rotate the picture, so a quarter turn swaps the displayed dimensions
+			rotation := streamRotation(stream.SideDataList, stream.Tags)
+			props.Rotation = rotation
+
+			width, height := stream.Width, stream.Height
+			if rotation%180 != 0 {
+				width, height = height, width
+			}
+
+			props.Width, props.Height = width, height
+
+			switch {
+			case width <= 0 || height <= 0:
+				props.Orientation = OrientationUnknown
+			case width > height:
+				props.Orientation = OrientationHorizontal
+			default:
+				props.Orientation = OrientationVertical
 			}
 		}
 
 		if stream.CodecType == "audio" {
 			props.HasAudioStream = true
-			props.UnsupportedAudioFormat = !IsAudioCodecSupported(stream.CodecName)
+			props.UnsupportedAudioFormat = !IsAudioCodecSupportedWith(stream.CodecName, supportedAudioCodecs)
+			props.AudioCodec = stream.CodecName
+			props.AudioChannels = max(props.AudioChannels, stream.Channels)
+
+			// Streams of different or unknown rates have no common one
+			sampleRate, err := strconv.Atoi(stream.SampleRate)
+			if err != nil || (audioStreams > 0 && sampleRate != props.AudioSampleRate) {
+				sampleRate = 0
+			}
+
+			props.AudioSampleRate = sampleRate
+			audioStreams++
+		}
+
+		if stream.CodecType == "subtitle" {
+			props.HasSubtitleStream = true
+
+			if IsTextSubtitleCodec(stream.CodecName) {
+				props.TextSubtitleStreams = append(props.TextSubtitleStreams, stream.Index)
+			}
 		}
 	}
 
+	if timecode, ok := info.Format.Tags["timecode"]; ok && props.Timecode == "" {
+		props.Timecode = timecode
+	}
+
+	// The creation date of the file wins over the one of its video stream
+	if creationTime, ok := info.Format.Tags["creation_time"]; ok && creationTime != "" {
+		props.CreationTime = creationTime
+	}
+
 	return props
 }
@@ -0,0 +1,462 @@
+package media
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/internal/fakeexec"
+)
+
+// Outputs of ffprobe -show_format -show_streams -print_format json.
+const (
+	probeVideoOnly = `{"format": {"filename": "clip.mov", "duration": "10.0"}, "streams": [
+		{"index": 0, "codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080,
+		 "pix_fmt": "yuv420p", "r_frame_rate": "25/1", "avg_frame_rate": "25/1"}]}`
+	probeAudioOnly = `{"format": {"filename": "voice.wav", "duration": "10.0"}, "streams": [
+		{"index": 0, "codec_type": "audio", "codec_name": "pcm_s24le", "channels": 2, "sample_rate": "48000"}]}`
+	probeVertical = `{"format": {"filename": "phone.mp4", "duration": "10.0"}, "streams": [
+		{"index": 0, "codec_type": "video", "codec_name": "hevc", "width": 1080, "height": 1920,
+		 "pix_fmt": "yuv420p", "r_frame_rate": "30/1", "avg_frame_rate": "30/1"},
+		{"index": 1, "codec_type": "audio", "codec_name": "aac", "channels": 2, "sample_rate": "44100"}]}`
+	probeRotated = `{"format": {"filename": "phone.mov", "duration": "10.0"}, "streams": [
+		{"index": 0, "codec_type": "video", "codec_name": "hevc", "width": 1920, "height": 1080,
+		 "pix_fmt": "yuv420p", "side_data_list": [{"side_data_type": "Display Matrix", "rotation": -90}]}]}`
+	probeHighBitDepth = `{"format": {"filename": "master.mov", "duration": "10.0"}, "streams": [
+		{"index": 0, "codec_type": "video", "codec_name": "prores", "width": 3840, "height": 2160,
+		 "pix_fmt": "yuv422p10le", "r_frame_rate": "24000/1001", "avg_frame_rate": "24000/1001"},
+		{"index": 1, "codec_type": "audio", "codec_name": "alac", "channels": 6, "sample_rate": "48000"}]}`
+	probeCoverArt = `{"format": {"filename": "song.mp3", "duration": "180.0"}, "streams": [
+		{"index": 0, "codec_type": "audio", "codec_name": "mp3", "channels": 2, "sample_rate": "44100"},
+		{"index": 1, "codec_type": "video", "codec_name": "mjpeg", "width": 600, "height": 600,
+		 "pix_fmt": "yuvj420p", "disposition": {"attached_pic": 1}}]}`
+	probePlaceholderVideo = `{"format": {"filename": "memo.m4a", "duration": "60.0"}, "streams": [
+		{"index": 0, "codec_type": "audio", "codec_name": "aac", "channels": 1, "sample_rate": "48000"},
+		{"index": 1, "codec_type": "video", "codec_name": "h264", "width": 2, "height": 2,
+		 "pix_fmt": "yuv420p", "r_frame_rate": "1/1", "avg_frame_rate": "1/1"}]}`
+	probeFullRange = `{"format": {"filename": "screen.mp4", "duration": "10.0"}, "streams": [
+		{"index": 0, "codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080,
+		 "pix_fmt": "yuvj420p", "color_range": "pc", "r_frame_rate": "60/1", "avg_frame_rate": "60/1"}]}`
+	probeLimitedRange = `{"format": {"filename": "camera.mov", "duration": "10.0"}, "streams": [
+		{"index": 0, "codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080,
+		 "pix_fmt": "yuv420p", "color_range": "tv", "r_frame_rate": "25/1", "avg_frame_rate": "25/1"}]}`
+)
+
+// parseProbe unmarshals an FFprobe output.
+func parseProbe(t *testing.T, output string) MediaInfo {
+	t.Helper()
+
+	var info MediaInfo
+	if err := json.Unmarshal([]byte(output), &info); err != nil {
+		t.Fatalf("error unmarshalling probe output: %v", err)
+	}
+
+	return info
+}
+
+func TestAnalyzeMediaInfo(t *testing.T) {
+	tests := []struct {
+		name  string
+		probe string
+		want  Properties
+	}{
+		{
+			name:  "video only",
+			probe: probeVideoOnly,
+			want: Properties{
+				HasVideoStream: true, Orientation: OrientationHorizontal, Width: 1920, Height: 1080,
+				HighestBitDepth: 8, VideoCodec: "h264", PixelFormat: "yuv420p", FrameRate: "25/1",
+			},
+		},
+		{
+			name:  "audio only",
+			probe: probeAudioOnly,
+			want: Properties{
+				HasAudioStream: true, AudioCodec: "pcm_s24le", AudioChannels: 2, AudioSampleRate: 48000,
+			},
+		},
+		{
+			name:  "vertical",
+			probe: probeVertical,
+			want: Properties{
+				HasVideoStream: true, HasAudioStream: true, Orientation: OrientationVertical, Width: 1080, Height: 1920,
+				HighestBitDepth: 8, VideoCodec: "hevc", AudioCodec: "aac", AudioChannels: 2, AudioSampleRate: 44100,
+				PixelFormat: "yuv420p", FrameRate: "30/1",
+			},
+		},
+		{
+			name:  "rotated to vertical",
+			probe: probeRotated,
+			want: Properties{
+				HasVideoStream: true, Orientation: OrientationVertical, Width: 1080, Height: 1920, Rotation: 90,
+				HighestBitDepth: 8, VideoCodec: "hevc", PixelFormat: "yuv420p",
+			},
+		},
+		{
+			name:  "high bit depth with unsupported audio",
+			probe: probeHighBitDepth,
+			want: Properties{
+				HasVideoStream: true, HasAudioStream: true, Orientation: OrientationHorizontal, Width: 3840, Height: 2160,
+				UnsupportedAudioFormat: true, HighestBitDepth: 10, VideoCodec: "prores", AudioCodec: "alac",
+				AudioChannels: 6, AudioSampleRate: 48000, PixelFormat: "yuv422p10le", FrameRate: "24000/1001",
+			},
+		},
+		{
+			name:  "cover art",
+			probe: probeCoverArt,
+			want: Properties{
+				HasAudioStream: true, HasAttachedPicture: true, AudioCodec: "mp3", AudioChannels: 2,
+				AudioSampleRate: 44100,
+			},
+		},
+		{
+			name:  "placeholder video",
+			probe: probePlaceholderVideo,
+			want: Properties{
+				HasAudioStream: true, AudioCodec: "aac", AudioChannels: 1, AudioSampleRate: 48000,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeCommands(t, map[string]fakeexec.Output{})
+
+			got := AnalyzeMediaInfo(parseProbe(t, tt.probe))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("AnalyzeMediaInfo() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsPlaceholderVideo(t *testing.T) {
+	tests := []struct {
+		name   string
+		width  int
+		height int
+		want   bool
+	}{
+		{"1x1", 1, 1, true},
+		{"16x16", 16, 16, true},
+		{"thin but long", 16, 1080, false},
+		{"17x17", 17, 17, false},
+		{"full HD", 1920, 1080, false},
+		{"unknown size", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsPlaceholderVideo(tt.width, tt.height); got != tt.want {
+				t.Errorf("IsPlaceholderVideo(%d, %d) = %v, want %v", tt.width, tt.height, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnalyzeMediaInfoColorRange(t *testing.T) {
+	tests := []struct {
+		name  string
+		probe string
+		want  string
+	}{
+		{"full range", probeFullRange, "pc"},
+		{"limited range", probeLimitedRange, "tv"},
+		{"unspecified", probeVideoOnly, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeCommands(t, map[string]fakeexec.Output{})
+
+			if got := AnalyzeMediaInfo(parseProbe(t, tt.probe)).ColorRange; got != tt.want {
+				t.Errorf("AnalyzeMediaInfo() ColorRange = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnalyzeMediaInfoWith(t *testing.T) {
+	fakeCommands(t, map[string]fakeexec.Output{})
+
+	info := parseProbe(t, probeVertical)
+
+	if props := AnalyzeMediaInfoWith(info, []string{"aac"}); props.UnsupportedAudioFormat {
+		t.Error("AAC audio is unsupported, want supported")
+	}
+
+	if props := AnalyzeMediaInfoWith(info, []string{"pcm_*"}); !props.UnsupportedAudioFormat {
+		t.Error("AAC audio is supported, want unsupported")
+	}
+}
+
+func TestIsAudioCodecSupported(t *testing.T) {
+	tests := []struct {
+		codec string
+		want  bool
+	}{
+		{"aac", true},
+		{"mp3", true},
+		{"opus", true},
+		{"flac", true},
+		{"ac3", true},
+		{"pcm_s16le", true},
+		{"pcm_s24be", true},
+		{"adpcm_ima_wav", true},
+		{"adpcm_ms", true},
+		{"alac", false},
+		{"eac3", false},
+		{"dts", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.codec, func(t *testing.T) {
+			if got := IsAudioCodecSupported(tt.codec); got != tt.want {
+				t.Errorf("IsAudioCodecSupported(%q) = %v, want %v", tt.codec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsAudioCodecSupportedWith(t *testing.T) {
+	tests := []struct {
+		name    string
+		codec   string
+		allowed []string
+		want    bool
+	}{
+		{"listed", "aac", []string{"mp3", "aac"}, true},
+		{"not listed", "aac", []string{"mp3"}, false},
+		{"prefix", "pcm_f32le", []string{"pcm_*"}, true},
+		{"prefix mismatch", "mp3", []string{"pcm_*"}, false},
+		{"no prefix match without star", "pcm_s16le", []string{"pcm_"}, false},
+		{"empty list", "aac", nil, false},
+		{"empty codec", "", []string{"*"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsAudioCodecSupportedWith(tt.codec, tt.allowed); got != tt.want {
+				t.Errorf("IsAudioCodecSupportedWith(%q, %v) = %v, want %v", tt.codec, tt.allowed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetMediaInfo(t *testing.T) {
+	fake := fakeCommands(t, map[string]fakeexec.Output{"ffprobe": {Stdout: probeVertical}})
+
+	info, err := GetMediaInfo("phone.mp4", "-headers", "X: y")
+	if err != nil {
+		t.Fatalf("GetMediaInfo() error = %v", err)
+	}
+
+	if len(info.Streams) != 2 || info.Streams[0].Width != 1080 || info.Format.Duration != "10.0" {
+		t.Errorf("GetMediaInfo() = %+v, want the faked streams", info)
+	}
+
+	calls := fake.Calls()
+	if len(calls) != 1 || calls[0][0] != "ffprobe" {
+		t.Fatalf("commands run = %v, want a single ffprobe", calls)
+	}
+
+	args := strings.Join(calls[0][1:], " ")
+	if !strings.HasSuffix(args, "-headers X: y phone.mp4") || !strings.Contains(args, "-show_streams") {
+		t.Errorf("ffprobe arguments = %q, want the streams of phone.mp4 with the input options", args)
+	}
+}
+
+func TestGetMediaInfoStderrWarning(t *testing.T) {
+	fakeCommands(t, map[string]fakeexec.Output{"ffprobe": {
+		Stdout: probeVideoOnly,
+		Stderr: "[mov,mp4,m4a,3gp,3g2,mj2 @ 0x5581] stream 0, timescale not set\n",
+	}})
+
+	info, err := GetMediaInfo("clip.mov")
+	if err != nil {
+		t.Fatalf("GetMediaInfo() error = %v, want the warning kept out of the JSON", err)
+	}
+
+	if len(info.Streams) != 1 || info.Streams[0].CodecName != "h264" {
+		t.Errorf("GetMediaInfo() = %+v, want the faked stream", info)
+	}
+}
+
+func TestGetMediaInfoMalformedOutput(t *testing.T) {
+	fakeCommands(t, map[string]fakeexec.Output{"ffprobe": {
+		Stdout: `{"format": {"filename": `,
+		Stderr: "clip.mov: moov atom not found\n",
+	}})
+
+	_, err := GetMediaInfo("clip.mov")
+	if err == nil || !strings.Contains(err.Error(), "moov atom not found") {
+		t.Errorf("GetMediaInfo() error = %v, want the unmarshalling error with the ffprobe stderr", err)
+	}
+}
+
+func TestGetMediaInfoInvalidData(t *testing.T) {
+	fakeCommands(t, map[string]fakeexec.Output{"ffprobe": {
+		Stdout:   `{"error": {"code": -1094995529, "string": "Invalid data found when processing input"}}`,
+		ExitCode: 1,
+	}})
+
+	if _, err := GetMediaInfo("broken.mp4"); !errors.Is(err, ErrInvalidData) {
+		t.Errorf("GetMediaInfo() error = %v, want %v", err, ErrInvalidData)
+	}
+}
+
+func TestGetMediaInfoFailure(t *testing.T) {
+	fakeCommands(t, map[string]fakeexec.Output{"ffprobe": {Stderr: "missing.mp4: No such file", ExitCode: 1}})
+
+	_, err := GetMediaInfo("missing.mp4")
+	if err == nil || errors.Is(err, ErrInvalidData) || !strings.Contains(err.Error(), "No such file") {
+		t.Errorf("GetMediaInfo() error = %v, want the ffprobe failure with its output", err)
+	}
+}
+
+func TestGetMediaInfoReader(t *testing.T) {
+	fake := fakeCommands(t, map[string]fakeexec.Output{"ffprobe": {Stdout: probeAudioOnly}})
+
+	if _, err := GetMediaInfoReader(strings.NewReader("RIFF")); err != nil {
+		t.Fatalf("GetMediaInfoReader() error = %v", err)
+	}
+
+	if calls := fake.Calls(); len(calls) != 1 || calls[0][len(calls[0])-1] != "pipe:0" {
+		t.Errorf("commands run = %v, want ffprobe reading pipe:0", calls)
+	}
+}
+
+func TestGetBitDepth(t *testing.T) {
+	tests := []struct {
+		pixelFormat string
+		want        int
+		wantErr     bool
+	}{
+		{"yuv420p", 8, false},
+		{"yuv422p10le", 10, false},
+		{"gray", 8, false},
+		{"unknown", -1, true},
+	}
+
+	fake := fakeCommands(t, map[string]fakeexec.Output{})
+
+	for _, tt := range tests {
+		t.Run(tt.pixelFormat, func(t *testing.T) {
+			got, err := GetBitDepth(tt.pixelFormat)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("GetBitDepth(%q) = %d, %v, want %d (error: %v)", tt.pixelFormat, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+
+	// The table is loaded once
+	if calls := fake.Calls(); len(calls) != 1 {
+		t.Errorf("commands run = %v, want a single ffmpeg -pix_fmts", calls)
+	}
+}
+
+func TestGetBitDepthFailure(t *testing.T) {
+	fakeCommands(t, map[string]fakeexec.Output{"ffmpeg": {ExitCode: 1}})
+
+	if _, err := GetBitDepth("yuv420p"); err == nil {
+		t.Error("GetBitDepth() error = nil, want the ffmpeg failure")
+	}
+}
+
+func TestStreamRotation(t *testing.T) {
+	tests := []struct {
+		name     string
+		sideData []SideData
+		tags     map[string]string
+		want     int
+	}{
+		{"display matrix clockwise", []SideData{{SideDataType: "Display Matrix", Rotation: -90}}, nil, 90},
+		{"display matrix counterclockwise", []SideData{{SideDataType: "Display Matrix", Rotation: 90}}, nil, 270},
+		{"display matrix upside down", []SideData{{SideDataType: "Display Matrix", Rotation: 180}}, nil, 180},
+		{"display matrix rounded", []SideData{{SideDataType: "Display Matrix", Rotation: -89.9}}, nil, 90},
+		{"rotate tag", nil, map[string]string{"rotate": "90"}, 90},
+		{"negative rotate tag", nil, map[string]string{"rotate": "-90"}, 270},
+		{"full turn", nil, map[string]string{"rotate": "360"}, 0},
+		{
+			"display matrix over the rotate tag",
+			[]SideData{{SideDataType: "Display Matrix", Rotation: -90}}, map[string]string{"rotate": "180"}, 90,
+		},
+		{"other side data", []SideData{{SideDataType: "Mastering display metadata"}}, nil, 0},
+		{"none", nil, nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := streamRotation(tt.sideData, tt.tags); got != tt.want {
+				t.Errorf("streamRotation() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnalyzeMediaInfoRotation(t *testing.T) {
+	tests := []struct {
+		name            string
+		rotation        string
+		wantOrientation Orientation
+		wantWidth       int
+		wantHeight      int
+	}{
+		{
+			"quarter turn", `"side_data_list": [{"side_data_type": "Display Matrix", "rotation": -90}]`,
+			OrientationVertical, 1080, 1920,
+		},
+		{"rotate tag", `"tags": {"rotate": "270"}`, OrientationVertical, 1080, 1920},
+		{
+			"upside down", `"side_data_list": [{"side_data_type": "Display Matrix", "rotation": 180}]`,
+			OrientationHorizontal, 1920, 1080,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Phones store portrait footage with landscape dimensions and a rotation
+			info := parseProbe(t, `{"format": {"filename": "phone.mov", "duration": "10.0"}, "streams": [
+				{"index": 0, "codec_type": "video", "codec_name": "hevc", "width": 1920, "height": 1080,
+				 "pix_fmt": "yuv420p", `+tt.rotation+`}]}`)
+
+			props := AnalyzeMediaInfo(info)
+			if props.Orientation != tt.wantOrientation || props.Width != tt.wantWidth || props.Height != tt.wantHeight {
+				t.Errorf("AnalyzeMediaInfo() = %v %dx%d, want %v %dx%d", props.Orientation, props.Width, props.Height,
+					tt.wantOrientation, tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+}
+
+func TestAnalyzeMediaInfoCreationTime(t *testing.T) {
+	tests := []struct {
+		name       string
+		formatTags string
+		streamTags string
+		want       string
+	}{
+		{"format tag", `{"creation_time": "2024-05-01T10:00:00.000000Z"}`, `{}`, "2024-05-01T10:00:00.000000Z"},
+		{"video stream tag", `{}`, `{"creation_time": "2024-05-01T09:59:58.000000Z"}`, "2024-05-01T09:59:58.000000Z"},
+		{
+			"format tag wins", `{"creation_time": "2024-05-01T10:00:00.000000Z"}`,
+			`{"creation_time": "2024-05-01T09:59:58.000000Z"}`, "2024-05-01T10:00:00.000000Z",
+		},
+		{"no tag", `{}`, `{}`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := parseProbe(t, `{"format": {"filename": "clip.mov", "duration": "10.0", "tags": `+tt.formatTags+`},
+				"streams": [{"index": 0, "codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080,
+				 "pix_fmt": "yuv420p", "tags": `+tt.streamTags+`}]}`)
+
+			if got := AnalyzeMediaInfo(info).CreationTime; got != tt.want {
+				t.Errorf("AnalyzeMediaInfo() CreationTime = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
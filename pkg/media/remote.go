@@ -0,0 +1,41 @@
+package media
+
+import (
+	"strings"
+)
+
+// IsRemote reports whether a source is an HTTP(S) URL rather than a local path.
+func IsRemote(source string) bool {
+	lowercaseSource := strings.ToLower(source)
+
+	return strings.HasPrefix(lowercaseSource, "http://") || strings.HasPrefix(lowercaseSource, "https://")
+}
+
+// HeaderArgs returns the FFmpeg/FFprobe input options sending HTTP headers for a remote source.
+// Headers are "Name: value" strings; nothing is returned for local sources.
+func HeaderArgs(source string, headers []string) []string {
+	if !IsRemote(source) || len(headers) == 0 {
+		return nil
+	}
+
+	var value strings.Builder
+
+	for _, header := range headers {
+		value.WriteString(strings.TrimSpace(header))
+		value.WriteString("\r\n")
+	}
+
+	return []string{"-headers", value.String()}
+}
+
+// RedactHeaders replaces the values of an FFmpeg -headers option so secrets never reach the logs.
+func RedactHeaders(value string) string {
+	var redacted []string
+
+	for _, header := range strings.Split(strings.TrimSpace(value), "\r\n") {
+		name, _, _ := strings.Cut(header, ":")
+		redacted = append(redacted, strings.TrimSpace(name)+": <redacted>")
+	}
+
+	return strings.Join(redacted, "\\r\\n")
+}
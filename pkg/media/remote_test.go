@@ -0,0 +1,62 @@
+package media
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestIsRemote(t *testing.T) {
+	tests := []struct {
+		source string
+		want   bool
+	}{
+		{"https://media.example.com/clip.mov", true},
+		{"HTTP://media.example.com/clip.mov", true},
+		{"/footage/clip.mov", false},
+		{"footage/https/clip.mov", false},
+		{"concat:/disc/VTS_01_1.VOB|/disc/VTS_01_2.VOB", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			if got := IsRemote(tt.source); got != tt.want {
+				t.Errorf("IsRemote(%q) = %v, want %v", tt.source, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeaderArgs(t *testing.T) {
+	headers := []string{"Authorization: Bearer s3cr3t", " X-Request-Id: 42 "}
+
+	tests := []struct {
+		name    string
+		source  string
+		headers []string
+		want    []string
+	}{
+		{
+			name:    "remote source",
+			source:  "https://media.example.com/clip.mov",
+			headers: headers,
+			want:    []string{"-headers", "Authorization: Bearer s3cr3t\r\nX-Request-Id: 42\r\n"},
+		},
+		{"local source", "/footage/clip.mov", headers, nil},
+		{"no headers", "https://media.example.com/clip.mov", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HeaderArgs(tt.source, tt.headers); !slices.Equal(got, tt.want) {
+				t.Errorf("HeaderArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactHeaders(t *testing.T) {
+	got := RedactHeaders("Authorization: Bearer s3cr3t\r\nX-Request-Id: 42\r\n")
+	if want := `Authorization: <redacted>\r\nX-Request-Id: <redacted>`; got != want {
+		t.Errorf("RedactHeaders() = %q, want %q", got, want)
+	}
+}
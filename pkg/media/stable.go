@@ -0,0 +1,28 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrFileNotStable is returned for a source that is still being written, e.g. while it is copied.
+var ErrFileNotStable = errors.New("file is still being written")
+
+// IsFileStable reports whether the size and modification time of a file are unchanged over the quiet duration.
+func IsFileStable(path string, quiet time.Duration) (bool, error) {
+	before, err := os.Stat(path)
+	if err != nil {
+		return false, fmt.Errorf("error getting file info: %w", err)
+	}
+
+	time.Sleep(quiet)
+
+	after, err := os.Stat(path)
+	if err != nil {
+		return false, fmt.Errorf("error getting file info: %w", err)
+	}
+
+	return before.Size() == after.Size() && before.ModTime().Equal(after.ModTime()), nil
+}
@@ -0,0 +1,142 @@
+package mxf
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/media"
+)
+
+// opAtomULMarker identifies the OP-Atom operational pattern in the operational_pattern_ul reported by FFprobe.
+// The bytes following it vary between writers.
+const opAtomULMarker = ".0d010201.10"
+
+// essenceNameExp matches Avid essence file names such as Interview01V01.5A3E1B7B_53E1B7C4E9A.mxf,
+// capturing the clip name before the track marker.
+var essenceNameExp = regexp.MustCompile(`(?i)^(.+?)[VA]\d{2}\.`)
+
+// Essence is a single-track OP-Atom file.
+type Essence struct {
+	// Path is the essence file.
+	Path string
+	// ClipID identifies the clip the essence belongs to.
+	ClipID string
+	// Name is the clip name.
+	Name string
+	// HasVideo reports whether the essence holds the video track.
+	HasVideo bool
+}
+
+// Clip is an OP-Atom clip made of a video essence and its audio essences.
+type Clip struct {
+	// Name is the clip name, used to name the proxy.
+	Name string
+	// Video is the video essence, or empty for audio-only clips.
+	Video string
+	// Audio are the audio essences in track order.
+	Audio []string
+}
+
+// Inputs returns the essences of the clip in the order they are passed to FFmpeg, video first.
+func (c Clip) Inputs() []string {
+	if c.Video == "" {
+		return c.Audio
+	}
+
+	return append([]string{c.Video}, c.Audio...)
+}
+
+// IsMXF reports whether a file has the MXF extension.
+func IsMXF(filePath string) bool {
+	return strings.EqualFold(filepath.Ext(filePath), ".mxf")
+}
+
+// IsOPAtom reports whether probed media is an OP-Atom essence file.
+func IsOPAtom(info media.MediaInfo) bool {
+	return strings.Contains(strings.ToLower(info.Format.Tags["operational_pattern_ul"]), opAtomULMarker)
+}
+
+// NewEssence describes a probed OP-Atom file. Essences are attached to their clip by the material
+// package UMID shared by all tracks of a clip, or by the clip name in the file name when it is missing.
+func NewEssence(filePath string, info media.MediaInfo) Essence {
+	essence := Essence{Path: filePath}
+
+	fileName := filepath.Base(filePath)
+	stem := strings.TrimSuffix(fileName, filepath.Ext(fileName))
+
+	if match := essenceNameExp.FindStringSubmatch(fileName); match != nil {
+		stem = match[1]
+	}
+
+	essence.Name = info.Format.Tags["material_package_name"]
+	if essence.Name == "" {
+		essence.Name = stem
+	}
+
+	essence.ClipID = info.Format.Tags["material_package_umid"]
+	if essence.ClipID == "" {
+		essence.ClipID = filepath.Join(filepath.Dir(filePath), stem)
+	}
+
+	for _, stream := range info.Streams {
+		if stream.CodecType == "video" {
+			essence.HasVideo = true
+		}
+	}
+
+	return essence
+}
+
+// ProbeEssence probes a file and describes it when it is an OP-Atom essence.
+func ProbeEssence(filePath string) (Essence, bool, error) {
+	info, err := media.GetMediaInfo(filePath)
+	if err != nil {
+		return Essence{}, false, fmt.Errorf("error getting media info: %w", err)
+	}
+
+	if !IsOPAtom(info) {
+		return Essence{}, false, nil
+	}
+
+	return NewEssence(filePath, info), true, nil
+}
+
+// GroupEssences pairs the essences of each clip. Clips are returned in the order their first
+// essence was given, and audio essences are sorted by file name, which follows the track number.
+func GroupEssences(essences []Essence) []Clip {
+	var (
+		clips []Clip
+		index = make(map[string]int)
+	)
+
+	for _, essence := range essences {
+		i, ok := index[essence.ClipID]
+		if !ok {
+			i = len(clips)
+			index[essence.ClipID] = i
+
+			clips = append(clips, Clip{Name: essence.Name})
+		}
+
+		switch {
+		case essence.HasVideo && clips[i].Video == "":
+			clips[i].Video = essence.Path
+		case essence.HasVideo:
+			// A second video essence belongs to another clip sharing the name, keep it separate
+			clips = append(clips, Clip{Name: essence.Name, Video: essence.Path})
+		default:
+			clips[i].Audio = append(clips[i].Audio, essence.Path)
+		}
+	}
+
+	for _, clip := range clips {
+		sort.Slice(clip.Audio, func(a, b int) bool {
+			return strings.ToUpper(filepath.Base(clip.Audio[a])) < strings.ToUpper(filepath.Base(clip.Audio[b]))
+		})
+	}
+
+	return clips
+}
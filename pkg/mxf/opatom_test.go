@@ -0,0 +1,154 @@
+package mxf
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/media"
+)
+
+// avidOPAtomUL is the operational pattern reported by FFprobe for Avid OP-Atom essences.
+const avidOPAtomUL = "060e2b34.04010102.0d010201.10030000"
+
+// essenceInfo returns the probed media of an essence file with the given format tags and stream type.
+func essenceInfo(t *testing.T, tags map[string]string, codecType string) media.MediaInfo {
+	t.Helper()
+
+	tagsJSON, err := json.Marshal(tags)
+	if err != nil {
+		t.Fatalf("error marshalling tags: %v", err)
+	}
+
+	output := fmt.Sprintf(`{"format": {"format_name": "mxf", "tags": %s}, "streams": [{"index": 0, "codec_type": %q}]}`,
+		tagsJSON, codecType)
+
+	var info media.MediaInfo
+	if err := json.Unmarshal([]byte(output), &info); err != nil {
+		t.Fatalf("error unmarshalling probe output: %v", err)
+	}
+
+	return info
+}
+
+func TestIsOPAtom(t *testing.T) {
+	tests := []struct {
+		name string
+		ul   string
+		want bool
+	}{
+		{"avid op-atom", avidOPAtomUL, true},
+		{"upper case", "060E2B34.04010102.0D010201.10030000", true},
+		{"op1a", "060e2b34.04010101.0d010201.01010900", false},
+		{"missing", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := essenceInfo(t, map[string]string{"operational_pattern_ul": tt.ul}, "video")
+			if got := IsOPAtom(info); got != tt.want {
+				t.Errorf("IsOPAtom(%q) = %v, want %v", tt.ul, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewEssence(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      string
+		tags      map[string]string
+		codecType string
+		want      Essence
+	}{
+		{
+			name:      "video essence with package metadata",
+			path:      "/Avid MediaFiles/MXF/1/Interview01V01.5A3E1B7B_53E1B7C4E9A.mxf",
+			tags:      map[string]string{"material_package_name": "Interview 01", "material_package_umid": "0x060A2B34"},
+			codecType: "video",
+			want: Essence{
+				Path:   "/Avid MediaFiles/MXF/1/Interview01V01.5A3E1B7B_53E1B7C4E9A.mxf",
+				ClipID: "0x060A2B34", Name: "Interview 01", HasVideo: true,
+			},
+		},
+		{
+			name:      "audio essence named after the clip",
+			path:      "/Avid MediaFiles/MXF/1/Interview01A02.5A3E1B7B_53E1B7C4E9B.mxf",
+			tags:      map[string]string{},
+			codecType: "audio",
+			want: Essence{
+				Path:   "/Avid MediaFiles/MXF/1/Interview01A02.5A3E1B7B_53E1B7C4E9B.mxf",
+				ClipID: "/Avid MediaFiles/MXF/1/Interview01", Name: "Interview01",
+			},
+		},
+		{
+			name:      "file name without track marker",
+			path:      "/media/clip.mxf",
+			tags:      map[string]string{},
+			codecType: "video",
+			want:      Essence{Path: "/media/clip.mxf", ClipID: "/media/clip", Name: "clip", HasVideo: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewEssence(tt.path, essenceInfo(t, tt.tags, tt.codecType)); got != tt.want {
+				t.Errorf("NewEssence() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupEssences(t *testing.T) {
+	essences := []Essence{
+		{Path: "Interview01A02.mxf", ClipID: "umid-1", Name: "Interview 01"},
+		{Path: "Broll01V01.mxf", ClipID: "umid-2", Name: "Broll 01", HasVideo: true},
+		{Path: "Interview01V01.mxf", ClipID: "umid-1", Name: "Interview 01", HasVideo: true},
+		{Path: "Interview01a01.mxf", ClipID: "umid-1", Name: "Interview 01"},
+		{Path: "Music01A01.mxf", ClipID: "umid-3", Name: "Music 01"},
+		{Path: "Broll01V01.copy.mxf", ClipID: "umid-2", Name: "Broll 01", HasVideo: true},
+	}
+
+	// Clips keep the order of their first essence, with the audio in track order whatever the case
+	want := []Clip{
+		{Name: "Interview 01", Video: "Interview01V01.mxf", Audio: []string{"Interview01a01.mxf", "Interview01A02.mxf"}},
+		{Name: "Broll 01", Video: "Broll01V01.mxf"},
+		{Name: "Music 01", Audio: []string{"Music01A01.mxf"}},
+		{Name: "Broll 01", Video: "Broll01V01.copy.mxf"},
+	}
+
+	if got := GroupEssences(essences); !reflect.DeepEqual(got, want) {
+		t.Errorf("GroupEssences() = %+v, want %+v", got, want)
+	}
+}
+
+func TestClipInputs(t *testing.T) {
+	tests := []struct {
+		name string
+		clip Clip
+		want []string
+	}{
+		{
+			"video first",
+			Clip{Video: "V01.mxf", Audio: []string{"A01.mxf", "A02.mxf"}}, []string{"V01.mxf", "A01.mxf", "A02.mxf"},
+		},
+		{"audio only", Clip{Audio: []string{"A01.mxf"}}, []string{"A01.mxf"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.clip.Inputs(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Clip.Inputs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsMXF(t *testing.T) {
+	for path, want := range map[string]bool{"clip.mxf": true, "CLIP.MXF": true, "clip.mov": false, "mxf": false} {
+		if got := IsMXF(path); got != want {
+			t.Errorf("IsMXF(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/config"
+	"github.com/cyrilschreiber3/media-processor/pkg/disc"
+	"github.com/cyrilschreiber3/media-processor/pkg/estimate"
+	"github.com/cyrilschreiber3/media-processor/pkg/fileutil"
+	"github.com/cyrilschreiber3/media-processor/pkg/media"
+	"github.com/cyrilschreiber3/media-processor/pkg/proxy"
+)
+
+// probe returns the properties and the duration in seconds of the job's source.
+func (j job) probe(cfg config.Config) (media.Properties, float64, error) {
+	input := j.path
+
+	if j.disc {
+		title, err := disc.FindTitle(j.path)
+		if err != nil {
+			return media.Properties{}, 0, fmt.Errorf("error finding disc title: %w", err)
+		}
+
+		input = title.Input()
+	}
+
+	info, err := media.GetMediaInfo(input, media.HeaderArgs(input, cfg.HTTPHeaders)...)
+	if err != nil {
+		return media.Properties{}, 0, fmt.Errorf("error getting media info: %w", err)
+	}
+
+	duration, err := info.DurationSeconds()
+	if err != nil {
+		return media.Properties{}, 0, fmt.Errorf("error getting duration: %w", err)
+	}
+
+	return media.AnalyzeMediaInfoWith(info, cfg.SupportedAudioCodecs), duration, nil
+}
+
+// estimateReport is the estimate printed as JSON with JSONOutput.
+type estimateReport struct {
+	Files             int     `json:"files"`
+	Unprobed          int     `json:"unprobed"`
+	DurationSeconds   float64 `json:"duration_seconds"`
+	ProcessingSeconds float64 `json:"processing_seconds"`
+	RealtimeFactor    float64 `json:"realtime_factor"`
+	Jobs              int     `json:"jobs"`
+	ProxyBytes        int64   `json:"proxy_bytes"`
+}
+
+// printEstimate probes every job and prints to w the estimated processing time and proxy size without encoding
+// anything, as a single JSON object with JSONOutput. It warns when the proxies may not fit in the free space of the
+// volume they are written to.
+func printEstimate(w io.Writer, jobs []job, watchPath string, cfg config.Config) error {
+	durations := make([]float64, 0, len(jobs))
+
+	var size int64
+
+	for _, job := range jobs {
+		props, duration, err := job.probe(cfg)
+		if err != nil {
+			slog.Warn("Error probing source, leaving it out of the estimate", "path", job.path, "error", err)
+
+			continue
+		}
+
+		durations = append(durations, duration)
+
+		duration = max(duration-cfg.TrimStart, 0)
+
+		if length := cfg.TrimLength(); length > 0 {
+			duration = min(duration, length)
+		}
+
+		if cfg.PreviewSeconds > 0 {
+			duration = min(duration, cfg.PreviewSeconds)
+		}
+
+		proxySize := proxy.EstimateProxySize(props, duration, cfg.MaxRate)
+
+		// Every rung of a ladder is capped at the same bitrate
+		if props.HasVideoStream && len(cfg.Ladder) > 0 {
+			proxySize *= int64(len(cfg.Ladder))
+		}
+
+		size += proxySize
+	}
+
+	total := time.Duration(estimate.Total(durations) * float64(time.Second))
+	wallClock := estimate.Estimate(durations, cfg.Jobs, cfg.RealtimeFactor)
+
+	if err := writeEstimate(w, estimateReport{
+		Files:             len(durations),
+		Unprobed:          len(jobs) - len(durations),
+		DurationSeconds:   total.Seconds(),
+		ProcessingSeconds: wallClock.Seconds(),
+		RealtimeFactor:    cfg.RealtimeFactor,
+		Jobs:              cfg.Jobs,
+		ProxyBytes:        size,
+	}, cfg.JSONOutput); err != nil {
+		return err
+	}
+
+	target := watchPath
+	if cfg.OutputRoot != "" {
+		target = cfg.OutputRoot
+	}
+
+	if media.IsRemote(target) {
+		return nil
+	}
+
+	free, err := fileutil.FreeSpace(target)
+	if err != nil {
+		slog.Warn("Could not check the free space", "path", target, "error", err)
+
+		return nil
+	}
+
+	if uint64(size) > free { //nolint:gosec
+		slog.Warn("The proxies may not fit in the free space",
+			"path", target, "free", fmt.Sprintf("%.1f GB", float64(free)/1e9))
+	}
+
+	return nil
+}
+
+// writeEstimate writes the estimate to w, as JSON or as text for a reader.
+func writeEstimate(w io.Writer, r estimateReport, asJSON bool) error {
+	if asJSON {
+		data, err := json.Marshal(r)
+		if err != nil {
+			return fmt.Errorf("error marshalling estimate: %w", err)
+		}
+
+		if _, err := w.Write(append(data, '\n')); err != nil {
+			return fmt.Errorf("error writing estimate: %w", err)
+		}
+
+		return nil
+	}
+
+	total := time.Duration(r.DurationSeconds * float64(time.Second))
+	wallClock := time.Duration(r.ProcessingSeconds * float64(time.Second))
+
+	_, err := fmt.Fprintf(w, "Files: %d (%d could not be probed)\n"+
+		"Total media duration: %s\n"+
+		"Estimated processing time: %s (%.1fx realtime, %d concurrent)\n"+
+		"Estimated proxy size: at most %.1f GB\n",
+		r.Files, r.Unprobed, total.Round(time.Second),
+		wallClock.Round(time.Second), r.RealtimeFactor, r.Jobs, float64(r.ProxyBytes)/1e9)
+	if err != nil {
+		return fmt.Errorf("error writing estimate: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/config"
+)
+
+func TestPrintEstimate(t *testing.T) {
+	installCommands(t)
+
+	watchPath := t.TempDir()
+	jobs := []job{{path: filepath.Join(watchPath, "clip0.mov")}, {path: filepath.Join(watchPath, "clip1.mov")}}
+
+	cfg := config.Default()
+
+	var text bytes.Buffer
+	if err := printEstimate(&text, jobs, watchPath, cfg); err != nil {
+		t.Fatalf("printEstimate() error = %v", err)
+	}
+
+	if !strings.HasPrefix(text.String(), "Files: 2 (0 could not be probed)\nTotal media duration: 20s\n") {
+		t.Errorf("printEstimate() = %q, want the estimate of both clips", text.String())
+	}
+
+	// With JSONOutput the standard output only holds JSON
+	cfg.JSONOutput = true
+
+	var output bytes.Buffer
+	if err := printEstimate(&output, jobs, watchPath, cfg); err != nil {
+		t.Fatalf("printEstimate() error = %v", err)
+	}
+
+	var got estimateReport
+
+	decoder := json.NewDecoder(&output)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&got); err != nil {
+		t.Fatalf("printEstimate() = %q, want a JSON estimate: %v", output.String(), err)
+	}
+
+	if got.Files != 2 || got.DurationSeconds != 20 || got.Jobs != cfg.Jobs || got.ProxyBytes <= 0 {
+		t.Errorf("printEstimate() = %+v, want the estimate of both clips", got)
+	}
+
+	if decoder.More() {
+		t.Errorf("printEstimate() wrote more than the JSON estimate")
+	}
+}
@@ -0,0 +1,37 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/internal/fakeexec"
+)
+
+// probeClip is the ffprobe output of a ten seconds clip with video and supported audio.
+const probeClip = `{"format": {"filename": "clip.mov", "duration": "10.0", "bit_rate": "50000000"}, "streams": [
+	{"index": 0, "codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080,
+	 "pix_fmt": "yuv420p", "r_frame_rate": "25/1", "avg_frame_rate": "25/1", "nb_frames": "250"},
+	{"index": 1, "codec_type": "audio", "codec_name": "aac", "channels": 2, "sample_rate": "48000"}]}`
+
+// probeVoice is the ffprobe output of a ten seconds audio-only recording with supported audio.
+const probeVoice = `{"format": {"filename": "voice.wav", "duration": "10.0", "bit_rate": "1536000"}, "streams": [
+	{"index": 0, "codec_type": "audio", "codec_name": "pcm_s16le", "channels": 2, "sample_rate": "48000"}]}`
+
+func TestMain(m *testing.M) {
+	fakeexec.Main(m)
+}
+
+// installCommands fakes FFmpeg and FFprobe on the PATH for the duration of the test, since the package
+// runs them through the media, ffmpeg and proxy packages. FFprobe prints probeClip unless given another output.
+func installCommands(t *testing.T, probe ...string) *fakeexec.Fake {
+	t.Helper()
+
+	output := probeClip
+	if len(probe) > 0 {
+		output = probe[0]
+	}
+
+	fake := &fakeexec.Fake{Outputs: map[string]fakeexec.Output{"ffprobe": {Stdout: output}, "ffmpeg": {}}}
+	fake.Install(t)
+
+	return fake
+}
@@ -0,0 +1,230 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/config"
+	"github.com/cyrilschreiber3/media-processor/pkg/disc"
+	"github.com/cyrilschreiber3/media-processor/pkg/media"
+	"github.com/cyrilschreiber3/media-processor/pkg/mxf"
+	"github.com/cyrilschreiber3/media-processor/pkg/proxy"
+)
+
+// job is a single source to generate a proxy for.
+type job struct {
+	path   string
+	entry  os.DirEntry
+	disc   bool
+	remote bool
+	clip   *mxf.Clip
+}
+
+// run processes the job's source.
+func (j job) run(ctx context.Context, cfg config.Config) (bool, error) {
+	if j.disc {
+		return processDisc(ctx, j.path, cfg)
+	}
+
+	if j.clip != nil {
+		slog.Info("Processing OP-Atom clip", "clip", j.clip.Name, "inputs", strings.Join(j.clip.Inputs(), ", "))
+
+		return proxy.GenerateOPAtomProxy(ctx, *j.clip, cfg)
+	}
+
+	if j.remote {
+		slog.Info("Processing remote source", "url", j.path)
+
+		return proxy.GenerateRemoteProxy(ctx, j.path, cfg)
+	}
+
+	return processFile(ctx, j.entry, j.path, cfg)
+}
+
+// collectJobs selects the entries of the watch path that should be processed.
+func collectJobs(watchPath string, files []os.DirEntry, cfg config.Config) []job {
+	var jobs []job
+
+	for _, file := range files {
+		filePath := filepath.Join(watchPath, file.Name())
+
+		// Process ripped discs as a single source, skip other directories
+		if file.IsDir() {
+			if disc.IsDiscRoot(filePath) {
+				jobs = append(jobs, job{path: filePath, entry: file, disc: true})
+			}
+
+			continue
+		}
+
+		if isMediaSource(filePath, cfg) {
+			jobs = append(jobs, job{path: filePath, entry: file})
+		}
+	}
+
+	return jobs
+}
+
+// walkJobs selects the media of the watch path and its subdirectories, down to the configured depth.
+// Generated directories are never descended into. Files and discs rejected by filter are ignored, unless it is nil.
+func walkJobs(
+	watchPath string, cfg config.Config, filter func(filePath string, entry os.DirEntry) bool,
+) ([]job, error) {
+	var jobs []job
+
+	skipDirs := []string{cfg.VideoProxyDir, cfg.AudioProxyDir, cfg.OriginalsDir}
+
+	// An output root inside the watch path only holds proxies
+	outputRoot := ""
+	if cfg.OutputRoot != "" {
+		outputRoot, _ = filepath.Abs(cfg.OutputRoot)
+	}
+
+	err := filepath.WalkDir(watchPath, func(filePath string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !entry.IsDir() {
+			if filter != nil && !filter(filePath, entry) {
+				return nil
+			}
+
+			if isMediaSource(filePath, cfg) {
+				jobs = append(jobs, job{path: filePath, entry: entry})
+			}
+
+			return nil
+		}
+
+		if filePath == watchPath {
+			return nil
+		}
+
+		if slices.Contains(skipDirs, entry.Name()) {
+			return filepath.SkipDir
+		}
+
+		if absPath, err := filepath.Abs(filePath); err == nil && absPath == outputRoot {
+			return filepath.SkipDir
+		}
+
+		relPath, _ := filepath.Rel(watchPath, filePath)
+		if cfg.MaxDepth > 0 && len(strings.Split(relPath, string(filepath.Separator))) > cfg.MaxDepth {
+			return filepath.SkipDir
+		}
+
+		// Process ripped discs as a single source
+		if disc.IsDiscRoot(filePath) {
+			if filter == nil || filter(filePath, entry) {
+				jobs = append(jobs, job{path: filePath, entry: entry, disc: true})
+			}
+
+			return filepath.SkipDir
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking %s: %w", watchPath, err)
+	}
+
+	return jobs, nil
+}
+
+// isMediaSource reports whether a file is a source to generate a proxy for.
+func isMediaSource(filePath string, cfg config.Config) bool {
+	// Skip non-media files
+	if !media.IsMediaFile(filePath) {
+		slog.Debug("Skipping non-media file", "path", filePath)
+
+		return false
+	}
+
+	if !matchesFilters(filepath.Base(filePath), cfg) {
+		slog.Debug("Skipping filtered file", "path", filePath)
+
+		return false
+	}
+
+	// Skip files in the proxy directories
+	parentDir := filepath.Base(filepath.Dir(filePath))
+	if parentDir == cfg.VideoProxyDir || parentDir == cfg.AudioProxyDir {
+		slog.Debug("Skipping proxy file", "path", filePath)
+
+		return false
+	}
+
+	// Skip the originals kept after an audio conversion
+	if parentDir == cfg.OriginalsDir {
+		slog.Debug("Skipping original file", "path", filePath)
+
+		return false
+	}
+
+	return true
+}
+
+// matchesFilters reports whether a file name matches one of the include patterns, when there are any,
+// and none of the exclude patterns.
+func matchesFilters(fileName string, cfg config.Config) bool {
+	matchesAny := func(patterns []string) bool {
+		return slices.ContainsFunc(patterns, func(pattern string) bool {
+			matched, _ := filepath.Match(pattern, fileName)
+
+			return matched
+		})
+	}
+
+	return (len(cfg.Include) == 0 || matchesAny(cfg.Include)) && !matchesAny(cfg.Exclude)
+}
+
+// pairOPAtom replaces the jobs of OP-Atom essence files by one job per clip combining its essences.
+// Other MXF files are processed on their own.
+func pairOPAtom(jobs []job) []job {
+	var (
+		paired    []job
+		essences  []mxf.Essence
+		firstClip = -1
+	)
+
+	for _, job := range jobs {
+		if job.disc || job.remote || !mxf.IsMXF(job.path) {
+			paired = append(paired, job)
+
+			continue
+		}
+
+		essence, ok, err := mxf.ProbeEssence(job.path)
+		if err != nil || !ok {
+			paired = append(paired, job)
+
+			continue
+		}
+
+		// Keep the clips where their first essence was scanned
+		if firstClip < 0 {
+			firstClip = len(paired)
+		}
+
+		essences = append(essences, essence)
+	}
+
+	if len(essences) == 0 {
+		return paired
+	}
+
+	clips := mxf.GroupEssences(essences)
+	clipJobs := make([]job, len(clips))
+
+	for i := range clips {
+		clipJobs[i] = job{path: clips[i].Inputs()[0], clip: &clips[i]}
+	}
+
+	return slices.Insert(paired, firstClip, clipJobs...)
+}
@@ -0,0 +1,261 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/config"
+	"github.com/cyrilschreiber3/media-processor/pkg/ffmpeg"
+	"github.com/cyrilschreiber3/media-processor/pkg/gpu"
+	"github.com/cyrilschreiber3/media-processor/pkg/manifest"
+	"github.com/cyrilschreiber3/media-processor/pkg/media"
+	"github.com/cyrilschreiber3/media-processor/pkg/proxy"
+	"github.com/cyrilschreiber3/media-processor/pkg/report"
+	"github.com/cyrilschreiber3/media-processor/pkg/timing"
+)
+
+// pool processes jobs concurrently with a bounded number of workers.
+type pool struct {
+	cfg        config.Config
+	quarantine *manifest.Quarantine
+	inFlight   *manifest.InFlight
+	cache      *manifest.Cache
+	gpus       *ffmpeg.DeviceRoundRobin
+	throttle   *gpu.Throttle
+
+	mu      sync.Mutex
+	status  Summary
+	stopped atomic.Bool
+}
+
+// runJob processes a job, and is replaced by the tests.
+var runJob = func(ctx context.Context, j job, cfg config.Config) (bool, error) {
+	return j.run(ctx, cfg)
+}
+
+// dispatched is a job handed to a worker along with its configuration.
+type dispatched struct {
+	job job
+	cfg config.Config
+}
+
+// run processes the jobs in order with up to cfg.Jobs workers and returns the batch status.
+// Jobs are dispatched in order, so a worker never starts a job before the ones ahead of it.
+// Cancelling the context aborts the running jobs.
+func (p *pool) run(ctx context.Context, jobs []job) Summary {
+	queue := make(chan dispatched)
+
+	var wg sync.WaitGroup
+
+	for range max(p.cfg.Jobs, 1) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for item := range queue {
+				p.process(ctx, item.job, item.cfg)
+			}
+		}()
+	}
+
+	for i, job := range jobs {
+		if p.stopped.Load() {
+			p.mu.Lock()
+			p.status.Skipped += len(jobs) - i
+			p.mu.Unlock()
+
+			break
+		}
+
+		// Skip known-bad sources, still reporting them as failed
+		if p.quarantine != nil && !p.cfg.RetryFailed {
+			if entry, ok := p.quarantine.Lookup(job.path, p.cfg.QuarantineAfter); ok {
+				slog.Warn("Skipping quarantined file", "path", job.path, "attempts", entry.Attempts, "reason", entry.Reason)
+				err := fmt.Errorf("quarantined: %s", entry.Reason)
+				p.recordFailure(job.path, err)
+
+				if p.cfg.JSONOutput {
+					result := report.NewProcessResult(job.path)
+					result.Finish(false, err, time.Now())
+					p.writeResult(result)
+				}
+
+				continue
+			}
+		}
+
+		// Skip sources unchanged since they were processed without probing them again
+		if entry, ok := p.lookupCache(job); ok {
+			slog.Info("File unchanged since last run, skipping", "path", job.path, "proxy", entry.Output)
+
+			result := report.NewProcessResult(job.path)
+			result.SetOutput(entry.Output)
+			result.SetSkipReason(report.ReasonCached)
+			result.Finish(false, nil, time.Now())
+
+			p.mu.Lock()
+			p.status.recordSuccess(job.path, false, result)
+			p.mu.Unlock()
+
+			if p.cfg.JSONOutput {
+				p.writeResult(result)
+			}
+
+			continue
+		}
+
+		jobCfg := p.cfg
+		jobCfg.GPU = p.gpus.Next()
+		jobCfg.InFlight = p.inFlight
+		jobCfg.Timings = timing.NewBreakdown()
+		jobCfg.Result = report.NewProcessResult(job.path)
+
+		if p.throttle != nil {
+			p.throttle.Wait(jobCfg.GPU)
+		}
+
+		queue <- dispatched{job: job, cfg: jobCfg}
+	}
+
+	close(queue)
+	wg.Wait()
+
+	return p.status
+}
+
+// process runs a single job and records its outcome.
+func (p *pool) process(ctx context.Context, job job, cfg config.Config) {
+	if p.inFlight != nil {
+		if err := p.inFlight.Start(job.path); err != nil {
+			slog.Error("Error recording in-flight source", "error", err)
+		}
+	}
+
+	start := time.Now()
+	changed, err := runJob(ctx, job, cfg)
+
+	cfg.Result.Finish(changed, err, start)
+
+	if p.cfg.JSONOutput {
+		p.writeResult(cfg.Result)
+	}
+
+	slog.Debug("Timing", "path", job.path, "stages", cfg.Timings.String())
+
+	p.mu.Lock()
+	p.status.recordTimings(job.path, cfg.Timings)
+	p.mu.Unlock()
+
+	if p.inFlight != nil {
+		if err := p.inFlight.Finish(job.path); err != nil {
+			slog.Error("Error recording in-flight source", "error", err)
+		}
+	}
+
+	if err != nil {
+		slog.Error("Error processing file", "path", job.path, "error", err)
+		p.recordFailure(job.path, err)
+
+		// Sources still being written, moved away or interrupted are retried on the next run
+		// without counting as a bad file
+		if p.quarantine != nil && !errors.Is(err, media.ErrFileNotStable) && !errors.Is(err, proxy.ErrSourceMissing) &&
+			ctx.Err() == nil {
+			p.quarantine.RecordFailure(job.path, err.Error())
+		}
+
+		if p.cache != nil {
+			p.cache.Invalidate(job.path)
+		}
+
+		if p.cfg.FailFast && !p.stopped.Swap(true) {
+			slog.Warn("Stopping after first failure")
+		}
+
+		return
+	}
+
+	p.mu.Lock()
+	p.status.recordSuccess(job.path, changed, cfg.Result)
+	p.mu.Unlock()
+
+	if p.quarantine != nil {
+		p.quarantine.Clear(job.path)
+	}
+
+	p.updateCache(job, cfg.Result)
+
+	// Log the result
+	if changed {
+		slog.Info("File processed successfully", "path", job.path, "proxy", cfg.Result.Output)
+	} else {
+		slog.Info("File has not been changed", "path", job.path, "reason", cfg.Result.Reason)
+	}
+}
+
+// isCacheable reports whether the outcome of a job can be cached. Only local files are, as the cache
+// tells them apart by size and modification time, and runs regenerating proxies or sidecars bypass it.
+func (p *pool) isCacheable(job job) bool {
+	return p.cache != nil && job.entry != nil && !job.disc && !job.remote && job.clip == nil &&
+		!p.cfg.Overwrite && !p.cfg.SidecarsOnly
+}
+
+// lookupCache returns the cache entry of a job's source when it is unchanged since it was processed.
+func (p *pool) lookupCache(job job) (manifest.CacheEntry, bool) {
+	if !p.isCacheable(job) {
+		return manifest.CacheEntry{}, false
+	}
+
+	info, err := os.Stat(job.path)
+	if err != nil {
+		return manifest.CacheEntry{}, false
+	}
+
+	return p.cache.Lookup(job.path, info.Size(), info.ModTime())
+}
+
+// updateCache records a successfully processed source along with its proxy.
+// The source is read again since converting its audio changes it.
+func (p *pool) updateCache(job job, result *report.ProcessResult) {
+	if !p.isCacheable(job) || p.cfg.DryRun {
+		return
+	}
+
+	info, err := os.Stat(job.path)
+	if err != nil || result.Output == "" {
+		p.cache.Invalidate(job.path)
+
+		return
+	}
+
+	p.cache.Record(job.path, manifest.CacheEntry{
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Output:  result.Output,
+		Status:  result.Status,
+	})
+}
+
+// writeResult prints the JSON result of a job on the standard output.
+func (p *pool) writeResult(result *report.ProcessResult) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := result.Write(os.Stdout); err != nil {
+		slog.Error("Error writing result", "error", err)
+	}
+}
+
+// recordFailure records a failed job.
+func (p *pool) recordFailure(filePath string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.status.recordFailure(filePath, err)
+}
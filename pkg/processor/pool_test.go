@@ -0,0 +1,303 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/config"
+	"github.com/cyrilschreiber3/media-processor/pkg/ffmpeg"
+	"github.com/cyrilschreiber3/media-processor/pkg/gpu"
+	"github.com/cyrilschreiber3/media-processor/pkg/manifest"
+	"github.com/cyrilschreiber3/media-processor/pkg/media"
+	"github.com/cyrilschreiber3/media-processor/pkg/proxy"
+	"github.com/cyrilschreiber3/media-processor/pkg/timing"
+)
+
+// fakeJobs replaces the processing of jobs for the duration of the test, calling run instead.
+func fakeJobs(t *testing.T, run func(ctx context.Context, j job, cfg config.Config) (bool, error)) {
+	t.Helper()
+
+	original := runJob
+	runJob = run
+
+	t.Cleanup(func() {
+		runJob = original
+	})
+}
+
+// newJobs returns jobs for the given number of sources.
+func newJobs(count int) []job {
+	jobs := make([]job, count)
+	for i := range jobs {
+		jobs[i] = job{path: fmt.Sprintf("clip%d.mov", i)}
+	}
+
+	return jobs
+}
+
+func TestPoolGPURoundRobin(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		gpus = make(map[string]int)
+	)
+
+	fakeJobs(t, func(_ context.Context, j job, cfg config.Config) (bool, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		gpus[j.path] = cfg.GPU
+
+		return true, nil
+	})
+
+	cfg := config.Default()
+	cfg.Jobs = 3
+	cfg.GPUs = []int{0, 1, 3}
+
+	p := &pool{cfg: cfg, gpus: ffmpeg.NewDeviceRoundRobin(cfg.GPUs)}
+	summary := p.run(context.Background(), newJobs(7))
+
+	if summary.Passed != 7 {
+		t.Fatalf("pool.run() passed = %d, want 7", summary.Passed)
+	}
+
+	for i := range 7 {
+		path := fmt.Sprintf("clip%d.mov", i)
+		if want := cfg.GPUs[i%len(cfg.GPUs)]; gpus[path] != want {
+			t.Errorf("GPU of %s = %d, want %d", path, gpus[path], want)
+		}
+	}
+}
+
+func TestPoolNoGPU(t *testing.T) {
+	fakeJobs(t, func(_ context.Context, j job, cfg config.Config) (bool, error) {
+		if cfg.GPU != -1 {
+			return false, fmt.Errorf("GPU of %s = %d, want -1", j.path, cfg.GPU)
+		}
+
+		return true, nil
+	})
+
+	cfg := config.Default()
+	p := &pool{cfg: cfg, gpus: ffmpeg.NewDeviceRoundRobin(cfg.GPUs)}
+
+	if summary := p.run(context.Background(), newJobs(3)); summary.Failed > 0 {
+		t.Errorf("pool.run() failures = %v, want none", summary.Failures)
+	}
+}
+
+func TestPoolThrottle(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		reads    int
+		started  []int
+		readings = [][]gpu.Stats{{{Index: 0, Temperature: 90}}, {{Index: 0, Temperature: 60}}}
+	)
+
+	fakeJobs(t, func(context.Context, job, config.Config) (bool, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		started = append(started, reads)
+
+		return true, nil
+	})
+
+	throttle := &gpu.Throttle{
+		MaxTemperature: 80,
+		Read: func() ([]gpu.Stats, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			reading := readings[min(reads, len(readings)-1)]
+			reads++
+
+			return reading, nil
+		},
+		Sleep: func(time.Duration) {},
+	}
+
+	cfg := config.Default()
+	cfg.GPUs = []int{0}
+
+	p := &pool{cfg: cfg, gpus: ffmpeg.NewDeviceRoundRobin(cfg.GPUs), throttle: throttle}
+	p.run(context.Background(), newJobs(2))
+
+	// The first job waits for the GPU to cool down, the second one is dispatched at once
+	if reads != 3 || len(started) != 2 || started[0] < 2 {
+		t.Errorf("pool.run() read the GPU %d times and started jobs after %v reads, want 3 and the first after 2",
+			reads, started)
+	}
+}
+
+func TestPoolQuarantine(t *testing.T) {
+	tests := []struct {
+		name            string
+		retryFailed     bool
+		wantRun         bool
+		wantFailed      int
+		wantQuarantined bool
+	}{
+		{"quarantined source skipped", false, false, 1, true},
+		{"forced retry", true, true, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quarantine, err := manifest.LoadQuarantine(filepath.Join(t.TempDir(), manifest.QuarantineFileName))
+			if err != nil {
+				t.Fatalf("LoadQuarantine() error = %v", err)
+			}
+
+			quarantine.RecordFailure("clip0.mov", "invalid data")
+			quarantine.RecordFailure("clip0.mov", "invalid data")
+
+			run := false
+
+			fakeJobs(t, func(context.Context, job, config.Config) (bool, error) {
+				run = true
+
+				return true, nil
+			})
+
+			cfg := config.Default()
+			cfg.QuarantineAfter = 2
+			cfg.RetryFailed = tt.retryFailed
+
+			p := &pool{cfg: cfg, quarantine: quarantine, gpus: ffmpeg.NewDeviceRoundRobin(nil)}
+			summary := p.run(context.Background(), newJobs(1))
+
+			if run != tt.wantRun {
+				t.Errorf("job run = %v, want %v", run, tt.wantRun)
+			}
+
+			if summary.Failed != tt.wantFailed {
+				t.Errorf("pool.run() failed = %d, want %d", summary.Failed, tt.wantFailed)
+			}
+
+			if _, ok := quarantine.Lookup("clip0.mov", cfg.QuarantineAfter); ok != tt.wantQuarantined {
+				t.Errorf("quarantined = %v, want %v", ok, tt.wantQuarantined)
+			}
+		})
+	}
+}
+
+func TestPoolQuarantineRecording(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		wantAttempts int
+	}{
+		{"failure", errors.New("error executing ffmpeg"), 1},
+		{"source still being written", media.ErrFileNotStable, 0},
+		{"source moved away", proxy.ErrSourceMissing, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quarantine, err := manifest.LoadQuarantine(filepath.Join(t.TempDir(), manifest.QuarantineFileName))
+			if err != nil {
+				t.Fatalf("LoadQuarantine() error = %v", err)
+			}
+
+			fakeJobs(t, func(context.Context, job, config.Config) (bool, error) {
+				return false, tt.err
+			})
+
+			cfg := config.Default()
+			p := &pool{cfg: cfg, quarantine: quarantine, gpus: ffmpeg.NewDeviceRoundRobin(nil)}
+			p.run(context.Background(), newJobs(1))
+
+			if entry, _ := quarantine.Lookup("clip0.mov", 1); entry.Attempts != tt.wantAttempts {
+				t.Errorf("quarantine attempts = %d, want %d", entry.Attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestPoolInFlight(t *testing.T) {
+	path := filepath.Join(t.TempDir(), manifest.InFlightFileName)
+
+	inFlight, err := manifest.LoadInFlight(path)
+	if err != nil {
+		t.Fatalf("LoadInFlight() error = %v", err)
+	}
+
+	var recorded []string
+
+	// A crash while the job runs leaves it to be recovered by the next run
+	fakeJobs(t, func(context.Context, job, config.Config) (bool, error) {
+		crashed, err := manifest.LoadInFlight(path)
+		if err != nil {
+			return false, err
+		}
+
+		recorded, err = crashed.Recover()
+
+		return true, err
+	})
+
+	p := &pool{cfg: config.Default(), inFlight: inFlight, gpus: ffmpeg.NewDeviceRoundRobin(nil)}
+	p.run(context.Background(), newJobs(1))
+
+	if len(recorded) != 1 || recorded[0] != "clip0.mov" {
+		t.Errorf("in-flight sources while running = %v, want [clip0.mov]", recorded)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("in-flight file error = %v after the run, want it removed", err)
+	}
+}
+
+func TestPoolTimings(t *testing.T) {
+	fakeJobs(t, func(_ context.Context, _ job, cfg config.Config) (bool, error) {
+		for _, stage := range timing.Stages {
+			cfg.Timings.Since(stage, time.Now().Add(-time.Second))
+		}
+
+		return true, nil
+	})
+
+	cfg := config.Default()
+	cfg.Jobs = 2
+
+	p := &pool{cfg: cfg, gpus: ffmpeg.NewDeviceRoundRobin(nil)}
+	summary := p.run(context.Background(), newJobs(3))
+
+	// Every file gets its own breakdown
+	if len(summary.Timings) != 3 {
+		t.Fatalf("pool.run() timings = %v, want one per file", summary.Timings)
+	}
+
+	for _, timings := range summary.Timings {
+		for _, stage := range timing.Stages {
+			if seconds := timings.Stages[string(stage)]; seconds < 1 || seconds > 2 {
+				t.Errorf("%s %s = %vs, want the recorded second", timings.Path, stage, seconds)
+			}
+		}
+	}
+}
+
+func TestPoolSkippedBatches(t *testing.T) {
+	fakeJobs(t, func(context.Context, job, config.Config) (bool, error) {
+		return true, nil
+	})
+
+	p := &pool{cfg: config.Default(), gpus: ffmpeg.NewDeviceRoundRobin(nil)}
+	p.run(context.Background(), newJobs(2))
+
+	// A watcher runs the pool once per batch, the jobs skipped by every batch add up
+	p.stopped.Store(true)
+	p.run(context.Background(), newJobs(3))
+	summary := p.run(context.Background(), newJobs(2))
+
+	if summary.Passed != 2 || summary.Skipped != 5 {
+		t.Errorf("pool.run() passed = %d, skipped = %d, want 2 and 5", summary.Passed, summary.Skipped)
+	}
+}
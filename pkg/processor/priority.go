@@ -0,0 +1,103 @@
+package processor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// loadPriorityList reads a priority file listing one source path or glob pattern per line.
+// Blank lines and lines starting with # are ignored.
+func loadPriorityList(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening priority file: %w", err)
+	}
+	defer file.Close()
+
+	var patterns []string
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if _, err := filepath.Match(line, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q in priority file: %w", line, err)
+		}
+
+		patterns = append(patterns, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading priority file: %w", err)
+	}
+
+	return patterns, nil
+}
+
+// priorityRank returns the index of the first pattern matching the path, or -1 when none matches.
+// Patterns are matched against the path as given, its absolute form and its base name.
+func priorityRank(path string, patterns []string) int {
+	candidates := []string{path, filepath.Base(path)}
+	if absPath, err := filepath.Abs(path); err == nil {
+		candidates = append(candidates, absPath)
+	}
+
+	for i, pattern := range patterns {
+		for _, candidate := range candidates {
+			if matched, _ := filepath.Match(pattern, candidate); matched {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+// prioritize moves the jobs matching the priority patterns to the front, ordered by the first
+// pattern they match. The scan order is kept otherwise.
+func prioritize(jobs []job, patterns []string) []job {
+	if len(patterns) == 0 {
+		return jobs
+	}
+
+	ranks := make(map[string]int, len(jobs))
+	for _, job := range jobs {
+		ranks[job.path] = priorityRank(job.path, patterns)
+		if ranks[job.path] < 0 {
+			ranks[job.path] = len(patterns)
+		}
+	}
+
+	sorted := slices.Clone(jobs)
+	slices.SortStableFunc(sorted, func(a, b job) int {
+		return ranks[a.path] - ranks[b.path]
+	})
+
+	return sorted
+}
+
+// requeueFirst moves the jobs of the given sources to the front, keeping the order otherwise.
+func requeueFirst(jobs []job, sources []string) []job {
+	sorted := slices.Clone(jobs)
+	slices.SortStableFunc(sorted, func(a, b job) int {
+		aFirst, bFirst := slices.Contains(sources, a.path), slices.Contains(sources, b.path)
+
+		switch {
+		case aFirst && !bFirst:
+			return -1
+		case bFirst && !aFirst:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	return sorted
+}
@@ -0,0 +1,123 @@
+package processor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/config"
+	"github.com/cyrilschreiber3/media-processor/pkg/ffmpeg"
+)
+
+// jobPaths returns the source paths of jobs.
+func jobPaths(jobs []job) []string {
+	paths := make([]string, len(jobs))
+	for i, job := range jobs {
+		paths[i] = job.path
+	}
+
+	return paths
+}
+
+func TestLoadPriorityList(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		wantErr bool
+	}{
+		{"paths and patterns", "/footage/hero.mov\n*_A001*\n", []string{"/footage/hero.mov", "*_A001*"}, false},
+		{"comments and blank lines", "# hero shots\n\n  hero.mov  \n", []string{"hero.mov"}, false},
+		{"invalid pattern", "[hero\n", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "priority.txt")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatalf("error creating %s: %v", path, err)
+			}
+
+			got, err := loadPriorityList(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadPriorityList() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("loadPriorityList() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := loadPriorityList(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("loadPriorityList() error = nil for a missing file, want an error")
+	}
+}
+
+func TestPriorityRank(t *testing.T) {
+	patterns := []string{"/footage/hero.mov", "*_A001*", "interview*"}
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/footage/hero.mov", 0},
+		{"/footage/day1/clip_A001_C002.mov", 1},
+		{"/footage/interview_1.mov", 2},
+		{"/footage/broll.mov", -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := priorityRank(tt.path, patterns); got != tt.want {
+				t.Errorf("priorityRank(%q) = %d, want %d", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrioritize(t *testing.T) {
+	jobs := []job{
+		{path: "a.mov"}, {path: "interview_1.mov"}, {path: "b.mov"}, {path: "hero.mov"}, {path: "interview_2.mov"},
+	}
+
+	got := jobPaths(prioritize(jobs, []string{"hero.mov", "interview*"}))
+
+	// Priority files come first in the order of their patterns, the scan order is kept otherwise
+	want := []string{"hero.mov", "interview_1.mov", "interview_2.mov", "a.mov", "b.mov"}
+	if !slices.Equal(got, want) {
+		t.Errorf("prioritize() = %v, want %v", got, want)
+	}
+
+	if got := jobPaths(prioritize(jobs, nil)); !slices.Equal(got, jobPaths(jobs)) {
+		t.Errorf("prioritize() without patterns = %v, want the scan order", got)
+	}
+}
+
+func TestRequeueFirst(t *testing.T) {
+	got := jobPaths(requeueFirst(newJobs(4), []string{"clip3.mov", "clip1.mov"}))
+
+	if want := []string{"clip1.mov", "clip3.mov", "clip0.mov", "clip2.mov"}; !slices.Equal(got, want) {
+		t.Errorf("requeueFirst() = %v, want %v", got, want)
+	}
+}
+
+func TestPoolPriorityDispatch(t *testing.T) {
+	var started []string
+
+	fakeJobs(t, func(_ context.Context, j job, _ config.Config) (bool, error) {
+		started = append(started, j.path)
+
+		return true, nil
+	})
+
+	cfg := config.Default()
+	p := &pool{cfg: cfg, gpus: ffmpeg.NewDeviceRoundRobin(nil)}
+	p.run(context.Background(), prioritize(newJobs(5), []string{"clip4.mov", "clip2.mov"}))
+
+	if want := []string{"clip4.mov", "clip2.mov", "clip0.mov", "clip1.mov", "clip3.mov"}; !slices.Equal(started, want) {
+		t.Errorf("dispatch order = %v, want %v", started, want)
+	}
+}
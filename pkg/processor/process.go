@@ -0,0 +1,220 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/audio"
+	"github.com/cyrilschreiber3/media-processor/pkg/config"
+	"github.com/cyrilschreiber3/media-processor/pkg/disc"
+	"github.com/cyrilschreiber3/media-processor/pkg/fileutil"
+	"github.com/cyrilschreiber3/media-processor/pkg/gpu"
+	"github.com/cyrilschreiber3/media-processor/pkg/media"
+	"github.com/cyrilschreiber3/media-processor/pkg/proxy"
+	"github.com/cyrilschreiber3/media-processor/pkg/report"
+	"github.com/cyrilschreiber3/media-processor/pkg/scancache"
+	"github.com/cyrilschreiber3/media-processor/pkg/timing"
+)
+
+// processFile handles the processing of a single media file.
+func processFile(ctx context.Context, file os.DirEntry, filePath string, cfg config.Config) (bool, error) {
+	slog.Info("Processing file", "path", filePath)
+
+	if cfg.StableWait > 0 {
+		if err := waitStable(filePath, cfg); err != nil {
+			return false, err
+		}
+	}
+
+	// Generate proxy file
+	changed, err := proxy.GenerateProxyWithProgress(ctx, filePath, file, cfg, progressLogger(filePath))
+	if err != nil {
+		return false, fmt.Errorf("error generating proxy: %w", err)
+	}
+
+	// Only a proxy written and verified by this run vouches for the source, not one found existing.
+	// Verifications may not apply, e.g. the frame count of an audio-only source, which leaves the source in place.
+	if cfg.DeleteSourceOnSuccess && changed {
+		if cfg.Result.IsVerified() {
+			return changed, removeSource(filePath, cfg)
+		}
+
+		slog.Warn("Not deleting source whose proxy could not be verified", "path", filePath)
+	}
+
+	// Sources are left untouched when only sidecars are refreshed, or when proxies go to an output root
+	if cfg.SidecarsOnly || cfg.OutputRoot != "" {
+		return changed, nil
+	}
+
+	// Get media information for audio processing
+	start := time.Now()
+	mediaInfo, err := media.GetMediaInfo(filePath)
+	cfg.Timings.Since(timing.Probe, start)
+
+	if err != nil {
+		return false, fmt.Errorf("error getting media info: %w", err)
+	}
+
+	// Check if file has unsupported audio format
+	start = time.Now()
+	props := media.AnalyzeMediaInfoWith(mediaInfo, cfg.SupportedAudioCodecs)
+	cfg.Timings.Since(timing.Analyze, start)
+
+	if props.UnsupportedAudioFormat && cfg.NoModifySource {
+		slog.Warn("Unsupported audio format detected, leaving source unmodified", "path", filePath)
+		cfg.Result.SetWarning(report.WarningSourceAudioUnsupported)
+	} else if props.UnsupportedAudioFormat {
+		slog.Info("Unsupported audio format detected, converting to PCM", "path", filePath)
+
+		err = audio.ProcessUnsupportedAudio(ctx, filePath, cfg)
+		if err != nil {
+			return false, fmt.Errorf("error processing unsupported audio source file: %w", err)
+		}
+	}
+
+	return changed, nil
+}
+
+// removeSource deletes a source whose proxy was verified, or moves it to cfg.SourceTrash when set.
+// Sources kept in an originals folder are never removed.
+func removeSource(filePath string, cfg config.Config) error {
+	if slices.Contains(strings.Split(filepath.ToSlash(filepath.Dir(filePath)), "/"), cfg.OriginalsDir) {
+		slog.Warn("Not deleting source kept in an originals folder", "path", filePath)
+
+		return nil
+	}
+
+	if cfg.SourceTrash == "" {
+		if err := os.Remove(filePath); err != nil {
+			return fmt.Errorf("error deleting source: %w", err)
+		}
+
+		slog.Warn("Deleted source after verifying its proxy", "path", filePath, "proxy", cfg.Result.Output)
+
+		return nil
+	}
+
+	if err := fileutil.CreateDir(cfg.SourceTrash, cfg.DirMode, false); err != nil {
+		return fmt.Errorf("error creating source trash: %w", err)
+	}
+
+	// Sources of the same name from different folders don't replace each other
+	trashPath := filepath.Join(cfg.SourceTrash, filepath.Base(filePath))
+	if _, err := os.Stat(trashPath); err == nil {
+		trashPath = filepath.Join(cfg.SourceTrash, time.Now().Format("20060102-150405.000")+"-"+filepath.Base(filePath))
+	}
+
+	if err := os.Rename(filePath, trashPath); err != nil {
+		return fmt.Errorf("error moving source to trash: %w", err)
+	}
+
+	slog.Warn("Moved source to trash after verifying its proxy", "path", filePath, "trash", trashPath,
+		"proxy", cfg.Result.Output)
+
+	return nil
+}
+
+// waitStable checks that a file isn't being written anymore, checking again up to cfg.StableRetries times.
+func waitStable(filePath string, cfg config.Config) error {
+	for attempt := 0; ; attempt++ {
+		stable, err := media.IsFileStable(filePath, cfg.StableWait)
+		if err != nil {
+			return fmt.Errorf("error checking file stability: %w", err)
+		}
+
+		if stable {
+			return nil
+		}
+
+		if attempt >= cfg.StableRetries {
+			return fmt.Errorf("skipping %s: %w", filePath, media.ErrFileNotStable)
+		}
+
+		slog.Info("File is still being written, checking again", "path", filePath)
+	}
+}
+
+// progressLoggingStep is the percentage between two progress log lines.
+const progressLoggingStep = 10
+
+// progressLogger returns a progress callback logging the encode of a file every progressLoggingStep percent.
+func progressLogger(filePath string) func(pct float64) {
+	next := float64(progressLoggingStep)
+
+	return func(pct float64) {
+		if pct < next {
+			return
+		}
+
+		slog.Info("Encoding", "path", filePath, "progress", fmt.Sprintf("%.0f%%", pct))
+
+		for next <= pct {
+			next += progressLoggingStep
+		}
+	}
+}
+
+// processDisc generates a proxy of the main title of a ripped DVD or Blu-ray structure.
+// Disc files are never modified, so unsupported audio is only handled in the proxy.
+func processDisc(ctx context.Context, discPath string, cfg config.Config) (bool, error) {
+	slog.Info("Processing disc", "path", discPath)
+
+	title, err := disc.FindTitle(discPath)
+	if err != nil {
+		return false, fmt.Errorf("error finding disc title: %w", err)
+	}
+
+	changed, err := proxy.GenerateDiscProxy(ctx, title, cfg)
+	if err != nil {
+		return false, fmt.Errorf("error generating proxy: %w", err)
+	}
+
+	return changed, nil
+}
+
+// updateScanCache records the watch path as processed when every job succeeded, and invalidates it otherwise.
+func updateScanCache(scanCache *scancache.Cache, watchPath string, files []os.DirEntry, status Summary) {
+	// Stat again since creating the Proxy directory changes the modification time
+	watchInfo, err := os.Stat(watchPath)
+	if err != nil || status.Failed > 0 {
+		scanCache.Invalidate(watchPath)
+	} else {
+		names := make([]string, len(files))
+		for i, file := range files {
+			names[i] = file.Name()
+		}
+
+		scanCache.Update(watchPath, watchInfo.ModTime(), names)
+	}
+
+	if err := scanCache.Save(); err != nil {
+		slog.Error("Error saving scan cache", "error", err)
+	}
+}
+
+// newThrottle creates the GPU throttle gating dispatch, or nil when throttling is disabled or unavailable.
+func newThrottle(cfg config.Config) *gpu.Throttle {
+	if cfg.ThrottleTemperature <= 0 && cfg.ThrottleUtilization <= 0 {
+		return nil
+	}
+
+	if !gpu.IsNvidiaSMIInstalled() {
+		slog.Warn("nvidia-smi is not installed, GPU throttling is disabled")
+
+		return nil
+	}
+
+	return &gpu.Throttle{
+		MaxTemperature: cfg.ThrottleTemperature,
+		MaxUtilization: cfg.ThrottleUtilization,
+		Interval:       cfg.ThrottleInterval,
+		Read:           gpu.ReadNvidiaSMI,
+	}
+}
@@ -0,0 +1,58 @@
+package processor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/scancache"
+)
+
+func TestUpdateScanCache(t *testing.T) {
+	tests := []struct {
+		name    string
+		failed  bool
+		modify  bool
+		wantHit bool
+	}{
+		{"all succeeded", false, false, true},
+		{"directory modified since", false, true, false},
+		{"some failed", true, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			watchPath := t.TempDir()
+
+			cache, err := scancache.Load(filepath.Join(t.TempDir(), "scan-cache.json"))
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+
+			var status Summary
+			if tt.failed {
+				status.recordFailure(filepath.Join(watchPath, "clip.mov"), errors.New("error executing ffmpeg"))
+			}
+
+			updateScanCache(cache, watchPath, nil, status)
+
+			if tt.modify {
+				modTime := time.Now().Add(time.Hour)
+				if err := os.Chtimes(watchPath, modTime, modTime); err != nil {
+					t.Fatalf("error setting the times of %s: %v", watchPath, err)
+				}
+			}
+
+			info, err := os.Stat(watchPath)
+			if err != nil {
+				t.Fatalf("error getting info of %s: %v", watchPath, err)
+			}
+
+			if got := cache.IsUnchanged(watchPath, info.ModTime()); got != tt.wantHit {
+				t.Errorf("Cache.IsUnchanged() = %v, want %v", got, tt.wantHit)
+			}
+		})
+	}
+}
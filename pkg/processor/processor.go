@@ -0,0 +1,259 @@
+// Package processor scans a watch path and generates the proxies of its media, as the media-processor command does.
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/config"
+	"github.com/cyrilschreiber3/media-processor/pkg/ffmpeg"
+	"github.com/cyrilschreiber3/media-processor/pkg/manifest"
+	"github.com/cyrilschreiber3/media-processor/pkg/media"
+	"github.com/cyrilschreiber3/media-processor/pkg/report"
+	"github.com/cyrilschreiber3/media-processor/pkg/scancache"
+)
+
+// Options are the settings of a run.
+type Options struct {
+	// Config is the configuration of the run, checked with its Validate method beforehand.
+	Config config.Config
+	// Path is the watch path, a directory of media, a single media file or the URL of a remote source.
+	Path string
+}
+
+// Run processes the media of the watch path and returns the summary of the run.
+// Cancelling the context stops dispatching new files and aborts the running ones, removing their partial proxies;
+// it also ends Watch mode.
+// With Estimate, the estimate is printed on the standard output and an empty summary is returned.
+// The returned error reports a run that couldn't start, failed files are reported in the summary.
+func Run(ctx context.Context, opts Options) (Summary, error) {
+	cfg := opts.Config
+	watchPath := opts.Path
+
+	if !ffmpeg.IsFFmpegInstalled() {
+		return Summary{}, errors.New("ffmpeg is not installed, please install ffmpeg to use this program")
+	}
+
+	// An unusable hardware backend would fail every file, and quarantine them
+	if _, err := ffmpeg.HardwareBackend(cfg); err != nil {
+		return Summary{}, err
+	}
+
+	if cfg.Watch && media.IsRemote(watchPath) {
+		return Summary{}, errors.New("-watch requires a local watch path")
+	}
+
+	// A single file is processed on its own, with the state files of its directory
+	var fileInfo os.FileInfo
+
+	stateDir := watchPath
+
+	if !media.IsRemote(watchPath) {
+		if info, err := os.Stat(watchPath); err == nil && !info.IsDir() {
+			fileInfo = info
+			stateDir = filepath.Dir(watchPath)
+		}
+	}
+
+	if fileInfo != nil && cfg.Watch {
+		return Summary{}, errors.New("-watch requires a directory watch path")
+	}
+
+	var scanCache *scancache.Cache
+
+	if cfg.ScanCache != "" {
+		var err error
+
+		scanCache, err = scancache.Load(cfg.ScanCache)
+		if err != nil {
+			return Summary{}, err
+		}
+	}
+
+	// Read the files in the watch path, unless it was fully processed and hasn't changed since
+	var (
+		files []os.DirEntry
+		jobs  []job
+	)
+
+	switch {
+	case media.IsRemote(watchPath):
+		jobs = []job{{path: watchPath, remote: true}}
+	case fileInfo != nil && !media.IsMediaFile(watchPath):
+		// Hooks calling for every new file also pass non-media, which isn't an error
+		slog.Info("Skipping non-media file", "path", watchPath)
+	case fileInfo != nil:
+		jobs = []job{{path: watchPath, entry: fs.FileInfoToDirEntry(fileInfo)}}
+	case cfg.Recursive:
+		// The scan cache only tracks the top level, so subdirectories are always walked
+		walked, err := walkJobs(watchPath, cfg, nil)
+		if err != nil {
+			return Summary{}, err
+		}
+
+		jobs = pairOPAtom(walked)
+	default:
+		watchInfo, err := os.Stat(watchPath)
+		if err != nil {
+			return Summary{}, fmt.Errorf("error reading watch path: %w", err)
+		}
+
+		// Overwriting regenerates every proxy, so the cache can't tell there is nothing to do
+		if scanCache != nil && !cfg.Overwrite && scanCache.IsUnchanged(watchPath, watchInfo.ModTime()) {
+			slog.Info("Directory unchanged since last scan, skipping", "path", watchPath)
+		} else {
+			files, err = os.ReadDir(watchPath)
+			if err != nil {
+				return Summary{}, fmt.Errorf("error reading watch path: %w", err)
+			}
+		}
+
+		jobs = pairOPAtom(collectJobs(watchPath, files, cfg))
+	}
+
+	var patterns []string
+
+	if cfg.PriorityFile != "" {
+		var err error
+
+		patterns, err = loadPriorityList(cfg.PriorityFile)
+		if err != nil {
+			return Summary{}, err
+		}
+
+		jobs = prioritize(jobs, patterns)
+	}
+
+	if cfg.Estimate {
+		return Summary{}, printEstimate(os.Stdout, jobs, watchPath, cfg)
+	}
+
+	var quarantine *manifest.Quarantine
+
+	// Dry runs read the quarantine to show what would be skipped, but never update it
+	if cfg.QuarantineAfter > 0 && !media.IsRemote(watchPath) {
+		var err error
+
+		quarantine, err = manifest.LoadQuarantine(filepath.Join(stateDir, manifest.QuarantineFileName))
+		if err != nil {
+			return Summary{}, err
+		}
+	}
+
+	// Retry first the sources a previous run was processing when it stopped, after removing their partial outputs
+	var (
+		inFlight    *manifest.InFlight
+		interrupted []string
+	)
+
+	if !media.IsRemote(watchPath) && !cfg.DryRun {
+		var err error
+
+		inFlight, err = manifest.LoadInFlight(filepath.Join(stateDir, manifest.InFlightFileName))
+		if err != nil {
+			return Summary{}, err
+		}
+
+		interrupted, err = inFlight.Recover()
+		if err != nil {
+			return Summary{}, err
+		}
+
+		if len(interrupted) > 0 {
+			slog.Info("Retrying sources interrupted by a previous run", "count", len(interrupted))
+
+			jobs = requeueFirst(jobs, interrupted)
+		}
+	}
+
+	var cache *manifest.Cache
+
+	if !media.IsRemote(watchPath) && !cfg.NoCache {
+		var err error
+
+		cache, err = manifest.LoadCache(filepath.Join(stateDir, manifest.CacheFileName))
+		if err != nil {
+			return Summary{}, err
+		}
+	}
+
+	cfg.SourceRoot = stateDir
+
+	jobPool := &pool{
+		cfg:        cfg,
+		quarantine: quarantine,
+		inFlight:   inFlight,
+		cache:      cache,
+		gpus:       ffmpeg.NewDeviceRoundRobin(cfg.GPUs),
+		throttle:   newThrottle(cfg),
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		jobPool.stopped.Store(true)
+	})
+	defer stop()
+
+	var summary Summary
+
+	if cfg.Watch {
+		// Media already in the watch path is debounced on start like new media, after the interrupted sources
+		watcher, err := newWatcher(watchPath, patterns, jobPool, quarantine)
+		if err != nil {
+			return Summary{}, err
+		}
+
+		summary = watcher.run(ctx, interrupted)
+	} else {
+		summary = jobPool.run(ctx, jobs)
+	}
+
+	if fileInfo != nil && len(jobs) == 0 {
+		result := report.NewProcessResult(watchPath)
+		result.SetSkipReason(report.ReasonNotMedia)
+		result.Finish(false, nil, time.Now())
+
+		summary.recordSuccess(watchPath, false, result)
+
+		if cfg.JSONOutput {
+			if err := result.Write(os.Stdout); err != nil {
+				slog.Error("Error writing result", "error", err)
+			}
+		}
+	}
+
+	summary.setStatus()
+	summary.printSummary()
+
+	if quarantine != nil && !cfg.DryRun {
+		if err := quarantine.Save(); err != nil {
+			slog.Error("Error saving quarantine", "error", err)
+		}
+	}
+
+	if cache != nil && !cfg.DryRun {
+		if err := cache.Save(); err != nil {
+			slog.Error("Error saving cache", "error", err)
+		}
+	}
+
+	// Filtered runs leave files out, so they don't mark the watch path as processed
+	filtered := len(cfg.Include) > 0 || len(cfg.Exclude) > 0
+
+	if scanCache != nil && files != nil && !cfg.DryRun && !cfg.Watch && !filtered {
+		updateScanCache(scanCache, watchPath, files, summary)
+	}
+
+	if cfg.StatusFile != "" {
+		if err := writeStatusFile(cfg.StatusFile, summary); err != nil {
+			return summary, err
+		}
+	}
+
+	return summary, nil
+}
@@ -0,0 +1,252 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/config"
+	"github.com/cyrilschreiber3/media-processor/pkg/manifest"
+	"github.com/cyrilschreiber3/media-processor/pkg/report"
+)
+
+// createSource creates an empty media file, along with its directories.
+func createSource(t *testing.T, path string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("error creating %s: %v", filepath.Dir(path), err)
+	}
+
+	if err := os.WriteFile(path, []byte("source"), 0o600); err != nil {
+		t.Fatalf("error creating %s: %v", path, err)
+	}
+}
+
+// dryRun runs a dry run over the watch path and returns its summary.
+func dryRun(t *testing.T, watchPath string, cfg config.Config) Summary {
+	t.Helper()
+
+	cfg.DryRun = true
+
+	summary, err := Run(context.Background(), Options{Config: cfg, Path: watchPath})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	return summary
+}
+
+func TestRunSpecialCharacters(t *testing.T) {
+	tests := []struct {
+		name      string
+		subdir    string
+		recursive bool
+	}{
+		{"watch path", "", false},
+		{"subdirectory", "Cam A + B (été)", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installCommands(t)
+
+			watchPath := filepath.Join(t.TempDir(), "Day 1 + B-roll")
+			source := filepath.Join(watchPath, tt.subdir, "clip +1 été.mov")
+			createSource(t, source)
+
+			cfg := config.Default()
+			cfg.Recursive = tt.recursive
+
+			summary := dryRun(t, watchPath, cfg)
+
+			if len(summary.Files) != 1 {
+				t.Fatalf("Run() files = %+v, want a single file", summary.Files)
+			}
+
+			file := summary.Files[0]
+			want := filepath.Join(filepath.Dir(source), "Proxy", "clip +1 été.mov")
+
+			if file.Path != source || file.Output != want || file.Reason != report.ReasonDryRun {
+				t.Errorf("Run() file = %+v, want %s proxied to %s", file, source, want)
+			}
+		})
+	}
+}
+
+func TestIsMediaSource(t *testing.T) {
+	cfg := config.Default()
+	cfg.AudioProxyDir = "AudioProxy"
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/footage/clip.mov", true},
+		{"/footage/Proxy/clip.mov", false},
+		{"/footage/AudioProxy/voice.m4a", false},
+		{"/footage/Originals/voice.wav", false},
+		{"/footage/Proxy Day/clip.mov", true},
+		{"/footage/notes.txt", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := isMediaSource(tt.path, cfg); got != tt.want {
+				t.Errorf("isMediaSource(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunSkipsProxyFolders(t *testing.T) {
+	tests := []struct {
+		name      string
+		recursive bool
+	}{
+		{"watch path", false},
+		{"recursive", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installCommands(t)
+
+			watchPath := t.TempDir()
+			source := filepath.Join(watchPath, "clip.mov")
+			createSource(t, source)
+
+			// Proxies and originals found as the watch path is walked are never processed again
+			for _, path := range []string{"Proxy/clip.mov", "Originals/voice.wav", "Proxy/Proxy/clip.mov"} {
+				createSource(t, filepath.Join(watchPath, path))
+			}
+
+			cfg := config.Default()
+			cfg.Recursive = tt.recursive
+
+			summary := dryRun(t, watchPath, cfg)
+
+			if len(summary.Files) != 1 || summary.Files[0].Path != source {
+				t.Errorf("Run() files = %+v, want only %s", summary.Files, source)
+			}
+
+			// Pointing the tool at a proxy folder doesn't proxy the proxies either
+			if summary := dryRun(t, filepath.Join(watchPath, "Proxy"), cfg); summary.Total != 0 {
+				t.Errorf("Run() files = %+v in the proxy folder, want none", summary.Files)
+			}
+		})
+	}
+}
+
+func TestRunDeleteSourceUnverified(t *testing.T) {
+	tests := []struct {
+		name       string
+		probe      string
+		source     string
+		wantSource bool
+	}{
+		{"video source verified", probeClip, "clip.mov", false},
+		// The frame count of an audio-only source can't be checked, so nothing vouches for its proxy
+		{"audio-only source", probeVoice, "voice.wav", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installCommands(t, tt.probe)
+
+			watchPath := t.TempDir()
+			sourcePath := filepath.Join(watchPath, tt.source)
+			createSource(t, sourcePath)
+
+			cfg := config.Default()
+			cfg.VerifyFrameCount = true
+			cfg.DeleteSourceOnSuccess = true
+
+			if _, err := Run(context.Background(), Options{Config: cfg, Path: watchPath}); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+
+			if _, err := os.Stat(sourcePath); (err == nil) != tt.wantSource {
+				t.Errorf("source %s error = %v, want it kept %t", sourcePath, err, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestRunInterrupted(t *testing.T) {
+	tests := []struct {
+		name  string
+		watch bool
+		want  int
+	}{
+		{"batch", false, 3},
+		// The other sources never settle within the test, the interrupted one is processed without waiting
+		{"watch", true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installCommands(t)
+
+			watchPath := t.TempDir()
+			for _, name := range []string{"clip0.mov", "clip1.mov", "clip2.mov"} {
+				createSource(t, filepath.Join(watchPath, name))
+			}
+
+			// A crash while clip2.mov was processed leaves it in flight, along with its partial proxy
+			interrupted := filepath.Join(watchPath, "clip2.mov")
+			partial := filepath.Join(watchPath, "Proxy", "clip2.mov")
+			createSource(t, partial)
+
+			inFlight, err := manifest.LoadInFlight(filepath.Join(watchPath, manifest.InFlightFileName))
+			if err != nil {
+				t.Fatalf("LoadInFlight() error = %v", err)
+			}
+
+			if err := errors.Join(inFlight.Start(interrupted), inFlight.AddOutput(interrupted, partial)); err != nil {
+				t.Fatalf("error recording in-flight source: %v", err)
+			}
+
+			runs := make(chan watchRun, 16)
+
+			fakeJobs(t, func(_ context.Context, j job, _ config.Config) (bool, error) {
+				runs <- watchRun{path: j.path, at: time.Now()}
+
+				return true, nil
+			})
+
+			cfg := config.Default()
+			cfg.Watch = tt.watch
+			cfg.WatchInterval = time.Hour
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			done := make(chan error, 1)
+
+			go func() {
+				_, err := Run(ctx, Options{Config: cfg, Path: watchPath})
+				done <- err
+			}()
+
+			received := waitRuns(t, runs, tt.want)
+			noMoreRuns(t, runs)
+			cancel()
+
+			if err := <-done; err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+
+			if received[0].path != interrupted {
+				t.Errorf("first source processed = %s, want the interrupted %s", received[0].path, interrupted)
+			}
+
+			if _, err := os.Stat(partial); !os.IsNotExist(err) {
+				t.Errorf("partial proxy error = %v, want it removed", err)
+			}
+		})
+	}
+}
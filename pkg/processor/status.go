@@ -0,0 +1,141 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/report"
+	"github.com/cyrilschreiber3/media-processor/pkg/timing"
+)
+
+// Failure describes a file that could not be processed.
+type Failure struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// FileResult is the outcome of a processed file, with one of the report statuses,
+// and one of the report reasons when it was skipped.
+type FileResult struct {
+	Path    string `json:"path"`
+	Status  string `json:"status"`
+	Output  string `json:"output,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	Warning string `json:"warning,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// FileTimings is the time spent in each stage of the processing of a file, in seconds.
+type FileTimings struct {
+	Path   string             `json:"path"`
+	Stages map[string]float64 `json:"stages"`
+}
+
+// Summary is the pass/fail summary of a batch run.
+// Passed counts the files that succeeded, Created those of them that got a proxy.
+// Skipped counts the files that were never attempted after the run stopped early.
+type Summary struct {
+	Status   string        `json:"status"`
+	Total    int           `json:"total"`
+	Passed   int           `json:"passed"`
+	Created  int           `json:"created"`
+	Failed   int           `json:"failed"`
+	Skipped  int           `json:"skipped"`
+	Failures []Failure     `json:"failures"`
+	Files    []FileResult  `json:"files"`
+	Timings  []FileTimings `json:"timings"`
+}
+
+// recordSuccess counts a successfully processed file, which was changed or left untouched,
+// along with its proxy, the reason it was skipped and the caveats from its result.
+func (s *Summary) recordSuccess(filePath string, changed bool, result *report.ProcessResult) {
+	s.Total++
+	s.Passed++
+
+	status := report.StatusSkipped
+	if changed {
+		status = report.StatusCreated
+		s.Created++
+	}
+
+	s.Files = append(s.Files, FileResult{
+		Path:    filePath,
+		Status:  status,
+		Output:  result.Output,
+		Reason:  result.Reason,
+		Warning: result.Warning,
+	})
+}
+
+// recordFailure counts a failed file along with its error.
+func (s *Summary) recordFailure(filePath string, err error) {
+	s.Total++
+	s.Failed++
+	s.Failures = append(s.Failures, Failure{Path: filePath, Error: err.Error()})
+	s.Files = append(s.Files, FileResult{Path: filePath, Status: report.StatusFailed, Error: err.Error()})
+}
+
+// setStatus sets the overall status of the run: pass, or fail when a file failed.
+func (s *Summary) setStatus() {
+	s.Status = "pass"
+	if s.Failed > 0 {
+		s.Status = "fail"
+	}
+}
+
+// recordTimings adds the timing breakdown of a processed file.
+func (s *Summary) recordTimings(filePath string, breakdown *timing.Breakdown) {
+	s.Timings = append(s.Timings, FileTimings{Path: filePath, Stages: breakdown.Seconds()})
+}
+
+// printSummary logs the number of processed and failed files, and the failures.
+// Files left out by -fail-fast are counted apart, since they were never attempted.
+func (s *Summary) printSummary() {
+	if s.Skipped > 0 {
+		slog.Info("Processed files", "total", s.Total, "succeeded", s.Passed, "created", s.Created,
+			"failed", s.Failed, "not_attempted", s.Skipped)
+	} else {
+		slog.Info("Processed files", "total", s.Total, "succeeded", s.Passed, "created", s.Created, "failed", s.Failed)
+	}
+
+	for _, failure := range s.Failures {
+		slog.Warn("Failed file", "path", failure.Path, "error", failure.Error)
+	}
+}
+
+// ExitCode returns the process exit code matching the batch outcome.
+func (s *Summary) ExitCode() int {
+	if s.Failed > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+// writeStatusFile writes the batch summary as JSON to the given path.
+func writeStatusFile(path string, status Summary) error {
+	if status.Failures == nil {
+		status.Failures = []Failure{}
+	}
+
+	if status.Files == nil {
+		status.Files = []FileResult{}
+	}
+
+	if status.Timings == nil {
+		status.Timings = []FileTimings{}
+	}
+
+	data, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling status: %w", err)
+	}
+
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil { //nolint:gosec
+		return fmt.Errorf("error writing status file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,161 @@
+package processor
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/report"
+)
+
+// fileOutcome is the outcome of a file of a batch: a created proxy when changed, a skipped file otherwise,
+// or a failure with its error.
+type fileOutcome struct {
+	path    string
+	changed bool
+	err     error
+}
+
+// summarize records the outcomes of a batch in a summary.
+func summarize(outcomes []fileOutcome) Summary {
+	var summary Summary
+
+	for _, outcome := range outcomes {
+		if outcome.err != nil {
+			summary.recordFailure(outcome.path, outcome.err)
+
+			continue
+		}
+
+		summary.recordSuccess(outcome.path, outcome.changed, &report.ProcessResult{Output: outcome.path + ".proxy"})
+	}
+
+	summary.setStatus()
+
+	return summary
+}
+
+func TestSummaryExitCode(t *testing.T) {
+	tests := []struct {
+		name       string
+		outcomes   []fileOutcome
+		wantStatus string
+		wantCode   int
+	}{
+		{
+			name:       "all ok",
+			outcomes:   []fileOutcome{{path: "a.mov", changed: true}, {path: "b.mov", changed: true}},
+			wantStatus: "pass",
+			wantCode:   0,
+		},
+		{
+			name: "some failed",
+			outcomes: []fileOutcome{
+				{path: "a.mov", changed: true},
+				{path: "b.mov", err: errors.New("error executing ffmpeg")},
+			},
+			wantStatus: "fail",
+			wantCode:   1,
+		},
+		{
+			name:       "all skipped",
+			outcomes:   []fileOutcome{{path: "a.mov"}, {path: "b.mov"}},
+			wantStatus: "pass",
+			wantCode:   0,
+		},
+		{
+			name:       "no files",
+			wantStatus: "pass",
+			wantCode:   0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary := summarize(tt.outcomes)
+
+			if summary.Status != tt.wantStatus {
+				t.Errorf("Summary.Status = %q, want %q", summary.Status, tt.wantStatus)
+			}
+
+			if got := summary.ExitCode(); got != tt.wantCode {
+				t.Errorf("Summary.ExitCode() = %d, want %d", got, tt.wantCode)
+			}
+
+			if summary.Total != len(tt.outcomes) || summary.Passed+summary.Failed != summary.Total {
+				t.Errorf("Summary = %+v, want %d files counted once", summary, len(tt.outcomes))
+			}
+		})
+	}
+}
+
+func TestWriteStatusFile(t *testing.T) {
+	summary := summarize([]fileOutcome{
+		{path: "a.mov", changed: true},
+		{path: "b.mov"},
+		{path: "c.mov", err: errors.New("error executing ffmpeg")},
+	})
+
+	path := filepath.Join(t.TempDir(), "status.json")
+	if err := writeStatusFile(path, summary); err != nil {
+		t.Fatalf("writeStatusFile() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("error reading status file: %v", err)
+	}
+
+	var got Summary
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("error unmarshalling status file: %v", err)
+	}
+
+	want := Summary{
+		Status: "fail", Total: 3, Passed: 2, Created: 1, Failed: 1,
+		Failures: []Failure{{Path: "c.mov", Error: "error executing ffmpeg"}},
+		Files: []FileResult{
+			{Path: "a.mov", Status: report.StatusCreated, Output: "a.mov.proxy"},
+			{Path: "b.mov", Status: report.StatusSkipped, Output: "b.mov.proxy"},
+			{Path: "c.mov", Status: report.StatusFailed, Error: "error executing ffmpeg"},
+		},
+		Timings: []FileTimings{},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("status file = %+v, want %+v", got, want)
+	}
+}
+
+func TestWriteStatusFileEmpty(t *testing.T) {
+	summary := summarize(nil)
+
+	path := filepath.Join(t.TempDir(), "status.json")
+	if err := writeStatusFile(path, summary); err != nil {
+		t.Fatalf("writeStatusFile() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("error reading status file: %v", err)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("error unmarshalling status file: %v", err)
+	}
+
+	// CI consumers iterate the lists, which are written empty rather than null
+	for _, key := range []string{"failures", "files", "timings"} {
+		if list, ok := got[key].([]any); !ok || len(list) != 0 {
+			t.Errorf("status file %s = %v, want an empty list", key, got[key])
+		}
+	}
+
+	if got["status"] != "pass" {
+		t.Errorf("status file status = %v, want pass", got["status"])
+	}
+}
@@ -0,0 +1,340 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/disc"
+	"github.com/cyrilschreiber3/media-processor/pkg/manifest"
+)
+
+// fileSnapshot is the state of a file when it was handed over, used to tell whether it changed since.
+type fileSnapshot struct {
+	size    int64
+	modTime time.Time
+}
+
+// debounced is sent by the debounce timer of a path once it received no event for the watch interval.
+// seq tells a timer that was rearmed in the meantime apart from the current one.
+type debounced struct {
+	path string
+	seq  uint64
+}
+
+// pendingPath is the debounce timer of a path with events.
+type pendingPath struct {
+	timer *time.Timer
+	seq   uint64
+}
+
+// watcher follows the filesystem events of a watch path and processes the media it receives.
+// Every source is debounced on its own: it is handed over once it received no event for the watch interval,
+// so a file still being copied is never processed mid-write.
+type watcher struct {
+	watchPath  string
+	patterns   []string
+	pool       *pool
+	quarantine *manifest.Quarantine
+
+	events  *fsnotify.Watcher
+	ready   chan debounced
+	closed  chan struct{}
+	pending map[string]pendingPath
+	seq     uint64
+	// last is the state of the files already handed over, so events that leave a file unchanged are ignored
+	last map[string]fileSnapshot
+}
+
+// newWatcher creates a watcher processing the media of the watch path with a pool.
+// The watch path is watched, and its subdirectories too with Recursive.
+func newWatcher(watchPath string, patterns []string, jobPool *pool, quarantine *manifest.Quarantine) (*watcher, error) {
+	events, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("error creating filesystem watcher: %w", err)
+	}
+
+	w := &watcher{
+		watchPath:  watchPath,
+		patterns:   patterns,
+		pool:       jobPool,
+		quarantine: quarantine,
+		events:     events,
+		ready:      make(chan debounced),
+		closed:     make(chan struct{}),
+		pending:    make(map[string]pendingPath),
+		last:       make(map[string]fileSnapshot),
+	}
+
+	if err := w.watchTree(watchPath); err != nil {
+		_ = events.Close()
+
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// run processes the sources as they settle until the context is cancelled or the pool stops, and returns
+// the status of every processed file. The interrupted sources are processed first, without waiting for them to
+// settle, as a previous run was already processing them. The pool is stopped by Run when the context is cancelled,
+// which also aborts the running jobs; run returns once they are done.
+func (w *watcher) run(ctx context.Context, interrupted []string) Summary {
+	slog.Info("Watching for new media", "path", w.watchPath, "interval", w.pool.cfg.WatchInterval)
+
+	defer func() {
+		close(w.closed)
+
+		for _, pending := range w.pending {
+			pending.timer.Stop()
+		}
+
+		_ = w.events.Close()
+	}()
+
+	// Handed over now, their debounce on start finds them unchanged
+	w.handOver(ctx, w.jobs(interrupted))
+
+	for !w.pool.stopped.Load() && ctx.Err() == nil {
+		select {
+		case <-ctx.Done():
+		case event, ok := <-w.events.Events:
+			if ok {
+				w.handle(event)
+			}
+		case err, ok := <-w.events.Errors:
+			if ok {
+				slog.Error("Error watching watch path", "path", w.watchPath, "error", err)
+			}
+
+			// Events were lost while the pool was busy, the whole watch path is debounced again
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				if err := w.watchTree(w.watchPath); err != nil {
+					slog.Error("Error watching watch path", "path", w.watchPath, "error", err)
+				}
+			}
+		case settled := <-w.ready:
+			w.process(ctx, settled)
+		}
+	}
+
+	slog.Info("Stopped watching", "path", w.watchPath)
+
+	w.pool.mu.Lock()
+	defer w.pool.mu.Unlock()
+
+	return w.pool.status
+}
+
+// watchTree watches a directory and, with Recursive, its subdirectories down to the configured depth,
+// leaving out the proxy folders and the output root. Every file found is debounced, since it may have been
+// written before the directory was watched.
+func (w *watcher) watchTree(dir string) error {
+	cfg := w.pool.cfg
+
+	skipDirs := []string{cfg.VideoProxyDir, cfg.AudioProxyDir, cfg.OriginalsDir}
+
+	// An output root inside the watch path only holds proxies
+	outputRoot := ""
+	if cfg.OutputRoot != "" {
+		outputRoot, _ = filepath.Abs(cfg.OutputRoot)
+	}
+
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			// A directory removed while it is walked is forgotten by its remove event
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+
+			return err
+		}
+
+		if !entry.IsDir() {
+			w.arm(w.sourceOf(path))
+
+			return nil
+		}
+
+		if path != w.watchPath {
+			relPath, _ := filepath.Rel(w.watchPath, path)
+			if slices.Contains(skipDirs, entry.Name()) ||
+				(cfg.MaxDepth > 0 && len(strings.Split(relPath, string(filepath.Separator))) > cfg.MaxDepth) {
+				return filepath.SkipDir
+			}
+
+			if absPath, err := filepath.Abs(path); err == nil && absPath == outputRoot {
+				return filepath.SkipDir
+			}
+
+			// Directories are debounced too, as they may be discs
+			w.arm(w.sourceOf(path))
+
+			if !cfg.Recursive {
+				return filepath.SkipDir
+			}
+		}
+
+		if err := w.events.Add(path); err != nil {
+			return fmt.Errorf("error watching %s: %w", path, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error watching %s: %w", dir, err)
+	}
+
+	return nil
+}
+
+// handle debounces the source of a filesystem event. New directories are watched with Recursive,
+// and removed paths are forgotten.
+func (w *watcher) handle(event fsnotify.Event) {
+	if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+		w.forget(event.Name)
+
+		return
+	}
+
+	if event.Has(fsnotify.Create) && w.pool.cfg.Recursive {
+		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+			if err := w.watchTree(event.Name); err != nil {
+				slog.Error("Error watching new directory", "path", event.Name, "error", err)
+			}
+
+			return
+		}
+	}
+
+	w.arm(w.sourceOf(event.Name))
+}
+
+// sourceOf returns the source a path belongs to: the disc structure holding it, or the path itself.
+func (w *watcher) sourceOf(path string) string {
+	for dir := filepath.Dir(path); dir != w.watchPath && strings.HasPrefix(dir, w.watchPath); dir = filepath.Dir(dir) {
+		if disc.IsDiscRoot(dir) {
+			return dir
+		}
+	}
+
+	return path
+}
+
+// arm starts the debounce timer of a source, or restarts it when the source already has pending events.
+func (w *watcher) arm(path string) {
+	if pending, ok := w.pending[path]; ok {
+		pending.timer.Stop()
+	}
+
+	w.seq++
+	settled := debounced{path: path, seq: w.seq}
+
+	timer := time.AfterFunc(w.pool.cfg.WatchInterval, func() {
+		select {
+		case w.ready <- settled:
+		case <-w.closed:
+		}
+	})
+
+	w.pending[path] = pendingPath{timer: timer, seq: settled.seq}
+}
+
+// forget stops the debounce timers of a removed path and of the paths below it,
+// and drops their handed over state so a file copied again under the same name is processed.
+func (w *watcher) forget(path string) {
+	prefix := path + string(filepath.Separator)
+
+	for pendingPath, pending := range w.pending {
+		if pendingPath == path || strings.HasPrefix(pendingPath, prefix) {
+			pending.timer.Stop()
+			delete(w.pending, pendingPath)
+		}
+	}
+
+	for lastPath := range w.last {
+		if lastPath == path || strings.HasPrefix(lastPath, prefix) {
+			delete(w.last, lastPath)
+		}
+	}
+}
+
+// process hands over the sources that settled, along with the other ones settling at the same time
+// so they are processed concurrently.
+func (w *watcher) process(ctx context.Context, first debounced) {
+	var paths []string
+
+	for settled, more := first, true; more; {
+		if pending, ok := w.pending[settled.path]; ok && pending.seq == settled.seq {
+			delete(w.pending, settled.path)
+			paths = append(paths, settled.path)
+		}
+
+		select {
+		case settled = <-w.ready:
+		default:
+			more = false
+		}
+	}
+
+	w.handOver(ctx, w.jobs(paths))
+}
+
+// handOver processes jobs with the pool in the order of the priority patterns, and saves the quarantine.
+func (w *watcher) handOver(ctx context.Context, jobs []job) {
+	if len(jobs) == 0 {
+		return
+	}
+
+	w.pool.run(ctx, prioritize(jobs, w.patterns))
+
+	if w.quarantine != nil && !w.pool.cfg.DryRun {
+		if err := w.quarantine.Save(); err != nil {
+			slog.Error("Error saving quarantine", "error", err)
+		}
+	}
+}
+
+// jobs returns the jobs of the settled sources that changed since they were handed over.
+// Directories are only processed as discs.
+func (w *watcher) jobs(paths []string) []job {
+	var jobs []job
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			w.forget(path)
+
+			continue
+		}
+
+		snapshot := fileSnapshot{size: info.Size(), modTime: info.ModTime()}
+		if last, ok := w.last[path]; ok && last == snapshot {
+			continue
+		}
+
+		entry := fs.FileInfoToDirEntry(info)
+
+		switch {
+		case info.IsDir() && disc.IsDiscRoot(path):
+			jobs = append(jobs, job{path: path, entry: entry, disc: true})
+		case !info.IsDir() && isMediaSource(path, w.pool.cfg):
+			jobs = append(jobs, job{path: path, entry: entry})
+		default:
+			continue
+		}
+
+		w.last[path] = snapshot
+	}
+
+	return pairOPAtom(jobs)
+}
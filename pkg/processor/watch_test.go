@@ -0,0 +1,300 @@
+package processor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/config"
+	"github.com/cyrilschreiber3/media-processor/pkg/ffmpeg"
+)
+
+// watchInterval is the debounce interval of the watchers under test.
+const watchInterval = 100 * time.Millisecond
+
+// watchRun is a source handed over by a watcher under test, with the time it was handed over.
+type watchRun struct {
+	path string
+	at   time.Time
+}
+
+// startWatcher watches a directory with the jobs faked as succeeding, and returns the channel receiving the
+// sources handed over and a function stopping the watcher and returning its summary.
+func startWatcher(t *testing.T, watchPath string, cfg config.Config) (<-chan watchRun, func() Summary) {
+	t.Helper()
+
+	runs := make(chan watchRun, 16)
+
+	fakeJobs(t, func(_ context.Context, j job, _ config.Config) (bool, error) {
+		runs <- watchRun{path: j.path, at: time.Now()}
+
+		return true, nil
+	})
+
+	return runs, runWatcher(t, watchPath, cfg)
+}
+
+// runWatcher runs a watcher on a directory with the current jobs, and returns the function stopping it
+// and returning its summary.
+func runWatcher(t *testing.T, watchPath string, cfg config.Config) func() Summary {
+	t.Helper()
+
+	cfg.WatchInterval = watchInterval
+
+	p := &pool{cfg: cfg, gpus: ffmpeg.NewDeviceRoundRobin(nil)}
+
+	w, err := newWatcher(watchPath, nil, p, nil)
+	if err != nil {
+		t.Fatalf("newWatcher() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := context.AfterFunc(ctx, func() {
+		p.stopped.Store(true)
+	})
+
+	done := make(chan Summary, 1)
+
+	go func() {
+		done <- w.run(ctx, nil)
+	}()
+
+	var (
+		once    sync.Once
+		summary Summary
+	)
+
+	stopWatcher := func() Summary {
+		once.Do(func() {
+			cancel()
+			defer stop()
+
+			select {
+			case summary = <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("watcher.run() did not return after the context was cancelled")
+			}
+		})
+
+		return summary
+	}
+
+	t.Cleanup(func() {
+		stopWatcher()
+	})
+
+	return stopWatcher
+}
+
+// waitRuns waits for the given number of sources to be handed over.
+func waitRuns(t *testing.T, runs <-chan watchRun, count int) []watchRun {
+	t.Helper()
+
+	var received []watchRun
+
+	for range count {
+		select {
+		case run := <-runs:
+			received = append(received, run)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got %d sources handed over, want %d", len(received), count)
+		}
+	}
+
+	return received
+}
+
+// noMoreRuns fails the test if a source is handed over within a few watch intervals.
+func noMoreRuns(t *testing.T, runs <-chan watchRun) {
+	t.Helper()
+
+	select {
+	case run := <-runs:
+		t.Errorf("%s handed over again, want once", run.path)
+	case <-time.After(4 * watchInterval):
+	}
+}
+
+func TestWatcherDebounce(t *testing.T) {
+	dir := t.TempDir()
+	runs, stopWatcher := startWatcher(t, dir, config.Default())
+
+	path := filepath.Join(dir, "clip.mov")
+
+	var lastWrite time.Time
+
+	// A file being copied is written more often than the interval, and must not be processed mid-write
+	for i := range 5 {
+		if err := os.WriteFile(path, make([]byte, (i+1)*1024), 0o600); err != nil {
+			t.Fatalf("error writing %s: %v", path, err)
+		}
+
+		lastWrite = time.Now()
+
+		time.Sleep(watchInterval / 3)
+	}
+
+	run := waitRuns(t, runs, 1)[0]
+
+	if run.path != path {
+		t.Errorf("handed over %s, want %s", run.path, path)
+	}
+
+	if elapsed := run.at.Sub(lastWrite); elapsed < watchInterval {
+		t.Errorf("handed over %s after the last write, want at least %s", elapsed, watchInterval)
+	}
+
+	noMoreRuns(t, runs)
+
+	if summary := stopWatcher(); summary.Passed != 1 {
+		t.Errorf("watcher.run() passed = %d, want 1", summary.Passed)
+	}
+}
+
+func TestWatcherExistingFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "clip.mov")
+	createSource(t, path)
+	createSource(t, filepath.Join(dir, "notes.txt"))
+
+	runs, _ := startWatcher(t, dir, config.Default())
+
+	if run := waitRuns(t, runs, 1)[0]; run.path != path {
+		t.Errorf("handed over %s, want %s", run.path, path)
+	}
+
+	noMoreRuns(t, runs)
+}
+
+func TestWatcherRecursive(t *testing.T) {
+	tests := []struct {
+		name      string
+		recursive bool
+		want      []string
+	}{
+		{name: "top level only", recursive: false, want: []string{"root.mov"}},
+		{name: "recursive", recursive: true, want: []string{"day1/cam/clip.mov", "existing/clip.mov", "root.mov"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			createSource(t, filepath.Join(dir, "existing", "clip.mov"))
+			createSource(t, filepath.Join(dir, "Proxy", "root.mov"))
+
+			cfg := config.Default()
+			cfg.Recursive = tt.recursive
+
+			runs, _ := startWatcher(t, dir, cfg)
+
+			createSource(t, filepath.Join(dir, "root.mov"))
+			createSource(t, filepath.Join(dir, "day1", "cam", "clip.mov"))
+
+			var got []string
+
+			for _, run := range waitRuns(t, runs, len(tt.want)) {
+				relPath, _ := filepath.Rel(dir, run.path)
+				got = append(got, filepath.ToSlash(relPath))
+			}
+
+			slices.Sort(got)
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("handed over %v, want %v", got, tt.want)
+			}
+
+			noMoreRuns(t, runs)
+		})
+	}
+}
+
+func TestWatcherShutdown(t *testing.T) {
+	started := make(chan struct{})
+
+	fakeJobs(t, func(ctx context.Context, _ job, _ config.Config) (bool, error) {
+		close(started)
+		<-ctx.Done()
+
+		// The job is aborted by the cancellation, and returns after it
+		time.Sleep(watchInterval)
+
+		return true, nil
+	})
+
+	dir := t.TempDir()
+	createSource(t, filepath.Join(dir, "clip.mov"))
+
+	stopWatcher := runWatcher(t, dir, config.Default())
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("clip.mov was not handed over")
+	}
+
+	// Media landing after the shutdown is left for the next run
+	createSource(t, filepath.Join(dir, "late.mov"))
+
+	summary := stopWatcher()
+
+	if summary.Passed != 1 || summary.Total != 1 {
+		t.Errorf("watcher.run() passed = %d, total = %d, want the running job only", summary.Passed, summary.Total)
+	}
+}
+
+func TestWatcherForget(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "clip.mov")
+	createSource(t, path)
+
+	cfg := config.Default()
+	cfg.WatchInterval = time.Hour
+
+	w, err := newWatcher(dir, nil, &pool{cfg: cfg}, nil)
+	if err != nil {
+		t.Fatalf("newWatcher() error = %v", err)
+	}
+
+	t.Cleanup(func() {
+		for _, pending := range w.pending {
+			pending.timer.Stop()
+		}
+
+		_ = w.events.Close()
+	})
+
+	if jobs := w.jobs([]string{path}); len(jobs) != 1 {
+		t.Fatalf("watcher.jobs() = %d jobs, want 1", len(jobs))
+	}
+
+	if jobs := w.jobs([]string{path}); len(jobs) != 0 {
+		t.Errorf("watcher.jobs() = %d jobs for an unchanged file, want 0", len(jobs))
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("error removing %s: %v", path, err)
+	}
+
+	w.handle(fsnotify.Event{Name: path, Op: fsnotify.Remove})
+
+	if _, ok := w.last[path]; ok {
+		t.Errorf("watcher.last holds %s after it was removed", path)
+	}
+
+	if _, ok := w.pending[path]; ok {
+		t.Errorf("watcher.pending holds %s after it was removed", path)
+	}
+
+	// A source copied again under the same name is processed again
+	createSource(t, path)
+
+	if jobs := w.jobs([]string{path}); len(jobs) != 1 {
+		t.Errorf("watcher.jobs() = %d jobs for a copied again file, want 1", len(jobs))
+	}
+}
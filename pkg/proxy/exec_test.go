@@ -0,0 +1,28 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/internal/fakeexec"
+)
+
+// probeClip is the ffprobe output of a ten seconds clip with video and audio.
+const probeClip = `{"format": {"filename": "clip.mov", "duration": "10.0", "bit_rate": "50000000"}, "streams": [
+	{"index": 0, "codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080,
+	 "pix_fmt": "yuv420p", "r_frame_rate": "25/1", "avg_frame_rate": "25/1", "nb_frames": "250"},
+	{"index": 1, "codec_type": "audio", "codec_name": "aac", "channels": 2, "sample_rate": "48000"}]}`
+
+func TestMain(m *testing.M) {
+	fakeexec.Main(m)
+}
+
+// installCommands fakes FFmpeg and FFprobe on the PATH for the duration of the test, since the package
+// runs them through the media and ffmpeg packages.
+func installCommands(t *testing.T, outputs map[string]fakeexec.Output) *fakeexec.Fake {
+	t.Helper()
+
+	fake := &fakeexec.Fake{Outputs: outputs}
+	fake.Install(t)
+
+	return fake
+}
@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"strings"
+	"unicode"
+)
+
+// NormalizeFilename rewrites a proxy base name (without extension) to an NLE-safe set of characters.
+// ASCII letters and digits are always kept, as well as the characters in allowed; anything else
+// becomes an underscore. Leading dashes and dots are replaced so FFmpeg never reads the name as an option.
+func NormalizeFilename(name string, allowed string) string {
+	var builder strings.Builder
+
+	lastUnderscore := false
+
+	for _, r := range name {
+		safe := r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune(allowed, r))
+		if !safe {
+			r = '_'
+		}
+
+		// Collapse runs of replaced characters
+		if r == '_' && lastUnderscore {
+			continue
+		}
+
+		lastUnderscore = r == '_'
+
+		builder.WriteRune(r)
+	}
+
+	normalized := builder.String()
+
+	if trimmed := strings.TrimLeft(normalized, "-."); trimmed != normalized {
+		normalized = "_" + strings.TrimLeft(trimmed, "_")
+	}
+
+	if strings.Trim(normalized, "_") == "" {
+		return "proxy"
+	}
+
+	return normalized
+}
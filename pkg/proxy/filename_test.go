@@ -0,0 +1,34 @@
+package proxy
+
+import (
+	"testing"
+)
+
+func TestNormalizeFilename(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		allowed string
+		want    string
+	}{
+		{"safe", "A001_C002_0101XY", "-_.", "A001_C002_0101XY"},
+		{"hash and percent", "take #3 at 50%", "-_.", "take_3_at_50_"},
+		{"unicode", "Café été", "-_.", "Caf_t_"},
+		{"leading dash", "-clip", "-_.", "_clip"},
+		{"leading dashes and dots", "--.clip", "-_.", "_clip"},
+		{"hidden file", ".clip", "-_.", "_clip"},
+		{"dash kept inside", "day-1.take", "-_.", "day-1.take"},
+		{"custom allowed set", "day-1.take", "_", "day_1_take"},
+		{"collapsed runs", "a & b", "-_.", "a_b"},
+		{"only unsafe characters", "日本語", "-_.", "proxy"},
+		{"only dashes", "---", "-_.", "proxy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeFilename(tt.input, tt.allowed); got != tt.want {
+				t.Errorf("NormalizeFilename(%q, %q) = %q, want %q", tt.input, tt.allowed, got, tt.want)
+			}
+		})
+	}
+}
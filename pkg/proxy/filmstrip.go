@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/ffmpeg"
+	"github.com/cyrilschreiber3/media-processor/pkg/media"
+)
+
+// FilmstripCount returns how many filmstrip thumbnails can be extracted,
+// capping the requested count to the number of frames of short clips.
+func FilmstripCount(requested int, frames int64, framesKnown bool) int {
+	if framesKnown && frames > 0 && int64(requested) > frames {
+		return int(frames)
+	}
+
+	return requested
+}
+
+// GenerateFilmstrip extracts count evenly-spaced frames of a media file as individual JPEGs named
+// <proxyDir>/<name>_thumb_01.jpg, <proxyDir>/<name>_thumb_02.jpg, and so on, and returns their paths.
+func GenerateFilmstrip(filePath string, proxyDir string, count int) ([]string, error) {
+	if count <= 0 {
+		return nil, errors.New("filmstrip count must be positive")
+	}
+
+	mediaInfo, err := media.GetMediaInfo(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error getting media info: %w", err)
+	}
+
+	duration, err := mediaInfo.DurationSeconds()
+	if err != nil || duration <= 0 {
+		return nil, errors.New("media has no valid duration")
+	}
+
+	if !media.AnalyzeMediaInfo(mediaInfo).HasVideoStream {
+		return nil, errors.New("no video stream found")
+	}
+
+	frames, framesKnown := media.VideoFrameCount(mediaInfo)
+	count = FilmstripCount(count, frames, framesKnown)
+
+	fileName := filepath.Base(filePath)
+	prefix := filepath.Join(proxyDir, strings.TrimSuffix(fileName, filepath.Ext(fileName))+"_thumb_")
+
+	cmd := ffmpeg.CreateFilmstripCommand(filePath, prefix+"%02d.jpg", count, duration)
+	if err := runSidecarCommand(cmd); err != nil {
+		return nil, fmt.Errorf("error generating filmstrip: %w", err)
+	}
+
+	paths := make([]string, count)
+	for i := range paths {
+		paths[i] = fmt.Sprintf("%s%02d.jpg", prefix, i+1)
+	}
+
+	return paths, nil
+}
@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/internal/fakeexec"
+)
+
+// probeShortClip is the ffprobe output of a clip of three frames.
+const probeShortClip = `{"format": {"filename": "short.mov", "duration": "0.12"}, "streams": [
+	{"index": 0, "codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080,
+	 "pix_fmt": "yuv420p", "r_frame_rate": "25/1", "avg_frame_rate": "25/1", "nb_frames": "3"}]}`
+
+// probeAudioOnly is the ffprobe output of an audio recording.
+const probeAudioOnly = `{"format": {"filename": "voice.wav", "duration": "10.0"}, "streams": [
+	{"index": 0, "codec_type": "audio", "codec_name": "pcm_s16le", "channels": 1, "sample_rate": "48000"}]}`
+
+func TestFilmstripCount(t *testing.T) {
+	tests := []struct {
+		name        string
+		requested   int
+		frames      int64
+		framesKnown bool
+		want        int
+	}{
+		{"enough frames", 10, 250, true, 10},
+		{"short clip", 10, 3, true, 3},
+		{"unknown frame count", 10, 0, false, 10},
+		{"zero frames reported", 10, 0, true, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FilmstripCount(tt.requested, tt.frames, tt.framesKnown); got != tt.want {
+				t.Errorf("FilmstripCount() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateFilmstrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		probe     string
+		count     int
+		wantPaths []string
+	}{
+		{
+			name:      "evenly-spaced thumbnails",
+			probe:     probeClip,
+			count:     3,
+			wantPaths: []string{"clip_thumb_01.jpg", "clip_thumb_02.jpg", "clip_thumb_03.jpg"},
+		},
+		{
+			name:      "capped to the frames of a short clip",
+			probe:     probeShortClip,
+			count:     10,
+			wantPaths: []string{"clip_thumb_01.jpg", "clip_thumb_02.jpg", "clip_thumb_03.jpg"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := installCommands(t, map[string]fakeexec.Output{"ffprobe": {Stdout: tt.probe}, "ffmpeg": {}})
+			proxyDir := t.TempDir()
+
+			paths, err := GenerateFilmstrip("/footage/clip.mov", proxyDir, tt.count)
+			if err != nil {
+				t.Fatalf("GenerateFilmstrip() error = %v", err)
+			}
+
+			want := make([]string, len(tt.wantPaths))
+			for i, name := range tt.wantPaths {
+				want[i] = filepath.Join(proxyDir, name)
+			}
+
+			if !slices.Equal(paths, want) {
+				t.Errorf("GenerateFilmstrip() = %v, want %v", paths, want)
+			}
+
+			var extractions [][]string
+
+			for _, call := range fake.Calls() {
+				if call[0] == "ffmpeg" && slices.Contains(call, "-i") {
+					extractions = append(extractions, call)
+				}
+			}
+
+			if len(extractions) != 1 {
+				t.Fatalf("ffmpeg extractions = %v, want a single pass", extractions)
+			}
+
+			if output := extractions[0][len(extractions[0])-1]; !strings.HasSuffix(output, "clip_thumb_%02d.jpg") {
+				t.Errorf("ffmpeg output = %q, want the thumbnail pattern", output)
+			}
+		})
+	}
+}
+
+func TestGenerateFilmstripErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		outputs map[string]fakeexec.Output
+		count   int
+	}{
+		{"non-positive count", map[string]fakeexec.Output{"ffprobe": {Stdout: probeClip}}, 0},
+		{"audio only", map[string]fakeexec.Output{"ffprobe": {Stdout: probeAudioOnly}}, 3},
+		{"probe failure", map[string]fakeexec.Output{"ffprobe": {Stderr: "Invalid data", ExitCode: 1}}, 3},
+		{
+			"extraction failure",
+			map[string]fakeexec.Output{"ffprobe": {Stdout: probeClip}, "ffmpeg": {Stderr: "Conversion failed", ExitCode: 1}},
+			3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installCommands(t, tt.outputs)
+
+			if paths, err := GenerateFilmstrip("/footage/clip.mov", t.TempDir(), tt.count); err == nil {
+				t.Errorf("GenerateFilmstrip() = %v, want an error", paths)
+			}
+		})
+	}
+}
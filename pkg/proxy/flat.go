@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/fileutil"
+	"github.com/cyrilschreiber3/media-processor/pkg/manifest"
+)
+
+// nameHashLength is the number of hex characters of the hash appended to proxy names to resolve collisions.
+const nameHashLength = 8
+
+// FlatProxyName returns the collision-safe proxy base name (without extension) of a source in a flat output
+// directory. The plain name is used unless the manifest already maps it to another source, in which case a
+// short hash of the source directory is appended. Sources already recorded with a hash keep it.
+func FlatProxyName(flatManifest manifest.Manifest, fileName string, ext string, source string) string {
+	return collisionSafeName(flatManifest, fileName, ext, source, filepath.Dir(source))
+}
+
+// NormalizedProxyName returns the collision-safe proxy base name (without extension) of a source whose name
+// was normalized. Normalization maps different names to the same one, e.g. a#1 and a%1 to a_1, so a short hash
+// of the source path is appended when the manifest already maps the name to another source.
+func NormalizedProxyName(proxyManifest manifest.Manifest, fileName string, ext string, source string) string {
+	return collisionSafeName(proxyManifest, fileName, ext, source, source)
+}
+
+// collisionSafeName returns the plain name unless the manifest maps it to another source,
+// and otherwise the name followed by a short hash of hashed.
+func collisionSafeName(m manifest.Manifest, fileName string, ext string, source string, hashed string) string {
+	hash := sha256.Sum256([]byte(hashed))
+	hashedName := fileName + "_" + hex.EncodeToString(hash[:])[:nameHashLength]
+
+	if entry, ok := m.Entries[hashedName+ext]; ok && entry.Source == source {
+		return hashedName
+	}
+
+	if entry, ok := m.Entries[fileName+ext]; ok && entry.Source != source {
+		return hashedName
+	}
+
+	return fileName
+}
+
+var (
+	// reservedNamesMu serializes the choice of proxy names between concurrent jobs.
+	reservedNamesMu sync.Mutex
+	// reservedNames maps the proxy paths chosen during this run to their source,
+	// since the manifest is only updated once a proxy is complete.
+	reservedNames = make(map[string]string)
+)
+
+// reserveProxyNames chooses the collision-safe names of the proxies of a source in a directory with proxyName,
+// such as FlatProxyName, and reserves them for the run so concurrent jobs never write to the same proxy.
+func reserveProxyNames(
+	proxyDir string, names []string, ext string, source string,
+	proxyName func(m manifest.Manifest, fileName string, ext string, source string) string,
+) ([]string, error) {
+	reservedNamesMu.Lock()
+	defer reservedNamesMu.Unlock()
+
+	proxyManifest, err := manifest.Load(filepath.Join(proxyDir, manifest.FileName))
+	if err != nil {
+		return nil, fmt.Errorf("error loading proxy manifest: %w", err)
+	}
+
+	for path, reservedSource := range reservedNames {
+		name := filepath.Base(path)
+		if _, ok := proxyManifest.Entries[name]; filepath.Dir(path) == proxyDir && !ok {
+			proxyManifest.Entries[name] = manifest.Entry{Source: reservedSource, Proxy: path}
+		}
+	}
+
+	chosen := make([]string, len(names))
+
+	for i, name := range names {
+		chosen[i] = proxyName(proxyManifest, name, ext, source)
+		reservedNames[filepath.Join(proxyDir, chosen[i]+ext)] = source
+	}
+
+	return chosen, nil
+}
+
+// CreateFlatOutputDirectory creates the flat output directory if it doesn't exist,
+// with the given permission bits, or 0755 for a zero mode.
+func CreateFlatOutputDirectory(flatDir string, mode os.FileMode) error {
+	if err := fileutil.CreateDir(flatDir, mode, false); err != nil {
+		return fmt.Errorf("error creating flat output directory: %w", err)
+	}
+
+	return nil
+}
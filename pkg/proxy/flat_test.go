@@ -0,0 +1,150 @@
+package proxy
+
+import (
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/manifest"
+)
+
+// hashedNameExp matches a proxy name with a source directory hash appended.
+var hashedNameExp = regexp.MustCompile(`^clip_[0-9a-f]{8}$`)
+
+func TestFlatProxyName(t *testing.T) {
+	dayOne, dayTwo := "/footage/day1/clip.mov", "/footage/day2/clip.mov"
+	hashedDayOne := FlatProxyName(manifest.Manifest{Entries: map[string]manifest.Entry{
+		"clip.mov": {Source: dayTwo},
+	}}, "clip", ".mov", dayOne)
+
+	tests := []struct {
+		name    string
+		entries map[string]manifest.Entry
+		source  string
+		want    string
+	}{
+		{"first source", nil, dayOne, "clip"},
+		{"same source", map[string]manifest.Entry{"clip.mov": {Source: dayOne}}, dayOne, "clip"},
+		{"collision", map[string]manifest.Entry{"clip.mov": {Source: dayTwo}}, dayOne, hashedDayOne},
+		{
+			name: "recorded with a hash",
+			entries: map[string]manifest.Entry{
+				hashedDayOne + ".mov": {Source: dayOne},
+			},
+			source: dayOne,
+			want:   hashedDayOne,
+		},
+		{"other extension", map[string]manifest.Entry{"clip.mp4": {Source: dayTwo}}, dayOne, "clip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FlatProxyName(manifest.Manifest{Entries: tt.entries}, "clip", ".mov", tt.source)
+			if got != tt.want {
+				t.Errorf("FlatProxyName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if !hashedNameExp.MatchString(hashedDayOne) {
+		t.Errorf("FlatProxyName() = %q, want the name with a short hash", hashedDayOne)
+	}
+
+	// The hash only depends on the source directory
+	hashedDayTwo := FlatProxyName(manifest.Manifest{Entries: map[string]manifest.Entry{
+		"clip.mov": {Source: dayOne},
+	}}, "clip", ".mov", dayTwo)
+	if hashedDayTwo == hashedDayOne || !hashedNameExp.MatchString(hashedDayTwo) {
+		t.Errorf("FlatProxyName() = %q, want a hash different from %q", hashedDayTwo, hashedDayOne)
+	}
+}
+
+func TestReserveProxyNames(t *testing.T) {
+	flatDir := t.TempDir()
+	dayOne, dayTwo := "/footage/day1/clip.mov", "/footage/day2/clip.mov"
+	names := []string{"clip_preview", "clip"}
+
+	first, err := reserveProxyNames(flatDir, names, ".mov", dayOne, FlatProxyName)
+	if err != nil {
+		t.Fatalf("reserveProxyNames() error = %v", err)
+	}
+
+	second, err := reserveProxyNames(flatDir, names, ".mov", dayTwo, FlatProxyName)
+	if err != nil {
+		t.Fatalf("reserveProxyNames() error = %v", err)
+	}
+
+	if !slices.Equal(first, names) {
+		t.Errorf("reserveProxyNames() = %q, want the plain names for the first source", first)
+	}
+
+	if second[0] == first[0] || second[1] == first[1] {
+		t.Errorf("reserveProxyNames() = %q, want names apart from the first source", second)
+	}
+
+	// Reserving again for the same source keeps its names
+	again, err := reserveProxyNames(flatDir, names, ".mov", dayTwo, FlatProxyName)
+	if err != nil || !slices.Equal(again, second) {
+		t.Errorf("reserveProxyNames() = %q, %v, want %q", again, err, second)
+	}
+
+	// Completed proxies are found from the manifest in the next runs
+	entry := manifest.Entry{Source: dayTwo, Proxy: filepath.Join(flatDir, second[1]+".mov")}
+	if err := manifest.Record(entry); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	flatManifest, err := manifest.Load(filepath.Join(flatDir, manifest.FileName))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if got := FlatProxyName(flatManifest, "clip", ".mov", dayTwo); got != second[1] {
+		t.Errorf("FlatProxyName() = %q, want the recorded %q", got, second[1])
+	}
+}
+
+func TestReserveNormalizedNames(t *testing.T) {
+	proxyDir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		sources []string
+	}{
+		{"punctuation", []string{"/footage/a#1.mov", "/footage/a%1.mov"}},
+		{"non-ASCII", []string{"/footage/東京.mov", "/footage/大阪.mov"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			normalized := NormalizeFilename(strings.TrimSuffix(filepath.Base(tt.sources[0]), ".mov"), "")
+			if other := NormalizeFilename(strings.TrimSuffix(filepath.Base(tt.sources[1]), ".mov"), ""); other != normalized {
+				t.Fatalf("NormalizeFilename() = %q and %q, want a collision", normalized, other)
+			}
+
+			var got []string
+
+			for _, source := range tt.sources {
+				names, err := reserveProxyNames(proxyDir, []string{normalized}, ".mov", source, NormalizedProxyName)
+				if err != nil {
+					t.Fatalf("reserveProxyNames() error = %v", err)
+				}
+
+				got = append(got, names[0])
+			}
+
+			if got[0] != normalized || got[1] == normalized || !strings.HasPrefix(got[1], normalized+"_") {
+				t.Errorf("reserveProxyNames() = %q, want %q then the name with a short source hash", got, normalized)
+			}
+
+			// The sources share a directory, so the hash is of the whole source path
+			if hashed := FlatProxyName(manifest.Manifest{Entries: map[string]manifest.Entry{
+				normalized + ".mov": {Source: tt.sources[0]},
+			}}, normalized, ".mov", tt.sources[1]); hashed == got[1] {
+				t.Errorf("NormalizedProxyName() = %q, want a hash of the source path", got[1])
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/config"
+	"github.com/cyrilschreiber3/media-processor/pkg/ffmpeg"
+	"github.com/cyrilschreiber3/media-processor/pkg/fileutil"
+	"github.com/cyrilschreiber3/media-processor/pkg/manifest"
+	"github.com/cyrilschreiber3/media-processor/pkg/media"
+	"github.com/cyrilschreiber3/media-processor/pkg/report"
+	"github.com/cyrilschreiber3/media-processor/pkg/timing"
+)
+
+// rung is a proxy of a ladder, of the given long edge.
+type rung struct {
+	width int
+	path  string
+}
+
+// LadderName returns the name of the proxy of a ladder rung, e.g. name_540.
+func LadderName(fileName string, width int) string {
+	return fileName + "_" + strconv.Itoa(width)
+}
+
+// generateLadder creates one proxy per size of cfg.Ladder with a single FFmpeg command, decoding the source once.
+// Rungs are checked for an existing proxy one by one, so extending a ladder only encodes the new sizes.
+// Sources without video have no size to vary, so they get a single proxy.
+func generateLadder( //nolint:funlen
+	ctx context.Context, src source, cfg config.Config, progress func(pct float64),
+) (bool, error) {
+	original := src
+	parentDir := filepath.Dir(src.path)
+
+	fileName := src.name
+	if cfg.NormalizeFilenames {
+		fileName = NormalizeFilename(fileName, cfg.FilenameSafeChars)
+	}
+
+	start := time.Now()
+	mediaInfo, cleanup, err := probeSource(&src, cfg)
+	cfg.Timings.Since(timing.Probe, start)
+
+	if err != nil {
+		return false, err
+	}
+
+	defer cleanup()
+
+	mediaInfo, cleanupInput, err := prepareInput(&src, mediaInfo, cfg)
+	if err != nil {
+		return false, err
+	}
+
+	defer cleanupInput()
+
+	props, err := analyzeSource(src, mediaInfo, cfg)
+	if err != nil {
+		return false, err
+	}
+
+	if !props.HasVideoStream {
+		cfg.Ladder = nil
+
+		return generate(ctx, original, cfg, progress)
+	}
+
+	proxyDir := filepath.Join(parentDir, ProxyDirName(props, cfg))
+	if cfg.OutputRoot != "" {
+		proxyDir = mirroredDir(parentDir, src.path, cfg)
+	}
+
+	ext := ffmpeg.ProxyExtension(props, cfg)
+
+	rungNames := make([]string, len(cfg.Ladder))
+	for i, width := range cfg.Ladder {
+		rungNames[i] = LadderName(fileName, width)
+	}
+
+	if cfg.NormalizeFilenames {
+		rungNames, err = reserveProxyNames(proxyDir, rungNames, ext, src.path, NormalizedProxyName)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	var rungs []rung
+
+	for i, width := range cfg.Ladder {
+		rungPath := filepath.Join(proxyDir, rungNames[i]+ext)
+
+		if _, err := os.Stat(rungPath); err == nil && !cfg.Overwrite {
+			slog.Info("Proxy file already exists", "proxy", rungPath)
+
+			continue
+		}
+
+		rungs = append(rungs, rung{width: width, path: rungPath})
+	}
+
+	if len(rungs) == 0 {
+		cfg.Result.SetSkipReason(report.ReasonProxyExists)
+
+		return false, nil
+	}
+
+	// The result only has room for one proxy, the first rung written
+	cfg.Result.SetOutput(rungs[0].path)
+
+	if err := checkTrim(mediaInfo, cfg); err != nil {
+		return false, err
+	}
+
+	if err := ffmpeg.CheckContainer(props, cfg); err != nil {
+		return false, err
+	}
+
+	cmds := make([][]string, len(rungs))
+
+	for i, r := range rungs {
+		rungCfg := cfg
+		rungCfg.ProxyWidth = r.width
+
+		cmd, err := ffmpeg.CreateProxyCommand(src.input, r.path, props, rungCfg, src.extraInputs...)
+		if err != nil {
+			return false, fmt.Errorf("error creating ffmpeg command: %w", err)
+		}
+
+		cmds[i] = cmd
+	}
+
+	ffmpegCmd := ffmpeg.MultiOutputCommand(cmds, 1+len(src.extraInputs))
+
+	if cfg.DryRun {
+		slog.Info("Dry run, would write ladder", "proxies", len(rungs), "command", ffmpeg.FormatCommand(ffmpegCmd))
+		cfg.Result.SetSkipReason(report.ReasonDryRun)
+
+		return false, nil
+	}
+
+	if cfg.OutputRoot != "" {
+		err = CreateFlatOutputDirectory(proxyDir, cfg.DirMode)
+	} else {
+		_, err = CreateProxyDirectory(src.path, filepath.Base(proxyDir), cfg.DirMode)
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("error creating proxy directory: %w", err)
+	}
+
+	// Let a run following a crash remove the partial proxies instead of mistaking them for complete ones
+	if cfg.InFlight != nil {
+		for _, r := range rungs {
+			if err := cfg.InFlight.AddOutput(src.path, r.path); err != nil {
+				return false, fmt.Errorf("error recording in-flight output: %w", err)
+			}
+		}
+	}
+
+	slog.Debug("Executing ffmpeg command", "command", ffmpeg.FormatCommand(ffmpegCmd))
+
+	encodeStart := time.Now()
+	err = runEncodeWithRetries(ctx, ffmpegCmd, encodeDuration(mediaInfo, cfg), progress, cfg)
+	cfg.Timings.Since(timing.Encode, encodeStart)
+
+	// Rungs cut short by a failure or cancellation would be mistaken for complete ones by the next runs
+	if err != nil {
+		for _, r := range rungs {
+			_ = os.Remove(r.path)
+		}
+
+		return false, fmt.Errorf("error executing ffmpeg command: %w", err)
+	}
+
+	for _, r := range rungs {
+		if err := finishRung(src, r.path, props, mediaInfo, cfg); err != nil {
+			return true, err
+		}
+	}
+
+	if cfg.Thumbnails && !media.IsRemote(src.input) {
+		thumbnailPath, err := GenerateThumbnail(src.input, proxyDir, 0)
+		if err != nil {
+			return true, err
+		}
+
+		slog.Info("Created thumbnail", "path", thumbnailPath)
+	}
+
+	if cfg.Filmstrip > 0 && !media.IsRemote(src.input) {
+		if _, err := GenerateFilmstrip(src.input, proxyDir, cfg.Filmstrip); err != nil {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+// finishRung verifies a proxy of a ladder when configured, and writes its sidecars, ownership and manifest entry.
+func finishRung(
+	src source, proxyFilePath string, props media.Properties, mediaInfo media.MediaInfo, cfg config.Config,
+) error {
+	if cfg.Verify || cfg.VerifyFrameCount {
+		verifyStart := time.Now()
+
+		var err error
+
+		if cfg.Verify {
+			err = VerifyProxy(proxyFilePath, props, encodeDuration(mediaInfo, cfg), cfg)
+		}
+
+		if err == nil && cfg.VerifyFrameCount {
+			err = VerifyFrameCount(src.input, mediaInfo, proxyFilePath)
+		}
+
+		cfg.Timings.Since(timing.Verify, verifyStart)
+
+		// An invalid rung left in place would be skipped as existing by the next runs
+		if err != nil {
+			_ = os.Remove(proxyFilePath)
+
+			return fmt.Errorf("error verifying proxy: %w", err)
+		}
+
+		cfg.Result.SetVerified()
+	}
+
+	if len(cfg.Sidecars) > 0 {
+		if _, err := GenerateSidecars(proxyFilePath, mediaInfo, cfg.Sidecars); err != nil {
+			return err
+		}
+	}
+
+	if cfg.SubtitleSidecars && len(props.TextSubtitleStreams) > 0 {
+		if _, err := ExtractSubtitles(src.input, proxyFilePath, props); err != nil {
+			return err
+		}
+	}
+
+	if err := fileutil.ApplyOwnership(proxyFilePath, cfg.OutputMode, cfg.OutputGroup); err != nil {
+		return fmt.Errorf("error setting proxy ownership: %w", err)
+	}
+
+	if cfg.PreserveModTime && src.modPath != "" {
+		if err := preserveModTime(proxyFilePath, src.modPath, false); err != nil {
+			return err
+		}
+	}
+
+	if cfg.NormalizeFilenames || cfg.OutputRoot != "" {
+		if err := manifest.Record(manifest.Entry{Source: src.path, Proxy: proxyFilePath}); err != nil {
+			return fmt.Errorf("error recording proxy in manifest: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/config"
+	"github.com/cyrilschreiber3/media-processor/pkg/internal/fakeexec"
+	"github.com/cyrilschreiber3/media-processor/pkg/media"
+)
+
+func TestFinishRungVerifyError(t *testing.T) {
+	// The rung decodes as a proxy without any stream
+	installCommands(t, map[string]fakeexec.Output{
+		"ffprobe": {Stdout: `{"format": {"filename": "clip_540.mov", "duration": "10.0"}, "streams": []}`},
+	})
+
+	dir := t.TempDir()
+	rungPath := filepath.Join(dir, "clip_540.mov")
+
+	if err := os.WriteFile(rungPath, []byte("proxy"), 0o600); err != nil {
+		t.Fatalf("error creating %s: %v", rungPath, err)
+	}
+
+	cfg := config.Default()
+	cfg.Verify = true
+
+	src := source{path: filepath.Join(dir, "clip.mov"), input: filepath.Join(dir, "clip.mov")}
+	props := media.Properties{HasVideoStream: true, HasAudioStream: true}
+
+	err := finishRung(src, rungPath, props, parseProbe(t, probeClip), cfg)
+	if !errors.Is(err, ErrInvalidProxy) {
+		t.Fatalf("finishRung() error = %v, want %v", err, ErrInvalidProxy)
+	}
+
+	// An invalid rung left in place would be skipped as existing by the next runs
+	if _, err := os.Stat(rungPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("rung %s still exists after failing verification", rungPath)
+	}
+}
@@ -0,0 +1,45 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/media"
+)
+
+// MeasureCoverage returns the fraction of the expected duration covered by the proxy.
+func MeasureCoverage(expectedDuration float64, proxyFilePath string) (float64, error) {
+	if expectedDuration <= 0 {
+		return 0, errors.New("unknown source duration")
+	}
+
+	proxyInfo, err := media.GetMediaInfo(proxyFilePath)
+	if err != nil {
+		return 0, fmt.Errorf("error getting proxy media info: %w", err)
+	}
+
+	proxyDuration, err := proxyInfo.DurationSeconds()
+	if err != nil {
+		return 0, fmt.Errorf("error parsing proxy duration: %w", err)
+	}
+
+	return proxyDuration / expectedDuration, nil
+}
+
+// IsCoverageAcceptable reports whether a partial proxy covers enough of its source to be kept.
+func IsCoverageAcceptable(coverage float64, minCoverage float64) bool {
+	return minCoverage > 0 && coverage >= minCoverage
+}
+
+// acceptPartial decides whether a proxy left by a failed encode can be kept.
+func acceptPartial(expectedDuration float64, proxyFilePath string, minCoverage float64) (float64, bool) {
+	coverage, err := MeasureCoverage(expectedDuration, proxyFilePath)
+	if err != nil {
+		slog.Warn("Could not measure partial proxy coverage", "error", err)
+
+		return 0, false
+	}
+
+	return coverage, IsCoverageAcceptable(coverage, minCoverage)
+}
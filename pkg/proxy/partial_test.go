@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestIsCoverageAcceptable(t *testing.T) {
+	tests := []struct {
+		name        string
+		coverage    float64
+		minCoverage float64
+		want        bool
+	}{
+		{"above threshold", 0.99, 0.95, true},
+		{"at threshold", 0.95, 0.95, true},
+		{"below threshold", 0.94, 0.95, false},
+		{"complete", 1, 0.95, true},
+		{"nothing encoded", 0, 0.95, false},
+		{"partial proxies not accepted", 0.99, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsCoverageAcceptable(tt.coverage, tt.minCoverage); got != tt.want {
+				t.Errorf("IsCoverageAcceptable(%v, %v) = %v, want %v", tt.coverage, tt.minCoverage, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMeasureCoverageUnknownDuration(t *testing.T) {
+	if _, err := MeasureCoverage(0, filepath.Join(t.TempDir(), "clip_proxy.mov")); err == nil {
+		t.Error("MeasureCoverage() error = nil, want the unknown source duration")
+	}
+}
+
+func TestAcceptPartialUnknownDuration(t *testing.T) {
+	// A proxy whose coverage can't be measured is never kept
+	if coverage, ok := acceptPartial(0, filepath.Join(t.TempDir(), "clip_proxy.mov"), 0.95); ok || coverage != 0 {
+		t.Errorf("acceptPartial() = %v, %v, want 0, false", coverage, ok)
+	}
+}
@@ -1,87 +1,825 @@
 package proxy
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"log"
+	"io"
+	"io/fs"
+	"log/slog"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/cyrilschreiber3/media-processor/pkg/config"
+	"github.com/cyrilschreiber3/media-processor/pkg/disc"
 	"github.com/cyrilschreiber3/media-processor/pkg/ffmpeg"
+	"github.com/cyrilschreiber3/media-processor/pkg/fileutil"
+	"github.com/cyrilschreiber3/media-processor/pkg/manifest"
 	"github.com/cyrilschreiber3/media-processor/pkg/media"
+	"github.com/cyrilschreiber3/media-processor/pkg/mxf"
+	"github.com/cyrilschreiber3/media-processor/pkg/report"
+	"github.com/cyrilschreiber3/media-processor/pkg/timing"
 )
 
-// CreateProxyDirectory creates a proxy directory within the parent directory.
-func CreateProxyDirectory(filePath string) (string, error) {
-	parentDir, err := os.Stat(filepath.Dir(filePath))
-	if err != nil {
-		return "", fmt.Errorf("error getting parent directory: %w", err)
-	}
+// PreviewSuffix is appended to the name of preview proxies so they are never mistaken for full proxies.
+const PreviewSuffix = "_preview"
+
+// dirMu serializes the creation of proxy directories shared by concurrent jobs.
+var dirMu sync.Mutex
 
-	proxyDir := filepath.Join(filepath.Dir(filePath), "Proxy")
+// CreateProxyDirectory creates the named proxy directory within the parent directory of filePath,
+// with the given permission bits, or those of the parent directory for a zero mode.
+// It is safe for concurrent use.
+func CreateProxyDirectory(filePath string, dirName string, mode os.FileMode) (string, error) {
+	dirMu.Lock()
+	defer dirMu.Unlock()
+
+	proxyDir := filepath.Join(filepath.Dir(filePath), dirName)
 
 	if _, err := os.Stat(proxyDir); err == nil {
 		return proxyDir, nil
 	}
 
-	if err := os.MkdirAll(proxyDir, parentDir.Mode()); err != nil {
+	if err := fileutil.CreateDir(proxyDir, mode, true); err != nil {
 		return "", fmt.Errorf("error creating proxy directory: %w", err)
 	}
 
 	return proxyDir, nil
 }
 
+// ProxyDirName returns the folder receiving the proxy of a source with the given properties.
+func ProxyDirName(props media.Properties, cfg config.Config) string {
+	if !props.HasVideoStream {
+		return cfg.AudioProxyDir
+	}
+
+	return cfg.VideoProxyDir
+}
+
+// IsProxyStale reports whether the source was modified after the proxy was created.
+// Differences within the tolerance are ignored to absorb clock skew on network filesystems.
+func IsProxyStale(sourceModTime, proxyModTime time.Time, tolerance time.Duration) bool {
+	return sourceModTime.Sub(proxyModTime) > tolerance
+}
+
+// Errors returned when a source can't be read, e.g. because it was moved since it was listed.
+var (
+	ErrSourceMissing    = errors.New("source file is missing")
+	ErrSourceUnreadable = errors.New("source file is unreadable")
+)
+
+// source describes the media a proxy is generated from.
+type source struct {
+	// path is the source file, or the root directory of a disc structure.
+	path string
+	// input is the FFmpeg input, which differs from path for multi-part sources.
+	input string
+	// modPath is the file whose modification time is compared with the proxy, empty for remote sources.
+	modPath string
+	// name is the proxy base name without extension.
+	name string
+	// extraInputs are additional FFmpeg inputs whose audio is muxed into the proxy.
+	extraInputs []string
+}
+
 // GenerateProxy creates a proxy file from the original media.
-func GenerateProxy(filePath string, fileInfo os.DirEntry) (bool, error) {
+func GenerateProxy(ctx context.Context, filePath string, fileInfo os.DirEntry, cfg config.Config) (bool, error) {
+	return GenerateProxyWithProgress(ctx, filePath, fileInfo, cfg, nil)
+}
+
+// GenerateProxyWithProgress creates a proxy file from the original media, reporting the percentage encoded
+// to progress as the encode runs. Only the end is reported for sources of unknown duration.
+func GenerateProxyWithProgress(
+	ctx context.Context, filePath string, fileInfo os.DirEntry, cfg config.Config, progress func(pct float64),
+) (bool, error) {
+	return generate(ctx, source{
+		path:    filePath,
+		input:   filePath,
+		modPath: filePath,
+		name:    strings.TrimSuffix(fileInfo.Name(), filepath.Ext(fileInfo.Name())),
+	}, cfg, progress)
+}
+
+// GenerateRemoteProxy creates a proxy file from an HTTP(S) source into the flat output directory.
+func GenerateRemoteProxy(ctx context.Context, url string, cfg config.Config) (bool, error) {
+	if cfg.FlatOutput == "" && cfg.OutputRoot == "" {
+		return false, errors.New("remote sources require a flat output directory or an output root")
+	}
+
+	name := path.Base(strings.SplitN(url, "?", 2)[0])
+
+	return generate(ctx, source{
+		path:  url,
+		input: url,
+		name:  strings.TrimSuffix(name, path.Ext(name)),
+	}, cfg, nil)
+}
+
+// GenerateDiscProxy creates a single proxy from the main title of a ripped DVD or Blu-ray structure.
+// The proxy is named after the disc root directory.
+func GenerateDiscProxy(ctx context.Context, title disc.Title, cfg config.Config) (bool, error) {
+	if len(title.Parts) == 0 {
+		return false, errors.New("disc title has no parts")
+	}
+
+	return generate(ctx, source{
+		path:    title.Root,
+		input:   title.Input(),
+		modPath: title.Parts[0],
+		name:    filepath.Base(title.Root),
+	}, cfg, nil)
+}
+
+// GenerateOPAtomProxy creates a single proxy from the video and audio essences of an OP-Atom clip.
+// The proxy is written next to the first essence and named after the clip.
+func GenerateOPAtomProxy(ctx context.Context, clip mxf.Clip, cfg config.Config) (bool, error) {
+	inputs := clip.Inputs()
+	if len(inputs) == 0 {
+		return false, errors.New("clip has no essence")
+	}
+
+	return generate(ctx, source{
+		path:        inputs[0],
+		input:       inputs[0],
+		modPath:     inputs[0],
+		name:        clip.Name,
+		extraInputs: inputs[1:],
+	}, cfg, nil)
+}
+
+func generate( //nolint:gocognit,gocyclo,cyclop,funlen
+	ctx context.Context, src source, cfg config.Config, progress func(pct float64),
+) (bool, error) {
+	if err := checkSource(src); err != nil {
+		return false, err
+	}
+
+	if len(cfg.Ladder) > 0 {
+		return generateLadder(ctx, src, cfg, progress)
+	}
+
+	filePath := src.path
+	jobPath := src.path
 	parentDir := filepath.Dir(filePath)
-	fileName := strings.TrimSuffix(fileInfo.Name(), filepath.Ext(fileInfo.Name()))
-	proxyFilePath := filepath.Join(parentDir, "Proxy", fileName+".mov")
+	fileName := src.name
+
+	if cfg.NormalizeFilenames {
+		fileName = NormalizeFilename(fileName, cfg.FilenameSafeChars)
+	}
+
+	var (
+		mediaInfo media.MediaInfo
+		probed    bool
+	)
+
+	proxyDir := filepath.Join(parentDir, cfg.VideoProxyDir)
+	previewName := fileName + PreviewSuffix
+	ext := cfg.ProxyExtension()
+
+	// The folder and extension depend on the streams, so probe before looking for an existing proxy
+	if (cfg.FlatOutput == "" && cfg.VideoProxyDir != cfg.AudioProxyDir) || cfg.AudioOnlyProxies {
+		start := time.Now()
+		info, cleanup, err := probeSource(&src, cfg)
+		cfg.Timings.Since(timing.Probe, start)
+
+		if err != nil {
+			return false, err
+		}
+
+		defer cleanup()
+
+		mediaInfo = info
+
+		probed = true
+
+		start = time.Now()
+		props := media.AnalyzeMediaInfoWith(mediaInfo, cfg.SupportedAudioCodecs)
+		proxyDir = filepath.Join(parentDir, ProxyDirName(props, cfg))
+		ext = ffmpeg.ProxyExtension(props, cfg)
+		cfg.Timings.Since(timing.Analyze, start)
+	}
+
+	if cfg.OutputRoot != "" {
+		proxyDir = mirroredDir(parentDir, src.path, cfg)
+	}
+
+	if cfg.FlatOutput != "" {
+		proxyDir = cfg.FlatOutput
+
+		source := filePath
+		if !media.IsRemote(source) {
+			var err error
+
+			source, err = filepath.Abs(filePath)
+			if err != nil {
+				return false, fmt.Errorf("error resolving source path: %w", err)
+			}
+		}
+
+		filePath = source
+		src.path = source
+	}
+
+	if cfg.FlatOutput != "" || cfg.NormalizeFilenames {
+		proxyName := FlatProxyName
+		if cfg.NormalizeFilenames {
+			proxyName = NormalizedProxyName
+		}
+
+		names, err := reserveProxyNames(proxyDir, []string{previewName, fileName}, ext, filePath, proxyName)
+		if err != nil {
+			return false, err
+		}
+
+		previewName, fileName = names[0], names[1]
+	}
+
+	proxyFilePath := filepath.Join(proxyDir, fileName+ext)
+	previewFilePath := filepath.Join(proxyDir, previewName+ext)
+
+	if cfg.PreviewSeconds > 0 {
+		// A full proxy supersedes any preview
+		if _, err := os.Stat(proxyFilePath); err == nil {
+			slog.Info("Full proxy already exists, skipping preview", "proxy", proxyFilePath)
+			cfg.Result.SetOutput(proxyFilePath)
+			cfg.Result.SetSkipReason(report.ReasonProxyExists)
+
+			return false, nil
+		}
+
+		proxyFilePath = previewFilePath
+	}
+
+	// A segmented proxy exists once its index is written
+	if cfg.SegmentDuration > 0 {
+		proxyFilePath = SegmentIndexPath(proxyDir, fileName)
+	}
+
+	cfg.Result.SetOutput(proxyFilePath)
+
+	if cfg.SidecarsOnly {
+		return generateMissingSidecars(src, proxyFilePath, cfg)
+	}
 
 	// Check if proxy already exists
-	if _, err := os.Stat(proxyFilePath); err == nil {
-		log.Printf("Proxy file already exists: %s\n", proxyFilePath)
+	if proxyStat, err := os.Stat(proxyFilePath); err == nil && cfg.Overwrite {
+		slog.Info("Overwriting existing proxy", "proxy", proxyFilePath)
+	} else if err == nil {
+		if !cfg.RefreshStale || src.modPath == "" {
+			slog.Info("Proxy file already exists", "proxy", proxyFilePath)
+			cfg.Result.SetSkipReason(report.ReasonProxyExists)
 
-		return false, nil
+			return false, nil
+		}
+
+		sourceStat, err := os.Stat(src.modPath)
+		if err != nil {
+			return false, fmt.Errorf("error getting source file info: %w", err)
+		}
+
+		if !IsProxyStale(sourceStat.ModTime(), proxyStat.ModTime(), cfg.StaleTolerance) {
+			slog.Info("Proxy file is up to date", "proxy", proxyFilePath)
+			cfg.Result.SetSkipReason(report.ReasonProxyUpToDate)
+
+			return false, nil
+		}
+
+		slog.Info("Source is newer than proxy, regenerating", "proxy", proxyFilePath)
 	}
 
 	// Get media information
-	mediaInfo, err := media.GetMediaInfo(filePath)
+	var err error
+
+	if !probed {
+		start := time.Now()
+		info, cleanup, err := probeSource(&src, cfg)
+		cfg.Timings.Since(timing.Probe, start)
+
+		if err != nil {
+			return false, err
+		}
+
+		defer cleanup()
+
+		mediaInfo = info
+	}
+
+	var cleanupInput func()
+
+	mediaInfo, cleanupInput, err = prepareInput(&src, mediaInfo, cfg)
 	if err != nil {
-		return false, fmt.Errorf("error getting media info: %w", err)
+		return false, err
 	}
 
-	if len(mediaInfo.Streams) == 0 {
-		return false, errors.New("no streams found in media file")
+	defer cleanupInput()
+
+	props, err := analyzeSource(src, mediaInfo, cfg)
+	if err != nil {
+		return false, err
 	}
 
-	// Analyze media properties
-	props := media.AnalyzeMediaInfo(mediaInfo)
-	if !props.HasVideoStream && !props.HasAudioStream {
-		return false, errors.New("no video or audio stream found")
+	if cfg.SkipProxySized && IsProxySized(props, mediaInfo, cfg) {
+		slog.Info("Skipping source, already proxy-sized", "path", jobPath)
+		cfg.Result.SetSkipReason(report.ReasonProxySized)
+
+		return false, nil
+	}
+
+	if err := checkTrim(mediaInfo, cfg); err != nil {
+		return false, err
+	}
+
+	if err := ffmpeg.CheckContainer(props, cfg); err != nil {
+		return false, err
+	}
+
+	// Create ffmpeg command
+	ffmpegCmd, err := ffmpeg.CreateProxyCommand(src.input, proxyFilePath, props, cfg, src.extraInputs...)
+	if err != nil {
+		return false, fmt.Errorf("error creating ffmpeg command: %w", err)
+	}
+
+	var firstPass []string
+
+	if cfg.TwoPass && props.HasVideoStream && !ffmpeg.UseTwoPass(props, cfg) {
+		slog.Info("Two-pass encoding is not available for this proxy, encoding in a single pass",
+			"proxy", proxyFilePath)
+	}
+
+	if ffmpeg.UseTwoPass(props, cfg) {
+		passLogDir := os.TempDir()
+
+		if !cfg.DryRun {
+			passLogDir, err = os.MkdirTemp("", "media-processor-pass")
+			if err != nil {
+				return false, fmt.Errorf("error creating pass log directory: %w", err)
+			}
+
+			defer os.RemoveAll(passLogDir)
+		}
+
+		firstPass, ffmpegCmd = ffmpeg.TwoPassCommands(ffmpegCmd, filepath.Join(passLogDir, "passlog"))
+	}
+
+	if cfg.DryRun {
+		if firstPass != nil {
+			slog.Info("Dry run, would analyze", "path", src.input, "command", ffmpeg.FormatCommand(firstPass))
+		}
+
+		slog.Info("Dry run, would write", "proxy", proxyFilePath, "command", ffmpeg.FormatCommand(ffmpegCmd))
+		cfg.Result.SetSkipReason(report.ReasonDryRun)
+
+		return false, nil
 	}
 
 	// Create proxy directory
-	_, err = CreateProxyDirectory(filePath)
+	if cfg.FlatOutput != "" || cfg.OutputRoot != "" {
+		err = CreateFlatOutputDirectory(proxyDir, cfg.DirMode)
+	} else {
+		_, err = CreateProxyDirectory(filePath, filepath.Base(proxyDir), cfg.DirMode)
+	}
+
+	if err == nil && cfg.SegmentDuration > 0 {
+		err = createSegmentDirectory(proxyFilePath, cfg.DirMode)
+	}
+
 	if err != nil {
 		return false, fmt.Errorf("error creating proxy directory: %w", err)
 	}
 
-	// Create and run ffmpeg command
-	ffmpegCmd := ffmpeg.CreateProxyCommand(filePath, proxyFilePath, props)
-	if len(ffmpegCmd) == 0 {
-		return false, errors.New("could not generate ffmpeg command")
+	// Let a run following a crash remove the partial proxy instead of mistaking it for a complete one
+	if cfg.InFlight != nil {
+		if err := cfg.InFlight.AddOutput(jobPath, proxyFilePath); err != nil {
+			return false, fmt.Errorf("error recording in-flight output: %w", err)
+		}
+	}
+
+	encodeStart := time.Now()
+
+	if firstPass != nil {
+		slog.Debug("Executing first pass", "command", ffmpeg.FormatCommand(firstPass))
+
+		if err := runEncodeWithRetries(ctx, firstPass, encodeDuration(mediaInfo, cfg), nil, cfg); err != nil {
+			cfg.Timings.Since(timing.Encode, encodeStart)
+
+			return false, fmt.Errorf("error executing ffmpeg first pass: %w", err)
+		}
 	}
 
-	log.Printf("Executing ffmpeg command: %s\n", strings.Join(ffmpegCmd, " "))
-	cmdExec := exec.Command(ffmpegCmd[0], ffmpegCmd[1:]...) //nolint:gosec
-	cmdExec.Stdout = os.Stdout
-	cmdExec.Stderr = os.Stderr
+	slog.Debug("Executing ffmpeg command", "command", ffmpeg.FormatCommand(ffmpegCmd))
+
+	partial := false
+
+	err = runEncodeWithRetries(ctx, ffmpegCmd, encodeDuration(mediaInfo, cfg), progress, cfg)
+	cfg.Timings.Since(timing.Encode, encodeStart)
+
+	// A proxy cut short by a failure or cancellation would be mistaken for a complete one by the next runs,
+	// unless it is kept on purpose with AcceptPartial
+	if err != nil && (ctx.Err() != nil || !cfg.AcceptPartial) {
+		removeProxy(proxyFilePath, cfg.SegmentDuration > 0)
 
-	if err := cmdExec.Run(); err != nil {
 		return false, fmt.Errorf("error executing ffmpeg command: %w", err)
 	}
 
+	if err != nil {
+		coverage, ok := acceptPartial(encodeDuration(mediaInfo, cfg), proxyFilePath, cfg.PartialMinCoverage)
+		if !ok {
+			removeProxy(proxyFilePath, cfg.SegmentDuration > 0)
+
+			return false, fmt.Errorf("error executing ffmpeg command (partial output covers %.1f%%): %w",
+				coverage*100, err)
+		}
+
+		slog.Warn("ffmpeg failed but the partial proxy covers most of the source, keeping it",
+			"coverage", fmt.Sprintf("%.1f%%", coverage*100), "proxy", proxyFilePath, "error", err)
+
+		partial = true
+	}
+
+	if cfg.VerifyFrameCount && props.HasVideoStream {
+		if partial || cfg.PreviewSeconds > 0 {
+			slog.Info("Skipping frame count verification of trimmed proxy", "proxy", proxyFilePath)
+		} else {
+			verifyStart := time.Now()
+			err := VerifyFrameCount(src.input, mediaInfo, proxyFilePath)
+			cfg.Timings.Since(timing.Verify, verifyStart)
+
+			// A proxy missing frames left in place would be skipped as existing by the next runs
+			if err != nil {
+				removeProxy(proxyFilePath, cfg.SegmentDuration > 0)
+
+				return false, fmt.Errorf("error verifying proxy: %w", err)
+			}
+
+			cfg.Result.SetVerified()
+		}
+	}
+
+	// Partial proxies are known to be short, and were measured when accepted
+	if cfg.Verify && !partial {
+		verifyStart := time.Now()
+		err := VerifyProxy(proxyFilePath, props, encodeDuration(mediaInfo, cfg), cfg)
+		cfg.Timings.Since(timing.Verify, verifyStart)
+
+		// An invalid proxy left in place would be skipped as existing by the next runs
+		if err != nil {
+			removeProxy(proxyFilePath, cfg.SegmentDuration > 0)
+
+			return false, fmt.Errorf("error verifying proxy: %w", err)
+		}
+
+		cfg.Result.SetVerified()
+	}
+
+	if len(cfg.Sidecars) > 0 {
+		if _, err := GenerateSidecars(proxyFilePath, mediaInfo, cfg.Sidecars); err != nil {
+			return true, err
+		}
+	}
+
+	if cfg.SubtitleSidecars && len(props.TextSubtitleStreams) > 0 && cfg.SegmentDuration <= 0 {
+		if _, err := ExtractSubtitles(src.input, proxyFilePath, props); err != nil {
+			return true, err
+		}
+	}
+
+	if cfg.Thumbnails && props.HasVideoStream && cfg.FlatOutput == "" && !media.IsRemote(src.input) {
+		thumbnailPath, err := GenerateThumbnail(src.input, proxyDir, 0)
+		if err != nil {
+			return true, err
+		}
+
+		slog.Info("Created thumbnail", "path", thumbnailPath)
+	}
+
+	if cfg.Filmstrip > 0 && props.HasVideoStream && cfg.FlatOutput == "" && !media.IsRemote(src.input) {
+		if _, err := GenerateFilmstrip(src.input, proxyDir, cfg.Filmstrip); err != nil {
+			return true, err
+		}
+	}
+
+	if cfg.SegmentDuration > 0 {
+		if err := finishSegments(proxyFilePath, cfg.OutputMode, cfg.OutputGroup); err != nil {
+			return true, err
+		}
+	} else if err := fileutil.ApplyOwnership(proxyFilePath, cfg.OutputMode, cfg.OutputGroup); err != nil {
+		return true, fmt.Errorf("error setting proxy ownership: %w", err)
+	}
+
+	// Keep the capture order of the sources when sorting proxies by date
+	if cfg.PreserveModTime && src.modPath != "" {
+		if err := preserveModTime(proxyFilePath, src.modPath, cfg.SegmentDuration > 0); err != nil {
+			return true, err
+		}
+	}
+
+	// Replace the preview now that the full proxy exists
+	if cfg.PreviewSeconds <= 0 {
+		if err := os.Remove(previewFilePath); err == nil {
+			slog.Info("Removed superseded preview", "path", previewFilePath)
+		}
+	}
+
+	// Record the original name so renamed proxies can still be relinked, and flag partial proxies
+	if cfg.NormalizeFilenames || cfg.FlatOutput != "" || cfg.OutputRoot != "" || partial {
+		entry := manifest.Entry{Source: filePath, Proxy: proxyFilePath, Partial: partial}
+		if err := manifest.Record(entry); err != nil {
+			return true, fmt.Errorf("error recording proxy in manifest: %w", err)
+		}
+	}
+
 	return true, nil
 }
+
+// prepareInput remuxes fragmented MP4 sources into a temporary file, removed by the returned cleanup function,
+// and adds the streams of the extra inputs to the media info of the source.
+func prepareInput(src *source, mediaInfo media.MediaInfo, cfg config.Config) (media.MediaInfo, func(), error) {
+	cleanup := func() {}
+
+	if media.IsFragmentedMP4(mediaInfo) && !media.IsRemote(src.input) && cfg.DryRun {
+		slog.Info("Dry run, would remux fragmented MP4 before proxying", "path", src.input)
+	} else if media.IsFragmentedMP4(mediaInfo) && !media.IsRemote(src.input) {
+		remuxPath, remuxInfo, err := remuxFragmented(src.input)
+		if err != nil {
+			return mediaInfo, cleanup, err
+		}
+
+		cleanup = func() { _ = os.Remove(remuxPath) }
+		src.input, mediaInfo = remuxPath, remuxInfo
+	}
+
+	// Analyze the streams of every input together
+	for _, input := range src.extraInputs {
+		start := time.Now()
+		extraInfo, err := media.GetMediaInfo(input)
+		cfg.Timings.Since(timing.Probe, start)
+
+		if err != nil {
+			return mediaInfo, cleanup, fmt.Errorf("error getting media info of %s: %w", input, err)
+		}
+
+		mediaInfo.Streams = append(mediaInfo.Streams, extraInfo.Streams...)
+	}
+
+	if len(mediaInfo.Streams) == 0 {
+		return mediaInfo, cleanup, errors.New("no streams found in media file")
+	}
+
+	return mediaInfo, cleanup, nil
+}
+
+// analyzeSource returns the media properties of a source, with its crop rectangle when AutoCrop is set.
+func analyzeSource(src source, mediaInfo media.MediaInfo, cfg config.Config) (media.Properties, error) {
+	start := time.Now()
+	defer cfg.Timings.Since(timing.Analyze, start)
+
+	props := media.AnalyzeMediaInfoWith(mediaInfo, cfg.SupportedAudioCodecs)
+	if !props.HasVideoStream && !props.HasAudioStream {
+		return props, errors.New("no video or audio stream found")
+	}
+
+	if cfg.AutoCrop && props.HasVideoStream {
+		var err error
+
+		props.Crop, err = media.DetectCrop(src.input, mediaInfo, media.HeaderArgs(src.input, cfg.HTTPHeaders)...)
+		if err != nil {
+			return props, fmt.Errorf("error detecting crop: %w", err)
+		}
+	}
+
+	return props, nil
+}
+
+// checkSource checks that the local files of a source exist and can be opened, so a source that
+// disappeared or can't be read isn't mistaken for a corrupt one by FFprobe.
+func checkSource(src source) error {
+	paths := append([]string{src.modPath}, src.extraInputs...)
+
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+
+		file, err := os.Open(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("%w: %s", ErrSourceMissing, path)
+		}
+
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrSourceUnreadable, err)
+		}
+
+		_ = file.Close()
+	}
+
+	return nil
+}
+
+// mirroredDir returns the directory of the output root receiving the proxies of the sources of parentDir,
+// at the same place relative to the output root as parentDir relative to the watch path.
+// Remote sources and sources outside the watch path go to the output root itself.
+func mirroredDir(parentDir string, sourcePath string, cfg config.Config) string {
+	if media.IsRemote(sourcePath) || cfg.SourceRoot == "" {
+		return cfg.OutputRoot
+	}
+
+	root, err := filepath.Abs(cfg.SourceRoot)
+	if err != nil {
+		return cfg.OutputRoot
+	}
+
+	dir, err := filepath.Abs(parentDir)
+	if err != nil {
+		return cfg.OutputRoot
+	}
+
+	relPath, err := filepath.Rel(root, dir)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return cfg.OutputRoot
+	}
+
+	return filepath.Join(cfg.OutputRoot, relPath)
+}
+
+// preserveModTime copies the modification time of the source to the proxy, and to its parts when segmented.
+func preserveModTime(proxyFilePath string, sourcePath string, segmented bool) error {
+	paths := []string{proxyFilePath}
+
+	if segmented {
+		parts, err := filepath.Glob(filepath.Join(filepath.Dir(proxyFilePath), ffmpeg.SegmentGlob))
+		if err != nil {
+			return fmt.Errorf("error listing segments: %w", err)
+		}
+
+		paths = append(paths, parts...)
+	}
+
+	for _, path := range paths {
+		if err := fileutil.CopyModTime(path, sourcePath); err != nil {
+			return fmt.Errorf("error preserving proxy modification time: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// encodeDuration returns the duration in seconds of the encoded part of the source, or 0 when unknown.
+func encodeDuration(info media.MediaInfo, cfg config.Config) float64 {
+	duration, err := info.DurationSeconds()
+	if err != nil || duration <= 0 {
+		duration = 0
+	}
+
+	if duration > 0 {
+		duration = max(duration-cfg.TrimStart, 0)
+	}
+
+	if length := cfg.TrimLength(); length > 0 && (duration == 0 || length < duration) {
+		duration = length
+	}
+
+	if cfg.PreviewSeconds > 0 && (duration == 0 || cfg.PreviewSeconds < duration) {
+		duration = cfg.PreviewSeconds
+	}
+
+	return duration
+}
+
+// checkTrim checks that the range proxies are trimmed to starts within the source, when its duration is known.
+func checkTrim(info media.MediaInfo, cfg config.Config) error {
+	if cfg.TrimStart <= 0 {
+		return nil
+	}
+
+	if duration, err := info.DurationSeconds(); err == nil && duration > 0 && cfg.TrimStart >= duration {
+		return fmt.Errorf("invalid trim range: start %v is past the end of the source at %v", cfg.TrimStart, duration)
+	}
+
+	return nil
+}
+
+// runEncodeWithRetries runs an FFmpeg encode, running it again up to cfg.Retries times with an exponential backoff
+// while it fails for transient reasons such as a busy GPU. Cancelling the context also ends the backoff.
+func runEncodeWithRetries(
+	ctx context.Context, ffmpegCmd []string, duration float64, progress func(pct float64), cfg config.Config,
+) error {
+	for attempt := 0; ; attempt++ {
+		err := runEncode(ctx, ffmpegCmd, duration, progress, cfg.Timeout)
+		if err == nil || attempt >= cfg.Retries || !ffmpeg.IsTransient(err) {
+			return err
+		}
+
+		delay := cfg.RetryDelay << attempt
+		slog.Warn("Transient ffmpeg failure, retrying", "delay", delay, "retry", attempt+1, "retries", cfg.Retries,
+			"error", err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", ctx.Err(), err)
+		case <-time.After(delay):
+		}
+	}
+}
+
+// runEncode runs an FFmpeg encode, reporting its progress when a callback is given.
+// The output is still shown, and its end is kept in the returned ffmpeg.CommandError.
+// Cancelling the context, or running longer than a non-zero timeout, kills the encode along with its child processes.
+// A timed out encode fails with ffmpeg.ErrTimeout, a cancelled one with the error of the context.
+func runEncode(
+	ctx context.Context, ffmpegCmd []string, duration float64, progress func(pct float64), timeout time.Duration,
+) error {
+	var tail ffmpeg.OutputTail
+
+	args := ffmpegCmd[1:]
+	if progress != nil {
+		args = append(slices.Clone(ffmpeg.ProgressArgs), args...)
+	}
+
+	encodeCtx := ctx
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+
+		encodeCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	cmdExec := ffmpeg.CommandContext(encodeCtx, ffmpegCmd[0], args...)
+	cmdExec.Stderr = io.MultiWriter(os.Stderr, &tail)
+
+	err := ffmpeg.NewCommandError(execEncode(cmdExec, duration, progress), tail.String())
+
+	switch {
+	case err == nil:
+		return nil
+	case ctx.Err() != nil:
+		return fmt.Errorf("%w: %w", ctx.Err(), err)
+	case errors.Is(encodeCtx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("%w after %s: %w", ffmpeg.ErrTimeout, timeout, err)
+	default:
+		return err
+	}
+}
+
+// execEncode runs an FFmpeg encode command, parsing the progress written on its standard output
+// when a callback is given.
+func execEncode(cmdExec *exec.Cmd, duration float64, progress func(pct float64)) error {
+	if progress == nil {
+		cmdExec.Stdout = os.Stdout
+
+		return cmdExec.Run() //nolint:wrapcheck
+	}
+
+	stdout, err := cmdExec.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("error reading ffmpeg progress: %w", err)
+	}
+
+	if err := cmdExec.Start(); err != nil {
+		return fmt.Errorf("error starting ffmpeg: %w", err)
+	}
+
+	if err := ffmpeg.ParseProgress(stdout, duration, progress); err != nil {
+		slog.Warn("Error reading ffmpeg progress", "error", err)
+	}
+
+	return cmdExec.Wait() //nolint:wrapcheck
+}
+
+// generateMissingSidecars creates the missing sidecars of an existing proxy without touching the proxy itself.
+func generateMissingSidecars(src source, proxyFilePath string, cfg config.Config) (bool, error) {
+	if _, err := os.Stat(proxyFilePath); err != nil {
+		slog.Info("No existing proxy, skipping sidecars", "proxy", proxyFilePath)
+
+		return false, nil
+	}
+
+	kinds := cfg.Sidecars
+	if len(kinds) == 0 {
+		kinds = config.Sidecars
+	}
+
+	if cfg.DryRun {
+		slog.Info("Dry run, would generate missing sidecars", "kinds", kinds, "proxy", proxyFilePath)
+
+		return false, nil
+	}
+
+	mediaInfo, err := media.GetMediaInfo(src.input, media.HeaderArgs(src.input, cfg.HTTPHeaders)...)
+	if err != nil {
+		return false, fmt.Errorf("error getting media info: %w", err)
+	}
+
+	created, err := GenerateSidecars(proxyFilePath, mediaInfo, kinds)
+	if err != nil {
+		return created > 0, err
+	}
+
+	return created > 0, nil
+}
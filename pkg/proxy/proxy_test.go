@@ -0,0 +1,296 @@
+package proxy
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/config"
+	"github.com/cyrilschreiber3/media-processor/pkg/internal/fakeexec"
+	"github.com/cyrilschreiber3/media-processor/pkg/media"
+	"github.com/cyrilschreiber3/media-processor/pkg/report"
+	"github.com/cyrilschreiber3/media-processor/pkg/timing"
+)
+
+// touch creates a file modified at the given time and returns its modification time.
+func touch(t *testing.T, path string, modTime time.Time) time.Time {
+	t.Helper()
+
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatalf("error creating %s: %v", path, err)
+	}
+
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("error setting the times of %s: %v", path, err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("error getting info of %s: %v", path, err)
+	}
+
+	return info.ModTime()
+}
+
+func TestIsProxyStale(t *testing.T) {
+	proxyTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		sourceTime time.Time
+		want       bool
+	}{
+		{"newer source", proxyTime.Add(time.Hour), true},
+		{"older source", proxyTime.Add(-time.Hour), false},
+		{"same time", proxyTime, false},
+		{"newer within tolerance", proxyTime.Add(time.Second), false},
+		{"newer just past tolerance", proxyTime.Add(3 * time.Second), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			sourceModTime := touch(t, filepath.Join(dir, "clip.mov"), tt.sourceTime)
+			proxyModTime := touch(t, filepath.Join(dir, "clip_proxy.mov"), proxyTime)
+
+			if got := IsProxyStale(sourceModTime, proxyModTime, 2*time.Second); got != tt.want {
+				t.Errorf("IsProxyStale(%v, %v) = %v, want %v", sourceModTime, proxyModTime, got, tt.want)
+			}
+		})
+	}
+}
+
+// writeFile creates a file with the given content, along with its parent directories, and returns its entry.
+func writeFile(t *testing.T, path string, content string) fs.DirEntry {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("error creating the directory of %s: %v", path, err)
+	}
+
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("error creating %s: %v", path, err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("error getting info of %s: %v", path, err)
+	}
+
+	return fs.FileInfoToDirEntry(info)
+}
+
+func TestGenerateProxyPreviewSkip(t *testing.T) {
+	tests := []struct {
+		name       string
+		existing   string
+		preview    float64
+		wantOutput string
+		wantReason string
+	}{
+		{"full proxy supersedes preview", "clip.mov", 30, "clip.mov", report.ReasonProxyExists},
+		{"existing preview", "clip_preview.mov", 30, "clip_preview.mov", report.ReasonProxyExists},
+		{"existing full proxy", "clip.mov", 0, "clip.mov", report.ReasonProxyExists},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			source := filepath.Join(dir, "clip.mov")
+			entry := writeFile(t, source, "source")
+			writeFile(t, filepath.Join(dir, "Proxy", tt.existing), "proxy")
+
+			cfg := config.Default()
+			cfg.PreviewSeconds = tt.preview
+			cfg.Result = report.NewProcessResult(source)
+
+			changed, err := GenerateProxy(context.Background(), source, entry, cfg)
+			if changed || err != nil {
+				t.Fatalf("GenerateProxy() = %v, %v, want a skipped file", changed, err)
+			}
+
+			if want := filepath.Join(dir, "Proxy", tt.wantOutput); cfg.Result.Output != want {
+				t.Errorf("GenerateProxy() output = %q, want %q", cfg.Result.Output, want)
+			}
+
+			if cfg.Result.Reason != tt.wantReason {
+				t.Errorf("GenerateProxy() reason = %q, want %q", cfg.Result.Reason, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestProxyDirName(t *testing.T) {
+	cfg := config.Default()
+	cfg.VideoProxyDir = "VideoProxy"
+	cfg.AudioProxyDir = "AudioProxy"
+
+	tests := []struct {
+		name  string
+		props media.Properties
+		want  string
+	}{
+		{"video and audio", media.Properties{HasVideoStream: true, HasAudioStream: true}, "VideoProxy"},
+		{"video only", media.Properties{HasVideoStream: true}, "VideoProxy"},
+		{"audio only", media.Properties{HasAudioStream: true}, "AudioProxy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ProxyDirName(tt.props, cfg); got != tt.want {
+				t.Errorf("ProxyDirName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateProxyStreamTypeFolders(t *testing.T) {
+	tests := []struct {
+		name       string
+		probe      string
+		existing   string
+		wantOutput string
+		wantReason string
+	}{
+		{"video proxy exists", probeClip, "VideoProxy", "VideoProxy", report.ReasonProxyExists},
+		{"audio proxy exists", probeAudioOnly, "AudioProxy", "AudioProxy", report.ReasonProxyExists},
+		{"video proxy in the audio folder", probeClip, "AudioProxy", "VideoProxy", report.ReasonDryRun},
+		{"audio proxy in the video folder", probeAudioOnly, "VideoProxy", "AudioProxy", report.ReasonDryRun},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installCommands(t, map[string]fakeexec.Output{"ffprobe": {Stdout: tt.probe}, "ffmpeg": {}})
+
+			dir := t.TempDir()
+			source := filepath.Join(dir, "clip.mov")
+			entry := writeFile(t, source, "source")
+			writeFile(t, filepath.Join(dir, tt.existing, "clip.mov"), "proxy")
+
+			// A dry run reports the proxy that would be written when none exists in the folder of the source type
+			cfg := config.Default()
+			cfg.VideoProxyDir = "VideoProxy"
+			cfg.AudioProxyDir = "AudioProxy"
+			cfg.DryRun = true
+			cfg.Result = report.NewProcessResult(source)
+
+			changed, err := GenerateProxy(context.Background(), source, entry, cfg)
+			if changed || err != nil {
+				t.Fatalf("GenerateProxy() = %v, %v, want a skipped file", changed, err)
+			}
+
+			if want := filepath.Join(dir, tt.wantOutput, "clip.mov"); cfg.Result.Output != want {
+				t.Errorf("GenerateProxy() output = %q, want %q", cfg.Result.Output, want)
+			}
+
+			if cfg.Result.Reason != tt.wantReason {
+				t.Errorf("GenerateProxy() reason = %q, want %q", cfg.Result.Reason, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestGenerateProxyTimings(t *testing.T) {
+	installCommands(t, map[string]fakeexec.Output{"ffprobe": {Stdout: probeClip}, "ffmpeg": {}})
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "clip.mov")
+	entry := writeFile(t, source, "source")
+
+	cfg := config.Default()
+	cfg.DryRun = true
+	cfg.Timings = timing.NewBreakdown()
+
+	if _, err := GenerateProxy(context.Background(), source, entry, cfg); err != nil {
+		t.Fatalf("GenerateProxy() error = %v", err)
+	}
+
+	// A dry run probes and analyzes the source, but never encodes nor verifies
+	for stage, wantRecorded := range map[timing.Stage]bool{
+		timing.Probe: true, timing.Analyze: true, timing.Encode: false, timing.Verify: false,
+	} {
+		if got := cfg.Timings.Get(stage); (got > 0) != wantRecorded || got < 0 {
+			t.Errorf("Timings.Get(%s) = %v, want recorded: %v", stage, got, wantRecorded)
+		}
+	}
+}
+
+func TestGenerateProxyNormalizedCollision(t *testing.T) {
+	installCommands(t, map[string]fakeexec.Output{"ffprobe": {Stdout: probeClip}, "ffmpeg": {}})
+
+	dir := t.TempDir()
+
+	cfg := config.Default()
+	cfg.NormalizeFilenames = true
+	cfg.DryRun = true
+
+	// Both names normalize to a_1, the second source must not be taken for the proxy of the first
+	var outputs []string
+
+	for _, name := range []string{"a#1.mov", "a%1.mov"} {
+		source := filepath.Join(dir, name)
+		entry := writeFile(t, source, "source")
+		cfg.Result = report.NewProcessResult(source)
+
+		if _, err := GenerateProxy(context.Background(), source, entry, cfg); err != nil {
+			t.Fatalf("GenerateProxy(%s) error = %v", name, err)
+		}
+
+		if cfg.Result.Reason != report.ReasonDryRun {
+			t.Errorf("GenerateProxy(%s) reason = %q, want %q", name, cfg.Result.Reason, report.ReasonDryRun)
+		}
+
+		outputs = append(outputs, cfg.Result.Output)
+	}
+
+	if want := filepath.Join(dir, cfg.VideoProxyDir, "a_1.mov"); outputs[0] != want || outputs[1] == want {
+		t.Errorf("GenerateProxy() outputs = %q, want %q then another proxy", outputs, want)
+	}
+}
+
+func TestGenerateProxyFailureRemovesOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		ladder  []int
+		outputs []string
+	}{
+		{"single proxy", nil, []string{"clip.mov"}},
+		{"ladder", []int{640, 1280}, []string{"clip_640.mov", "clip_1280.mov"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installCommands(t, map[string]fakeexec.Output{
+				"ffprobe": {Stdout: probeClip},
+				"ffmpeg":  {Stderr: "Conversion failed!", ExitCode: 1},
+			})
+
+			dir := t.TempDir()
+			source := filepath.Join(dir, "clip.mov")
+			entry := writeFile(t, source, "source")
+
+			// The truncated output ffmpeg leaves behind when it fails
+			cfg := config.Default()
+			for _, output := range tt.outputs {
+				writeFile(t, filepath.Join(dir, cfg.VideoProxyDir, output), "truncated")
+			}
+
+			cfg.Overwrite = true
+			cfg.Ladder = tt.ladder
+
+			if changed, err := GenerateProxy(context.Background(), source, entry, cfg); changed || err == nil {
+				t.Fatalf("GenerateProxy() = %v, %v, want an error", changed, err)
+			}
+
+			for _, output := range tt.outputs {
+				if _, err := os.Stat(filepath.Join(dir, cfg.VideoProxyDir, output)); !os.IsNotExist(err) {
+					t.Errorf("%s left behind after ffmpeg failed, stat error = %v", output, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/config"
+	"github.com/cyrilschreiber3/media-processor/pkg/ffmpeg"
+	"github.com/cyrilschreiber3/media-processor/pkg/media"
+)
+
+// repairFormats are the formats tried, in order, when FFprobe can't detect the container of a source.
+var repairFormats = []string{"mpegts", "h264", "hevc", "mpegvideo", "aac", "mp3", "ac3"}
+
+// remux copies the streams of a file read as inputFormat into a temporary file with the given extension,
+// and probes the result. The caller must remove the returned file.
+func remux(filePath string, inputFormat string, ext string) (string, media.MediaInfo, error) {
+	tmpFile, err := os.CreateTemp("", "media-processor-remux-*"+ext)
+	if err != nil {
+		return "", media.MediaInfo{}, fmt.Errorf("error creating remux file: %w", err)
+	}
+
+	tmpPath := tmpFile.Name()
+	_ = tmpFile.Close()
+
+	if err := runSidecarCommand(ffmpeg.CreateRemuxCommand(filePath, inputFormat, tmpPath)); err != nil {
+		_ = os.Remove(tmpPath)
+
+		return "", media.MediaInfo{}, fmt.Errorf("error remuxing as %s: %w", inputFormat, err)
+	}
+
+	info, err := media.GetMediaInfo(tmpPath)
+	if err != nil {
+		_ = os.Remove(tmpPath)
+
+		return "", media.MediaInfo{}, fmt.Errorf("error getting remuxed media info: %w", err)
+	}
+
+	return tmpPath, info, nil
+}
+
+// remuxFragmented rebuilds the index of a fragmented MP4 into a temporary file and probes it again.
+// The caller must remove the returned file.
+func remuxFragmented(filePath string) (string, media.MediaInfo, error) {
+	slog.Info("Fragmented MP4 detected, remuxing to rebuild the index", "path", filePath)
+
+	return remux(filePath, "mp4", ".mp4")
+}
+
+// InferInputFormat returns the first of the candidate formats the file can be probed as with streams.
+func InferInputFormat(filePath string, candidates []string) (string, bool) {
+	for _, format := range candidates {
+		info, err := media.GetMediaInfo(filePath, "-f", format)
+		if err == nil && len(info.Streams) > 0 {
+			return format, true
+		}
+	}
+
+	return "", false
+}
+
+// repairContainer remuxes a source whose container is wrong or misdetected into a temporary Matroska file,
+// read as the forced format or, without one, as the inferred format. The caller must remove the returned file.
+func repairContainer(filePath string, forcedFormat string) (string, media.MediaInfo, error) {
+	format := forcedFormat
+	if format == "" {
+		var ok bool
+
+		format, ok = InferInputFormat(filePath, repairFormats)
+		if !ok {
+			return "", media.MediaInfo{}, errors.New("could not infer the input format")
+		}
+	}
+
+	slog.Info("Remuxing to repair the container", "path", filePath, "format", format)
+
+	return remux(filePath, format, ".mkv")
+}
+
+// probeSource probes the input of a source. A forced input format, or an unreadable container,
+// makes the source be remuxed first, in which case src.input is set to the remuxed file removed by cleanup.
+func probeSource(src *source, cfg config.Config) (media.MediaInfo, func(), error) {
+	cleanup := func() {}
+
+	if cfg.DryRun && cfg.ForceInputFormat != "" {
+		slog.Info("Dry run, would remux before proxying", "path", src.input, "format", cfg.ForceInputFormat)
+
+		info, err := media.GetMediaInfo(src.input, "-f", cfg.ForceInputFormat)
+		if err != nil {
+			return info, cleanup, fmt.Errorf("error reading source as %s: %w", cfg.ForceInputFormat, err)
+		}
+
+		return info, cleanup, nil
+	}
+
+	if cfg.ForceInputFormat != "" && !media.IsRemote(src.input) {
+		repairedPath, info, err := repairContainer(src.input, cfg.ForceInputFormat)
+		if err != nil {
+			return info, cleanup, fmt.Errorf("error reading source as %s: %w", cfg.ForceInputFormat, err)
+		}
+
+		src.input = repairedPath
+
+		return info, func() { _ = os.Remove(repairedPath) }, nil
+	}
+
+	info, err := media.GetMediaInfo(src.input, media.HeaderArgs(src.input, cfg.HTTPHeaders)...)
+	if err == nil {
+		return info, cleanup, nil
+	}
+
+	canRepair := errors.Is(err, media.ErrInvalidData) && !media.IsRemote(src.input) && len(src.extraInputs) == 0
+	if !canRepair || cfg.DryRun {
+		return info, cleanup, fmt.Errorf("error getting media info: %w", err)
+	}
+
+	repairedPath, repairedInfo, repairErr := repairContainer(src.input, "")
+	if repairErr != nil {
+		return info, cleanup, fmt.Errorf("error getting media info: %w (repair failed: %w)", err, repairErr)
+	}
+
+	src.input = repairedPath
+
+	return repairedInfo, func() { _ = os.Remove(repairedPath) }, nil
+}
@@ -0,0 +1,253 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/config"
+	"github.com/cyrilschreiber3/media-processor/pkg/internal/fakeexec"
+	"github.com/cyrilschreiber3/media-processor/pkg/media"
+)
+
+// probeFragmented is the ffprobe output of a fragmented MP4 capture, before its index is rebuilt.
+const probeFragmented = `{"format": {"filename": "capture.mp4", "format_name": "mov,mp4,m4a,3gp,3g2,mj2",
+	"duration": "2.002", "tags": {"major_brand": "iso6", "compatible_brands": "iso6dashmp41"}}, "streams": [
+	{"index": 0, "codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080,
+	 "pix_fmt": "yuv420p", "r_frame_rate": "25/1", "avg_frame_rate": "25/1"}]}`
+
+// parseProbe unmarshals an FFprobe output.
+func parseProbe(t *testing.T, output string) media.MediaInfo {
+	t.Helper()
+
+	var info media.MediaInfo
+	if err := json.Unmarshal([]byte(output), &info); err != nil {
+		t.Fatalf("error unmarshalling probe output: %v", err)
+	}
+
+	return info
+}
+
+func TestPrepareInputFragmented(t *testing.T) {
+	// The remuxed file is probed again, and reports the full duration
+	fake := installCommands(t, map[string]fakeexec.Output{"ffprobe": {Stdout: probeClip}, "ffmpeg": {}})
+
+	src := source{path: "/footage/capture.mp4", input: "/footage/capture.mp4"}
+
+	info, cleanup, err := prepareInput(&src, parseProbe(t, probeFragmented), config.Default())
+	if err != nil {
+		t.Fatalf("prepareInput() error = %v", err)
+	}
+
+	remuxPath := src.input
+	if remuxPath == "/footage/capture.mp4" || filepath.Ext(remuxPath) != ".mp4" {
+		t.Errorf("prepareInput() input = %q, want a remuxed MP4", remuxPath)
+	}
+
+	if duration, err := info.DurationSeconds(); err != nil || duration != 10 {
+		t.Errorf("prepareInput() duration = %v, %v, want the duration of the remuxed file", duration, err)
+	}
+
+	var remuxes [][]string
+
+	for _, call := range fake.Calls() {
+		if call[0] == "ffmpeg" && slices.Contains(call, "-i") {
+			remuxes = append(remuxes, call)
+		}
+	}
+
+	want := []string{"-f", "mp4", "-i", "/footage/capture.mp4", "-map", "0", "-c", "copy", "-movflags", "+faststart"}
+	if len(remuxes) != 1 || !slices.Equal(remuxes[0][5:len(remuxes[0])-1], want) {
+		t.Errorf("ffmpeg remuxes = %v, want a single stream copy rebuilding the index", remuxes)
+	}
+
+	cleanup()
+
+	if _, err := os.Stat(remuxPath); !os.IsNotExist(err) {
+		t.Errorf("remuxed file error = %v after cleanup, want it removed", err)
+	}
+}
+
+func TestPrepareInputFragmentedSkipped(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		cfg   func(*config.Config)
+	}{
+		{"dry run", "/footage/capture.mp4", func(cfg *config.Config) { cfg.DryRun = true }},
+		{"remote source", "https://example.com/capture.mp4", func(*config.Config) {}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := installCommands(t, map[string]fakeexec.Output{"ffprobe": {Stdout: probeClip}, "ffmpeg": {}})
+
+			cfg := config.Default()
+			tt.cfg(&cfg)
+
+			src := source{path: tt.input, input: tt.input}
+
+			if _, _, err := prepareInput(&src, parseProbe(t, probeFragmented), cfg); err != nil {
+				t.Fatalf("prepareInput() error = %v", err)
+			}
+
+			if src.input != tt.input || len(fake.Calls()) != 0 {
+				t.Errorf("prepareInput() input = %q with calls %v, want the source left as is", src.input, fake.Calls())
+			}
+		})
+	}
+}
+
+func TestPrepareInputFragmentedRemuxError(t *testing.T) {
+	installCommands(t, map[string]fakeexec.Output{"ffmpeg": {Stderr: "moov atom not found", ExitCode: 1}})
+
+	src := source{path: "/footage/capture.mp4", input: "/footage/capture.mp4"}
+
+	if _, _, err := prepareInput(&src, parseProbe(t, probeFragmented), config.Default()); err == nil {
+		t.Error("prepareInput() error = nil, want the remux error")
+	}
+
+	if src.input != "/footage/capture.mp4" {
+		t.Errorf("prepareInput() input = %q, want the source left as is", src.input)
+	}
+}
+
+// probeInvalidData is the ffprobe output of a source whose container can't be parsed, such as a raw stream.
+const probeInvalidData = `{"error": {"code": -1094995529, "string": "Invalid data found when processing input"}}`
+
+// containsArgs reports whether a command contains the arguments in sequence.
+func containsArgs(cmd []string, args ...string) bool {
+	for i := range len(cmd) - len(args) + 1 {
+		if slices.Equal(cmd[i:i+len(args)], args) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// remuxCalls returns the FFmpeg remux commands among the calls of a fake.
+func remuxCalls(fake *fakeexec.Fake) [][]string {
+	var remuxes [][]string
+
+	for _, call := range fake.Calls() {
+		if call[0] == "ffmpeg" && slices.Contains(call, "copy") {
+			remuxes = append(remuxes, call)
+		}
+	}
+
+	return remuxes
+}
+
+func TestProbeSourceForcedFormat(t *testing.T) {
+	fake := installCommands(t, map[string]fakeexec.Output{"ffprobe": {Stdout: probeClip}, "ffmpeg": {}})
+
+	cfg := config.Default()
+	cfg.ForceInputFormat = "h264"
+
+	src := source{path: "/footage/raw.mp4", input: "/footage/raw.mp4"}
+
+	_, cleanup, err := probeSource(&src, cfg)
+	if err != nil {
+		t.Fatalf("probeSource() error = %v", err)
+	}
+
+	repairedPath := src.input
+	if filepath.Ext(repairedPath) != ".mkv" {
+		t.Errorf("probeSource() input = %q, want a repaired Matroska file", repairedPath)
+	}
+
+	remuxes := remuxCalls(fake)
+	if len(remuxes) != 1 || !containsArgs(remuxes[0], "-f", "h264", "-i", "/footage/raw.mp4") {
+		t.Errorf("ffmpeg remuxes = %v, want the source read as h264", remuxes)
+	}
+
+	cleanup()
+
+	if _, err := os.Stat(repairedPath); !os.IsNotExist(err) {
+		t.Errorf("repaired file error = %v after cleanup, want it removed", err)
+	}
+}
+
+func TestProbeSourceForcedFormatDryRun(t *testing.T) {
+	fake := installCommands(t, map[string]fakeexec.Output{"ffprobe": {Stdout: probeClip}, "ffmpeg": {}})
+
+	cfg := config.Default()
+	cfg.ForceInputFormat = "h264"
+	cfg.DryRun = true
+
+	src := source{path: "/footage/raw.mp4", input: "/footage/raw.mp4"}
+
+	if _, _, err := probeSource(&src, cfg); err != nil {
+		t.Fatalf("probeSource() error = %v", err)
+	}
+
+	calls := fake.Calls()
+	if src.input != "/footage/raw.mp4" || len(calls) != 1 || !containsArgs(calls[0], "-f", "h264", "/footage/raw.mp4") {
+		t.Errorf("probeSource() input = %q with calls %v, want a single probe as h264", src.input, calls)
+	}
+}
+
+func TestProbeSourceRepair(t *testing.T) {
+	// The source only probes as MPEG-TS, and the repaired file probes normally
+	fake := installCommands(t, map[string]fakeexec.Output{
+		"ffprobe /footage/raw.mp4": {Stdout: probeInvalidData, ExitCode: 1},
+		"ffprobe mpegts":           {Stdout: probeClip},
+		"ffprobe":                  {Stdout: probeClip},
+		"ffmpeg":                   {},
+	})
+
+	src := source{path: "/footage/raw.mp4", input: "/footage/raw.mp4"}
+
+	_, cleanup, err := probeSource(&src, config.Default())
+	if err != nil {
+		t.Fatalf("probeSource() error = %v", err)
+	}
+	defer cleanup()
+
+	if filepath.Ext(src.input) != ".mkv" {
+		t.Errorf("probeSource() input = %q, want a repaired Matroska file", src.input)
+	}
+
+	remuxes := remuxCalls(fake)
+	if len(remuxes) != 1 || !containsArgs(remuxes[0], "-f", "mpegts", "-i", "/footage/raw.mp4") {
+		t.Errorf("ffmpeg remuxes = %v, want the source read as the inferred mpegts", remuxes)
+	}
+}
+
+func TestProbeSourceRepairSkipped(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		cfg   func(*config.Config)
+	}{
+		{"no format inferred", "/footage/raw.mp4", func(*config.Config) {}},
+		{"dry run", "/footage/raw.mp4", func(cfg *config.Config) { cfg.DryRun = true }},
+		{"remote source", "https://example.com/raw.mp4", func(*config.Config) {}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := installCommands(t, map[string]fakeexec.Output{
+				"ffprobe": {Stdout: probeInvalidData, ExitCode: 1},
+				"ffmpeg":  {},
+			})
+
+			cfg := config.Default()
+			tt.cfg(&cfg)
+
+			src := source{path: tt.input, input: tt.input}
+
+			if _, _, err := probeSource(&src, cfg); !errors.Is(err, media.ErrInvalidData) {
+				t.Errorf("probeSource() error = %v, want %v", err, media.ErrInvalidData)
+			}
+
+			if remuxes := remuxCalls(fake); src.input != tt.input || len(remuxes) != 0 {
+				t.Errorf("probeSource() input = %q with remuxes %v, want the source left as is", src.input, remuxes)
+			}
+		})
+	}
+}
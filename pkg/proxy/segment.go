@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/ffmpeg"
+	"github.com/cyrilschreiber3/media-processor/pkg/fileutil"
+)
+
+// SegmentIndexPath returns the index of the segment set of a proxy, which marks the set as complete.
+func SegmentIndexPath(proxyDir string, name string) string {
+	return filepath.Join(proxyDir, name, ffmpeg.SegmentListName)
+}
+
+// createSegmentDirectory creates the directory holding the segments of a proxy,
+// removing the parts of a previous set so a shorter source leaves no extra parts behind.
+func createSegmentDirectory(indexPath string, mode os.FileMode) error {
+	segmentDir := filepath.Dir(indexPath)
+
+	if err := fileutil.CreateDir(segmentDir, mode, false); err != nil {
+		return fmt.Errorf("error creating segment directory: %w", err)
+	}
+
+	parts, err := filepath.Glob(filepath.Join(segmentDir, ffmpeg.SegmentGlob))
+	if err != nil {
+		return fmt.Errorf("error listing segments: %w", err)
+	}
+
+	for _, path := range parts {
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("error removing previous segment: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// removeProxy removes an unfinished proxy, or the whole directory of a segment set with its parts and partial index.
+func removeProxy(proxyFilePath string, segmented bool) {
+	if segmented {
+		_ = os.RemoveAll(filepath.Dir(proxyFilePath))
+
+		return
+	}
+
+	_ = os.Remove(proxyFilePath)
+}
+
+// finishSegments publishes the index of a completed segment set and sets the ownership of its files.
+// The index is only renamed into place once every segment is written, so an interrupted set is redone.
+func finishSegments(indexPath string, mode os.FileMode, group string) error {
+	partialPath := filepath.Join(filepath.Dir(indexPath), ffmpeg.PartialSegmentListName)
+	if err := os.Rename(partialPath, indexPath); err != nil {
+		return fmt.Errorf("error publishing segment index: %w", err)
+	}
+
+	parts, err := filepath.Glob(filepath.Join(filepath.Dir(indexPath), ffmpeg.SegmentGlob))
+	if err != nil {
+		return fmt.Errorf("error listing segments: %w", err)
+	}
+
+	if len(parts) == 0 {
+		return errors.New("no segments were written")
+	}
+
+	for _, path := range append(parts, indexPath) {
+		if err := fileutil.ApplyOwnership(path, mode, group); err != nil {
+			return fmt.Errorf("error setting segment ownership: %w", err)
+		}
+	}
+
+	return nil
+}
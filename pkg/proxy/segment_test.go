@@ -0,0 +1,163 @@
+package proxy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/config"
+	"github.com/cyrilschreiber3/media-processor/pkg/internal/fakeexec"
+	"github.com/cyrilschreiber3/media-processor/pkg/report"
+)
+
+func TestSegmentIndexPath(t *testing.T) {
+	if got := SegmentIndexPath("/footage/Proxy", "lecture"); got != "/footage/Proxy/lecture/index.csv" {
+		t.Errorf("SegmentIndexPath() = %q, want /footage/Proxy/lecture/index.csv", got)
+	}
+}
+
+func TestGenerateProxySegmentsSkip(t *testing.T) {
+	tests := []struct {
+		name       string
+		existing   []string
+		wantReason string
+	}{
+		{"complete segment set", []string{"part_000.mov", "part_001.mov", "index.csv"}, report.ReasonProxyExists},
+		{"interrupted segment set", []string{"part_000.mov", "index.csv.partial"}, report.ReasonDryRun},
+		{"single file proxy", []string{"../lecture.mov"}, report.ReasonDryRun},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installCommands(t, map[string]fakeexec.Output{"ffprobe": {Stdout: probeClip}, "ffmpeg": {}})
+
+			dir := t.TempDir()
+			source := filepath.Join(dir, "lecture.mov")
+			entry := writeFile(t, source, "source")
+
+			for _, name := range tt.existing {
+				writeFile(t, filepath.Join(dir, "Proxy", "lecture", name), "segment")
+			}
+
+			cfg := config.Default()
+			cfg.SegmentDuration = 10 * time.Minute
+			cfg.DryRun = true
+			cfg.Result = report.NewProcessResult(source)
+
+			changed, err := GenerateProxy(context.Background(), source, entry, cfg)
+			if changed || err != nil {
+				t.Fatalf("GenerateProxy() = %v, %v, want a skipped file", changed, err)
+			}
+
+			if want := filepath.Join(dir, "Proxy", "lecture", "index.csv"); cfg.Result.Output != want {
+				t.Errorf("GenerateProxy() output = %q, want %q", cfg.Result.Output, want)
+			}
+
+			if cfg.Result.Reason != tt.wantReason {
+				t.Errorf("GenerateProxy() reason = %q, want %q", cfg.Result.Reason, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestCreateSegmentDirectory(t *testing.T) {
+	indexPath := filepath.Join(t.TempDir(), "lecture", "index.csv")
+	segmentDir := filepath.Dir(indexPath)
+
+	for _, name := range []string{"part_000.mov", "part_001.mov", "notes.txt"} {
+		writeFile(t, filepath.Join(segmentDir, name), "previous")
+	}
+
+	if err := createSegmentDirectory(indexPath, 0o755); err != nil {
+		t.Fatalf("createSegmentDirectory() error = %v", err)
+	}
+
+	// The parts of the previous set are removed, other files are left alone
+	entries, err := os.ReadDir(segmentDir)
+	if err != nil {
+		t.Fatalf("error reading %s: %v", segmentDir, err)
+	}
+
+	if len(entries) != 1 || entries[0].Name() != "notes.txt" {
+		t.Errorf("segment directory = %v, want only notes.txt left", entries)
+	}
+}
+
+func TestFinishSegments(t *testing.T) {
+	indexPath := filepath.Join(t.TempDir(), "lecture", "index.csv")
+	segmentDir := filepath.Dir(indexPath)
+
+	writeFile(t, filepath.Join(segmentDir, "part_000.mov"), "segment")
+	writeFile(t, filepath.Join(segmentDir, "index.csv.partial"), "part_000.mov,0.000000,600.000000\n")
+
+	if err := finishSegments(indexPath, 0o640, ""); err != nil {
+		t.Fatalf("finishSegments() error = %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(segmentDir, "index.csv.partial")); !os.IsNotExist(err) {
+		t.Errorf("partial index error = %v, want it renamed", err)
+	}
+
+	for _, path := range []string{indexPath, filepath.Join(segmentDir, "part_000.mov")} {
+		if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o640 {
+			t.Errorf("%s = %v, %v, want a 0640 file", path, info, err)
+		}
+	}
+}
+
+func TestFinishSegmentsErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []string
+	}{
+		{"no partial index", []string{"part_000.mov"}},
+		{"no segments", []string{"index.csv.partial"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			indexPath := filepath.Join(t.TempDir(), "lecture", "index.csv")
+
+			for _, name := range tt.existing {
+				writeFile(t, filepath.Join(filepath.Dir(indexPath), name), "segment")
+			}
+
+			if err := finishSegments(indexPath, 0o640, ""); err == nil {
+				t.Error("finishSegments() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestRemoveProxy(t *testing.T) {
+	proxyDir := t.TempDir()
+
+	// An interrupted segment set is removed whole, so no stray parts are left next to the next attempt
+	indexPath := SegmentIndexPath(proxyDir, "lecture")
+	segmentDir := filepath.Dir(indexPath)
+
+	writeFile(t, filepath.Join(segmentDir, "part_000.mov"), "segment")
+	writeFile(t, filepath.Join(segmentDir, "part_001.mov"), "segment")
+	writeFile(t, filepath.Join(segmentDir, "index.csv.partial"), "part_000.mov,0.000000,600.000000\n")
+
+	removeProxy(indexPath, true)
+
+	if _, err := os.Stat(segmentDir); !os.IsNotExist(err) {
+		t.Errorf("segment directory error = %v, want it removed", err)
+	}
+
+	proxyFilePath := filepath.Join(proxyDir, "clip.mov")
+	writeFile(t, proxyFilePath, "proxy")
+
+	removeProxy(proxyFilePath, false)
+
+	if _, err := os.Stat(proxyFilePath); !os.IsNotExist(err) {
+		t.Errorf("proxy error = %v, want it removed", err)
+	}
+
+	if _, err := os.Stat(proxyDir); err != nil {
+		t.Errorf("proxy directory error = %v, want it kept", err)
+	}
+}
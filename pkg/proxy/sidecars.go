@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/config"
+	"github.com/cyrilschreiber3/media-processor/pkg/ffmpeg"
+	"github.com/cyrilschreiber3/media-processor/pkg/media"
+)
+
+// thumbnailPosition is the fraction of the duration the thumbnail is taken at, to avoid black intro frames.
+const thumbnailPosition = 0.1
+
+// SidecarPath returns the path of a sidecar artifact of a proxy.
+func SidecarPath(proxyFilePath string, kind string) string {
+	base := strings.TrimSuffix(proxyFilePath, filepath.Ext(proxyFilePath))
+
+	switch kind {
+	case config.SidecarThumbnail:
+		return base + ".jpg"
+	case config.SidecarSprite:
+		return base + "_sprite.jpg"
+	case config.SidecarWaveform:
+		return base + "_waveform.png"
+	default:
+		return base + ".json"
+	}
+}
+
+// GenerateSidecars creates the sidecar artifacts of a proxy that don't exist yet and returns how many were created.
+// Images are extracted from the proxy, the metadata sidecar holds the probe information of the source.
+func GenerateSidecars(proxyFilePath string, sourceInfo media.MediaInfo, kinds []string) (int, error) {
+	proxyInfo, err := media.GetMediaInfo(proxyFilePath)
+	if err != nil {
+		return 0, fmt.Errorf("error getting proxy media info: %w", err)
+	}
+
+	duration, err := proxyInfo.DurationSeconds()
+	if err != nil || duration <= 0 {
+		return 0, errors.New("proxy has no valid duration")
+	}
+
+	props := media.AnalyzeMediaInfo(proxyInfo)
+	created := 0
+
+	for _, kind := range kinds {
+		sidecarPath := SidecarPath(proxyFilePath, kind)
+		if _, err := os.Stat(sidecarPath); err == nil {
+			continue
+		}
+
+		var cmd []string
+
+		switch kind {
+		case config.SidecarThumbnail, config.SidecarSprite:
+			if !props.HasVideoStream {
+				continue
+			}
+
+			cmd = ffmpeg.CreateThumbnailCommand(proxyFilePath, sidecarPath, duration*thumbnailPosition)
+			if kind == config.SidecarSprite {
+				cmd = ffmpeg.CreateSpriteCommand(proxyFilePath, sidecarPath, duration)
+			}
+		case config.SidecarWaveform:
+			if !props.HasAudioStream {
+				continue
+			}
+
+			cmd = ffmpeg.CreateWaveformCommand(proxyFilePath, sidecarPath)
+		}
+
+		if len(cmd) > 0 {
+			err = runSidecarCommand(cmd)
+		} else {
+			err = writeMetadataSidecar(sidecarPath, sourceInfo)
+		}
+
+		if err != nil {
+			return created, fmt.Errorf("error generating %s sidecar: %w", kind, err)
+		}
+
+		slog.Info("Created sidecar", "kind", kind, "path", sidecarPath)
+		created++
+	}
+
+	return created, nil
+}
+
+// SubtitlePath returns the path of the SRT sidecar of the n-th text subtitle stream of a proxy, counting from 0.
+func SubtitlePath(proxyFilePath string, n int) string {
+	base := strings.TrimSuffix(proxyFilePath, filepath.Ext(proxyFilePath))
+	if n == 0 {
+		return base + ".srt"
+	}
+
+	return base + "_" + strconv.Itoa(n+1) + ".srt"
+}
+
+// ExtractSubtitles writes each text subtitle stream of the source to an SRT sidecar of the proxy
+// and returns their paths.
+func ExtractSubtitles(filePath string, proxyFilePath string, props media.Properties) ([]string, error) {
+	paths := make([]string, 0, len(props.TextSubtitleStreams))
+
+	for n, index := range props.TextSubtitleStreams {
+		srtPath := SubtitlePath(proxyFilePath, n)
+
+		if err := runSidecarCommand(ffmpeg.CreateSubtitleCommand(filePath, index, srtPath)); err != nil {
+			return paths, fmt.Errorf("error extracting subtitle stream %d: %w", index, err)
+		}
+
+		slog.Info("Created subtitle sidecar", "path", srtPath)
+		paths = append(paths, srtPath)
+	}
+
+	return paths, nil
+}
+
+func writeMetadataSidecar(sidecarPath string, sourceInfo media.MediaInfo) error {
+	data, err := json.MarshalIndent(sourceInfo, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling metadata sidecar: %w", err)
+	}
+
+	if err := os.WriteFile(sidecarPath, append(data, '\n'), 0o644); err != nil { //nolint:gosec
+		return fmt.Errorf("error writing metadata sidecar: %w", err)
+	}
+
+	return nil
+}
+
+func runSidecarCommand(cmd []string) error {
+	slog.Debug("Executing ffmpeg command", "command", ffmpeg.FormatCommand(cmd))
+	cmdExec := exec.Command(cmd[0], cmd[1:]...) //nolint:gosec
+	cmdExec.Stdout = os.Stdout
+
+	var tail ffmpeg.OutputTail
+
+	cmdExec.Stderr = io.MultiWriter(os.Stderr, &tail)
+
+	if err := cmdExec.Run(); err != nil {
+		return fmt.Errorf("error executing ffmpeg command: %w", ffmpeg.NewCommandError(err, tail.String()))
+	}
+
+	return nil
+}
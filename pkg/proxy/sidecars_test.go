@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/config"
+	"github.com/cyrilschreiber3/media-processor/pkg/internal/fakeexec"
+	"github.com/cyrilschreiber3/media-processor/pkg/report"
+)
+
+func TestSidecarPath(t *testing.T) {
+	tests := []struct {
+		kind string
+		want string
+	}{
+		{config.SidecarThumbnail, "/footage/Proxy/clip.jpg"},
+		{config.SidecarSprite, "/footage/Proxy/clip_sprite.jpg"},
+		{config.SidecarWaveform, "/footage/Proxy/clip_waveform.png"},
+		{config.SidecarMetadata, "/footage/Proxy/clip.json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.kind, func(t *testing.T) {
+			if got := SidecarPath("/footage/Proxy/clip.mov", tt.kind); got != tt.want {
+				t.Errorf("SidecarPath(%q) = %q, want %q", tt.kind, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateProxySidecarsOnly(t *testing.T) {
+	fake := installCommands(t, map[string]fakeexec.Output{"ffprobe": {Stdout: probeClip}, "ffmpeg": {}})
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "clip.mov")
+	proxyPath := filepath.Join(dir, "Proxy", "clip.mov")
+	thumbnailPath := filepath.Join(dir, "Proxy", "clip.jpg")
+
+	entry := writeFile(t, source, "source")
+	writeFile(t, proxyPath, "proxy")
+	writeFile(t, thumbnailPath, "thumbnail")
+
+	cfg := config.Default()
+	cfg.SidecarsOnly = true
+	cfg.Sidecars = []string{config.SidecarThumbnail, config.SidecarSprite, config.SidecarMetadata}
+	cfg.Result = report.NewProcessResult(source)
+
+	changed, err := GenerateProxy(context.Background(), source, entry, cfg)
+	if err != nil || !changed {
+		t.Fatalf("GenerateProxy() = %v, %v, want the missing sidecars created", changed, err)
+	}
+
+	for path, want := range map[string]string{proxyPath: "proxy", thumbnailPath: "thumbnail"} {
+		if data, err := os.ReadFile(path); err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v, want it untouched", path, data, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "Proxy", "clip.json")); err != nil {
+		t.Errorf("metadata sidecar error = %v, want it created", err)
+	}
+
+	var outputs []string
+
+	for _, call := range fake.Calls() {
+		if call[0] == "ffmpeg" && slices.Contains(call, "-i") {
+			outputs = append(outputs, call[len(call)-1])
+		}
+	}
+
+	// Only the missing sprite is extracted, and the proxy is never encoded again
+	if want := []string{filepath.Join(dir, "Proxy", "clip_sprite.jpg")}; !slices.Equal(outputs, want) {
+		t.Errorf("ffmpeg outputs = %v, want %v", outputs, want)
+	}
+}
+
+func TestGenerateProxySidecarsOnlyWithoutProxy(t *testing.T) {
+	fake := installCommands(t, map[string]fakeexec.Output{"ffprobe": {Stdout: probeClip}, "ffmpeg": {}})
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "clip.mov")
+	entry := writeFile(t, source, "source")
+
+	cfg := config.Default()
+	cfg.SidecarsOnly = true
+
+	if changed, err := GenerateProxy(context.Background(), source, entry, cfg); changed || err != nil {
+		t.Errorf("GenerateProxy() = %v, %v, want the source skipped", changed, err)
+	}
+
+	if calls := fake.Calls(); len(calls) != 0 {
+		t.Errorf("commands run = %v, want none", calls)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "Proxy", "clip.mov")); !os.IsNotExist(err) {
+		t.Errorf("proxy error = %v, want no proxy created", err)
+	}
+}
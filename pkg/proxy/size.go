@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/config"
+	"github.com/cyrilschreiber3/media-processor/pkg/media"
+)
+
+const (
+	// pcmBitrate is the bitrate of the 16-bit 48 kHz stereo PCM proxies get for PCM and unsupported audio.
+	pcmBitrate = 48000 * 16 * 2
+	// copiedAudioBitrate bounds the bitrate of compressed audio copied into proxies.
+	copiedAudioBitrate = 320_000
+)
+
+// EstimateProxySize returns a rough upper bound of the size in bytes of the proxy of a source, from its duration
+// in seconds, the maximum video bitrate in FFmpeg notation and the bitrate of its audio.
+// An empty or invalid maxRate is replaced by the default one.
+func EstimateProxySize(props media.Properties, durationSec float64, maxRate string) int64 {
+	var bitrate float64
+
+	if props.HasVideoStream {
+		videoBitrate, ok := parseBitrate(maxRate)
+		if !ok {
+			videoBitrate, _ = parseBitrate(config.DefaultMaxRate)
+		}
+
+		bitrate += videoBitrate
+	}
+
+	if props.HasAudioStream {
+		if props.UnsupportedAudioFormat || strings.HasPrefix(props.AudioCodec, "pcm_") {
+			bitrate += pcmBitrate
+		} else {
+			bitrate += copiedAudioBitrate
+		}
+	}
+
+	return int64(math.Ceil(bitrate * max(durationSec, 0) / 8))
+}
+
+// IsProxySized reports whether the video of a source is already at or below the resolution of its proxy
+// and its overall bitrate at or below the maximum one, so a proxy would be no lighter.
+// Sources of unknown dimensions or bitrate are never proxy-sized.
+func IsProxySized(props media.Properties, info media.MediaInfo, cfg config.Config) bool {
+	if !props.HasVideoStream || props.Width <= 0 || props.Height <= 0 {
+		return false
+	}
+
+	// Mirror the edge fitted by the scale filter
+	edge, limit := props.Width, cfg.ProxyWidth
+
+	switch {
+	case limit <= 0 && props.Orientation == media.OrientationVertical:
+		limit = 540
+	case limit <= 0:
+		limit = 960
+	case props.Orientation == media.OrientationVertical:
+		edge = props.Height
+	}
+
+	if edge > limit {
+		return false
+	}
+
+	bitrate, err := strconv.ParseFloat(info.Format.Bitrate, 64)
+	if err != nil || bitrate <= 0 {
+		return false
+	}
+
+	maxRate, ok := parseBitrate(cfg.MaxRate)
+	if !ok {
+		maxRate, _ = parseBitrate(config.DefaultMaxRate)
+	}
+
+	return bitrate <= maxRate
+}
+
+// parseBitrate parses a bitrate in FFmpeg notation, such as 7M or 800k, into bits per second.
+func parseBitrate(rate string) (float64, bool) {
+	multiplier := 1.0
+
+	switch {
+	case strings.HasSuffix(rate, "k"), strings.HasSuffix(rate, "K"):
+		multiplier = 1e3
+	case strings.HasSuffix(rate, "M"):
+		multiplier = 1e6
+	case strings.HasSuffix(rate, "G"):
+		multiplier = 1e9
+	}
+
+	if multiplier != 1 {
+		rate = rate[:len(rate)-1]
+	}
+
+	value, err := strconv.ParseFloat(rate, 64)
+	if err != nil || value <= 0 {
+		return 0, false
+	}
+
+	return value * multiplier, true
+}
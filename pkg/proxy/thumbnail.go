@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/ffmpeg"
+	"github.com/cyrilschreiber3/media-processor/pkg/media"
+)
+
+// GenerateThumbnail extracts a JPEG poster frame of a media file at atSeconds as <proxyDir>/<name>.jpg
+// and returns its path. A zero or negative position takes the frame at 10% of the duration.
+func GenerateThumbnail(filePath string, proxyDir string, atSeconds float64) (string, error) {
+	mediaInfo, err := media.GetMediaInfo(filePath)
+	if err != nil {
+		return "", fmt.Errorf("error getting media info: %w", err)
+	}
+
+	if !media.AnalyzeMediaInfo(mediaInfo).HasVideoStream {
+		return "", errors.New("no video stream found")
+	}
+
+	if atSeconds <= 0 {
+		duration, err := mediaInfo.DurationSeconds()
+		if err != nil {
+			return "", fmt.Errorf("error getting duration: %w", err)
+		}
+
+		atSeconds = duration * thumbnailPosition
+	}
+
+	fileName := filepath.Base(filePath)
+	thumbnailPath := filepath.Join(proxyDir, strings.TrimSuffix(fileName, filepath.Ext(fileName))+".jpg")
+
+	if err := runSidecarCommand(ffmpeg.CreateThumbnailCommand(filePath, thumbnailPath, atSeconds)); err != nil {
+		return "", fmt.Errorf("error generating thumbnail: %w", err)
+	}
+
+	return thumbnailPath, nil
+}
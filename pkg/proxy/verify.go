@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+
+	"github.com/cyrilschreiber3/media-processor/pkg/config"
+	"github.com/cyrilschreiber3/media-processor/pkg/ffmpeg"
+	"github.com/cyrilschreiber3/media-processor/pkg/media"
+)
+
+var (
+	// ErrFrameCountMismatch is returned when a proxy doesn't have as many frames as its source.
+	ErrFrameCountMismatch = errors.New("frame count mismatch")
+	// ErrInvalidProxy is returned when a proxy lacks a stream of its source or doesn't have its duration.
+	ErrInvalidProxy = errors.New("invalid proxy")
+)
+
+const (
+	// durationTolerance is the fraction of the expected duration a verified proxy may differ by.
+	durationTolerance = 0.02
+	// minDurationTolerance is the difference in seconds always accepted, absorbing the rounding of short proxies.
+	minDurationTolerance = 1.0
+)
+
+// CompareFrameCounts returns ErrFrameCountMismatch when the source and proxy frame counts differ.
+func CompareFrameCounts(sourceFrames int64, proxyFrames int64) error {
+	if sourceFrames != proxyFrames {
+		return fmt.Errorf("%w: source has %d frames, proxy has %d", ErrFrameCountMismatch, sourceFrames, proxyFrames)
+	}
+
+	return nil
+}
+
+// VerifyFrameCount checks that the proxy has the same number of frames as its source.
+// Frame counts come from the container metadata, or from counting frames when it is missing.
+func VerifyFrameCount(sourceInput string, sourceInfo media.MediaInfo, proxyFilePath string) error {
+	sourceFrames, err := frameCount(sourceInput, sourceInfo)
+	if err != nil {
+		return fmt.Errorf("error counting source frames: %w", err)
+	}
+
+	proxyInfo, err := media.GetMediaInfo(proxyFilePath)
+	if err != nil {
+		return fmt.Errorf("error getting proxy media info: %w", err)
+	}
+
+	proxyFrames, err := frameCount(proxyFilePath, proxyInfo)
+	if err != nil {
+		return fmt.Errorf("error counting proxy frames: %w", err)
+	}
+
+	slog.Info("Frame count", "proxy", proxyFilePath, "source_frames", sourceFrames, "proxy_frames", proxyFrames)
+
+	return CompareFrameCounts(sourceFrames, proxyFrames)
+}
+
+func frameCount(filePath string, info media.MediaInfo) (int64, error) {
+	if frames, ok := media.VideoFrameCount(info); ok {
+		return frames, nil
+	}
+
+	return media.CountFrames(filePath)
+}
+
+// VerifyProxy checks that the proxy has the video and audio streams expected from the source properties,
+// and a non-zero duration close to expectedDuration. Sources of unknown duration only need a non-zero one.
+func VerifyProxy(proxyFilePath string, props media.Properties, expectedDuration float64, cfg config.Config) error {
+	proxyInfo, err := media.GetMediaInfo(proxyFilePath)
+	if err != nil {
+		return fmt.Errorf("error getting proxy media info: %w", err)
+	}
+
+	proxyProps := media.AnalyzeMediaInfo(proxyInfo)
+
+	if props.HasVideoStream && !ffmpeg.IsAudioOnlyProxy(props, cfg) && !proxyProps.HasVideoStream {
+		return fmt.Errorf("%w: no video stream", ErrInvalidProxy)
+	}
+
+	if props.HasAudioStream && cfg.AudioPolicy != config.AudioPolicyDrop && !proxyProps.HasAudioStream {
+		return fmt.Errorf("%w: no audio stream", ErrInvalidProxy)
+	}
+
+	proxyDuration, err := proxyInfo.DurationSeconds()
+	if err != nil || proxyDuration <= 0 {
+		return fmt.Errorf("%w: no duration", ErrInvalidProxy)
+	}
+
+	if expectedDuration > 0 &&
+		math.Abs(proxyDuration-expectedDuration) > max(expectedDuration*durationTolerance, minDurationTolerance) {
+		return fmt.Errorf("%w: proxy lasts %.1fs, source %.1fs", ErrInvalidProxy, proxyDuration, expectedDuration)
+	}
+
+	return nil
+}
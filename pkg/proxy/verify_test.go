@@ -0,0 +1,28 @@
+package proxy
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCompareFrameCounts(t *testing.T) {
+	tests := []struct {
+		name         string
+		sourceFrames int64
+		proxyFrames  int64
+		wantErr      error
+	}{
+		{"equal counts", 1500, 1500, nil},
+		{"missing frames", 1500, 1450, ErrFrameCountMismatch},
+		{"extra frames", 1500, 1501, ErrFrameCountMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CompareFrameCounts(tt.sourceFrames, tt.proxyFrames)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("CompareFrameCounts(%d, %d) error = %v, want %v", tt.sourceFrames, tt.proxyFrames, err, tt.wantErr)
+			}
+		})
+	}
+}
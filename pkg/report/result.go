@@ -0,0 +1,150 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Statuses of a processed file.
+const (
+	StatusCreated = "created"
+	StatusSkipped = "skipped"
+	StatusFailed  = "failed"
+)
+
+// Reasons of a skipped file.
+const (
+	ReasonProxyExists   = "already exists"
+	ReasonProxyUpToDate = "up to date"
+	ReasonProxySized    = "already proxy-sized"
+	ReasonNotMedia      = "not a media file"
+	ReasonDryRun        = "dry run"
+	ReasonCached        = "unchanged since last run"
+)
+
+// WarningSourceAudioUnsupported notes a source whose unsupported audio was left as is, as asked,
+// so only its proxy can be edited with the audio.
+const WarningSourceAudioUnsupported = "source left unmodified, its audio is still unsupported by NLEs"
+
+// ProcessResult is the machine-readable outcome of the processing of a file.
+// A nil ProcessResult records nothing, and it is safe for concurrent use.
+type ProcessResult struct {
+	mu sync.Mutex
+
+	Input           string  `json:"input"`
+	Output          string  `json:"output,omitempty"`
+	Status          string  `json:"status"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Error           string  `json:"error,omitempty"`
+	Reason          string  `json:"reason,omitempty"`
+	Warning         string  `json:"warning,omitempty"`
+	// Verified reports that the written proxy passed a verification, such as a decode or frame count check.
+	Verified bool `json:"verified,omitempty"`
+}
+
+// NewProcessResult returns the result of a file about to be processed.
+func NewProcessResult(input string) *ProcessResult {
+	return &ProcessResult{Input: input}
+}
+
+// SetOutput records the proxy written for the file.
+func (r *ProcessResult) SetOutput(output string) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Output = output
+}
+
+// SetSkipReason records why the file is skipped without generating a proxy.
+func (r *ProcessResult) SetSkipReason(reason string) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Reason = reason
+}
+
+// SetWarning records a caveat of a successfully processed file.
+func (r *ProcessResult) SetWarning(warning string) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Warning = warning
+}
+
+// SetVerified records that the written proxy passed a verification.
+func (r *ProcessResult) SetVerified() {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Verified = true
+}
+
+// IsVerified reports whether the written proxy passed a verification. A nil ProcessResult is never verified.
+func (r *ProcessResult) IsVerified() bool {
+	if r == nil {
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.Verified
+}
+
+// Finish records the outcome of the processing, started at start.
+func (r *ProcessResult) Finish(changed bool, err error, start time.Time) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.DurationSeconds = time.Since(start).Seconds()
+
+	switch {
+	case err != nil:
+		r.Status = StatusFailed
+		r.Error = err.Error()
+	case changed:
+		r.Status = StatusCreated
+	default:
+		r.Status = StatusSkipped
+	}
+}
+
+// Write writes the result as a single line of JSON.
+func (r *ProcessResult) Write(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("error marshalling result: %w", err)
+	}
+
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("error writing result: %w", err)
+	}
+
+	return nil
+}
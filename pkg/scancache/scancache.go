@@ -0,0 +1,92 @@
+package scancache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Entry is the state of a directory at the end of its last complete scan.
+type Entry struct {
+	ModTime time.Time `json:"mod_time"`
+	Files   []string  `json:"files"`
+}
+
+// Cache remembers fully processed directories so unchanged ones can be skipped.
+// It is safe for concurrent use.
+type Cache struct {
+	mu   sync.Mutex
+	path string
+	dirs map[string]Entry
+}
+
+// Load reads the scan cache at the given path. A missing file yields an empty cache.
+func Load(path string) (*Cache, error) {
+	cache := &Cache{path: path, dirs: make(map[string]Entry)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cache, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading scan cache: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &cache.dirs); err != nil {
+		return nil, fmt.Errorf("error unmarshalling scan cache: %w", err)
+	}
+
+	return cache, nil
+}
+
+// IsUnchanged reports whether the directory was fully processed and not modified since.
+func (c *Cache) IsUnchanged(dir string, modTime time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.dirs[dir]
+
+	return ok && entry.ModTime.Equal(modTime)
+}
+
+// Update records a fully processed directory.
+func (c *Cache) Update(dir string, modTime time.Time, files []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.dirs[dir] = Entry{ModTime: modTime, Files: files}
+}
+
+// Invalidate forgets a directory so it is scanned again on the next run.
+func (c *Cache) Invalidate(dir string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.dirs, dir)
+}
+
+// Save writes the scan cache to disk.
+func (c *Cache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, err := json.MarshalIndent(c.dirs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling scan cache: %w", err)
+	}
+
+	tmpPath := c.path + ".tmp"
+	if err := os.WriteFile(tmpPath, append(data, '\n'), 0o644); err != nil { //nolint:gosec
+		return fmt.Errorf("error writing scan cache: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, c.path); err != nil {
+		return fmt.Errorf("error replacing scan cache: %w", err)
+	}
+
+	return nil
+}
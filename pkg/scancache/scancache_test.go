@@ -0,0 +1,95 @@
+package scancache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheIsUnchanged(t *testing.T) {
+	modTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		dir     string
+		modTime time.Time
+		want    bool
+	}{
+		{"hit", "/footage/day1", modTime, true},
+		{"same time in another zone", "/footage/day1", modTime.In(time.FixedZone("CET", 3600)), true},
+		{"directory modified", "/footage/day1", modTime.Add(time.Second), false},
+		{"unknown directory", "/footage/day2", modTime, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache, err := Load(filepath.Join(t.TempDir(), "scan-cache.json"))
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+
+			cache.Update("/footage/day1", modTime, []string{"clip.mov"})
+
+			if got := cache.IsUnchanged(tt.dir, tt.modTime); got != tt.want {
+				t.Errorf("Cache.IsUnchanged(%q, %v) = %v, want %v", tt.dir, tt.modTime, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheInvalidate(t *testing.T) {
+	modTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	cache, err := Load(filepath.Join(t.TempDir(), "scan-cache.json"))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	cache.Update("/footage/day1", modTime, nil)
+	cache.Invalidate("/footage/day1")
+
+	if cache.IsUnchanged("/footage/day1", modTime) {
+		t.Error("Cache.IsUnchanged() = true after Invalidate(), want false")
+	}
+}
+
+func TestCacheSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scan-cache.json")
+	modTime := time.Date(2024, 3, 1, 12, 0, 0, 123, time.UTC)
+
+	cache, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	cache.Update("/footage/day1", modTime, []string{"clip.mov"})
+
+	if err := cache.Save(); err != nil {
+		t.Fatalf("Cache.Save() error = %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if !loaded.IsUnchanged("/footage/day1", modTime) {
+		t.Error("Cache.IsUnchanged() = false after reloading, want true")
+	}
+
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file error = %v, want it renamed over the cache", err)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scan-cache.json")
+	if err := os.WriteFile(path, []byte("["), 0o600); err != nil {
+		t.Fatalf("error writing scan cache: %v", err)
+	}
+
+	if _, err := Load(path); err == nil {
+		t.Error("Load() error = nil, want the unmarshalling error")
+	}
+}
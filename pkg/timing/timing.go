@@ -0,0 +1,80 @@
+package timing
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stage is a step of the processing of a file.
+type Stage string
+
+// Stages of the processing of a file, in pipeline order.
+const (
+	Probe   Stage = "probe"
+	Analyze Stage = "analyze"
+	Encode  Stage = "encode"
+	Verify  Stage = "verify"
+)
+
+// Stages lists the stages in pipeline order.
+var Stages = []Stage{Probe, Analyze, Encode, Verify}
+
+// Breakdown accumulates the time spent in each stage of the processing of a file.
+// A nil Breakdown records nothing, and it is safe for concurrent use.
+type Breakdown struct {
+	mu     sync.Mutex
+	stages map[Stage]time.Duration
+}
+
+// NewBreakdown returns an empty breakdown.
+func NewBreakdown() *Breakdown {
+	return &Breakdown{stages: make(map[Stage]time.Duration)}
+}
+
+// Since adds the time elapsed since start to a stage.
+func (b *Breakdown) Since(stage Stage, start time.Time) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.stages[stage] += time.Since(start)
+}
+
+// Get returns the time spent in a stage.
+func (b *Breakdown) Get(stage Stage) time.Duration {
+	if b == nil {
+		return 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.stages[stage]
+}
+
+// Seconds returns the time spent in every stage in seconds, keyed by stage name.
+func (b *Breakdown) Seconds() map[string]float64 {
+	seconds := make(map[string]float64, len(Stages))
+
+	for _, stage := range Stages {
+		seconds[string(stage)] = b.Get(stage).Seconds()
+	}
+
+	return seconds
+}
+
+// String formats the breakdown for logging, e.g. "probe 0.2s, analyze 1.3s, encode 40s, verify 0s".
+func (b *Breakdown) String() string {
+	parts := make([]string, len(Stages))
+
+	for i, stage := range Stages {
+		parts[i] = fmt.Sprintf("%s %s", stage, b.Get(stage).Round(time.Millisecond))
+	}
+
+	return strings.Join(parts, ", ")
+}
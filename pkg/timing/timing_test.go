@@ -0,0 +1,61 @@
+package timing
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBreakdown(t *testing.T) {
+	breakdown := NewBreakdown()
+
+	var previous time.Duration
+
+	// The time of a stage only grows as more of it is recorded
+	for range 3 {
+		start := time.Now()
+
+		time.Sleep(time.Millisecond)
+		breakdown.Since(Encode, start)
+
+		got := breakdown.Get(Encode)
+		if got < previous+time.Millisecond {
+			t.Errorf("Breakdown.Get(Encode) = %v, want at least %v", got, previous+time.Millisecond)
+		}
+
+		previous = got
+	}
+
+	if got := breakdown.Get(Probe); got != 0 {
+		t.Errorf("Breakdown.Get(Probe) = %v, want 0 for an unrecorded stage", got)
+	}
+
+	seconds := breakdown.Seconds()
+	if len(seconds) != len(Stages) || seconds["encode"] != previous.Seconds() || seconds["verify"] != 0 {
+		t.Errorf("Breakdown.Seconds() = %v, want every stage with the encode time", seconds)
+	}
+}
+
+func TestBreakdownNil(t *testing.T) {
+	var breakdown *Breakdown
+
+	breakdown.Since(Probe, time.Now().Add(-time.Second))
+
+	if got := breakdown.Get(Probe); got != 0 {
+		t.Errorf("Breakdown.Get() = %v on a nil breakdown, want 0", got)
+	}
+
+	if got := breakdown.String(); got != "probe 0s, analyze 0s, encode 0s, verify 0s" {
+		t.Errorf("Breakdown.String() = %q on a nil breakdown, want every stage at 0s", got)
+	}
+}
+
+func TestBreakdownString(t *testing.T) {
+	breakdown := NewBreakdown()
+	breakdown.Since(Probe, time.Now().Add(-200*time.Millisecond))
+
+	got := breakdown.String()
+	if !strings.HasPrefix(got, "probe 20") || !strings.HasSuffix(got, "ms, analyze 0s, encode 0s, verify 0s") {
+		t.Errorf("Breakdown.String() = %q, want the stages in pipeline order", got)
+	}
+}